@@ -0,0 +1,64 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"ethereum/keyservice/common/hexutil"
+	"ethereum/keyservice/crypto"
+	"ethereum/keyservice/services/truekey/types"
+	"fmt"
+	"gopkg.in/urfave/cli.v1"
+	"strings"
+	"time"
+)
+
+// adminCall authorises method with the loaded admin key plus the signatures
+// other admins produced with --signonly, then calls it. Calls that need a
+// quorum are prepared by one admin, who shares --createdat and --nonce with the
+// others.
+func adminCall(ctx *cli.Context, result interface{}, method string, params ...interface{}) error {
+	if priKey == nil {
+		loadPrivate(ctx)
+	}
+	quest := parseAdminQuestParam(ctx)
+
+	createdAt := ctx.GlobalUint64(CreatedAtFlag.Name)
+	if createdAt == 0 {
+		createdAt = uint64(time.Now().Unix())
+	}
+	nonce := ctx.GlobalUint64(NonceFlag.Name)
+	if nonce == 0 {
+		var b [8]byte
+		if _, err := rand.Read(b[:]); err != nil {
+			return err
+		}
+		nonce = binary.BigEndian.Uint64(b[:])
+	}
+	hash := types.AdminCallHash(method, quest.Root, createdAt, nonce, params...)
+	sig, err := crypto.Sign(hash.Bytes(), priKey)
+	if err != nil {
+		return err
+	}
+	if ctx.GlobalBool(SignOnlyFlag.Name) {
+		fmt.Println("Admin ", from.Hex(), " createdat ", createdAt, " nonce ", nonce, " signature ", hexutil.Encode(sig))
+		return nil
+	}
+	auth := types.AdminAuth{
+		Root:       quest.Root,
+		CreatedAt:  hexutil.Uint64(createdAt),
+		Nonce:      hexutil.Uint64(nonce),
+		Signatures: []hexutil.Bytes{sig},
+	}
+	if sigs := ctx.GlobalString(SignaturesFlag.Name); sigs != "" {
+		for _, s := range strings.Split(sigs, ",") {
+			other, err := hexutil.Decode(strings.TrimSpace(s))
+			if err != nil {
+				return fmt.Errorf("invalid signature %q: %v", s, err)
+			}
+			auth.Signatures = append(auth.Signatures, other)
+		}
+	}
+	conn, url := dialConn(ctx)
+	printBaseInfo(conn, quest, url)
+	return conn.Call(result, method, append([]interface{}{auth}, params...)...)
+}
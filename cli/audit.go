@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"ethereum/keyservice/services/truekey/audit"
+	"ethereum/keyservice/services/truekey/types"
+	"ethereum/keyservice/services/utils"
+	"fmt"
+	"gopkg.in/urfave/cli.v1"
+	"os"
+)
+
+var AuditSearchCommand = cli.Command{
+	Name:   "auditsearch",
+	Usage:  "Search the audit log for records of a root, needs the key of an auditor",
+	Action: utils.MigrateFlags(auditSearch),
+	Flags:  append(append(AdminFlags, AuditQueryFlags...), AddressFlag, FormatFlag, OutFlag),
+	Description: `
+Auditors are configured per root in the config of the service. The search covers the
+records of --root only, matching every query flag given. --userid takes the id as the
+dapp sends it. jsonl exports the records as written, csv a table of the common fields.`,
+}
+
+func auditSearch(ctx *cli.Context) error {
+	out := ctx.GlobalString(OutFlag.Name)
+	if out == "" {
+		printError("Must specify --out")
+	}
+	var query audit.Query
+	for _, field := range audit.QueryFields {
+		// The root searched is the root of the call
+		if field != "root" && ctx.GlobalIsSet(field) {
+			if err := query.Set(field, ctx.GlobalString(field)); err != nil {
+				printError(err)
+			}
+		}
+	}
+	var res *types.AuditSearchResult
+	if err := adminCall(ctx, &res, "admin_auditSearch", query); err != nil {
+		fmt.Println("admin_auditSearch Error", err.Error())
+		return nil
+	}
+	if res == nil {
+		return nil
+	}
+	f, err := os.OpenFile(out, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		printError("Create export file error", err)
+	}
+	defer f.Close()
+	exporter, err := audit.NewExporter(f, ctx.GlobalString(FormatFlag.Name))
+	if err != nil {
+		printError(err)
+	}
+	for _, raw := range res.Records {
+		var rec audit.Record
+		if err := json.Unmarshal(raw, &rec); err != nil {
+			printError("Parse audit record error", err)
+		}
+		if err := exporter.Write(&rec, raw); err != nil {
+			printError("Write export file error", err)
+		}
+	}
+	if err := exporter.Flush(); err != nil {
+		printError("Write export file error", err)
+	}
+	fmt.Println("truekey auditsearch Success, records", len(res.Records), "written to", out)
+	if res.More {
+		fmt.Println("More records match, narrow the search or raise --limit")
+	}
+	return nil
+}
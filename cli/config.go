@@ -0,0 +1,30 @@
+package main
+
+import (
+	"ethereum/keyservice/services/utils"
+	"fmt"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var ReloadConfigCommand = cli.Command{
+	Name:   "reloadconfig",
+	Usage:  "Make the service re-read its config file, like SIGHUP does",
+	Action: utils.MigrateFlags(reloadConfig),
+	Flags:  AdminFlags,
+	Description: `
+An invalid config is rejected and the active config kept. The changes are printed and
+recorded in the audit log.`,
+}
+
+func reloadConfig(ctx *cli.Context) error {
+	var diff []string
+	if err := adminCall(ctx, &diff, "admin_reloadConfig"); err != nil {
+		fmt.Println("admin_reloadConfig Error", err.Error())
+		return nil
+	}
+	for _, change := range diff {
+		fmt.Println(" ", change)
+	}
+	fmt.Println("truekey reloadconfig Success, changes", len(diff))
+	return nil
+}
@@ -171,7 +171,7 @@ func getAllFile(path string) (string, error) {
 }
 
 func printError(error ...interface{}) {
-	log.Fatal(error)
+	log.Fatal(error...)
 }
 
 func loadPrivate(ctx *cli.Context) {
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"ethereum/keyservice/services/truekey/types"
+	"ethereum/keyservice/services/utils"
+	"fmt"
+	"gopkg.in/urfave/cli.v1"
+	"io/ioutil"
+	"strconv"
+)
+
+const dappSettingsDescription = `
+The settings file configures the dapp, e.g.
+{"name": "wallet", "key": "0x..", "admins": ["0x.."], "allowlist": ["10.0.0.0/8"],
+ "policy": "escalate", "limits": {"day": {"count": 1000}}, "path": "m/44'/60'/{account}'/0/{index}"}
+Only name and key are required. The dapp signs its calls with key.`
+
+var AddDappCommand = cli.Command{
+	Name:        "adddapp",
+	Usage:       "Add a dapp to a root under an account of its own, needs a quorum of admins",
+	Action:      utils.MigrateFlags(addDapp),
+	Flags:       append(AdminFlags, SettingsFlag),
+	Description: dappSettingsDescription,
+}
+
+var SetDappCommand = cli.Command{
+	Name:        "setdapp",
+	Usage:       "Replace the settings of a dapp, needs a quorum of admins",
+	Action:      utils.MigrateFlags(setDapp),
+	Flags:       append(AdminFlags, DappIndexFlag, SettingsFlag),
+	Description: dappSettingsDescription,
+}
+
+var DappsCommand = cli.Command{
+	Name:   "dapps",
+	Usage:  "List the dapps of a root",
+	Action: utils.MigrateFlags(dapps),
+	Flags:  AdminFlags,
+}
+
+var XPubCommand = cli.Command{
+	Name:   "xpub",
+	Usage:  "Export the extended public key of the branch of a dapp or any other account",
+	Action: utils.MigrateFlags(xpub),
+	Flags:  append(AdminFlags, DappIndexFlag),
+	Description: `
+Prints the BIP-32 extended public key of the account given with --dapp, e.g. 2000000, and the
+template of the paths of its users below the key, e.g. 0/{index}. The address of the user
+with index i derives from the key without the private keys, see hdwallet.DeriveAddress.`,
+}
+
+func readDappSettings(ctx *cli.Context) types.DappSettings {
+	file := ctx.GlobalString(SettingsFlag.Name)
+	if file == "" {
+		printError("Must specify --settings")
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		printError("Read settings file error", err)
+	}
+	var settings types.DappSettings
+	if err := json.Unmarshal(data, &settings); err != nil {
+		printError("Parse settings file error", err)
+	}
+	if err := settings.Check(); err != nil {
+		printError("Invalid settings", err)
+	}
+	return settings
+}
+
+func printResult(method string, result interface{}) {
+	out, _ := json.MarshalIndent(result, "", "  ")
+	fmt.Printf("truekey %s Success\n %s\n", method, out)
+}
+
+func addDapp(ctx *cli.Context) error {
+	var dapp *types.Dapp
+	if err := adminCall(ctx, &dapp, "admin_addDapp", readDappSettings(ctx)); err != nil {
+		fmt.Println("admin_addDapp Error", err.Error())
+		return nil
+	}
+	if dapp != nil {
+		printResult("addDapp", dapp)
+	}
+	return nil
+}
+
+func setDapp(ctx *cli.Context) error {
+	account, err := strconv.ParseUint(ctx.GlobalString(DappIndexFlag.Name), 10, 32)
+	if err != nil {
+		printError("Must input correct dapp index", err)
+	}
+	var dapp *types.Dapp
+	if err := adminCall(ctx, &dapp, "admin_updateDapp", uint32(account), readDappSettings(ctx)); err != nil {
+		fmt.Println("admin_updateDapp Error", err.Error())
+		return nil
+	}
+	if dapp != nil {
+		printResult("updateDapp", dapp)
+	}
+	return nil
+}
+
+func dapps(ctx *cli.Context) error {
+	var dapps []*types.Dapp
+	if err := adminCall(ctx, &dapps, "admin_dapps"); err != nil {
+		fmt.Println("admin_dapps Error", err.Error())
+		return nil
+	}
+	printResult("dapps", dapps)
+	return nil
+}
+
+func xpub(ctx *cli.Context) error {
+	account, err := strconv.ParseUint(ctx.GlobalString(DappIndexFlag.Name), 10, 32)
+	if err != nil {
+		printError("Must input correct dapp index", err)
+	}
+	var key *types.ExtendedPublicKey
+	if err := adminCall(ctx, &key, "admin_extendedPublicKey", uint32(account)); err != nil {
+		fmt.Println("admin_extendedPublicKey Error", err.Error())
+		return nil
+	}
+	if key != nil {
+		printResult("extendedPublicKey", key)
+	}
+	return nil
+}
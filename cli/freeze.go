@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"ethereum/keyservice/services/truekey/types"
+	"ethereum/keyservice/services/utils"
+	"fmt"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var FreezeCommand = cli.Command{
+	Name:   "freeze",
+	Usage:  "Stop all signing of a root, or of every root with --global",
+	Action: utils.MigrateFlags(freeze),
+	Flags:  append(AdminFlags, GlobalFlag, ReasonFlag),
+}
+
+var UnfreezeCommand = cli.Command{
+	Name:   "unfreeze",
+	Usage:  "Resume signing stopped by freeze, needs a quorum of admins",
+	Action: utils.MigrateFlags(unfreeze),
+	Flags:  append(AdminFlags, GlobalFlag, ReasonFlag),
+}
+
+var FreezeStatusCommand = cli.Command{
+	Name:   "frozen",
+	Usage:  "Show whether signing of a root is frozen",
+	Action: utils.MigrateFlags(freezeStatus),
+	Flags:  AdminFlags,
+}
+
+func freeze(ctx *cli.Context) error {
+	reason := ctx.GlobalString(ReasonFlag.Name)
+	if reason == "" {
+		printError("Must specify --reason")
+	}
+	if err := adminCall(ctx, nil, "admin_freeze", ctx.GlobalBool(GlobalFlag.Name), reason); err != nil {
+		fmt.Println("admin_freeze Error", err.Error())
+		return nil
+	}
+	fmt.Println("truekey freeze Success")
+	return nil
+}
+
+func unfreeze(ctx *cli.Context) error {
+	reason := ctx.GlobalString(ReasonFlag.Name)
+	if reason == "" {
+		printError("Must specify --reason")
+	}
+	if err := adminCall(ctx, nil, "admin_unfreeze", ctx.GlobalBool(GlobalFlag.Name), reason); err != nil {
+		fmt.Println("admin_unfreeze Error", err.Error())
+		return nil
+	}
+	fmt.Println("truekey unfreeze Success")
+	return nil
+}
+
+func freezeStatus(ctx *cli.Context) error {
+	var status *types.FreezeStatus
+	if err := adminCall(ctx, &status, "admin_freezeStatus"); err != nil {
+		fmt.Println("admin_freezeStatus Error", err.Error())
+		return nil
+	}
+	if status == nil {
+		return nil
+	}
+	out, _ := json.MarshalIndent(status, "", "  ")
+	fmt.Println("truekey frozen Success\n", string(out))
+	return nil
+}
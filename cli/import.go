@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"ethereum/keyservice/services/truekey/types"
+	"ethereum/keyservice/services/utils"
+	"fmt"
+	"gopkg.in/urfave/cli.v1"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var ImportIDsCommand = cli.Command{
+	Name:      "importids",
+	Usage:     "Register the user ids of a file in bulk",
+	Action:    utils.MigrateFlags(importIDs),
+	ArgsUsage: "<idsfile>",
+	Flags:     append(AdminFlags, DappIndexFlag, OutFlag),
+	Description: `
+Registers the user ids of a file, one per line, with the running service, of the dapp
+given with --dapp if set. The ids are sent in calls of 10000, each committed in a single
+write, and the userId, address and path of every user written to --out as CSV,
+<idsfile>.csv by default. Users registered before keep their accounts, so an interrupted
+import is resumed by running it again with the same file.`,
+}
+
+func importIDs(ctx *cli.Context) error {
+	if ctx.NArg() != 1 {
+		printError("Must specify the file of user ids")
+	}
+	idsFile := ctx.Args().First()
+	var dapp *uint32
+	if ctx.GlobalIsSet(DappIndexFlag.Name) {
+		account, err := strconv.ParseUint(ctx.GlobalString(DappIndexFlag.Name), 10, 32)
+		if err != nil {
+			printError("Must input correct dapp index", err)
+		}
+		dapp = new(uint32)
+		*dapp = uint32(account)
+	}
+	in, err := os.Open(idsFile)
+	if err != nil {
+		printError("Read user ids file error", err)
+	}
+	defer in.Close()
+	outFile := ctx.GlobalString(OutFlag.Name)
+	if outFile == "" {
+		outFile = idsFile + ".csv"
+	}
+	out, err := os.Create(outFile)
+	if err != nil {
+		printError("Create out file error", err)
+	}
+	defer out.Close()
+	w := csv.NewWriter(out)
+	w.Write([]string{"userId", "address", "path"})
+
+	var (
+		scanner       = bufio.NewScanner(in)
+		batch         = make([]types.UserID, 0, types.MaxImportUsers)
+		users, newIDs int
+	)
+	flush := func() bool {
+		if len(batch) == 0 {
+			return true
+		}
+		var accounts []*types.ImportedAccount
+		if err := adminCall(ctx, &accounts, "admin_importUserIds", batch, dapp); err != nil {
+			fmt.Println("admin_importUserIds Error", err.Error(), "after", users, "users")
+			return false
+		}
+		for _, account := range accounts {
+			w.Write([]string{string(account.UserID), account.Address.Hex(), account.Path})
+			if account.New {
+				newIDs++
+			}
+		}
+		w.Flush()
+		users += len(batch)
+		fmt.Println("Imported", users, "users,", newIDs, "new")
+		batch = batch[:0]
+		return true
+	}
+	for scanner.Scan() {
+		if id := strings.TrimSpace(scanner.Text()); id != "" {
+			batch = append(batch, types.UserID(id))
+		}
+		if len(batch) == types.MaxImportUsers && !flush() {
+			return nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		printError("Read user ids file error", err)
+	}
+	if !flush() {
+		return nil
+	}
+	if err := w.Error(); err != nil {
+		printError("Write out file error", err)
+	}
+	fmt.Println("truekey importUserIds Success", outFile)
+	return nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"ethereum/keyservice/common"
+	"ethereum/keyservice/services/truekey/types"
+	"ethereum/keyservice/services/utils"
+	"fmt"
+	"gopkg.in/urfave/cli.v1"
+	"io/ioutil"
+	"strconv"
+)
+
+var SetLimitsCommand = cli.Command{
+	Name:   "setlimits",
+	Usage:  "Set the spending limits of a root, needs a quorum of admins",
+	Action: utils.MigrateFlags(setLimits),
+	Flags:  append(AdminFlags, LimitsFlag),
+	Description: `
+The limits file holds the account and dapp limits, e.g.
+{"account": {"day": {"value": 1000000000000000000, "count": 10}}, "dapp": {"month": {"count": 1000}}}`,
+}
+
+var UsageCommand = cli.Command{
+	Name:   "usage",
+	Usage:  "Show the spending of an account or a dapp",
+	Action: utils.MigrateFlags(usage),
+	Flags:  append(AdminFlags, AddressFlag, DappIndexFlag),
+}
+
+var ResetUsageCommand = cli.Command{
+	Name:   "resetusage",
+	Usage:  "Reset the spending of an account or a dapp, needs a quorum of admins",
+	Action: utils.MigrateFlags(resetUsage),
+	Flags:  append(AdminFlags, AddressFlag, DappIndexFlag),
+}
+
+func setLimits(ctx *cli.Context) error {
+	file := ctx.GlobalString(LimitsFlag.Name)
+	if file == "" {
+		printError("Must specify --limits")
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		printError("Read limits file error", err)
+	}
+	var limits types.LimitConfig
+	if err := json.Unmarshal(data, &limits); err != nil {
+		printError("Parse limits file error", err)
+	}
+	if err := adminCall(ctx, nil, "admin_setLimits", limits); err != nil {
+		fmt.Println("admin_setLimits Error", err.Error())
+		return nil
+	}
+	fmt.Println("truekey setLimits Success")
+	return nil
+}
+
+func parseUsageScope(ctx *cli.Context) types.UsageScope {
+	var scope types.UsageScope
+	if ctx.GlobalIsSet(AddressFlag.Name) {
+		address := ctx.GlobalString(AddressFlag.Name)
+		if !common.IsHexAddress(address) {
+			printError("Must input correct address")
+		}
+		account := common.HexToAddress(address)
+		scope.Account = &account
+	}
+	if ctx.GlobalIsSet(DappIndexFlag.Name) {
+		dapp, err := strconv.ParseUint(ctx.GlobalString(DappIndexFlag.Name), 10, 32)
+		if err != nil {
+			printError("Must input correct dapp index", err)
+		}
+		scope.Dapp = &dapp
+	}
+	if err := scope.Validate(); err != nil {
+		printError(err)
+	}
+	return scope
+}
+
+func usage(ctx *cli.Context) error {
+	var report *types.UsageReport
+	if err := adminCall(ctx, &report, "admin_usage", parseUsageScope(ctx)); err != nil {
+		fmt.Println("admin_usage Error", err.Error())
+		return nil
+	}
+	if report == nil {
+		return nil
+	}
+	out, _ := json.MarshalIndent(report, "", "  ")
+	fmt.Println("truekey usage Success\n", string(out))
+	return nil
+}
+
+func resetUsage(ctx *cli.Context) error {
+	if err := adminCall(ctx, nil, "admin_resetUsage", parseUsageScope(ctx)); err != nil {
+		fmt.Println("admin_resetUsage Error", err.Error())
+		return nil
+	}
+	fmt.Println("truekey resetUsage Success")
+	return nil
+}
+
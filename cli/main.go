@@ -65,6 +65,91 @@ var (
 		Usage: "Account address",
 		Value: "",
 	}
+	LimitsFlag = cli.StringFlag{
+		Name:  "limits",
+		Usage: "Spending limits json file",
+		Value: "",
+	}
+	DappIndexFlag = cli.StringFlag{
+		Name:  "dapp",
+		Usage: "Dapp index, the hardened account level of the derivation path",
+		Value: "",
+	}
+	SettingsFlag = cli.StringFlag{
+		Name:  "settings",
+		Usage: "Dapp settings json file",
+		Value: "",
+	}
+	CreatedAtFlag = cli.Uint64Flag{
+		Name:  "createdat",
+		Usage: "Unix time of an admin request, other admins must sign the same time",
+		Value: 0,
+	}
+	NonceFlag = cli.Uint64Flag{
+		Name:  "nonce",
+		Usage: "Nonce of an admin request, other admins must sign the same nonce",
+		Value: 0,
+	}
+	SignaturesFlag = cli.StringFlag{
+		Name:  "signatures",
+		Usage: "Signatures of other admins over the same request, each separated , over",
+		Value: "",
+	}
+	SignOnlyFlag = cli.BoolFlag{
+		Name:  "signonly",
+		Usage: "Only print the signature of the admin request for another admin to submit",
+	}
+	RequestFlag = cli.StringFlag{
+		Name:  "request",
+		Usage: "Id of a request escalated for admin approval",
+		Value: "",
+	}
+	ReasonFlag = cli.StringFlag{
+		Name:  "reason",
+		Usage: "Reason of an admin decision, recorded in the audit log",
+		Value: "",
+	}
+	GlobalFlag = cli.BoolFlag{
+		Name:  "global",
+		Usage: "Apply to every root served, not only --root",
+	}
+	ShareFlag = cli.StringFlag{
+		Name:  "share",
+		Usage: "Unseal share of a custodian, as printed by init --shares",
+		Value: "",
+	}
+	FormatFlag = cli.StringFlag{
+		Name:  "format",
+		Usage: "Export format, csv or jsonl",
+		Value: "jsonl",
+	}
+	OutFlag = cli.StringFlag{
+		Name:  "out",
+		Usage: "File to export to",
+		Value: "",
+	}
+	// AuditQueryFlags select audit records, next to --address
+	AuditQueryFlags = []cli.Flag{
+		cli.StringFlag{Name: "from", Usage: "Records written at or after, e.g. 2026-10-01 or 2026-10-01T12:00:00Z"},
+		cli.StringFlag{Name: "to", Usage: "Records written before"},
+		cli.StringFlag{Name: "method", Usage: "Method called, e.g. SignHashPlain"},
+		cli.StringFlag{Name: "userid", Usage: "User id as sent by the dapp, or the internal user id"},
+		cli.StringFlag{Name: "txhash", Usage: "Hash of a signed transaction"},
+		cli.StringFlag{Name: "remote", Usage: "Caller IP address or CIDR range"},
+		cli.StringFlag{Name: "outcome", Usage: "Result code or decision, e.g. ok, policy_rejected or escalate"},
+		cli.StringFlag{Name: "limit", Usage: "Records returned at most, 1000 by default"},
+	}
+	AdminFlags = []cli.Flag{
+		KeyFlag,
+		RootFlag,
+		KeyStoreFlag,
+		utils.RPCListenAddrFlag,
+		utils.RPCPortFlag,
+		CreatedAtFlag,
+		NonceFlag,
+		SignaturesFlag,
+		SignOnlyFlag,
+	}
 	RegisterFlags = []cli.Flag{
 		KeyFlag,
 		RootFlag,
@@ -138,7 +223,21 @@ func init() {
 		CountFlag,
 		StatusFlag,
 		AddressFlag,
+		LimitsFlag,
+		DappIndexFlag,
+		SettingsFlag,
+		CreatedAtFlag,
+		NonceFlag,
+		SignaturesFlag,
+		SignOnlyFlag,
+		RequestFlag,
+		ReasonFlag,
+		GlobalFlag,
+		ShareFlag,
+		FormatFlag,
+		OutFlag,
 	}
+	app.Flags = append(app.Flags, AuditQueryFlags...)
 	app.CommandNotFound = func(ctx *cli.Context, cmd string) {
 		fmt.Fprintf(os.Stderr, "No such command: %s\n", cmd)
 		os.Exit(1)
@@ -150,6 +249,26 @@ func init() {
 		UpdateDappCommand,
 		UpdateAccountCommand,
 		DappAddressCommand,
+		SetLimitsCommand,
+		UsageCommand,
+		ResetUsageCommand,
+		PendingCommand,
+		ApproveCommand,
+		DenyCommand,
+		FreezeCommand,
+		UnfreezeCommand,
+		FreezeStatusCommand,
+		SealCommand,
+		UnsealCommand,
+		AddRootCommand,
+		RetireRootCommand,
+		ReloadConfigCommand,
+		AuditSearchCommand,
+		AddDappCommand,
+		SetDappCommand,
+		DappsCommand,
+		XPubCommand,
+		ImportIDsCommand,
 	}
 	cli.CommandHelpTemplate = utils.OriginCommandHelpTemplate
 	sort.Sort(cli.CommandsByName(app.Commands))
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"ethereum/keyservice/common"
+	"ethereum/keyservice/common/hexutil"
+	"ethereum/keyservice/services/truekey/types"
+	"ethereum/keyservice/services/utils"
+	"fmt"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var PendingCommand = cli.Command{
+	Name:   "pending",
+	Usage:  "List the requests of a root waiting for admin approval",
+	Action: utils.MigrateFlags(pending),
+	Flags:  AdminFlags,
+}
+
+var ApproveCommand = cli.Command{
+	Name:   "approve",
+	Usage:  "Approve an escalated request, needs a quorum of admins",
+	Action: utils.MigrateFlags(approve),
+	Flags:  append(AdminFlags, RequestFlag, ReasonFlag),
+}
+
+var DenyCommand = cli.Command{
+	Name:   "deny",
+	Usage:  "Deny an escalated request",
+	Action: utils.MigrateFlags(deny),
+	Flags:  append(AdminFlags, RequestFlag, ReasonFlag),
+}
+
+func pending(ctx *cli.Context) error {
+	var reqs []*types.PendingRequest
+	if err := adminCall(ctx, &reqs, "admin_pendingRequests"); err != nil {
+		fmt.Println("admin_pendingRequests Error", err.Error())
+		return nil
+	}
+	if reqs == nil {
+		return nil
+	}
+	out, _ := json.MarshalIndent(reqs, "", "  ")
+	fmt.Println("truekey pending Success\n", string(out))
+	return nil
+}
+
+func parseDecision(ctx *cli.Context) (common.Hash, string) {
+	id, err := hexutil.Decode(ctx.GlobalString(RequestFlag.Name))
+	if err != nil || len(id) != common.HashLength {
+		printError("Must input correct request id", err)
+	}
+	reason := ctx.GlobalString(ReasonFlag.Name)
+	if reason == "" {
+		printError("Must specify --reason")
+	}
+	return common.BytesToHash(id), reason
+}
+
+func approve(ctx *cli.Context) error {
+	id, reason := parseDecision(ctx)
+	var result *types.PendingResult
+	if err := adminCall(ctx, &result, "admin_approveRequest", id, reason); err != nil {
+		fmt.Println("admin_approveRequest Error", err.Error())
+		return nil
+	}
+	if result == nil {
+		return nil
+	}
+	fmt.Println("truekey approve Success", result.ID.Hex(), "signed", result.Signed)
+	return nil
+}
+
+func deny(ctx *cli.Context) error {
+	id, reason := parseDecision(ctx)
+	var result *types.PendingResult
+	if err := adminCall(ctx, &result, "admin_denyRequest", id, reason); err != nil {
+		fmt.Println("admin_denyRequest Error", err.Error())
+		return nil
+	}
+	if result == nil {
+		return nil
+	}
+	fmt.Println("truekey deny Success", result.ID.Hex())
+	return nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"ethereum/keyservice/console"
+	"ethereum/keyservice/services/utils"
+	"fmt"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var AddRootCommand = cli.Command{
+	Name:   "addroot",
+	Usage:  "Serve a root whose keystore the service loaded, decrypting it with its passphrase",
+	Action: utils.MigrateFlags(addRoot),
+	Flags:  AdminFlags,
+	Description: `
+The passphrase of the root keystore is prompted for. Adding back a retired root needs a
+quorum of admins, who all sign over the passphrase.`,
+}
+
+var RetireRootCommand = cli.Command{
+	Name:   "retire",
+	Usage:  "Stop serving a root for good while keeping its data, needs a quorum of admins",
+	Action: utils.MigrateFlags(retireRoot),
+	Flags:  append(AdminFlags, ReasonFlag),
+}
+
+func addRoot(ctx *cli.Context) error {
+	passphrase, err := console.Stdin.PromptPassword("Root keystore passphrase: ")
+	if err != nil {
+		printError("Read passphrase error", err)
+	}
+	if err := adminCall(ctx, nil, "admin_addRoot", passphrase); err != nil {
+		fmt.Println("admin_addRoot Error", err.Error())
+		return nil
+	}
+	fmt.Println("truekey addroot Success")
+	return nil
+}
+
+func retireRoot(ctx *cli.Context) error {
+	reason := ctx.GlobalString(ReasonFlag.Name)
+	if reason == "" {
+		printError("Must specify --reason")
+	}
+	if err := adminCall(ctx, nil, "admin_retireRoot", reason); err != nil {
+		fmt.Println("admin_retireRoot Error", err.Error())
+		return nil
+	}
+	fmt.Println("truekey retire Success")
+	return nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"ethereum/keyservice/common/hexutil"
+	"ethereum/keyservice/console"
+	"ethereum/keyservice/services/truekey/types"
+	"ethereum/keyservice/services/utils"
+	"fmt"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var SealCommand = cli.Command{
+	Name:   "seal",
+	Usage:  "Wipe the keys of a root from the service memory",
+	Action: utils.MigrateFlags(seal),
+	Flags:  AdminFlags,
+}
+
+var UnsealCommand = cli.Command{
+	Name:   "unseal",
+	Usage:  "Submit a custodian's unseal share of a root",
+	Action: utils.MigrateFlags(unseal),
+	Flags: []cli.Flag{
+		RootFlag,
+		utils.RPCListenAddrFlag,
+		utils.RPCPortFlag,
+		ShareFlag,
+	},
+	Description: `
+The share is prompted for when --share is not given, so it stays out of the shell history.`,
+}
+
+func seal(ctx *cli.Context) error {
+	if err := adminCall(ctx, nil, "admin_seal"); err != nil {
+		fmt.Println("admin_seal Error", err.Error())
+		return nil
+	}
+	fmt.Println("truekey seal Success")
+	return nil
+}
+
+func unseal(ctx *cli.Context) error {
+	quest := parseAdminQuestParam(ctx)
+	input := ctx.GlobalString(ShareFlag.Name)
+	if input == "" {
+		var err error
+		if input, err = console.Stdin.PromptPassword("Unseal share: "); err != nil {
+			printError("Read share error", err)
+		}
+	}
+	share, err := hexutil.Decode(input)
+	if err != nil {
+		printError("Must input correct share", err)
+	}
+	conn, url := dialConn(ctx)
+	fmt.Println("Connect url ", url, " root ", quest.Root.String())
+
+	var status *types.SealStatus
+	if err := conn.Call(&status, "admin_unseal", quest.Root, hexutil.Bytes(share)); err != nil {
+		fmt.Println("admin_unseal Error", err.Error())
+		return nil
+	}
+	if status == nil {
+		return nil
+	}
+	if status.Sealed {
+		fmt.Println("truekey unseal Success, shares", status.Progress, "of", status.Threshold)
+	} else {
+		fmt.Println("truekey unseal Success, root unsealed")
+	}
+	return nil
+}
@@ -91,20 +91,38 @@ func (r *reporter) run() {
 	}
 }
 
+// splitTags turns the labels of a metric name into tags added to the configured
+// ones, so labeled metrics share a measurement.
+func (r *reporter) splitTags(name string) (string, map[string]string) {
+	name, labels := metrics.SplitLabels(name)
+	if len(labels) == 0 {
+		return name, r.tags
+	}
+	tags := make(map[string]string, len(r.tags)+len(labels))
+	for k, v := range r.tags {
+		tags[k] = v
+	}
+	for _, label := range labels {
+		tags[label.Name] = label.Value
+	}
+	return name, tags
+}
+
 func (r *reporter) send() error {
 	var pts []client.Point
 
 	r.reg.Each(func(name string, i interface{}) {
 		now := time.Now()
 		namespace := r.namespace
+		base, tags := r.splitTags(name)
 
 		switch metric := i.(type) {
 		case metrics.Counter:
 			v := metric.Count()
 			l := r.cache[name]
 			pts = append(pts, client.Point{
-				Measurement: fmt.Sprintf("%s%s.count", namespace, name),
-				Tags:        r.tags,
+				Measurement: fmt.Sprintf("%s%s.count", namespace, base),
+				Tags:        tags,
 				Fields: map[string]interface{}{
 					"value": v - l,
 				},
@@ -114,8 +132,8 @@ func (r *reporter) send() error {
 		case metrics.Gauge:
 			ms := metric.Snapshot()
 			pts = append(pts, client.Point{
-				Measurement: fmt.Sprintf("%s%s.gauge", namespace, name),
-				Tags:        r.tags,
+				Measurement: fmt.Sprintf("%s%s.gauge", namespace, base),
+				Tags:        tags,
 				Fields: map[string]interface{}{
 					"value": ms.Value(),
 				},
@@ -124,8 +142,8 @@ func (r *reporter) send() error {
 		case metrics.GaugeFloat64:
 			ms := metric.Snapshot()
 			pts = append(pts, client.Point{
-				Measurement: fmt.Sprintf("%s%s.gauge", namespace, name),
-				Tags:        r.tags,
+				Measurement: fmt.Sprintf("%s%s.gauge", namespace, base),
+				Tags:        tags,
 				Fields: map[string]interface{}{
 					"value": ms.Value(),
 				},
@@ -135,8 +153,8 @@ func (r *reporter) send() error {
 			ms := metric.Snapshot()
 			ps := ms.Percentiles([]float64{0.5, 0.75, 0.95, 0.99, 0.999, 0.9999})
 			pts = append(pts, client.Point{
-				Measurement: fmt.Sprintf("%s%s.histogram", namespace, name),
-				Tags:        r.tags,
+				Measurement: fmt.Sprintf("%s%s.histogram", namespace, base),
+				Tags:        tags,
 				Fields: map[string]interface{}{
 					"count":    ms.Count(),
 					"max":      ms.Max(),
@@ -156,8 +174,8 @@ func (r *reporter) send() error {
 		case metrics.Meter:
 			ms := metric.Snapshot()
 			pts = append(pts, client.Point{
-				Measurement: fmt.Sprintf("%s%s.meter", namespace, name),
-				Tags:        r.tags,
+				Measurement: fmt.Sprintf("%s%s.meter", namespace, base),
+				Tags:        tags,
 				Fields: map[string]interface{}{
 					"count": ms.Count(),
 					"m1":    ms.Rate1(),
@@ -171,8 +189,8 @@ func (r *reporter) send() error {
 			ms := metric.Snapshot()
 			ps := ms.Percentiles([]float64{0.5, 0.75, 0.95, 0.99, 0.999, 0.9999})
 			pts = append(pts, client.Point{
-				Measurement: fmt.Sprintf("%s%s.timer", namespace, name),
-				Tags:        r.tags,
+				Measurement: fmt.Sprintf("%s%s.timer", namespace, base),
+				Tags:        tags,
 				Fields: map[string]interface{}{
 					"count":    ms.Count(),
 					"max":      ms.Max(),
@@ -200,8 +218,8 @@ func (r *reporter) send() error {
 				ps := t.Percentiles([]float64{50, 95, 99})
 				val := t.Values()
 				pts = append(pts, client.Point{
-					Measurement: fmt.Sprintf("%s%s.span", namespace, name),
-					Tags:        r.tags,
+					Measurement: fmt.Sprintf("%s%s.span", namespace, base),
+					Tags:        tags,
 					Fields: map[string]interface{}{
 						"count": len(val),
 						"max":   val[len(val)-1],
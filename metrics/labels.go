@@ -0,0 +1,80 @@
+package metrics
+
+import (
+	"strings"
+)
+
+// Label is a dimension of a metric, e.g. the RPC method a counter counts.
+type Label struct {
+	Name  string
+	Value string
+}
+
+// LabeledName appends labels to a metric name in the Prometheus notation
+// name{k="v",...}. The registry keeps every label combination as a metric of its
+// own, exporters split the labels off again with SplitLabels.
+func LabeledName(name string, labels ...Label) string {
+	if len(labels) == 0 {
+		return name
+	}
+	var b strings.Builder
+	b.WriteString(name)
+	b.WriteByte('{')
+	for i, label := range labels {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(label.Name)
+		b.WriteString(`="`)
+		b.WriteString(labelEscaper.Replace(label.Value))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+var (
+	labelEscaper   = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	labelUnescaper = strings.NewReplacer(`\\`, `\`, `\"`, `"`, `\n`, "\n")
+)
+
+// SplitLabels splits a name created by LabeledName into the plain name and its
+// labels. Names without labels are returned as they are.
+func SplitLabels(name string) (string, []Label) {
+	open := strings.IndexByte(name, '{')
+	if open < 0 || !strings.HasSuffix(name, "}") {
+		return name, nil
+	}
+	var (
+		labels []Label
+		rest   = name[open+1 : len(name)-1]
+	)
+	for rest != "" {
+		eq := strings.Index(rest, `="`)
+		if eq < 0 {
+			return name, nil
+		}
+		label := Label{Name: rest[:eq]}
+		rest = rest[eq+2:]
+
+		// Find the closing quote, skipping escaped ones
+		end := -1
+		for i := 0; i < len(rest); i++ {
+			if rest[i] == '\\' {
+				i++
+				continue
+			}
+			if rest[i] == '"' {
+				end = i
+				break
+			}
+		}
+		if end < 0 {
+			return name, nil
+		}
+		label.Value = labelUnescaper.Replace(rest[:end])
+		labels = append(labels, label)
+		rest = strings.TrimPrefix(rest[end+1:], ",")
+	}
+	return name[:open], labels
+}
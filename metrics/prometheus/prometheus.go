@@ -0,0 +1,141 @@
+// Package prometheus exposes a metrics registry in the Prometheus text format.
+package prometheus
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"ethereum/keyservice/log"
+	"ethereum/keyservice/metrics"
+)
+
+// quantiles are exported for histograms and timers.
+var quantiles = []float64{0.5, 0.75, 0.95, 0.99, 0.999}
+
+// Handler returns an HTTP handler which dumps the metrics of the registry in
+// the Prometheus text format. Labels added with metrics.LabeledName become
+// Prometheus labels, timers are exported as summaries in seconds.
+func Handler(reg metrics.Registry) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		if _, err := w.Write(Collect(reg)); err != nil {
+			log.Debug("Failed to write metrics", "err", err)
+		}
+	})
+}
+
+// sample is a single registered metric, with its name split into the exported
+// name and labels.
+type sample struct {
+	name   string
+	labels []metrics.Label
+	metric interface{}
+}
+
+// Collect renders every metric of the registry in the Prometheus text format.
+func Collect(reg metrics.Registry) []byte {
+	var samples []sample
+	reg.Each(func(name string, i interface{}) {
+		base, labels := metrics.SplitLabels(name)
+		samples = append(samples, sample{mangle(base), labels, i})
+	})
+	sort.SliceStable(samples, func(i, j int) bool { return samples[i].name < samples[j].name })
+
+	var (
+		buf  = new(bytes.Buffer)
+		last string
+	)
+	for _, s := range samples {
+		typ := typeOf(s.metric)
+		if typ == "" {
+			continue
+		}
+		// Metrics differing only by labels share their type line
+		if s.name != last {
+			fmt.Fprintf(buf, "# TYPE %s %s\n", s.name, typ)
+			last = s.name
+		}
+		switch metric := s.metric.(type) {
+		case metrics.Counter:
+			writeValue(buf, s.name, s.labels, float64(metric.Count()))
+		case metrics.Gauge:
+			writeValue(buf, s.name, s.labels, float64(metric.Value()))
+		case metrics.GaugeFloat64:
+			writeValue(buf, s.name, s.labels, metric.Value())
+		case metrics.Meter:
+			writeValue(buf, s.name, s.labels, float64(metric.Count()))
+		case metrics.Histogram:
+			ms := metric.Snapshot()
+			writeSummary(buf, s.name, s.labels, ms.Percentiles(quantiles), float64(ms.Sum()), ms.Count(), 1)
+		case metrics.Timer:
+			ms := metric.Snapshot()
+			writeSummary(buf, s.name, s.labels, ms.Percentiles(quantiles), float64(ms.Sum()), ms.Count(), float64(time.Second))
+		case metrics.ResettingTimer:
+			ms := metric.Snapshot()
+			values, ps := ms.Values(), make([]float64, len(quantiles))
+			if len(values) > 0 {
+				percents := make([]float64, len(quantiles))
+				for i, q := range quantiles {
+					percents[i] = q * 100
+				}
+				for i, p := range ms.Percentiles(percents) {
+					ps[i] = float64(p)
+				}
+			}
+			var sum int64
+			for _, v := range values {
+				sum += v
+			}
+			writeSummary(buf, s.name, s.labels, ps, float64(sum), int64(len(values)), float64(time.Second))
+		}
+	}
+	return buf.Bytes()
+}
+
+// typeOf returns the Prometheus type a metric is exported as.
+func typeOf(metric interface{}) string {
+	switch metric.(type) {
+	case metrics.Counter, metrics.Meter:
+		return "counter"
+	case metrics.Gauge, metrics.GaugeFloat64:
+		return "gauge"
+	case metrics.Histogram, metrics.Timer, metrics.ResettingTimer:
+		return "summary"
+	}
+	return ""
+}
+
+// writeSummary writes the quantiles, sum and count of a summary. Values are
+// divided by unit, e.g. to turn nanoseconds into seconds.
+func writeSummary(buf *bytes.Buffer, name string, labels []metrics.Label, ps []float64, sum float64, count int64, unit float64) {
+	for i, q := range quantiles {
+		quantile := append(append([]metrics.Label{}, labels...), metrics.Label{Name: "quantile", Value: strconv.FormatFloat(q, 'g', -1, 64)})
+		writeValue(buf, name, quantile, ps[i]/unit)
+	}
+	writeValue(buf, name+"_sum", labels, sum/unit)
+	writeValue(buf, name+"_count", labels, float64(count))
+}
+
+func writeValue(buf *bytes.Buffer, name string, labels []metrics.Label, value float64) {
+	buf.WriteString(metrics.LabeledName(name, labels...))
+	buf.WriteByte(' ')
+	buf.WriteString(strconv.FormatFloat(value, 'g', -1, 64))
+	buf.WriteByte('\n')
+}
+
+// mangle turns a registry name like truekey/rpc/requests into a valid
+// Prometheus metric name.
+func mangle(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == ':':
+			return r
+		}
+		return '_'
+	}, name)
+}
@@ -18,12 +18,46 @@ package rpc
 
 import (
 	"net"
+	"net/http"
 
 	"ethereum/keyservice/log"
 )
 
 // StartHTTPEndpoint starts the HTTP RPC endpoint, configured with cors/vhosts/modules
 func StartHTTPEndpoint(endpoint string, apis []API, modules []string, cors []string, vhosts []string) (net.Listener, *Server, error) {
+	listener, handler, err := listenHTTP(endpoint, apis, modules)
+	if err != nil {
+		return nil, nil, err
+	}
+	go NewHTTPServer(cors, vhosts, handler).Serve(listener)
+	return listener, handler, err
+}
+
+// StartHTTPServer starts the HTTP RPC endpoint like StartHTTPEndpoint, but returns
+// the HTTP server so it can be shut down gracefully, letting in-flight requests finish.
+// Routes are served next to the RPC handler on their paths, e.g. health checks,
+// without the cors and vhosts restrictions.
+func StartHTTPServer(endpoint string, apis []API, modules []string, cors []string, vhosts []string, routes map[string]http.Handler) (*http.Server, *Server, error) {
+	listener, handler, err := listenHTTP(endpoint, apis, modules)
+	if err != nil {
+		return nil, nil, err
+	}
+	server := NewHTTPServer(cors, vhosts, handler)
+	if len(routes) > 0 {
+		mux := http.NewServeMux()
+		mux.Handle("/", server.Handler)
+		for path, route := range routes {
+			mux.Handle(path, route)
+		}
+		server.Handler = mux
+	}
+	go server.Serve(listener)
+	return server, handler, nil
+}
+
+// listenHTTP registers the whitelisted APIs with a new RPC server and opens the
+// TCP listener of an HTTP endpoint.
+func listenHTTP(endpoint string, apis []API, modules []string) (net.Listener, *Server, error) {
 	// Generate the whitelist based on the allowed modules
 	whitelist := make(map[string]bool)
 	for _, module := range modules {
@@ -40,15 +74,11 @@ func StartHTTPEndpoint(endpoint string, apis []API, modules []string, cors []str
 		}
 	}
 	// All APIs registered, start the HTTP listener
-	var (
-		listener net.Listener
-		err      error
-	)
-	if listener, err = net.Listen("tcp", endpoint); err != nil {
+	listener, err := net.Listen("tcp", endpoint)
+	if err != nil {
 		return nil, nil, err
 	}
-	go NewHTTPServer(cors, vhosts, handler).Serve(listener)
-	return listener, handler, err
+	return listener, handler, nil
 }
 
 // StartWSEndpoint starts a websocket endpoint
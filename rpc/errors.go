@@ -51,6 +51,13 @@ func (e *invalidParamsError) ErrorCode() int { return -32602 }
 
 func (e *invalidParamsError) Error() string { return e.message }
 
+// DataError is an error a callback returns with data for the caller, which is
+// sent in the data field of the JSON-RPC error next to the message.
+type DataError interface {
+	Error() string          // returns the message
+	ErrorData() interface{} // returns the error data
+}
+
 // logic error, callback returned an error
 type callbackError struct{ message string }
 
@@ -160,3 +160,29 @@ func TestServerMethodExecution(t *testing.T) {
 func TestServerMethodWithCtx(t *testing.T) {
 	testServerMethodExecution(t, "echoWithCtx")
 }
+
+type dataError struct{}
+
+func (dataError) Error() string          { return "data error" }
+func (dataError) ErrorData() interface{} { return "data" }
+
+type DataErrorService struct{}
+
+func (s *DataErrorService) Fail() error {
+	return dataError{}
+}
+
+func TestServerDataError(t *testing.T) {
+	server := NewServer()
+	if err := server.RegisterName("test", new(DataErrorService)); err != nil {
+		t.Fatal(err)
+	}
+	client := DialInProc(server)
+	defer client.Close()
+
+	err := client.Call(nil, "test_fail")
+	de, ok := err.(DataError)
+	if !ok || err.Error() != "data error" || de.ErrorData() != "data" {
+		t.Fatalf("have %v, want the error with its data", err)
+	}
+}
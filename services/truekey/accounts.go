@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"ethereum/keyservice/accounts/keystore"
+	"ethereum/keyservice/common"
+	"ethereum/keyservice/etruedb"
+	"ethereum/keyservice/log"
+	"ethereum/keyservice/services/truekey/signer"
+	"ethereum/keyservice/services/truekey/types"
+	"ethereum/keyservice/services/utils"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/urfave/cli.v1"
+)
+
+var (
+	importRootFlag = cli.StringFlag{
+		Name:  "root",
+		Usage: "Root to register the users under, the only root loaded by default",
+	}
+	importDappFlag = cli.StringFlag{
+		Name:  "dapp",
+		Usage: "Account of the dapp to register the users of, none by default",
+	}
+	importBatchFlag = cli.IntFlag{
+		Name:  "batch",
+		Usage: "Users committed in a single write",
+		Value: types.MaxImportUsers,
+	}
+	importOutFlag = cli.StringFlag{
+		Name:  "out",
+		Usage: "CSV file of the userId, address and path of every user, <idsfile>.csv by default",
+	}
+	accountsCommand = cli.Command{
+		Name:  "accounts",
+		Usage: "Manage the accounts of the datadir",
+		Subcommands: []cli.Command{
+			{
+				Action:    utils.MigrateFlags(importIDs),
+				Name:      "import-ids",
+				Usage:     "Register the user ids of a file in bulk",
+				ArgsUsage: "<idsfile>",
+				Flags: []cli.Flag{
+					logLevelFlag,
+					DataDirFlag,
+					ConfigFlag,
+					keystoreFlag,
+					keystoreDirFlag,
+					seedFlag,
+					passwordDirFlag,
+					passwordFdFlag,
+					passwordStdinFlag,
+					skipBadPasswordFlag,
+					importRootFlag,
+					importDappFlag,
+					importBatchFlag,
+					importOutFlag,
+				},
+				Description: `
+The import-ids command registers the user ids of a file, one per line, against the
+datadir while the service is stopped. Users are derived as RegisterAccount derives
+them and committed --batch at a time, each batch in a single write. The userId,
+address and path of every user are written to --out as CSV. Users registered before
+keep their accounts, so an interrupted import is resumed by running it again with the
+same file, which lists every user again.`,
+			},
+		},
+	}
+)
+
+// importIDs registers the user ids of a file under a root of the datadir.
+func importIDs(c *cli.Context) error {
+	if err := initialize(c); err != nil {
+		return err
+	}
+	if c.NArg() != 1 {
+		return errors.New("please specify the file of user ids to import")
+	}
+	idsFile := c.Args().First()
+	batchSize := c.Int(importBatchFlag.Name)
+	if batchSize <= 0 {
+		return fmt.Errorf("invalid --%s %d", importBatchFlag.Name, batchSize)
+	}
+	var dapp *uint32
+	if c.IsSet(importDappFlag.Name) {
+		account, err := strconv.ParseUint(c.String(importDappFlag.Name), 10, 32)
+		if err != nil {
+			return fmt.Errorf("invalid --%s: %v", importDappFlag.Name, err)
+		}
+		dapp = new(uint32)
+		*dapp = uint32(account)
+	}
+	api, closeDB, err := openOffline(c)
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+	root, err := importRoot(c, api)
+	if err != nil {
+		return err
+	}
+
+	in, err := os.Open(idsFile)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	outFile := c.String(importOutFlag.Name)
+	if outFile == "" {
+		outFile = idsFile + ".csv"
+	}
+	out, err := os.Create(outFile)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	w := csv.NewWriter(out)
+	w.Write([]string{"userId", "address", "path"})
+
+	var (
+		scanner  = bufio.NewScanner(in)
+		batch    = make([]string, 0, batchSize)
+		lines    = make([]int, 0, batchSize)
+		line     int
+		users    int
+		imported int
+	)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		accounts, err := api.ImportUsers(root, dapp, batch)
+		if err != nil {
+			return fmt.Errorf("batch from line %d: %v", lines[0], err)
+		}
+		for _, account := range accounts {
+			w.Write([]string{string(account.UserID), account.Address.Hex(), account.Path})
+			if account.New {
+				imported++
+			}
+		}
+		w.Flush()
+		if err := w.Error(); err != nil {
+			return err
+		}
+		users += len(batch)
+		log.Info("Import progress", "line", line, "users", users, "new", imported)
+		batch, lines = batch[:0], lines[:0]
+		return nil
+	}
+	for scanner.Scan() {
+		line++
+		if id := strings.TrimSpace(scanner.Text()); id != "" {
+			batch, lines = append(batch, id), append(lines, line)
+		}
+		if len(batch) == batchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+	log.Info("Import done", "root", root, "users", users, "new", imported, "out", outFile)
+	return nil
+}
+
+// openOffline serves the roots of the keystores and seeds given against the
+// database of the datadir, for commands run while the service is stopped.
+func openOffline(c *cli.Context) (*signer.SignerAPI, func(), error) {
+	files, err := keystoreFiles(c)
+	if err != nil {
+		return nil, nil, err
+	}
+	var seedFiles []string
+	if c.GlobalIsSet(seedFlag.Name) {
+		seedFiles = splitAndTrim(c.GlobalString(seedFlag.Name))
+	}
+	config, err := loadConfig(c, files, seedFiles)
+	if err != nil {
+		return nil, nil, err
+	}
+	passwords, err := newPasswordSources(c)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer passwords.close()
+	var keys []*keystore.Key
+	if len(files) > 0 {
+		if keys, err = readMasterKey(files, passwords); err != nil {
+			return nil, nil, err
+		}
+	}
+	seeds, err := readSeeds(seedFiles, passwords)
+	if err != nil {
+		return nil, nil, err
+	}
+	db, err := etruedb.NewLDBDatabase(filepath.Join(c.GlobalString(DataDirFlag.Name), KEYDataDir), DatabaseCache, makeDatabaseHandles())
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open the datadir, is the service running? %v", err)
+	}
+	api, err := signer.NewSignerAPI(db, keys, config.Config)
+	if err != nil {
+		db.Close()
+		return nil, nil, err
+	}
+	for _, seed := range seeds {
+		if _, err := api.UnlockSeed(seed.seed); err != nil {
+			db.Close()
+			return nil, nil, fmt.Errorf("failed to load the seed at '%s': %v", seed.file, err)
+		}
+	}
+	return api, func() {
+		api.Stop()
+		db.Close()
+	}, nil
+}
+
+// importRoot returns the root given with --root, or the only root served.
+func importRoot(c *cli.Context, api *signer.SignerAPI) (common.Address, error) {
+	if c.IsSet(importRootFlag.Name) {
+		if !common.IsHexAddress(c.String(importRootFlag.Name)) {
+			return common.Address{}, fmt.Errorf("invalid --%s", importRootFlag.Name)
+		}
+		return common.HexToAddress(c.String(importRootFlag.Name)), nil
+	}
+	var roots []common.Address
+	for _, rs := range api.Status().Roots {
+		if !rs.Sealed {
+			roots = append(roots, rs.Root)
+		}
+	}
+	if len(roots) != 1 {
+		return common.Address{}, fmt.Errorf("%d roots loaded, please specify --%s", len(roots), importRootFlag.Name)
+	}
+	return roots[0], nil
+}
@@ -0,0 +1,230 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"errors"
+	"ethereum/keyservice/common"
+	"ethereum/keyservice/log"
+	"ethereum/keyservice/services/truekey/audit"
+	"ethereum/keyservice/services/truekey/types"
+	"ethereum/keyservice/services/utils"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+
+	"gopkg.in/urfave/cli.v1"
+)
+
+// auditPseudonymKeyFile in the datadir keys the pseudonyms of user ids in the
+// audit log.
+const auditPseudonymKeyFile = "audit_pseudonym.key"
+
+var (
+	auditorFlag = cli.StringFlag{
+		Name:  "auditor",
+		Usage: "Comma separated addresses checkpoints must be signed with, as logged at startup",
+	}
+	auditFormatFlag = cli.StringFlag{
+		Name:  "format",
+		Usage: "Export format, csv or jsonl",
+		Value: audit.FormatJSONL,
+	}
+	auditOutFlag = cli.StringFlag{
+		Name:  "out",
+		Usage: "File to export to instead of stdout",
+	}
+	// auditQueryFlags select records, one per field of audit.Query
+	auditQueryFlags = []cli.Flag{
+		cli.StringFlag{Name: "from", Usage: "Records written at or after, e.g. 2026-10-01 or 2026-10-01T12:00:00Z"},
+		cli.StringFlag{Name: "to", Usage: "Records written before"},
+		cli.StringFlag{Name: "method", Usage: "Method called, e.g. SignHashPlain"},
+		cli.StringFlag{Name: "root", Usage: "Root address"},
+		cli.StringFlag{Name: "userid", Usage: "Internal user id, matched in its pseudonymized form"},
+		cli.StringFlag{Name: "address", Usage: "Sender, recipient or registered account"},
+		cli.StringFlag{Name: "txhash", Usage: "Hash of a signed transaction"},
+		cli.StringFlag{Name: "remote", Usage: "Caller IP address or CIDR range"},
+		cli.StringFlag{Name: "outcome", Usage: "Result code or decision, e.g. ok, policy_rejected or escalate"},
+		cli.StringFlag{Name: "limit", Usage: "Stop after this many records"},
+	}
+	auditCommand = cli.Command{
+		Name:  "audit",
+		Usage: "Inspect the audit log",
+		Subcommands: []cli.Command{
+			{
+				Action:    utils.MigrateFlags(verifyAudit),
+				Name:      "verify",
+				Usage:     "Verify the hash chain and checkpoints of the audit log",
+				ArgsUsage: "[<logfile>...]",
+				Flags: []cli.Flag{
+					DataDirFlag,
+					auditorFlag,
+				},
+				Description: `
+The verify command walks the audit log, by default server_audit.log in the datadir
+and the files rotated out of it, oldest first. Files given as arguments are read in
+the order given. Every record carries the hash of the one before it, across rotated
+files as well, so edited, removed or reordered
+records and a truncated head are reported. Checkpoints must carry a valid signature,
+with --auditor by one of the given audit keys. The last checkpoint written is stored
+in server_audit.log.head, a log ending before it was cut at the tail. Records after
+that checkpoint can be dropped unnoticed and are reported as unsigned. The command
+fails if the log was tampered with.`,
+			},
+			{
+				Action: utils.MigrateFlags(searchAudit),
+				Name:   "search",
+				Usage:  "Search the audit log and export the matching records",
+				Flags:  append([]cli.Flag{DataDirFlag, auditFormatFlag, auditOutFlag}, auditQueryFlags...),
+				Description: `
+The search command reads server_audit.log in the datadir and the files rotated out of
+it, oldest first, and exports the records matching every given flag. User ids are
+pseudonymized in the log, --userid takes the internal user id and is matched with
+the pseudonym key of the datadir. jsonl exports the records as written, so an
+export can still be checked against the chain, csv a table of the common fields.`,
+			},
+		},
+	}
+)
+
+// configureAuditLog returns the config listener applying the audit section of
+// the config to the log. Rotation and forwarding are only touched when their
+// config changed, so a reload does not reconnect to syslog.
+func configureAuditLog(l *audit.Log, pseudonymKey []byte) func(types.Config) {
+	var (
+		policy  audit.RotatePolicy
+		forward []audit.Forward
+		applied bool
+	)
+	return func(config types.Config) {
+		l.SetRedactor(audit.NewRedactor(config.Redaction(), pseudonymKey))
+		if !applied || config.AuditRotation() != policy {
+			policy = config.AuditRotation()
+			l.SetRotation(policy)
+		}
+		if !applied || !reflect.DeepEqual(config.AuditForward(), forward) {
+			forward = config.AuditForward()
+			sinks := make(map[string]audit.Sink)
+			for _, f := range forward {
+				sink, err := audit.NewSink(f)
+				if err != nil {
+					log.Error("Audit log forwarding unavailable", "sink", f, "err", err)
+					continue
+				}
+				log.Info("Forwarding audit log", "sink", f)
+				sinks[f.String()] = sink
+			}
+			l.SetSinks(sinks)
+		}
+		applied = true
+	}
+}
+
+// auditQuery builds the query of the set query flags.
+func auditQuery(c *cli.Context) (audit.Query, error) {
+	var query audit.Query
+	for _, field := range audit.QueryFields {
+		if c.IsSet(field) {
+			if err := query.Set(field, c.String(field)); err != nil {
+				return query, err
+			}
+		}
+	}
+	return query, nil
+}
+
+func searchAudit(c *cli.Context) error {
+	query, err := auditQuery(c)
+	if err != nil {
+		return err
+	}
+	dataDir := c.GlobalString(DataDirFlag.Name)
+	var key []byte
+	if query.UserID != "" {
+		if key, err = ioutil.ReadFile(filepath.Join(dataDir, auditPseudonymKeyFile)); err != nil {
+			return fmt.Errorf("pseudonym key: %v", err)
+		}
+	}
+	files, err := audit.Files(filepath.Join(dataDir, ServerAUDITFILE))
+	if err != nil {
+		return err
+	}
+	out := os.Stdout
+	if c.IsSet(auditOutFlag.Name) {
+		if out, err = os.OpenFile(c.String(auditOutFlag.Name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600); err != nil {
+			return err
+		}
+		defer out.Close()
+	}
+	exporter, err := audit.NewExporter(out, c.String(auditFormatFlag.Name))
+	if err != nil {
+		return err
+	}
+	// The redaction rules of the config are unknown here, the defaults
+	// pseudonymize user ids the same way.
+	if err := audit.Search(files, query, audit.NewRedactor(nil, key), exporter.Write); err != nil {
+		return err
+	}
+	return exporter.Flush()
+}
+
+func verifyAudit(c *cli.Context) error {
+	files := []string(c.Args())
+	if len(files) == 0 {
+		var err error
+		if files, err = audit.Files(filepath.Join(c.GlobalString(DataDirFlag.Name), ServerAUDITFILE)); err != nil {
+			return err
+		}
+	}
+	var auditors []common.Address
+	if c.IsSet(auditorFlag.Name) {
+		for _, a := range splitAndTrim(c.String(auditorFlag.Name)) {
+			if !common.IsHexAddress(a) {
+				return fmt.Errorf("invalid auditor address %q", a)
+			}
+			auditors = append(auditors, common.HexToAddress(a))
+		}
+	}
+	// The head is stored next to the current file, the last one
+	head, err := audit.ReadHead(files[len(files)-1])
+	if err != nil {
+		return err
+	}
+	report, err := audit.VerifyFiles(files, auditors, head)
+	if err != nil {
+		return err
+	}
+	if head == nil && report.Checkpoints > 0 {
+		report.Warnings = append(report.Warnings, "no head stored next to the log, records removed from its tail cannot be noticed")
+	}
+	for _, p := range report.Problems {
+		fmt.Println("Problem:", p)
+	}
+	for _, w := range report.Warnings {
+		fmt.Println("Warning:", w)
+	}
+	fmt.Printf("%s: %d records in %d files, %d checkpoints\n", files[len(files)-1], report.Records, len(files), report.Checkpoints)
+	for _, a := range report.Auditors {
+		fmt.Println("Checkpoints signed by", a.Hex())
+	}
+	if !report.OK() {
+		return errors.New("audit log verification failed")
+	}
+	return nil
+}
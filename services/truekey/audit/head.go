@@ -0,0 +1,67 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package audit
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+
+	"ethereum/keyservice/common"
+)
+
+// Head is the last checkpoint written to a log. It is kept in a file of its
+// own, so records removed from the tail of the log up to and including that
+// checkpoint are noticed. The service database would do as well, but is locked
+// while the service runs.
+type Head struct {
+	Seq  uint64      `json:"seq"`
+	Hash common.Hash `json:"hash"` // of the checkpoint line
+}
+
+// HeadPath returns the file holding the head of the log at path.
+func HeadPath(path string) string {
+	return path + ".head"
+}
+
+// ReadHead reads the head stored for the log at path, nil if none was stored.
+func ReadHead(path string) (*Head, error) {
+	data, err := ioutil.ReadFile(HeadPath(path))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	head := new(Head)
+	if err := json.Unmarshal(data, head); err != nil {
+		return nil, err
+	}
+	return head, nil
+}
+
+// writeHead replaces the head stored for the log at path.
+func writeHead(path string, head Head) error {
+	data, err := json.Marshal(head)
+	if err != nil {
+		return err
+	}
+	tmp := HeadPath(path) + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, HeadPath(path))
+}
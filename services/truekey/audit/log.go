@@ -0,0 +1,387 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+// Package audit implements the tamper evident audit log of the signer.
+//
+// Every record is a line of JSON ending in the fields "seq" and "prev", where
+// prev is the keccak256 hash of the previous line. Removing, reordering or
+// editing a line breaks the chain. Periodically a checkpoint record is
+// appended, signed by an audit key derived from a root wallet, so that the
+// chain cannot simply be recomputed after an edit.
+//
+// The chain carries across rotated files: the first record of a new file links
+// to the last record of the file rotated before it, so the files of a log
+// verify as one chain.
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"ethereum/keyservice/common"
+	"ethereum/keyservice/common/hexutil"
+	"ethereum/keyservice/crypto"
+	"ethereum/keyservice/log"
+	"ethereum/keyservice/services/truekey/secret"
+)
+
+const (
+	// DefaultCheckpointRecords is the number of records after which a
+	// checkpoint is written.
+	DefaultCheckpointRecords = 1000
+
+	// DefaultCheckpointInterval is the longest time records stay uncovered by
+	// a checkpoint.
+	DefaultCheckpointInterval = time.Minute
+
+	// Events written by the log itself.
+	EventCheckpoint = "checkpoint"
+	EventRestart    = "restart"
+	EventRotated    = "rotated"
+	EventRetention  = "retention"
+)
+
+// Log is a log.Handler appending records to a hash chained file.
+type Log struct {
+	mu     sync.Mutex
+	f      *os.File
+	redact *Redactor
+	sinks  []*sink
+
+	seq  uint64      // sequence number of the next record
+	prev common.Hash // hash of the last line written
+	open int         // records written since the last checkpoint
+
+	size    int64     // bytes in the current file
+	created time.Time // time of the first record of the current file
+	policy  RotatePolicy
+	maint   sync.Mutex     // serializes compression and retention
+	pending sync.WaitGroup // running maintenance
+
+	key     *ecdsa.PrivateKey
+	auditor common.Address
+	every   int
+
+	quit chan struct{}
+	done chan struct{}
+}
+
+// Open opens or creates the audit log at path and resumes its chain. A
+// checkpoint is written every records records and at least every interval.
+// Records are redacted with DefaultRedaction keyed with pseudonymKey until
+// SetRedactor installs other rules.
+func Open(path string, pseudonymKey []byte, records int, interval time.Duration) (*Log, error) {
+	if err := moveLegacy(path); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	l := &Log{
+		f:      f,
+		redact: NewRedactor(nil, pseudonymKey),
+		every:  records,
+		quit:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	if err := l.resume(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	go l.loop(interval)
+	return l, nil
+}
+
+// moveLegacy moves a log of logfmt lines written before the JSON schema aside,
+// so it can still be read and the new log starts a clean chain.
+func moveLegacy(path string) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	first := make([]byte, 1)
+	n, _ := f.Read(first)
+	f.Close()
+	if n == 0 || first[0] == '{' {
+		return nil
+	}
+	legacy := fmt.Sprintf("%s.legacy-%d", path, time.Now().Unix())
+	log.Warn("Moving aside audit log of an older format", "file", path, "to", legacy)
+	return os.Rename(path, legacy)
+}
+
+// resume continues the chain from the last line of the file. A last line that
+// cannot be parsed, e.g. after a torn write, starts a new chain, which
+// verification reports.
+func (l *Log) resume() error {
+	first, last, torn, err := scanLines(l.f)
+	if err != nil {
+		return err
+	}
+	if l.size, err = l.f.Seek(0, io.SeekEnd); err != nil {
+		return err
+	}
+	var head struct {
+		Time time.Time `json:"time"`
+	}
+	if json.Unmarshal(first, &head) == nil && !head.Time.IsZero() {
+		l.created = head.Time
+	}
+	if torn {
+		if _, err := l.f.Write([]byte{'\n'}); err != nil {
+			return err
+		}
+	}
+	if last == nil {
+		return nil
+	}
+	var chain chainFields
+	if torn || json.Unmarshal(last, &chain) != nil || chain.Seq == nil || chain.Prev == nil {
+		log.Warn("Audit log chain broken, starting a new chain", "file", l.f.Name())
+		l.open = 1
+		return l.write(&Record{Level: "warn", Event: EventRestart, Action: "Chain restarted"})
+	}
+	l.seq, l.prev = *chain.Seq+1, crypto.Keccak256Hash(last)
+	return nil
+}
+
+// scanLines returns the first and last line of r without their newline, and
+// whether the last one lacks its newline.
+func scanLines(r io.Reader) ([]byte, []byte, bool, error) {
+	if seeker, ok := r.(io.Seeker); ok {
+		if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+			return nil, nil, false, err
+		}
+	}
+	var (
+		first, last []byte
+		torn        bool
+	)
+	in := bufio.NewReader(r)
+	for {
+		line, err := in.ReadBytes('\n')
+		if len(line) > 0 {
+			torn = line[len(line)-1] != '\n'
+			last = bytes.TrimSuffix(line, []byte{'\n'})
+			if first == nil {
+				first = last
+			}
+		}
+		if err == io.EOF {
+			return first, last, torn, nil
+		}
+		if err != nil {
+			return nil, nil, false, err
+		}
+	}
+}
+
+// SetRedactor replaces the redaction rules, e.g. after the config changed.
+func (l *Log) SetRedactor(r *Redactor) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.redact = r
+}
+
+// Log implements log.Handler.
+func (l *Log) Log(r *log.Record) error {
+	rec := newRecord(r)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.f == nil {
+		return errors.New("audit log closed")
+	}
+	l.redact.Redact(rec)
+	if err := l.write(rec); err != nil {
+		return err
+	}
+	l.open++
+	if l.every > 0 && l.open >= l.every {
+		if err := l.checkpoint(); err != nil {
+			return err
+		}
+	}
+	if l.policy.due(l.size, l.created, time.Now()) {
+		return l.rotate()
+	}
+	return nil
+}
+
+// write chains rec to the previous record and writes it out.
+func (l *Log) write(rec *Record) error {
+	rec.Version = SchemaVersion
+	if rec.Time.IsZero() {
+		rec.Time = time.Now().UTC()
+	}
+	rec.Seq, rec.Prev = l.seq, l.prev
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	if _, err := l.f.Write(line); err != nil {
+		return err
+	}
+	if l.size == 0 {
+		l.created = rec.Time
+	}
+	l.size += int64(len(line))
+	l.seq, l.prev = l.seq+1, crypto.Keccak256Hash(line[:len(line)-1])
+	l.forward(rec.Level, line)
+	return nil
+}
+
+// checkpoint signs the current head of the chain and stores the checkpoint as
+// the head of the log. Without an audit key the records stay uncovered until
+// one is set.
+func (l *Log) checkpoint() error {
+	if l.key == nil {
+		return nil
+	}
+	sig, err := crypto.Sign(CheckpointHash(l.seq, l.prev).Bytes(), l.key)
+	if err != nil {
+		return err
+	}
+	l.open = 0
+	err = l.write(&Record{
+		Level:     "info",
+		Event:     EventCheckpoint,
+		Action:    "Checkpoint",
+		Auditor:   l.auditor.Hex(),
+		Signature: hexutil.Encode(sig),
+	})
+	if err != nil {
+		return err
+	}
+	return writeHead(l.f.Name(), Head{Seq: l.seq - 1, Hash: l.prev})
+}
+
+// CheckpointHash is the hash signed by a checkpoint written as record seq
+// following the line hashing to prev.
+func CheckpointHash(seq uint64, prev common.Hash) common.Hash {
+	var n [8]byte
+	binary.BigEndian.PutUint64(n[:], seq)
+	return crypto.Keccak256Hash([]byte("truekey audit checkpoint"), n[:], prev.Bytes())
+}
+
+// SetKey installs the key signing checkpoints and checkpoints the records
+// written so far. The log takes ownership of key and wipes the previous one, a
+// nil key stops checkpointing.
+func (l *Log) SetKey(key *ecdsa.PrivateKey) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.key != nil {
+		if l.f != nil && l.open > 0 {
+			if err := l.checkpoint(); err != nil {
+				log.Error("Audit log checkpoint failed", "err", err)
+			}
+		}
+		secret.WipeKey(l.key)
+	}
+	l.key, l.auditor = key, common.Address{}
+	if key == nil {
+		return
+	}
+	l.auditor = crypto.PubkeyToAddress(key.PublicKey)
+	log.Info("Audit log checkpoints signed", "auditor", l.auditor)
+	if l.f != nil && l.open > 0 {
+		if err := l.checkpoint(); err != nil {
+			log.Error("Audit log checkpoint failed", "err", err)
+		}
+	}
+}
+
+// Auditor returns the address checkpoints are currently signed with.
+func (l *Log) Auditor() common.Address {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.auditor
+}
+
+func (l *Log) loop(interval time.Duration) {
+	defer close(l.done)
+	if interval <= 0 {
+		<-l.quit
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			l.mu.Lock()
+			if l.open > 0 {
+				if err := l.checkpoint(); err != nil {
+					log.Error("Audit log checkpoint failed", "err", err)
+				}
+			}
+			if l.f != nil && l.policy.due(l.size, l.created, time.Now()) {
+				if err := l.rotate(); err != nil {
+					log.Error("Audit log rotation failed", "err", err)
+				}
+			}
+			l.mu.Unlock()
+		case <-l.quit:
+			return
+		}
+	}
+}
+
+// Close writes a final checkpoint, wipes the audit key and closes the file and
+// the forwarding sinks. It waits for running compression and retention.
+func (l *Log) Close() error {
+	close(l.quit)
+	<-l.done
+	l.pending.Wait()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return nil
+	}
+	var err error
+	if l.open > 0 {
+		err = l.checkpoint()
+	}
+	if l.key != nil {
+		secret.WipeKey(l.key)
+		l.key = nil
+	}
+	if cerr := l.f.Close(); err == nil {
+		err = cerr
+	}
+	l.f = nil
+	for _, s := range l.sinks {
+		s.Close()
+	}
+	l.sinks = nil
+	return err
+}
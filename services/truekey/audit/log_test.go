@@ -0,0 +1,247 @@
+package audit
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"ethereum/keyservice/common"
+	"ethereum/keyservice/crypto"
+	"ethereum/keyservice/log"
+)
+
+var testKey = []byte("0123456789abcdef0123456789abcdef")
+
+// writeLog writes n records to a fresh audit log, calls setKey and writes one
+// more record. It does so twice and returns the lines and the head of the log.
+func writeLog(t *testing.T, n int, setKey func(*Log)) ([]string, *Head) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "audit.log")
+
+	// Two runs, the second one resumes the chain left by the first.
+	for run := 0; run < 2; run++ {
+		l, err := Open(path, testKey, 3, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		logger := log.New("api", "signer")
+		logger.SetHandler(l)
+		for i := 0; i < n; i++ {
+			logger.Info("SignHash", "type", "request", "run", run, "i", i)
+		}
+		setKey(l)
+		logger.Info("SignHash", "type", "response", "run", run)
+		if err := l.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	head, err := ReadHead(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.SplitAfter(string(data), "\n")
+	return lines[:len(lines)-1], head
+}
+
+func verify(t *testing.T, lines []string, head *Head, auditors ...common.Address) *Report {
+	report, err := Verify(strings.NewReader(strings.Join(lines, "")), auditors, head)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return report
+}
+
+func TestVerify(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	auditor := crypto.PubkeyToAddress(key.PublicKey)
+	lines, head := writeLog(t, 4, func(l *Log) {
+		// The log wipes the key it is handed.
+		k, _ := crypto.ToECDSA(crypto.FromECDSA(key))
+		l.SetKey(k)
+		if l.Auditor() != auditor {
+			t.Fatalf("auditor: have %x, want %x", l.Auditor(), auditor)
+		}
+	})
+	if head == nil {
+		t.Fatal("no head stored")
+	}
+	report := verify(t, lines, head, auditor)
+	if !report.OK() || report.Records != 10 || report.Uncovered != 0 || len(report.Warnings) != 0 {
+		t.Fatalf("intact log: have %+v", report)
+	}
+	if report.Checkpoints == 0 || len(report.Auditors) != 1 || report.Auditors[0] != auditor {
+		t.Fatalf("checkpoints: have %+v", report)
+	}
+
+	other, _ := crypto.GenerateKey()
+	if report := verify(t, lines, head, crypto.PubkeyToAddress(other.PublicKey)); report.OK() {
+		t.Error("checkpoints of an unpinned auditor accepted")
+	}
+
+	tamper := map[string]func([]string) []string{
+		"edited": func(l []string) []string {
+			l[2] = strings.Replace(l[2], `"event":"request"`, `"event":"response"`, 1)
+			return l
+		},
+		"removed": func(l []string) []string {
+			return append(l[:2], l[3:]...)
+		},
+		"reordered": func(l []string) []string {
+			l[1], l[2] = l[2], l[1]
+			return l
+		},
+		"head truncated": func(l []string) []string {
+			return l[2:]
+		},
+		"forged checkpoint": func(l []string) []string {
+			// The last line is the final checkpoint, no record links to it.
+			last := len(l) - 1
+			i := strings.Index(l[last], `"signature":"0x`) + len(`"signature":"0x`)
+			l[last] = l[last][:i] + string("10"[l[last][i]&1]) + l[last][i+1:]
+			return l
+		},
+	}
+	for name, fn := range tamper {
+		changed := fn(append([]string{}, lines...))
+		if report := verify(t, changed, head, auditor); report.OK() {
+			t.Errorf("%s log passed verification", name)
+		}
+	}
+
+	// Records dropped from the tail up to the head are a problem, without the
+	// head they only show up as unsigned records.
+	tail := lines[:len(lines)-1]
+	if report := verify(t, tail, head, auditor); report.OK() {
+		t.Error("log truncated before its head passed verification")
+	}
+	if report := verify(t, tail, nil, auditor); !report.OK() || report.Uncovered == 0 {
+		t.Errorf("truncated tail without head: have %+v", report)
+	}
+}
+
+func TestVerifyUnsigned(t *testing.T) {
+	lines, head := writeLog(t, 2, func(*Log) {})
+	if head != nil {
+		t.Fatalf("head stored without checkpoints: %+v", head)
+	}
+	report := verify(t, lines, nil)
+	if !report.OK() || report.Checkpoints != 0 || report.Uncovered != report.Records || len(report.Warnings) != 1 {
+		t.Fatalf("unsigned log: have %+v", report)
+	}
+}
+
+func TestResume(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "audit.log")
+
+	// A log of the logfmt days is moved aside
+	legacy := "t=2018-01-01T00:00:00+0000 lvl=info msg=SignHash type=request\n"
+	if err := ioutil.WriteFile(path, []byte(legacy), 0600); err != nil {
+		t.Fatal(err)
+	}
+	l, err := Open(path, testKey, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+	if moved, _ := filepath.Glob(path + ".legacy-*"); len(moved) != 1 {
+		t.Fatalf("legacy log not moved aside: %v", moved)
+	}
+
+	// A torn last line restarts the chain
+	f, _ := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	f.WriteString(`{"v":1,"event":"request","seq":0,"pr`)
+	f.Close()
+	if l, err = Open(path, testKey, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+	data, _ := ioutil.ReadFile(path)
+	if lines := bytes.Count(data, []byte{'\n'}); lines != 2 {
+		t.Fatalf("lines: have %d, want 2", lines)
+	}
+	report, err := Verify(bytes.NewReader(data), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Problems) != 2 {
+		t.Fatalf("problems: have %q", report.Problems)
+	}
+}
+
+func TestRotate(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "audit.log")
+	copyPath := filepath.Join(dir, "forwarded.log")
+
+	key, _ := crypto.GenerateKey()
+	auditor := crypto.PubkeyToAddress(key.PublicKey)
+	l, err := Open(path, testKey, 5, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k, _ := crypto.ToECDSA(crypto.FromECDSA(key))
+	l.SetKey(k)
+	l.SetRotation(RotatePolicy{MaxSize: 2048, Compress: true, KeepFiles: 2})
+	forwarded, err := NewSink(Forward{Type: "file", Path: copyPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.SetSinks(map[string]Sink{"file": forwarded})
+
+	logger := log.New("api", "signer")
+	logger.SetHandler(l)
+	for i := 0; i < 100; i++ {
+		logger.Info("SignHash", "type", "request", "i", i)
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := Files(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 3 || !strings.HasSuffix(files[0], ".gz") || !strings.HasSuffix(files[1], ".gz") {
+		t.Fatalf("files: have %v, want two compressed rotated files and the log", files)
+	}
+	head, err := ReadHead(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := VerifyFiles(files, []common.Address{auditor}, head)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK() || len(report.Warnings) != 1 || !strings.Contains(report.Warnings[0], "removed by retention") {
+		t.Fatalf("rotated log: have %+v", report)
+	}
+	// Without the retention record the missing start is a problem
+	if report, _ := VerifyFiles(files[:2], []common.Address{auditor}, nil); report.OK() {
+		t.Error("log missing its start passed verification")
+	}
+	// Nor is dropping the current file
+	if report, _ := VerifyFiles(files[:2], []common.Address{auditor}, head); report.OK() {
+		t.Error("log missing its current file passed verification")
+	}
+
+	// The forwarded copy holds every record, including the removed ones
+	data, err := ioutil.ReadFile(copyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err = Verify(bytes.NewReader(data), []common.Address{auditor}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK() || report.Uncovered != 0 || report.Records < 100 {
+		t.Fatalf("forwarded copy: have %+v", report)
+	}
+}
@@ -0,0 +1,199 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package audit
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"ethereum/keyservice/common"
+	"ethereum/keyservice/log"
+)
+
+// SchemaVersion is the version of the audit record schema. It is raised when a
+// field is removed or changes its meaning, new fields keep the version.
+const SchemaVersion = 1
+
+// Record is a line of the audit log.
+type Record struct {
+	Version   int                    `json:"v"`
+	Time      time.Time              `json:"time"`
+	Level     string                 `json:"level"`
+	API       string                 `json:"api,omitempty"`       // signer or admin
+	Event     string                 `json:"event"`               // request, response, checkpoint, config, seal, ...
+	Action    string                 `json:"action"`              // method called or what happened
+	RequestID string                 `json:"requestId,omitempty"` // pairs a request with its response
+	Caller    *Caller                `json:"caller,omitempty"`
+	Root      string                 `json:"root,omitempty"`
+	UserID    string                 `json:"userId,omitempty"` // pseudonymized unless redaction says otherwise
+	Tx        *Tx                    `json:"tx,omitempty"`
+	Decision  string                 `json:"decision,omitempty"` // approve, reject or escalate
+	Code      string                 `json:"code,omitempty"`     // result code, as in the metrics
+	Error     string                 `json:"error,omitempty"`
+	Admins    []string               `json:"admins,omitempty"`
+	Fields    map[string]interface{} `json:"fields,omitempty"`
+
+	// Checkpoints only
+	Auditor   string `json:"auditor,omitempty"`
+	Signature string `json:"signature,omitempty"`
+
+	// The chain, always last
+	Seq  uint64      `json:"seq"`
+	Prev common.Hash `json:"prev"`
+}
+
+// Caller describes where a call came from.
+type Caller struct {
+	Remote    string `json:"remote,omitempty"`
+	Local     string `json:"local,omitempty"`
+	Scheme    string `json:"scheme,omitempty"`
+	UserAgent string `json:"userAgent,omitempty"`
+	Origin    string `json:"origin,omitempty"`
+}
+
+// Tx summarizes a transaction without its payload.
+type Tx struct {
+	Hash     *common.Hash    `json:"hash,omitempty"`
+	From     *common.Address `json:"from,omitempty"`
+	To       *common.Address `json:"to,omitempty"`
+	Value    string          `json:"value,omitempty"`
+	Nonce    *uint64         `json:"nonce,omitempty"`
+	GasPrice uint64          `json:"gasPrice,omitempty"`
+	GasLimit uint64          `json:"gasLimit,omitempty"`
+	ChainID  uint64          `json:"chainId,omitempty"`
+	DataLen  int             `json:"dataLen,omitempty"`
+	Selector string          `json:"selector,omitempty"` // first four bytes of the data
+}
+
+// NewRequestID returns a random id pairing a request with its response.
+func NewRequestID() string {
+	var id [8]byte
+	rand.Read(id[:])
+	return hex.EncodeToString(id[:])
+}
+
+// levels names the log levels in records.
+var levels = map[log.Lvl]string{
+	log.LvlCrit:  "crit",
+	log.LvlError: "error",
+	log.LvlWarn:  "warn",
+	log.LvlInfo:  "info",
+	log.LvlDebug: "debug",
+	log.LvlTrace: "trace",
+}
+
+// newRecord converts a log record into an audit record. Context keys of the
+// schema fill its fields, any other key ends up in Fields.
+func newRecord(r *log.Record) *Record {
+	rec := &Record{
+		Version: SchemaVersion,
+		Time:    r.Time.UTC(),
+		Level:   levels[r.Lvl],
+		Action:  r.Msg,
+	}
+	for i := 0; i+1 < len(r.Ctx); i += 2 {
+		key, ok := r.Ctx[i].(string)
+		if !ok {
+			key = fmt.Sprint(r.Ctx[i])
+		}
+		switch v := r.Ctx[i+1]; key {
+		case "api":
+			rec.API = str(v)
+		case "type":
+			rec.Event = str(v)
+		case "requestId":
+			rec.RequestID = str(v)
+		case "metadata", "caller":
+			switch c := v.(type) {
+			case Caller:
+				rec.Caller = &c
+			case *Caller:
+				rec.Caller = c
+			default:
+				rec.field(key, v)
+			}
+		case "root":
+			rec.Root = str(v)
+		case "userId":
+			rec.UserID = str(v)
+		case "tx":
+			switch tx := v.(type) {
+			case Tx:
+				rec.Tx = &tx
+			case *Tx:
+				rec.Tx = tx
+			default:
+				rec.field(key, v)
+			}
+		case "decision":
+			rec.Decision = str(v)
+		case "code":
+			rec.Code = str(v)
+		case "error", "err":
+			rec.Error = str(v)
+		case "admins":
+			switch admins := v.(type) {
+			case []common.Address:
+				for _, admin := range admins {
+					rec.Admins = append(rec.Admins, admin.Hex())
+				}
+			case []string:
+				rec.Admins = admins
+			default:
+				rec.field(key, v)
+			}
+		default:
+			rec.field(key, v)
+		}
+	}
+	return rec
+}
+
+func (rec *Record) field(key string, v interface{}) {
+	if rec.Fields == nil {
+		rec.Fields = make(map[string]interface{})
+	}
+	switch v := v.(type) {
+	case error:
+		rec.Fields[key] = v.Error()
+	case fmt.Stringer:
+		rec.Fields[key] = v.String()
+	default:
+		rec.Fields[key] = v
+	}
+}
+
+// str renders a context value, nil and nil errors as the empty string.
+func str(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case error:
+		if v == nil {
+			return ""
+		}
+		return v.Error()
+	case common.Address:
+		return v.Hex()
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,203 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package audit
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"ethereum/keyservice/common"
+)
+
+// Redaction actions.
+const (
+	Keep = "keep" // written as is
+	Drop = "drop" // left out
+	Hash = "hash" // replaced by a keyed hash, equal values stay linkable
+	Mask = "mask" // all but the last four characters replaced by '*'
+)
+
+// DefaultRedaction applies to the fields the config does not mention. User ids
+// are pseudonymized, payloads, signatures and secrets never written.
+var DefaultRedaction = map[string]string{
+	"userId":       Hash,
+	"encryMessage": Drop,
+	"quest":        Drop,
+	"auth":         Drop,
+	"data":         Drop,
+	"signed":       Drop,
+	"signature":    Drop,
+	"share":        Drop,
+	"passphrase":   Drop,
+	"password":     Drop,
+	"seed":         Drop,
+	"mnemonic":     Drop,
+	"key":          Drop,
+	"privateKey":   Drop,
+}
+
+// redactable are the schema fields redaction rules may name, next to the
+// names of extra fields.
+var redactable = map[string]bool{
+	"root": true, "userId": true, "error": true,
+	"caller.remote": true, "caller.local": true, "caller.userAgent": true, "caller.origin": true,
+	"tx.from": true, "tx.to": true, "tx.value": true, "tx.hash": true,
+}
+
+// CheckRedaction validates redaction rules from the config.
+func CheckRedaction(rules map[string]string) error {
+	for field, action := range rules {
+		switch action {
+		case Keep, Drop, Hash, Mask:
+		default:
+			return fmt.Errorf("%s: unknown action %q, want keep, drop, hash or mask", field, action)
+		}
+		if field == "" || strings.Contains(field, ".") && !redactable[field] {
+			return fmt.Errorf("%s: not a field that can be redacted", field)
+		}
+	}
+	return nil
+}
+
+// Redactor applies redaction rules to records before they are written.
+type Redactor struct {
+	rules map[string]string
+	key   []byte
+}
+
+// NewRedactor combines rules with DefaultRedaction. key keys the hash action.
+func NewRedactor(rules map[string]string, key []byte) *Redactor {
+	r := &Redactor{rules: make(map[string]string), key: key}
+	for field, action := range DefaultRedaction {
+		r.rules[field] = action
+	}
+	for field, action := range rules {
+		r.rules[field] = action
+	}
+	return r
+}
+
+// Pseudonym returns the keyed hash a value is replaced with.
+func (r *Redactor) Pseudonym(value string) string {
+	mac := hmac.New(sha256.New, r.key)
+	mac.Write([]byte(value))
+	return "h:" + hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// apply redacts s according to the rule for field, dropping it leaves it empty.
+func (r *Redactor) apply(field, s string) string {
+	if s == "" {
+		return s
+	}
+	switch r.rules[field] {
+	case "", Keep:
+		return s
+	case Hash:
+		return r.Pseudonym(s)
+	case Mask:
+		if len(s) <= 4 {
+			return strings.Repeat("*", len(s))
+		}
+		return strings.Repeat("*", len(s)-4) + s[len(s)-4:]
+	}
+	// Drop, and unknown actions of an unchecked config
+	return ""
+}
+
+func (r *Redactor) string(field string, s *string) {
+	*s = r.apply(field, *s)
+}
+
+// Redact rewrites rec in place.
+func (r *Redactor) Redact(rec *Record) {
+	r.string("root", &rec.Root)
+	r.string("userId", &rec.UserID)
+	r.string("error", &rec.Error)
+	// Caller and Tx may be shared with the logger, redact copies
+	if rec.Caller != nil {
+		caller := *rec.Caller
+		r.string("caller.remote", &caller.Remote)
+		r.string("caller.local", &caller.Local)
+		r.string("caller.userAgent", &caller.UserAgent)
+		r.string("caller.origin", &caller.Origin)
+		rec.Caller = &caller
+	}
+	if rec.Tx != nil {
+		tx := *rec.Tx
+		tx.From, tx.To = r.address("tx.from", tx.From), r.address("tx.to", tx.To)
+		if r.rules["tx.hash"] != "" && r.rules["tx.hash"] != Keep {
+			tx.Hash = nil
+		}
+		r.string("tx.value", &tx.Value)
+		rec.Tx = &tx
+	}
+	if len(rec.Fields) > 0 {
+		fields := make(map[string]interface{}, len(rec.Fields))
+		for name, v := range rec.Fields {
+			if action := r.rules[name]; action != "" && action != Keep {
+				if v = r.apply(name, fmt.Sprint(v)); v == "" {
+					continue
+				}
+			}
+			fields[name] = v
+		}
+		rec.Fields = fields
+	}
+}
+
+// address redacts a transaction address. Pseudonyms and masks do not fit an
+// address, so anything but keep drops it.
+func (r *Redactor) address(field string, addr *common.Address) *common.Address {
+	if addr == nil || r.rules[field] == "" || r.rules[field] == Keep {
+		return addr
+	}
+	return nil
+}
+
+// LoadPseudonymKey reads the key of the hash action from path, creating a
+// random one on first use. Losing it makes old and new pseudonyms unlinkable.
+func LoadPseudonymKey(path string) ([]byte, error) {
+	key, err := ioutil.ReadFile(path)
+	if err == nil {
+		if len(key) != 32 {
+			return nil, fmt.Errorf("%s: pseudonym key is %d bytes, want 32", path, len(key))
+		}
+		return key, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+	key = make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0400)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if _, err := f.Write(key); err != nil {
+		return nil, err
+	}
+	return key, f.Sync()
+}
@@ -0,0 +1,54 @@
+package audit
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"ethereum/keyservice/common"
+	"ethereum/keyservice/log"
+)
+
+func TestRedact(t *testing.T) {
+	to := common.HexToAddress("0x01")
+	r := &log.Record{Time: time.Now(), Lvl: log.LvlError, Msg: "SignHashPlain", Ctx: []interface{}{
+		"api", "signer",
+		"type", "response",
+		"requestId", "0011",
+		"metadata", Caller{Remote: "10.0.0.1:5000", UserAgent: "curl"},
+		"root", to,
+		"userId", uint64(13800000000),
+		"tx", &Tx{To: &to, Value: "1"},
+		"error", errors.New("limit exceeded"),
+		"encryMessage", "secret",
+		"reason", "13800000000",
+		"count", 3,
+	}}
+	rec := newRecord(r)
+	NewRedactor(map[string]string{"reason": Mask, "caller.remote": Drop, "tx.to": Drop}, testKey).Redact(rec)
+
+	switch {
+	case rec.API != "signer" || rec.Event != "response" || rec.Action != "SignHashPlain" || rec.Level != "error" || rec.RequestID != "0011":
+		t.Errorf("schema fields: have %+v", rec)
+	case rec.Root != to.Hex() || rec.Error != "limit exceeded":
+		t.Errorf("root and error: have %q %q", rec.Root, rec.Error)
+	case rec.UserID != NewRedactor(nil, testKey).Pseudonym("13800000000"):
+		t.Errorf("userId not pseudonymized: %q", rec.UserID)
+	case rec.Caller.Remote != "" || rec.Caller.UserAgent != "curl":
+		t.Errorf("caller: have %+v", rec.Caller)
+	case rec.Tx.To != nil || rec.Tx.Value != "1":
+		t.Errorf("tx: have %+v", rec.Tx)
+	case rec.Fields["encryMessage"] != nil || rec.Fields["reason"] != "*******0000" || rec.Fields["count"] != 3:
+		t.Errorf("fields: have %v", rec.Fields)
+	}
+	if pseudonym := NewRedactor(nil, []byte("another key")).Pseudonym("13800000000"); pseudonym == rec.UserID {
+		t.Error("pseudonym does not depend on the key")
+	}
+
+	if err := CheckRedaction(map[string]string{"userId": "encrypt"}); err == nil {
+		t.Error("unknown action accepted")
+	}
+	if err := CheckRedaction(map[string]string{"caller.cookie": Drop}); err == nil {
+		t.Error("unknown schema field accepted")
+	}
+}
@@ -0,0 +1,312 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package audit
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"ethereum/keyservice/common"
+	"ethereum/keyservice/crypto"
+	"ethereum/keyservice/log"
+)
+
+// rotatedLayout is appended to the name of a rotated file. Names sort in the
+// order the files were rotated.
+const rotatedLayout = "2006-01-02T15-04-05.000000000"
+
+// RotatePolicy says when the log file is rotated and how long rotated files are
+// kept. Zero values disable the respective rule.
+type RotatePolicy struct {
+	MaxSize   int64         // rotate once the file holds this many bytes
+	Interval  time.Duration // rotate once the first record of the file is this old
+	Compress  bool          // gzip rotated files
+	KeepFiles int           // number of rotated files kept
+	KeepAge   time.Duration // remove rotated files rotated longer ago
+}
+
+// due reports whether a file of size bytes, whose first record was written at
+// created, is to be rotated.
+func (p RotatePolicy) due(size int64, created, now time.Time) bool {
+	if size == 0 {
+		return false
+	}
+	return p.MaxSize > 0 && size >= p.MaxSize || p.Interval > 0 && !created.IsZero() && now.Sub(created) >= p.Interval
+}
+
+// SetRotation installs the rotation and retention policy and applies it to the
+// files rotated before.
+func (l *Log) SetRotation(p RotatePolicy) {
+	l.mu.Lock()
+	l.policy = p
+	l.mu.Unlock()
+
+	l.pending.Add(1)
+	go func() {
+		defer l.pending.Done()
+		l.maintain()
+	}()
+}
+
+// rotate checkpoints and renames the current file and continues the chain in a
+// new one. The caller holds mu.
+func (l *Log) rotate() error {
+	if l.open > 0 {
+		if err := l.checkpoint(); err != nil {
+			return err
+		}
+	}
+	if err := l.f.Sync(); err != nil {
+		return err
+	}
+	path := l.f.Name()
+	rotated := path + "." + time.Now().UTC().Format(rotatedLayout)
+	if err := os.Rename(path, rotated); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		// Keep appending to the old file rather than losing records
+		if rerr := os.Rename(rotated, path); rerr != nil {
+			log.Error("Audit log file lost its name", "file", rotated, "err", rerr)
+		}
+		return err
+	}
+	l.f.Close()
+	l.f, l.size, l.created = f, 0, time.Time{}
+	log.Info("Audit log rotated", "file", rotated)
+
+	l.open++
+	err = l.write(&Record{
+		Level:  "info",
+		Event:  EventRotated,
+		Action: "Log rotated",
+		Fields: map[string]interface{}{"previous": filepath.Base(rotated)},
+	})
+	select {
+	case <-l.quit:
+	default:
+		l.pending.Add(1)
+		go func() {
+			defer l.pending.Done()
+			l.maintain()
+		}()
+	}
+	return err
+}
+
+// rotatedFile is a file rotated out of the log.
+type rotatedFile struct {
+	name    string
+	rotated time.Time
+}
+
+// rotatedFiles lists the files rotated out of the log at path, oldest first.
+func rotatedFiles(path string) ([]rotatedFile, error) {
+	names, err := filepath.Glob(path + ".*")
+	if err != nil {
+		return nil, err
+	}
+	var (
+		files []rotatedFile
+		seen  = make(map[string]bool)
+	)
+	sort.Strings(names)
+	for _, name := range names {
+		plain := strings.TrimSuffix(name, ".gz")
+		rotated, err := time.Parse(rotatedLayout, strings.TrimPrefix(plain, path+"."))
+		if err != nil {
+			continue // legacy logs, unfinished compressions
+		}
+		// A file left uncompressed next to its compressed copy by a crash is
+		// the complete one.
+		if seen[plain] {
+			continue
+		}
+		seen[plain] = true
+		files = append(files, rotatedFile{name, rotated})
+	}
+	return files, nil
+}
+
+// Files returns the files of the log at path in the order of its chain: the
+// rotated files, oldest first, and path itself.
+func Files(path string) ([]string, error) {
+	rotated, err := rotatedFiles(path)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, file := range rotated {
+		files = append(files, file.name)
+	}
+	return append(files, path), nil
+}
+
+// OpenFile opens a file of the log, decompressing rotated files.
+func OpenFile(name string) (io.ReadCloser, error) {
+	f, err := os.Open(name)
+	if err != nil || !strings.HasSuffix(name, ".gz") {
+		return f, err
+	}
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{zr, f}, nil
+}
+
+// maintain compresses rotated files and removes those past retention. It runs
+// in the background, compressing a large file takes a while.
+func (l *Log) maintain() {
+	l.maint.Lock()
+	defer l.maint.Unlock()
+
+	l.mu.Lock()
+	if l.f == nil {
+		l.mu.Unlock()
+		return
+	}
+	policy, path := l.policy, l.f.Name()
+	l.mu.Unlock()
+
+	files, err := rotatedFiles(path)
+	if err != nil {
+		log.Error("Failed to list rotated audit logs", "err", err)
+		return
+	}
+	if policy.Compress {
+		for i, file := range files {
+			if strings.HasSuffix(file.name, ".gz") {
+				continue
+			}
+			if err := compress(file.name); err != nil {
+				log.Error("Audit log compression failed", "file", file.name, "err", err)
+				continue
+			}
+			files[i].name += ".gz"
+		}
+	}
+	if err := l.retain(files, policy, time.Now()); err != nil {
+		log.Error("Audit log retention failed", "err", err)
+	}
+}
+
+// compress replaces name by a gzipped copy.
+func compress(name string) error {
+	in, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp := name + ".gz.tmp"
+	out, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(out)
+	if _, err = io.Copy(zw, in); err == nil {
+		if err = zw.Close(); err == nil {
+			err = out.Sync()
+		}
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, name+".gz")
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Remove(name)
+}
+
+// retain removes the oldest rotated files beyond the policy. Before they go a
+// retention record notes the head of the chain they end in, so the remaining
+// files verify as a log whose start was removed on purpose.
+func (l *Log) retain(files []rotatedFile, policy RotatePolicy, now time.Time) error {
+	var remove []rotatedFile
+	for i, file := range files {
+		if policy.KeepFiles > 0 && len(files)-i > policy.KeepFiles || policy.KeepAge > 0 && now.Sub(file.rotated) > policy.KeepAge {
+			remove = append(remove, file)
+		}
+	}
+	if len(remove) == 0 {
+		return nil
+	}
+	newest := remove[len(remove)-1].name
+	f, err := OpenFile(newest)
+	if err != nil {
+		return err
+	}
+	_, last, torn, err := scanLines(f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	var chain chainFields
+	if torn || json.Unmarshal(last, &chain) != nil || chain.Seq == nil {
+		return fmt.Errorf("%s: last record unreadable, keeping the file", newest)
+	}
+	names := make([]string, len(remove))
+	for i, file := range remove {
+		names[i] = filepath.Base(file.name)
+	}
+	l.mu.Lock()
+	if l.f == nil {
+		l.mu.Unlock()
+		return nil
+	}
+	l.open++
+	err = l.write(&Record{
+		Level:  "info",
+		Event:  EventRetention,
+		Action: "Rotated logs removed",
+		Fields: map[string]interface{}{"removed": names, "seq": *chain.Seq, "head": crypto.Keccak256Hash(last)},
+	})
+	l.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	for _, file := range remove {
+		if err := os.Remove(file.name); err != nil {
+			return err
+		}
+	}
+	log.Info("Removed rotated audit logs", "files", len(remove), "seq", *chain.Seq)
+	return nil
+}
+
+// retainedHead is what a retention record says about the removed files.
+type retainedHead struct {
+	Seq  *uint64      `json:"seq"`
+	Head *common.Hash `json:"head"`
+}
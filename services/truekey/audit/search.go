@@ -0,0 +1,359 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"ethereum/keyservice/common"
+	"ethereum/keyservice/common/hexutil"
+)
+
+// Query selects audit records. Unset fields match every record.
+type Query struct {
+	From    time.Time       `json:"from,omitempty"`    // written at or after
+	To      time.Time       `json:"to,omitempty"`      // written before
+	Method  string          `json:"method,omitempty"`  // e.g. SignHashPlain or truekey_signHashPlain
+	Root    *common.Address `json:"root,omitempty"`    //
+	UserID  string          `json:"userId,omitempty"`  // as the dapp sends it, matched in its redacted form
+	Address *common.Address `json:"address,omitempty"` // sender, recipient or registered account
+	TxHash  *common.Hash    `json:"txHash,omitempty"`  //
+	Remote  string          `json:"remote,omitempty"`  // caller IP or CIDR range
+	Outcome string          `json:"outcome,omitempty"` // result code or decision, e.g. ok or reject
+	Limit   int             `json:"limit,omitempty"`   // stop after as many matches
+}
+
+// QueryFields are the names Set accepts, as used by the command line flags.
+var QueryFields = []string{"from", "to", "method", "root", "userid", "address", "txhash", "remote", "outcome", "limit"}
+
+// Set sets the query field named by one of QueryFields from its text form.
+func (q *Query) Set(field, value string) error {
+	var err error
+	switch field {
+	case "from":
+		q.From, err = ParseTime(value)
+	case "to":
+		q.To, err = ParseTime(value)
+	case "method":
+		q.Method = value
+	case "root", "address":
+		if !common.IsHexAddress(value) {
+			return fmt.Errorf("%s: invalid address %q", field, value)
+		}
+		addr := common.HexToAddress(value)
+		if field == "root" {
+			q.Root = &addr
+		} else {
+			q.Address = &addr
+		}
+	case "userid":
+		q.UserID = value
+	case "txhash":
+		b, derr := hexutil.Decode(value)
+		if derr != nil || len(b) != common.HashLength {
+			return fmt.Errorf("txhash: invalid hash %q", value)
+		}
+		hash := common.BytesToHash(b)
+		q.TxHash = &hash
+	case "remote":
+		q.Remote = value
+	case "outcome":
+		q.Outcome = value
+	case "limit":
+		q.Limit, err = strconv.Atoi(value)
+	default:
+		return fmt.Errorf("unknown query field %q", field)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %v", field, err)
+	}
+	return nil
+}
+
+// ErrStopSearch returned by a search callback ends the search without error.
+var ErrStopSearch = errors.New("search stopped")
+
+// matcher is a query prepared to match records as they were written.
+type matcher struct {
+	q       Query
+	method  string
+	roots   []string
+	userIDs []string
+	ip      net.IP
+	ipNet   *net.IPNet
+}
+
+func newMatcher(q Query, r *Redactor) (*matcher, error) {
+	m := &matcher{q: q, method: q.Method}
+	if i := strings.IndexByte(m.method, '_'); i >= 0 {
+		m.method = m.method[i+1:]
+	}
+	// Redacted fields are matched in the written form under the current
+	// rules, the plain one and, for user ids, the pseudonym.
+	if q.Root != nil {
+		m.roots = []string{q.Root.Hex(), r.apply("root", q.Root.Hex())}
+	}
+	if q.UserID != "" {
+		m.userIDs = []string{q.UserID, r.apply("userId", q.UserID), r.Pseudonym(q.UserID)}
+	}
+	if q.Remote != "" {
+		if strings.Contains(q.Remote, "/") {
+			_, ipNet, err := net.ParseCIDR(q.Remote)
+			if err != nil {
+				return nil, fmt.Errorf("remote: %v", err)
+			}
+			m.ipNet = ipNet
+		} else if m.ip = net.ParseIP(q.Remote); m.ip == nil {
+			return nil, fmt.Errorf("remote: %q is neither an IP address nor a CIDR range", q.Remote)
+		}
+	}
+	return m, nil
+}
+
+func anyEqualFold(s string, candidates []string) bool {
+	for _, c := range candidates {
+		if c != "" && strings.EqualFold(s, c) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *matcher) match(rec *Record) bool {
+	q := m.q
+	switch {
+	case !q.From.IsZero() && rec.Time.Before(q.From):
+		return false
+	case !q.To.IsZero() && !rec.Time.Before(q.To):
+		return false
+	case m.method != "" && !strings.EqualFold(rec.Action, m.method):
+		return false
+	case m.roots != nil && !anyEqualFold(rec.Root, m.roots):
+		return false
+	case m.userIDs != nil && (rec.UserID == "" || !anyEqualFold(rec.UserID, m.userIDs)):
+		return false
+	case q.Outcome != "" && !strings.EqualFold(rec.Code, q.Outcome) && !strings.EqualFold(rec.Decision, q.Outcome):
+		return false
+	}
+	if q.Address != nil && !m.matchAddress(rec, *q.Address) {
+		return false
+	}
+	if q.TxHash != nil && (rec.Tx == nil || rec.Tx.Hash == nil || *rec.Tx.Hash != *q.TxHash) {
+		return false
+	}
+	if m.ip != nil || m.ipNet != nil {
+		if rec.Caller == nil {
+			return false
+		}
+		host := rec.Caller.Remote
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		ip := net.ParseIP(host)
+		if ip == nil || m.ip != nil && !m.ip.Equal(ip) || m.ipNet != nil && !m.ipNet.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *matcher) matchAddress(rec *Record, addr common.Address) bool {
+	if rec.Tx != nil && (rec.Tx.From != nil && *rec.Tx.From == addr || rec.Tx.To != nil && *rec.Tx.To == addr) {
+		return true
+	}
+	s, ok := rec.Fields["address"].(string)
+	return ok && strings.EqualFold(s, addr.Hex())
+}
+
+// Search calls fn with every record of files matching q, in the order of the
+// files, along with the line as written. Rotated files before q.From are
+// skipped and files removed while searching are ignored. r redacts the query
+// the way the records were redacted.
+func Search(files []string, q Query, r *Redactor, fn func(rec *Record, line []byte) error) error {
+	m, err := newMatcher(q, r)
+	if err != nil {
+		return err
+	}
+	matches := 0
+	for _, name := range files {
+		if rotated, ok := rotationTime(name); ok && !q.From.IsZero() && rotated.Before(q.From) {
+			continue
+		}
+		f, err := OpenFile(name)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		err = searchFile(f, m, func(rec *Record, line []byte) error {
+			matches++
+			if err := fn(rec, line); err != nil {
+				return err
+			}
+			if q.Limit > 0 && matches >= q.Limit {
+				return ErrStopSearch
+			}
+			return nil
+		})
+		f.Close()
+		if err == ErrStopSearch {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// rotationTime parses the time a rotated file was rotated from its name.
+func rotationTime(name string) (time.Time, bool) {
+	plain := strings.TrimSuffix(name, ".gz")
+	n := len(rotatedLayout) // formatted times are as long as the layout
+	if len(plain) <= n || plain[len(plain)-n-1] != '.' {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(rotatedLayout, plain[len(plain)-n:])
+	return t, err == nil
+}
+
+func searchFile(r io.Reader, m *matcher, fn func(*Record, []byte) error) error {
+	in := bufio.NewReader(r)
+	for {
+		line, err := in.ReadBytes('\n')
+		if len(line) > 0 {
+			line = bytes.TrimSuffix(line, []byte{'\n'})
+			var rec Record
+			if json.Unmarshal(line, &rec) == nil && m.match(&rec) {
+				if err := fn(&rec, line); err != nil {
+					return err
+				}
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Search searches the log and the files rotated out of it.
+func (l *Log) Search(q Query, fn func(rec *Record, line []byte) error) error {
+	l.mu.Lock()
+	if l.f == nil {
+		l.mu.Unlock()
+		return errors.New("audit log closed")
+	}
+	path, r := l.f.Name(), l.redact
+	l.mu.Unlock()
+
+	files, err := Files(path)
+	if err != nil {
+		return err
+	}
+	return Search(files, q, r, fn)
+}
+
+// Export formats.
+const (
+	FormatJSONL = "jsonl" // the records as written, which keeps them verifiable
+	FormatCSV   = "csv"
+)
+
+// csvHeader are the columns of the CSV export.
+var csvHeader = []string{
+	"time", "level", "api", "event", "action", "requestId", "remote", "root", "userId",
+	"txHash", "from", "to", "value", "selector", "decision", "code", "error", "seq",
+}
+
+// Exporter writes records as CSV or JSON lines.
+type Exporter struct {
+	w   io.Writer
+	csv *csv.Writer
+}
+
+// NewExporter returns an exporter writing format to w.
+func NewExporter(w io.Writer, format string) (*Exporter, error) {
+	switch format {
+	case FormatJSONL:
+		return &Exporter{w: w}, nil
+	case FormatCSV:
+		e := &Exporter{w: w, csv: csv.NewWriter(w)}
+		return e, e.csv.Write(csvHeader)
+	}
+	return nil, fmt.Errorf("unknown export format %q, want %s or %s", format, FormatCSV, FormatJSONL)
+}
+
+// Write exports a record, line is the record as written.
+func (e *Exporter) Write(rec *Record, line []byte) error {
+	if e.csv == nil {
+		_, err := e.w.Write(append(line[:len(line):len(line)], '\n'))
+		return err
+	}
+	var remote, hash, from, to, value, selector string
+	if rec.Caller != nil {
+		remote = rec.Caller.Remote
+	}
+	if tx := rec.Tx; tx != nil {
+		if tx.Hash != nil {
+			hash = tx.Hash.Hex()
+		}
+		if tx.From != nil {
+			from = tx.From.Hex()
+		}
+		if tx.To != nil {
+			to = tx.To.Hex()
+		}
+		value, selector = tx.Value, tx.Selector
+	}
+	return e.csv.Write([]string{
+		rec.Time.UTC().Format(time.RFC3339Nano), rec.Level, rec.API, rec.Event, rec.Action, rec.RequestID, remote, rec.Root, rec.UserID,
+		hash, from, to, value, selector, rec.Decision, rec.Code, rec.Error, strconv.FormatUint(rec.Seq, 10),
+	})
+}
+
+// Flush writes out buffered records.
+func (e *Exporter) Flush() error {
+	if e.csv == nil {
+		return nil
+	}
+	e.csv.Flush()
+	return e.csv.Error()
+}
+
+// ParseTime parses the bounds of a query: RFC 3339 times, or dates and
+// minutes in UTC.
+func ParseTime(s string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04", "2006-01-02"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q, want e.g. 2006-01-02 or 2006-01-02T15:04:05Z", s)
+}
@@ -0,0 +1,95 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/csv"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"ethereum/keyservice/common"
+	"ethereum/keyservice/log"
+)
+
+func TestSearch(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "audit.log")
+
+	l, err := Open(path, testKey, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	from, to, hash := common.HexToAddress("0x0a"), common.HexToAddress("0x0b"), common.HexToHash("0x0c")
+	logger := log.New("api", "signer")
+	logger.SetHandler(l)
+	logger.Info("SignHashPlain", "type", "request", "metadata", Caller{Remote: "10.0.0.1:5000"}, "userId", 13800000000)
+	logger.Info("SignHashPlain", "type", "response", "userId", 13800000000, "tx", &Tx{Hash: &hash, From: &from}, "code", "ok", "decision", "approve")
+	logger.Info("RegisterAccount", "type", "request", "metadata", Caller{Remote: "192.168.1.7:5000"}, "userId", 13800000001)
+	logger.Info("RegisterAccount", "type", "response", "userId", 13800000001, "address", to, "code", "policy_rejected", "decision", "reject")
+	// Later records go to a rotated file
+	l.SetRotation(RotatePolicy{MaxSize: 1})
+	logger.Info("Version", "type", "request")
+	l.Close()
+
+	files, err := Files(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	search := func(set ...string) []*Record {
+		var q Query
+		for i := 0; i < len(set); i += 2 {
+			if err := q.Set(set[i], set[i+1]); err != nil {
+				t.Fatal(err)
+			}
+		}
+		var found []*Record
+		if err := Search(files, q, NewRedactor(nil, testKey), func(rec *Record, line []byte) error {
+			found = append(found, rec)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		return found
+	}
+	tests := []struct {
+		query []string
+		want  int
+	}{
+		{nil, 6}, // the records and the first record of the file after rotation
+		{[]string{"method", "truekey_signHashPlain"}, 2},
+		{[]string{"userid", "13800000001"}, 2},
+		{[]string{"userid", "13800000001", "outcome", "reject"}, 1},
+		{[]string{"remote", "10.0.0.0/8"}, 1},
+		{[]string{"remote", "192.168.1.7"}, 1},
+		{[]string{"address", from.Hex()}, 1},
+		{[]string{"address", to.Hex()}, 1},
+		{[]string{"txhash", hash.Hex()}, 1},
+		{[]string{"outcome", "ok"}, 1},
+		{[]string{"from", time.Now().Add(time.Hour).UTC().Format(time.RFC3339)}, 0},
+		{[]string{"to", "2000-01-01"}, 0},
+		{[]string{"limit", "3"}, 3},
+	}
+	for _, test := range tests {
+		if found := search(test.query...); len(found) != test.want {
+			t.Errorf("%v: have %d records, want %d", test.query, len(found), test.want)
+		}
+	}
+
+	var buf bytes.Buffer
+	exporter, err := NewExporter(&buf, FormatCSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Search(files, Query{TxHash: &hash}, NewRedactor(nil, testKey), exporter.Write); err != nil {
+		t.Fatal(err)
+	}
+	exporter.Flush()
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil || len(rows) != 2 || rows[1][9] != hash.Hex() || rows[1][10] != from.Hex() || rows[1][15] != "ok" {
+		t.Fatalf("csv export: have %q %v", rows, err)
+	}
+	if strings.Contains(strings.Join(rows[1], ","), "13800000000") {
+		t.Error("user id exported in the clear")
+	}
+}
@@ -0,0 +1,156 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package audit
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"ethereum/keyservice/log"
+)
+
+// Forward configures a copy of the log kept elsewhere.
+type Forward struct {
+	Type    string `json:"type"`              // syslog or file
+	Network string `json:"network,omitempty"` // syslog: empty for the local daemon, udp or tcp
+	Addr    string `json:"addr,omitempty"`    // syslog: host:port of a remote daemon
+	Tag     string `json:"tag,omitempty"`     // syslog: tag of the messages, truekey by default
+	Path    string `json:"path,omitempty"`    // file: the file appended to
+}
+
+func (f Forward) String() string {
+	switch {
+	case f.Type == "file":
+		return "file " + f.Path
+	case f.Network != "":
+		return fmt.Sprintf("syslog %s://%s", f.Network, f.Addr)
+	}
+	return "syslog"
+}
+
+// CheckForward validates a forwarding config.
+func CheckForward(f Forward) error {
+	switch f.Type {
+	case "syslog":
+		switch f.Network {
+		case "":
+			if f.Addr != "" {
+				return errors.New("addr: needs network udp or tcp")
+			}
+		case "udp", "tcp":
+			if f.Addr == "" {
+				return errors.New("addr: missing")
+			}
+		default:
+			return fmt.Errorf("network: %q is not udp or tcp", f.Network)
+		}
+	case "file":
+		if f.Path == "" {
+			return errors.New("path: missing")
+		}
+	default:
+		return fmt.Errorf("type: %q is not syslog or file", f.Type)
+	}
+	return nil
+}
+
+// Sink receives every line written to the log, as written. Checkpoints are
+// forwarded as well, so a forwarded copy verifies like the log itself.
+type Sink interface {
+	Write(level string, line []byte) error
+	io.Closer
+}
+
+// NewSink opens the sink configured by f.
+func NewSink(f Forward) (Sink, error) {
+	if err := CheckForward(f); err != nil {
+		return nil, err
+	}
+	if f.Type == "file" {
+		return newFileSink(f.Path)
+	}
+	tag := f.Tag
+	if tag == "" {
+		tag = "truekey"
+	}
+	return newSyslogSink(f.Network, f.Addr, tag)
+}
+
+// fileSink appends to a file and syncs every line to disk before the record
+// counts as written.
+type fileSink struct {
+	f *os.File
+}
+
+func newFileSink(path string) (Sink, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &fileSink{f}, nil
+}
+
+func (s *fileSink) Write(level string, line []byte) error {
+	if _, err := s.f.Write(line); err != nil {
+		return err
+	}
+	return s.f.Sync()
+}
+
+func (s *fileSink) Close() error {
+	return s.f.Close()
+}
+
+// sink is a configured sink and whether it is failing, so a broken sink is
+// reported once rather than for every record.
+type sink struct {
+	Sink
+	name    string
+	failing bool
+}
+
+// SetSinks replaces the sinks lines are forwarded to, closing the previous
+// ones. The sinks are owned by the log afterwards.
+func (l *Log) SetSinks(sinks map[string]Sink) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, s := range l.sinks {
+		s.Close()
+	}
+	l.sinks = nil
+	for name, s := range sinks {
+		l.sinks = append(l.sinks, &sink{Sink: s, name: name})
+	}
+}
+
+// forward hands a written line to the sinks. The file stays the record of
+// truth, a failing sink does not fail the write. The caller holds mu.
+func (l *Log) forward(level string, line []byte) {
+	for _, s := range l.sinks {
+		err := s.Write(level, line)
+		switch {
+		case err != nil && !s.failing:
+			log.Error("Audit log forwarding failed", "sink", s.name, "err", err)
+		case err == nil && s.failing:
+			log.Info("Audit log forwarding resumed", "sink", s.name)
+		}
+		s.failing = err != nil
+	}
+}
@@ -0,0 +1,57 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+// +build !windows,!plan9
+
+package audit
+
+import (
+	"log/syslog"
+	"strings"
+)
+
+// syslogSink forwards lines to a syslog daemon with the authpriv facility, the
+// one meant for security relevant messages.
+type syslogSink struct {
+	w *syslog.Writer
+}
+
+func newSyslogSink(network, addr, tag string) (Sink, error) {
+	w, err := syslog.Dial(network, addr, syslog.LOG_AUTHPRIV|syslog.LOG_INFO, tag)
+	if err != nil {
+		return nil, err
+	}
+	return &syslogSink{w}, nil
+}
+
+func (s *syslogSink) Write(level string, line []byte) error {
+	msg := strings.TrimSuffix(string(line), "\n")
+	switch level {
+	case "crit":
+		return s.w.Crit(msg)
+	case "error":
+		return s.w.Err(msg)
+	case "warn":
+		return s.w.Warning(msg)
+	case "debug", "trace":
+		return s.w.Debug(msg)
+	}
+	return s.w.Info(msg)
+}
+
+func (s *syslogSink) Close() error {
+	return s.w.Close()
+}
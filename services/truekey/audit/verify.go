@@ -0,0 +1,237 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"ethereum/keyservice/common"
+	"ethereum/keyservice/common/hexutil"
+	"ethereum/keyservice/crypto"
+)
+
+// chainFields are the fields of a record verification looks at.
+type chainFields struct {
+	Event     string       `json:"event"`
+	Auditor   string       `json:"auditor"`
+	Signature string       `json:"signature"`
+	Fields    retainedHead `json:"fields"`
+	Seq       *uint64      `json:"seq"`
+	Prev      *common.Hash `json:"prev"`
+}
+
+// Report is the outcome of verifying an audit log.
+type Report struct {
+	Records     uint64           // records other than checkpoints
+	Checkpoints int              // valid checkpoints
+	Uncovered   uint64           // records after the last valid checkpoint
+	Auditors    []common.Address // keys that signed valid checkpoints
+	Problems    []string         // evidence of tampering
+	Warnings    []string         // gaps in what the log can prove
+}
+
+// OK reports whether no tampering was found.
+func (r *Report) OK() bool {
+	return len(r.Problems) == 0
+}
+
+// verifier walks a chain that may span several files.
+type verifier struct {
+	report *Report
+	pinned map[common.Address]bool
+	signed map[common.Address]bool
+
+	file   string // file being read, empty for a single stream
+	lineNo int    // line in file
+	lines  int    // lines read in all files
+	next   uint64
+	prev   common.Hash
+
+	start    *chainFields           // first record, if the chain does not start there
+	startAt  string                 // where the first record was read
+	retained map[common.Hash]uint64 // heads of files removed by retention
+
+	head    *Head // last checkpoint written, if known
+	reached bool  // whether the head was read
+}
+
+func (v *verifier) at() string {
+	if v.file == "" {
+		return fmt.Sprintf("line %d", v.lineNo)
+	}
+	return fmt.Sprintf("%s line %d", v.file, v.lineNo)
+}
+
+func (v *verifier) problem(format string, args ...interface{}) {
+	v.report.Problems = append(v.report.Problems, v.at()+": "+fmt.Sprintf(format, args...))
+}
+
+// Verify walks the chain of the audit log read from r. Checkpoints must be
+// signed by one of auditors, or by any key when none are given.
+//
+// Edits, removed and reordered records and a truncated head break the chain.
+// Records removed from the tail are noticed when the log ends before head, the
+// last checkpoint written as stored by the log. Records after it, or all of
+// them without a head, are reported as uncovered.
+func Verify(r io.Reader, auditors []common.Address, head *Head) (*Report, error) {
+	v := newVerifier(auditors, head)
+	if err := v.read(r); err != nil {
+		return nil, err
+	}
+	return v.finish(), nil
+}
+
+// VerifyFiles verifies a log spread over files, given in the order of the
+// chain as returned by Files. Rotated files may be compressed. A log whose
+// oldest files were removed by retention is verified from the oldest file
+// left.
+func VerifyFiles(files []string, auditors []common.Address, head *Head) (*Report, error) {
+	v := newVerifier(auditors, head)
+	for _, name := range files {
+		f, err := OpenFile(name)
+		if err != nil {
+			return nil, err
+		}
+		v.file, v.lineNo = name, 0
+		err = v.read(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+	}
+	return v.finish(), nil
+}
+
+func newVerifier(auditors []common.Address, head *Head) *verifier {
+	v := &verifier{
+		report:   new(Report),
+		pinned:   make(map[common.Address]bool),
+		signed:   make(map[common.Address]bool),
+		retained: make(map[common.Hash]uint64),
+		head:     head,
+	}
+	for _, a := range auditors {
+		v.pinned[a] = true
+	}
+	return v
+}
+
+func (v *verifier) read(r io.Reader) error {
+	report, in := v.report, bufio.NewReader(r)
+	for {
+		line, err := in.ReadBytes('\n')
+		if err == io.EOF && len(line) == 0 {
+			return nil
+		}
+		if err != nil && err != io.EOF {
+			return err
+		}
+		v.lineNo++
+		v.lines++
+		if line[len(line)-1] != '\n' {
+			v.problem("incomplete last line")
+		}
+		line = bytes.TrimSuffix(line, []byte{'\n'})
+		hash := crypto.Keccak256Hash(line)
+
+		var chain chainFields
+		if err := json.Unmarshal(line, &chain); err != nil || chain.Seq == nil || chain.Prev == nil {
+			v.problem("record without chain fields")
+			report.Records++
+			report.Uncovered++
+			v.prev = hash
+			continue
+		}
+		seq, link := *chain.Seq, *chain.Prev
+		switch {
+		case seq == 0 && link == (common.Hash{}):
+			if v.lines > 1 {
+				v.problem("chain restarted")
+			}
+		case v.lines == 1:
+			// Fine if retention removed the records before, which a
+			// later record tells
+			v.start, v.startAt = &chain, v.at()
+		case seq != v.next:
+			v.problem("record %d where %d was expected, records removed or reordered", seq, v.next)
+		case link != v.prev:
+			v.problem("previous record does not match its hash, records edited")
+		}
+		v.next, v.prev = seq+1, hash
+
+		if chain.Event == EventRetention && chain.Fields.Seq != nil && chain.Fields.Head != nil {
+			v.retained[*chain.Fields.Head] = *chain.Fields.Seq
+		}
+		if chain.Event != EventCheckpoint {
+			report.Records++
+			report.Uncovered++
+			continue
+		}
+		sig, err := hexutil.Decode(chain.Signature)
+		if err != nil || !common.IsHexAddress(chain.Auditor) {
+			v.problem("malformed checkpoint")
+			continue
+		}
+		auditor := common.HexToAddress(chain.Auditor)
+		pub, err := crypto.SigToPub(CheckpointHash(seq, link).Bytes(), sig)
+		switch {
+		case err != nil || crypto.PubkeyToAddress(*pub) != auditor:
+			v.problem("invalid checkpoint signature")
+		case len(v.pinned) > 0 && !v.pinned[auditor]:
+			v.problem("checkpoint signed by unknown auditor %s", auditor.Hex())
+		default:
+			report.Checkpoints++
+			report.Uncovered = 0
+			if v.head != nil && v.head.Seq == seq && v.head.Hash == hash {
+				v.reached = true
+			}
+			if !v.signed[auditor] {
+				v.signed[auditor] = true
+				report.Auditors = append(report.Auditors, auditor)
+			}
+		}
+	}
+}
+
+func (v *verifier) finish() *Report {
+	report := v.report
+	if v.start != nil {
+		seq := *v.start.Seq
+		if removed, ok := v.retained[*v.start.Prev]; ok && removed+1 == seq {
+			report.Warnings = append(report.Warnings, fmt.Sprintf("records before %d were removed by retention", seq))
+		} else {
+			report.Problems = append([]string{fmt.Sprintf("%s: log starts at record %d, earlier records are missing", v.startAt, seq)}, report.Problems...)
+		}
+	}
+	if v.head != nil && !v.reached {
+		report.Problems = append(report.Problems, fmt.Sprintf("log ends before checkpoint %d, records removed from the tail", v.head.Seq))
+	}
+	switch {
+	case v.lines == 0:
+		report.Warnings = append(report.Warnings, "log is empty")
+	case report.Uncovered > 0:
+		report.Warnings = append(report.Warnings, fmt.Sprintf("%d records after the last checkpoint are not signed", report.Uncovered))
+	}
+	if len(v.pinned) == 0 && report.Checkpoints > 0 {
+		report.Warnings = append(report.Warnings, "no auditor pinned, checkpoints prove the log was written by the holder of the signing key only")
+	}
+	return report
+}
@@ -0,0 +1,150 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"ethereum/keyservice/common"
+	"ethereum/keyservice/services/truekey/types"
+	"ethereum/keyservice/services/utils"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"ethereum/keyservice/log"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var (
+	allowInvalidConfigFlag = cli.BoolFlag{
+		Name:  "allowinvalidconfig",
+		Usage: "Start even though the config is invalid, ignoring what cannot be parsed",
+	}
+	configCommand = cli.Command{
+		Name:  "config",
+		Usage: "Manage the service config",
+		Subcommands: []cli.Command{
+			{
+				Action:    utils.MigrateFlags(checkConfig),
+				Name:      "check",
+				Usage:     "Validate the config file",
+				ArgsUsage: "",
+				Flags: []cli.Flag{
+					DataDirFlag,
+					ConfigFlag,
+					keystoreFlag,
+					keystoreDirFlag,
+					seedFlag,
+				},
+				Description: `
+The check command validates the config the service would start with against the
+schema: known fields only, addresses, ports, admins, quorums and limits. Given the
+keystores and seeds the service is started with, it also checks every configured
+root is among them. Every problem found is listed.`,
+			},
+		},
+	}
+)
+
+// configPath returns the config file given by --config or the one in the datadir.
+func configPath(c *cli.Context) string {
+	if c.GlobalIsSet(ConfigFlag.Name) {
+		return c.GlobalString(ConfigFlag.Name)
+	}
+	return filepath.Join(c.GlobalString(DataDirFlag.Name), "config.json")
+}
+
+// loadConfig reads and validates the config, checking its roots against the
+// keystore and seed files. Without --config a missing file is an empty config.
+func loadConfig(c *cli.Context, files, seedFiles []string) (types.Config, error) {
+	file := configPath(c)
+	if _, err := os.Stat(file); os.IsNotExist(err) && !c.GlobalIsSet(ConfigFlag.Name) {
+		log.Warn("No config file, the admin API has no admins", "file", file)
+		return types.Config{}, nil
+	}
+	config, err := types.LoadConfig(file)
+	if err != nil {
+		return types.Config{}, err
+	}
+	roots, err := fileRoots(files, seedFiles)
+	if err != nil {
+		return types.Config{}, err
+	}
+	if err := config.CheckRoots(roots); err != nil {
+		return types.Config{}, fmt.Errorf("%s: %v", file, err)
+	}
+	return config, nil
+}
+
+// fileRoots returns the roots of keystore and seed files without decrypting them.
+func fileRoots(files, seedFiles []string) ([]common.Address, error) {
+	var roots []common.Address
+	for _, file := range files {
+		keyjson, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the keyfile at '%s': %v", file, err)
+		}
+		var key struct {
+			Address string `json:"address"`
+		}
+		if err := json.Unmarshal(keyjson, &key); err != nil || !common.IsHexAddress(key.Address) {
+			return nil, fmt.Errorf("failed to parse the keyfile at '%s'", file)
+		}
+		roots = append(roots, common.HexToAddress(key.Address))
+	}
+	for _, file := range seedFiles {
+		root, err := seedFileRoot(file)
+		if err != nil {
+			return nil, err
+		}
+		roots = append(roots, root)
+	}
+	return roots, nil
+}
+
+func checkConfig(c *cli.Context) error {
+	file := configPath(c)
+	config, err := types.LoadConfig(file)
+	if err != nil {
+		fmt.Println(err)
+		return errors.New("config check failed")
+	}
+	if c.GlobalIsSet(keystoreFlag.Name) || c.GlobalIsSet(keystoreDirFlag.Name) || c.GlobalIsSet(seedFlag.Name) {
+		files, err := keystoreFiles(c)
+		if err != nil {
+			return err
+		}
+		var seedFiles []string
+		if c.GlobalIsSet(seedFlag.Name) {
+			seedFiles = splitAndTrim(c.GlobalString(seedFlag.Name))
+		}
+		roots, err := fileRoots(files, seedFiles)
+		if err != nil {
+			return err
+		}
+		if err := config.CheckRoots(roots); err != nil {
+			fmt.Printf("%s: %v\n", file, err)
+			return errors.New("config check failed")
+		}
+	} else {
+		fmt.Println("No keystores given, the configured roots were not checked")
+	}
+	fmt.Printf("Config %s is valid: %d roots\n", file, len(config.Config))
+	return nil
+}
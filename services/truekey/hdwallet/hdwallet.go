@@ -7,6 +7,8 @@ import (
 	"fmt"
 	"github.com/tyler-smith/go-bip39"
 	"math/big"
+	"strconv"
+	"strings"
 	"sync"
 
 	truechain "ethereum/keyservice"
@@ -108,6 +110,21 @@ func (w *Wallet) Close() error {
 	return nil
 }
 
+// Wipe clears the seed and the master key from memory, the wallet cannot derive
+// keys afterwards.
+func (w *Wallet) Wipe() {
+	w.cacheMu.Lock()
+	defer w.cacheMu.Unlock()
+
+	for i := range w.seed {
+		w.seed[i] = 0
+	}
+	if w.masterKey != nil {
+		w.masterKey.Zero()
+	}
+	w.mnemonic = ""
+}
+
 // Accounts implements accounts.Wallet, returning the list of accounts pinned to
 // the wallet. If self-derivation was enabled, the account list is
 // periodically expanded based on current chain state.
@@ -415,6 +432,24 @@ func NewSeedFromMnemonic(mnemonic string) ([]byte, error) {
 	return bip39.NewSeedWithErrorChecking(mnemonic, "")
 }
 
+// NewSeedFromMnemonicPassphrase returns a BIP-39 seed based on a BIP-39 mnemonic
+// protected by an additional passphrase.
+func NewSeedFromMnemonicPassphrase(mnemonic, passphrase string) ([]byte, error) {
+	if mnemonic == "" {
+		return nil, errors.New("mnemonic is required")
+	}
+
+	return bip39.NewSeedWithErrorChecking(mnemonic, passphrase)
+}
+
+// MasterPrivateKey returns the private key at the root of the derivation tree.
+func (w *Wallet) MasterPrivateKey() (*ecdsa.PrivateKey, error) {
+	w.cacheMu.RLock()
+	defer w.cacheMu.RUnlock()
+
+	return w.derivePrivateKey(nil)
+}
+
 // DerivePrivateKey derives the private key of the derivation path.
 func (w *Wallet) derivePrivateKey(path accounts.DerivationPath) (*ecdsa.PrivateKey, error) {
 	var err error
@@ -462,6 +497,61 @@ func (w *Wallet) deriveAddress(path accounts.DerivationPath) (common.Address, er
 	return address, nil
 }
 
+// ExtendedPublicKey returns the BIP-32 extended public key at path. The
+// addresses of the non-hardened levels below path derive from it without the
+// private keys, see DeriveAddress.
+func (w *Wallet) ExtendedPublicKey(path accounts.DerivationPath) (string, error) {
+	w.cacheMu.RLock()
+	defer w.cacheMu.RUnlock()
+
+	var err error
+	key := w.masterKey
+	for _, n := range path {
+		key, err = key.Child(n)
+		if err != nil {
+			return "", err
+		}
+	}
+	public, err := key.Neuter()
+	if err != nil {
+		return "", err
+	}
+	return public.String(), nil
+}
+
+// DeriveAddress derives the account address at path below the extended public
+// key xpub. The path is relative to xpub, e.g. "0/5", and cannot have hardened
+// levels, those need the private key.
+func DeriveAddress(xpub string, path string) (common.Address, error) {
+	key, err := hdkeychain.NewKeyFromString(xpub)
+	if err != nil {
+		return common.Address{}, err
+	}
+	if key.IsPrivate() {
+		return common.Address{}, errors.New("extended key is private, want an extended public key")
+	}
+	if path = strings.Trim(strings.TrimSpace(path), "/"); path != "" {
+		for _, component := range strings.Split(path, "/") {
+			component = strings.TrimSpace(component)
+			if strings.HasSuffix(component, "'") {
+				return common.Address{}, hdkeychain.ErrDeriveHardFromPublic
+			}
+			n, err := strconv.ParseUint(component, 10, 32)
+			if err != nil || n >= hdkeychain.HardenedKeyStart {
+				return common.Address{}, fmt.Errorf("invalid component: %s", component)
+			}
+			if key, err = key.Child(uint32(n)); err != nil {
+				return common.Address{}, err
+			}
+		}
+	}
+	publicKey, err := key.ECPubKey()
+	if err != nil {
+		return common.Address{}, err
+	}
+	return crypto.PubkeyToAddress(*publicKey.ToECDSA()), nil
+}
+
 // removeAtIndex removes an account at index.
 func removeAtIndex(accts []accounts.Account, index int) []accounts.Account {
 	return append(accts[:index], accts[index+1:]...)
@@ -275,3 +275,36 @@ func TestWallet(t *testing.T) {
 		t.Error("expected 12 words")
 	}
 }
+
+func TestDeriveAddress(t *testing.T) {
+	wallet, err := NewFromMnemonic("tag volcano eight thank tide danger coast health above argue embrace heavy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	xpub, err := wallet.ExtendedPublicKey(MustParseDerivationPath("m/44'/60'/2000000'"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(xpub, "xpub") {
+		t.Fatalf("extended public key: have %s", xpub)
+	}
+	for _, index := range []int{0, 1, 1000, 0x7fffffff} {
+		account, err := wallet.Derive(MustParseDerivationPath(fmt.Sprintf("m/44'/60'/2000000'/0/%d", index)), false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		address, err := DeriveAddress(xpub, fmt.Sprintf("0/%d", index))
+		if err != nil || address != account.Address {
+			t.Fatalf("index %d: have %x %v, want %x", index, address, err, account.Address)
+		}
+	}
+	if _, err := DeriveAddress(xpub, "0/1'"); err == nil {
+		t.Error("hardened level derived from a public key")
+	}
+	if _, err := DeriveAddress(xpub, "0/2147483648"); err == nil {
+		t.Error("hardened index derived from a public key")
+	}
+	if _, err := DeriveAddress("xpub", "0/0"); err == nil {
+		t.Error("malformed key accepted")
+	}
+}
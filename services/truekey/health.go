@@ -0,0 +1,55 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"ethereum/keyservice/services/truekey/signer"
+	"ethereum/keyservice/services/truekey/types"
+	"net/http"
+)
+
+// healthRoutes returns the health endpoints served next to the dapp RPC.
+// /healthz fails only while shutting down, /readyz also fails while the
+// instance cannot sign: database unreachable, every root sealed, frozen or
+// retired.
+func healthRoutes(api *signer.SignerAPI) map[string]http.Handler {
+	return map[string]http.Handler{
+		"/healthz": healthHandler(api, func(s *types.Status) bool { return !s.ShuttingDown }),
+		"/readyz":  healthHandler(api, func(s *types.Status) bool { return s.Ready }),
+	}
+}
+
+// healthHandler answers with the status as JSON, with 200 if ok holds and 503
+// otherwise.
+func healthHandler(api *signer.SignerAPI, ok func(*types.Status) bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		status := api.Status()
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		if ok(status) {
+			w.WriteHeader(http.StatusOK)
+		} else {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(status)
+	})
+}
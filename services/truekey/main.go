@@ -18,12 +18,16 @@ package main
 
 import (
 	"bufio"
+	"crypto/sha256"
 	"encoding/json"
 	"errors"
 	"ethereum/keyservice/accounts"
 	"ethereum/keyservice/common"
 	"ethereum/keyservice/common/fdlimit"
 	"ethereum/keyservice/etruedb"
+	"ethereum/keyservice/services/truekey/audit"
+	"ethereum/keyservice/services/truekey/rules"
+	"ethereum/keyservice/services/truekey/secret"
 	"ethereum/keyservice/services/truekey/signer"
 	"ethereum/keyservice/services/truekey/types"
 	"fmt"
@@ -35,6 +39,7 @@ import (
 	"path/filepath"
 	"runtime"
 	"strings"
+	"syscall"
 
 	"ethereum/keyservice/accounts/keystore"
 	"ethereum/keyservice/console"
@@ -97,6 +102,27 @@ var (
 		Name:  "config",
 		Usage: "Config file path",
 	}
+	rulesFlag = cli.StringFlag{
+		Name:  "rules",
+		Usage: "Path to the javascript rule file which approves, rejects or escalates requests",
+	}
+	pendingTimeoutFlag = cli.DurationFlag{
+		Name:  "pendingtimeout",
+		Usage: "How long a request escalated by the rules waits for an admin decision",
+		Value: signer.DefaultPendingTimeout,
+	}
+	sealedFlag = cli.BoolFlag{
+		Name:  "sealed",
+		Usage: "Start without decrypting any keystore, custodians unseal the roots with their shares over the admin API",
+	}
+	sharesFlag = cli.IntFlag{
+		Name:  "shares",
+		Usage: "Generate a random passphrase and split it into this many unseal shares",
+	}
+	thresholdFlag = cli.IntFlag{
+		Name:  "threshold",
+		Usage: "Number of unseal shares needed to rebuild the passphrase",
+	}
 	app         = cli.NewApp()
 	initCommand = cli.Command{
 		Action:    utils.MigrateFlags(initializeKeyStore),
@@ -106,9 +132,16 @@ var (
 		Flags: []cli.Flag{
 			logLevelFlag,
 			DataDirFlag,
+			sharesFlag,
+			thresholdFlag,
+			mnemonicFlag,
+			bip39PassphraseFlag,
 		},
 		Description: `
-The init command generates a keystore which TrueKeyService can use to start service.`,
+The init command generates a keystore which TrueKeyService can use to start service.
+With --shares and --threshold the keystore is encrypted with a random passphrase which
+is only printed as unseal shares, one per custodian. With --mnemonic a BIP-39 seed file
+is created instead, its mnemonic is shown once and restores every child account.`,
 	}
 )
 
@@ -128,9 +161,27 @@ func init() {
 		utils.RPCEnabledFlag,
 		rpcPortFlag,
 		ConfigFlag,
+		rulesFlag,
+		pendingTimeoutFlag,
+		shutdownTimeoutFlag,
+		metricsAddrFlag,
+		metricsPortFlag,
+		metricsInfluxDBFlag,
+		metricsInfluxDBEndpointFlag,
+		metricsInfluxDBDatabaseFlag,
+		metricsInfluxDBUsernameFlag,
+		metricsInfluxDBPasswordFlag,
+		metricsInfluxDBTagsFlag,
+		passwordDirFlag,
+		passwordFdFlag,
+		passwordStdinFlag,
+		skipBadPasswordFlag,
+		sealedFlag,
+		seedFlag,
+		allowInvalidConfigFlag,
 	}
 	app.Action = trueKeyService
-	app.Commands = []cli.Command{initCommand}
+	app.Commands = []cli.Command{initCommand, restoreCommand, rekeyCommand, configCommand, auditCommand, accountsCommand}
 	cli.CommandHelpTemplate = utils.OriginCommandHelpTemplate
 }
 
@@ -155,17 +206,13 @@ func initializeKeyStore(c *cli.Context) error {
 	if c.GlobalBool(utils.LightKDFFlag.Name) {
 		n, p = keystore.LightScryptN, keystore.LightScryptP
 	}
-	text := "Please specify a password. Do not forget this password!"
-	var password string
-	for {
-		password = getPassPhrase(text, true)
-		if err := signer.ValidatePasswordFormat(password); err != nil {
-			fmt.Printf("invalid password: %v\n", err)
-		} else {
-			fmt.Println()
-			break
-		}
+	if c.IsSet(sharesFlag.Name) || c.IsSet(thresholdFlag.Name) {
+		return initializeSharedKeyStore(c, configDir, n, p)
+	}
+	if c.Bool(mnemonicFlag.Name) {
+		return initializeMnemonic(c, configDir, n, p)
 	}
+	password := newPassword()
 
 	ks := keystore.NewKeyStore(configDir, n, p)
 	account, err := ks.NewAccount(password)
@@ -176,6 +223,21 @@ func initializeKeyStore(c *cli.Context) error {
 	return nil
 }
 
+// newPassword prompts for the password of a new keystore or seed file until it
+// is acceptable.
+func newPassword() string {
+	text := "Please specify a password. Do not forget this password!"
+	for {
+		password := getPassPhrase(text, true)
+		if err := signer.ValidatePasswordFormat(password); err != nil {
+			fmt.Printf("invalid password: %v\n", err)
+		} else {
+			fmt.Println()
+			return password
+		}
+	}
+}
+
 func initialize(c *cli.Context) error {
 	// Set up the logger to print everything
 	logOutput := os.Stdout
@@ -224,54 +286,153 @@ func trueKeyService(c *cli.Context) error {
 	}
 
 	configDir := c.GlobalString(DataDirFlag.Name)
-	stretchedKey, err := readMasterKey(c)
+	files, err := keystoreFiles(c)
 	if err != nil {
 		fmt.Println("Please use init command init a keystore or specified correct keystore")
 		return fmt.Errorf("aborted by user err = %s", err.Error())
 	}
+	var (
+		stretchedKey []*keystore.Key
+		seeds        []*seedRoot
+		seedFiles    []string
+		configFile   = configPath(c)
+	)
+	if c.GlobalIsSet(seedFlag.Name) {
+		seedFiles = splitAndTrim(c.GlobalString(seedFlag.Name))
+	}
+	// Check the config before any password is asked for
+	configAdmins, err := loadConfig(c, files, seedFiles)
+	if err != nil {
+		if !c.GlobalBool(allowInvalidConfigFlag.Name) {
+			return fmt.Errorf("refusing to start, fix the config or pass --%s: %v", allowInvalidConfigFlag.Name, err)
+		}
+		log.Error("Starting with an invalid config", "file", configFile, "err", err)
+		configAdmins = types.LoadNodesJSON(configFile)
+	}
+	passwords, err := newPasswordSources(c)
+	if err != nil {
+		return err
+	}
+	if c.GlobalBool(sealedFlag.Name) {
+		if c.GlobalIsSet(seedFlag.Name) {
+			utils.Fatalf("Seed roots cannot be unsealed with shares, start them without --sealed")
+		}
+		log.Info("Starting sealed, roots are unsealed with shares over the admin API", "keystores", len(files))
+	} else {
+		if len(files) > 0 {
+			if stretchedKey, err = readMasterKey(files, passwords); err != nil {
+				fmt.Println("Please use init command init a keystore or specified correct keystore")
+				return fmt.Errorf("aborted by user err = %s", err.Error())
+			}
+		}
+		if c.GlobalIsSet(seedFlag.Name) {
+			if seeds, err = readSeeds(seedFiles, passwords); err != nil {
+				return err
+			}
+		}
+	}
+	passwords.close()
 	keydata, err := etruedb.NewLDBDatabase(filepath.Join(configDir, KEYDataDir), DatabaseCache, makeDatabaseHandles())
 	if err != nil {
 		log.Info("NewLDBDatabase", "err", err)
 		return err
 	}
+	defer keydata.Close()
+	keydata.Meter("truekey/db/")
 	var (
-		rootLoc    = filepath.Join(configDir, "keystore")
-		lightKdf   = c.GlobalBool(utils.LightKDFFlag.Name)
-		configFile = c.GlobalString(ConfigFlag.Name)
+		rootLoc  = filepath.Join(configDir, "keystore")
+		lightKdf = c.GlobalBool(utils.LightKDFFlag.Name)
 	)
-
-	if !c.GlobalIsSet(ConfigFlag.Name) {
-		configFile = filepath.Join(configDir, "config.json")
-	}
-
-	configAdmins := types.LoadNodesJSON(configFile)
 	log.Info("Starting signer", "keystore", rootLoc, "light-kdf", lightKdf)
 	apiImpl, err := signer.NewSignerAPI(keydata, stretchedKey, configAdmins.Config)
 	if err != nil {
 		log.Info("NewSignerAPI", "err", err)
 		return err
 	}
+	for _, keyfile := range files {
+		keyjson, err := ioutil.ReadFile(keyfile)
+		if err != nil {
+			return fmt.Errorf("failed to read the keyfile at '%s': %v", keyfile, err)
+		}
+		if _, err := apiImpl.AddKeystore(keyjson); err != nil {
+			return fmt.Errorf("failed to parse the keyfile at '%s': %v", keyfile, err)
+		}
+	}
+	for _, seed := range seeds {
+		root, err := apiImpl.UnlockSeed(seed.seed)
+		if err == types.ErrRootRetired {
+			log.Warn("Root retired, not serving it", "root", root, "seed", seed.file)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to load the seed at '%s': %v", seed.file, err)
+		}
+		if root != seed.root {
+			return fmt.Errorf("seed at '%s' belongs to root %s", seed.file, root.Hex())
+		}
+	}
+	if c.GlobalIsSet(rulesFlag.Name) {
+		ruleJS, err := ioutil.ReadFile(c.GlobalString(rulesFlag.Name))
+		if err != nil {
+			utils.Fatalf("Could not read rules file: %v", err)
+		}
+		ruleEngine := rules.NewRuleEvaluator(rules.NewDBStorage(keydata))
+		if err := ruleEngine.Init(string(ruleJS)); err != nil {
+			utils.Fatalf("Could not load rules: %v", err)
+		}
+		apiImpl.SetPolicy(ruleEngine)
+		log.Info("Rule engine configured", "file", c.GlobalString(rulesFlag.Name), "sha256", fmt.Sprintf("%x", sha256.Sum256(ruleJS)))
+	}
 
 	// Establish the bidirectional communication, by creating a new UI backend and registering
 	// it with the UI.
-	//ServerAUDITFILE
-	truekeyApi, err := signer.NewServerAuditLogger(ServerAUDITFILE, signer.NewUIServerAPI(apiImpl))
+	pseudonymKey, err := audit.LoadPseudonymKey(filepath.Join(configDir, auditPseudonymKeyFile))
 	if err != nil {
-		utils.Fatalf(err.Error())
+		utils.Fatalf("Could not load the audit pseudonym key: %v", err)
+	}
+	auditFile := filepath.Join(configDir, ServerAUDITFILE)
+	auditLog, err := audit.Open(auditFile, pseudonymKey, audit.DefaultCheckpointRecords, audit.DefaultCheckpointInterval)
+	if err != nil {
+		utils.Fatalf("Could not open the audit log: %v", err)
+	}
+	defer auditLog.Close()
+	apiImpl.SetConfigLoader(configAdmins, func() (types.Config, error) {
+		return types.LoadConfig(configFile)
+	})
+	apiImpl.OnConfig(configureAuditLog(auditLog, pseudonymKey))
+
+	truekeyApi := signer.NewServerAuditLogger(auditLog, signer.NewUIServerAPI(apiImpl))
+	truekeyApi.SetUserIDs(apiImpl.UserID)
+	apiImpl.SetAuditSigner(auditLog.SetKey)
+	apiImpl.SetAuditSearch(auditLog.Search)
+	log.Info("Audit server logs configured", "file", auditFile, "auditor", auditLog.Auditor())
+
+	signerLog := log.New("api", "signer")
+	signerLog.SetHandler(truekeyApi.Handler())
+	apiImpl.SetAuditLog(signerLog)
+	apiImpl.SetPendingTimeout(c.GlobalDuration(pendingTimeoutFlag.Name))
+
+	if c.GlobalIsSet(keystoreDirFlag.Name) {
+		passwordDir := c.GlobalString(passwordDirFlag.Name)
+		if c.GlobalBool(sealedFlag.Name) {
+			passwordDir = ""
+		}
+		sub := watchKeystores(apiImpl, c.GlobalString(keystoreDirFlag.Name), passwordDir)
+		defer sub.Unsubscribe()
 	}
-	log.Info("Audit server logs configured", "file", ServerAUDITFILE)
 
 	// register signer API with server
 	var (
 		extapiURL = "n/a"
 		ipcapiURL = "n/a"
+		served    endpoints
 	)
 
 	serverAPI := []rpc.API{
 		{
 			Namespace: "truekey",
 			Public:    true,
-			Service:   truekeyApi,
+			Service:   signer.NewMetricsServerAPI(truekeyApi),
 			Version:   "1.0"},
 	}
 
@@ -279,40 +440,82 @@ func trueKeyService(c *cli.Context) error {
 	cors := splitAndTrim(c.GlobalString(utils.RPCCORSDomainFlag.Name))
 	// start http server
 	httpEndpoint := fmt.Sprintf("%s:%d", c.GlobalString(utils.RPCListenAddrFlag.Name), c.Int(rpcPortFlag.Name))
-	listener, _, err := rpc.StartHTTPEndpoint(httpEndpoint, serverAPI, []string{"truekey"}, cors, vhosts)
+	server, _, err := rpc.StartHTTPServer(httpEndpoint, serverAPI, []string{"truekey"}, cors, vhosts, healthRoutes(apiImpl))
 	if err != nil {
 		utils.Fatalf("Could not start RPC api: %v", err)
 	}
 	extapiURL = fmt.Sprintf("http://%s", httpEndpoint)
 	log.Info("HTTP endpoint server opened", "url", extapiURL)
+	served.http = append(served.http, httpServer{extapiURL, server})
 
-	defer func() {
-		listener.Close()
-		log.Info("HTTP endpoint server closed", "url", httpEndpoint)
-	}()
+	// The admin API is only served on its own endpoint and over IPC, never on
+	// the dapp facing endpoint above.
+	adminAPI := []rpc.API{
+		{
+			Namespace: "admin",
+			Public:    false,
+			Service:   signer.NewMetricsAdminAPI(signer.NewAdminAuditLogger(truekeyApi, signer.NewAdminServerAPI(apiImpl))),
+			Version:   "1.0"},
+	}
+	if configAdmins.RpcPort != 0 {
+		adminHost := configAdmins.RpcAddr
+		if adminHost == "" {
+			adminHost = DefaultHTTPHost
+		}
+		adminEndpoint := fmt.Sprintf("%s:%d", adminHost, configAdmins.RpcPort)
+		adminServer, _, err := rpc.StartHTTPServer(adminEndpoint, adminAPI, []string{"admin"}, cors, vhosts, nil)
+		if err != nil {
+			utils.Fatalf("Could not start admin RPC api: %v", err)
+		}
+		adminURL := fmt.Sprintf("http://%s", adminEndpoint)
+		log.Info("Admin HTTP endpoint opened", "url", adminURL)
+		served.http = append(served.http, httpServer{adminURL, adminServer})
+	}
 
 	if !c.GlobalBool(utils.IPCDisabledFlag.Name) {
 		givenPath := c.GlobalString(utils.IPCPathFlag.Name)
 		ipcapiURL = ipcEndpoint(filepath.Join(givenPath, "truekey.ipc"), configDir)
-		listener, _, err := rpc.StartIPCEndpoint(ipcapiURL, serverAPI)
+		listener, handler, err := rpc.StartIPCEndpoint(ipcapiURL, append(serverAPI, adminAPI...))
 		if err != nil {
 			utils.Fatalf("Could not start IPC api: %v", err)
 		}
 		log.Info("IPC endpoint opened", "url", ipcapiURL)
-		defer func() {
-			listener.Close()
-			log.Info("IPC endpoint closed", "url", ipcapiURL)
-		}()
+		served.ipcURL, served.ipc, served.ipcHandler = ipcapiURL, listener, handler
 	}
 
-	abortChan := make(chan os.Signal, 1)
-	signal.Notify(abortChan, os.Interrupt)
+	if err := startMetrics(c, &served); err != nil {
+		utils.Fatalf("%v", err)
+	}
 
-	sig := <-abortChan
-	apiImpl.Stop()
-	log.Info("Exiting...", "signal", sig)
+	if c.GlobalBool(sealedFlag.Name) && configAdmins.RpcPort == 0 && c.GlobalBool(utils.IPCDisabledFlag.Name) {
+		utils.Fatalf("Sealed start needs the admin endpoint or IPC to receive unseal shares")
+	}
 
-	return nil
+	abortChan := make(chan os.Signal, 1)
+	signal.Notify(abortChan, os.Interrupt, syscall.SIGTERM)
+	reloadChan := make(chan os.Signal, 1)
+	signal.Notify(reloadChan, syscall.SIGHUP)
+
+	for {
+		select {
+		case <-reloadChan:
+			if diff, err := apiImpl.ReloadConfig("SIGHUP"); err != nil {
+				log.Error("Config reload rejected, keeping the active config", "file", configFile, "err", err)
+			} else {
+				log.Info("Config reloaded", "file", configFile, "changes", len(diff))
+			}
+		case sig := <-abortChan:
+			// Drain the endpoints, then flush and wipe the signer before the
+			// deferred close of the database.
+			timeout := c.GlobalDuration(shutdownTimeoutFlag.Name)
+			log.Info("Shutting down, draining requests", "signal", sig, "timeout", timeout)
+			served.drain(timeout, abortChan)
+			apiImpl.Stop()
+			served.close()
+			log.Info("Exiting...", "signal", sig)
+			return nil
+		}
+	}
 }
 
 // splitAndTrim splits input separated by a comma
@@ -373,7 +576,7 @@ func getAllKeystoreFile(path string) ([]string, error) {
 	}
 	var files []string
 	for _, fi := range rd {
-		if fi.IsDir() {
+		if fi.IsDir() || strings.HasPrefix(fi.Name(), ".") || strings.HasSuffix(fi.Name(), backupSuffix) {
 			continue
 		} else {
 			var (
@@ -411,11 +614,9 @@ func getAllKeystoreFile(path string) ([]string, error) {
 	return files, nil
 }
 
-func readMasterKey(ctx *cli.Context) ([]*keystore.Key, error) {
-	var (
-		files []string
-		keys  []*keystore.Key
-	)
+// keystoreFiles lists the keystores given by --keystore and --keystoredir.
+func keystoreFiles(ctx *cli.Context) ([]string, error) {
+	var files []string
 	find := false
 	if ctx.GlobalIsSet(keystoreDirFlag.Name) {
 		find = true
@@ -434,31 +635,35 @@ func readMasterKey(ctx *cli.Context) ([]*keystore.Key, error) {
 		files = append(files, ctx.GlobalString(keystoreFlag.Name))
 	}
 
-	if !find {
+	if !find && !ctx.GlobalIsSet(seedFlag.Name) {
 		return nil, errors.New("please specified keystore")
 	}
+	return files, nil
+}
+
+func readMasterKey(files []string, passwords *passwordSources) ([]*keystore.Key, error) {
+	var keys []*keystore.Key
 
 	for _, keyfile := range files {
 		keyjson, err := ioutil.ReadFile(keyfile)
 		if err != nil {
 			return nil, fmt.Errorf("failed to read the keyfile at '%s': %v", keyfile, err)
 		}
-		for trials := 0; trials < 2; trials++ {
-			password := getPassPhrase("Please enter the password to decrypt the'"+keyfile+"':", false)
-
-			//password := "secret"
+		var root struct {
+			Address string `json:"address"`
+		}
+		if err := json.Unmarshal(keyjson, &root); err != nil {
+			return nil, fmt.Errorf("failed to parse the keyfile at '%s': %v", keyfile, err)
+		}
+		err = decryptFile(passwords, keyfile, common.HexToAddress(root.Address), func(password string) error {
 			key, err := keystore.DecryptKey(keyjson, password)
-			if err != nil {
-				if trials == 1 {
-					fmt.Println("Input error password limit ", keyfile)
-					break
-				}
-				fmt.Println("Please input correct password")
-			} else {
-				log.Info("Decrypt keystore success", "keyfile", keyfile)
+			if err == nil {
 				keys = append(keys, key)
-				break
 			}
+			return err
+		})
+		if err != nil {
+			return nil, err
 		}
 	}
 
@@ -469,6 +674,46 @@ func readMasterKey(ctx *cli.Context) ([]*keystore.Key, error) {
 	return keys, nil
 }
 
+// decryptFile decrypts the keystore or seed file of root with the password
+// from the configured sources, falling back to an interactive prompt. A file
+// the prompt cannot decrypt is skipped, a wrong password from a source is an
+// error unless --skipbadpassword is set.
+func decryptFile(passwords *passwordSources, file string, root common.Address, decrypt func(password string) error) error {
+	password, source, err := passwords.lookup(root)
+	if err != nil {
+		return fmt.Errorf("failed to read the password of '%s': %v", file, err)
+	}
+	if password != nil {
+		err := decrypt(unsafeString(password))
+		secret.Wipe(password)
+		if err != nil {
+			if !passwords.skipBad {
+				return fmt.Errorf("failed to decrypt '%s' with the password from %s: %v", file, source, err)
+			}
+			log.Error("Decrypt keystore failed, skipping the root", "keyfile", file, "password", source, "err", err)
+			return nil
+		}
+		log.Info("Decrypt keystore success", "keyfile", file, "root", root, "password", source)
+		return nil
+	}
+	for trials := 0; trials < 2; trials++ {
+		password := getPassPhrase("Please enter the password to decrypt the'"+file+"':", false)
+
+		//password := "secret"
+		if err := decrypt(password); err != nil {
+			if trials == 1 {
+				fmt.Println("Input error password limit ", file)
+				break
+			}
+			fmt.Println("Please input correct password")
+		} else {
+			log.Info("Decrypt keystore success", "keyfile", file, "root", root, "password", "prompt")
+			break
+		}
+	}
+	return nil
+}
+
 // confirm displays a text and asks for user confirmation
 func confirm(text string) bool {
 	fmt.Print(text)
@@ -0,0 +1,145 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"ethereum/keyservice/log"
+	"ethereum/keyservice/metrics"
+	"ethereum/keyservice/metrics/influxdb"
+	"ethereum/keyservice/metrics/prometheus"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/urfave/cli.v1"
+)
+
+const (
+	// metricsProcessInterval is how often the process metrics are collected.
+	metricsProcessInterval = 3 * time.Second
+
+	// metricsPushInterval is how often the metrics are pushed to InfluxDB.
+	metricsPushInterval = 10 * time.Second
+)
+
+var (
+	metricsAddrFlag = cli.StringFlag{
+		Name:  "metrics.addr",
+		Usage: "Listening address of the Prometheus metrics endpoint, disabled if empty",
+	}
+	metricsPortFlag = cli.IntFlag{
+		Name:  "metrics.port",
+		Usage: "Listening port of the Prometheus metrics endpoint",
+		Value: 6060,
+	}
+	metricsInfluxDBFlag = cli.BoolFlag{
+		Name:  "metrics.influxdb",
+		Usage: "Push the metrics to an InfluxDB database",
+	}
+	metricsInfluxDBEndpointFlag = cli.StringFlag{
+		Name:  "metrics.influxdb.endpoint",
+		Usage: "InfluxDB API endpoint to push the metrics to",
+		Value: "http://localhost:8086",
+	}
+	metricsInfluxDBDatabaseFlag = cli.StringFlag{
+		Name:  "metrics.influxdb.database",
+		Usage: "InfluxDB database to push the metrics to",
+		Value: "truekey",
+	}
+	metricsInfluxDBUsernameFlag = cli.StringFlag{
+		Name:  "metrics.influxdb.username",
+		Usage: "Username to authorize access to the InfluxDB database",
+	}
+	metricsInfluxDBPasswordFlag = cli.StringFlag{
+		Name:  "metrics.influxdb.password",
+		Usage: "Password to authorize access to the InfluxDB database, TRUEKEY_INFLUXDB_PASSWORD is used if not given",
+	}
+	metricsInfluxDBTagsFlag = cli.StringFlag{
+		Name:  "metrics.influxdb.tags",
+		Usage: "Comma separated InfluxDB tags (key=value) added to every point",
+		Value: "host=localhost",
+	}
+)
+
+// startMetrics serves the metrics registry in the Prometheus format on its own
+// listener and starts the InfluxDB push if configured. The listener is added to
+// the endpoints drained on shutdown.
+func startMetrics(c *cli.Context, served *endpoints) error {
+	addr := c.GlobalString(metricsAddrFlag.Name)
+	influx := c.GlobalBool(metricsInfluxDBFlag.Name)
+	if addr == "" && !influx {
+		return nil
+	}
+	go metrics.CollectProcessMetrics(metricsProcessInterval)
+
+	if addr != "" {
+		endpoint := fmt.Sprintf("%s:%d", addr, c.GlobalInt(metricsPortFlag.Name))
+		listener, err := net.Listen("tcp", endpoint)
+		if err != nil {
+			return fmt.Errorf("could not start the metrics endpoint: %v", err)
+		}
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", prometheus.Handler(metrics.DefaultRegistry))
+		server := &http.Server{
+			Handler:      mux,
+			ReadTimeout:  5 * time.Second,
+			WriteTimeout: 10 * time.Second,
+		}
+		go server.Serve(listener)
+
+		url := fmt.Sprintf("http://%s/metrics", endpoint)
+		log.Info("Metrics endpoint opened", "url", url)
+		served.http = append(served.http, httpServer{url, server})
+	}
+	if influx {
+		var (
+			endpoint = c.GlobalString(metricsInfluxDBEndpointFlag.Name)
+			database = c.GlobalString(metricsInfluxDBDatabaseFlag.Name)
+			username = c.GlobalString(metricsInfluxDBUsernameFlag.Name)
+			password = c.GlobalString(metricsInfluxDBPasswordFlag.Name)
+		)
+		if password == "" {
+			password = os.Getenv("TRUEKEY_INFLUXDB_PASSWORD")
+		}
+		tags, err := splitTags(c.GlobalString(metricsInfluxDBTagsFlag.Name))
+		if err != nil {
+			return err
+		}
+		go influxdb.InfluxDBWithTags(metrics.DefaultRegistry, metricsPushInterval, endpoint, database, username, password, "", tags)
+		log.Info("Pushing metrics to InfluxDB", "endpoint", endpoint, "database", database)
+	}
+	return nil
+}
+
+// splitTags parses comma separated key=value pairs.
+func splitTags(input string) (map[string]string, error) {
+	tags := make(map[string]string)
+	for _, pair := range splitAndTrim(input) {
+		if pair == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("invalid InfluxDB tag %q, want key=value", pair)
+		}
+		tags[kv[0]] = kv[1]
+	}
+	return tags, nil
+}
@@ -0,0 +1,221 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"crypto/rand"
+	"errors"
+	"ethereum/keyservice/common"
+	"ethereum/keyservice/console"
+	"ethereum/keyservice/crypto"
+	"ethereum/keyservice/log"
+	"ethereum/keyservice/services/truekey/hdwallet"
+	"ethereum/keyservice/services/utils"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"ethereum/keyservice/accounts/keystore"
+	"gopkg.in/urfave/cli.v1"
+)
+
+const (
+	// seedFilePrefix names seed files, followed by the root address.
+	seedFilePrefix = "seed--"
+
+	// mnemonicBits is the entropy of generated mnemonics, 24 words.
+	mnemonicBits = 256
+
+	// mnemonicChecks is the number of words asked back after display.
+	mnemonicChecks = 3
+)
+
+var (
+	mnemonicFlag = cli.BoolFlag{
+		Name:  "mnemonic",
+		Usage: "Generate a BIP-39 mnemonic and store its seed instead of a random keystore",
+	}
+	bip39PassphraseFlag = cli.BoolFlag{
+		Name:  "bip39passphrase",
+		Usage: "Protect the mnemonic with an additional BIP-39 passphrase, which is prompted for",
+	}
+	seedFlag = cli.StringFlag{
+		Name:  "seed",
+		Usage: "Seed files created by init --mnemonic or restore, separated by comma",
+	}
+	restoreCommand = cli.Command{
+		Action:    utils.MigrateFlags(restoreSeed),
+		Name:      "restore",
+		Usage:     "Restore a root wallet from its BIP-39 mnemonic",
+		ArgsUsage: "",
+		Flags: []cli.Flag{
+			logLevelFlag,
+			DataDirFlag,
+			bip39PassphraseFlag,
+		},
+		Description: `
+The restore command prompts for a BIP-39 mnemonic, and its passphrase with --bip39passphrase,
+and stores the seed encrypted in the datadir. Start the service with --seed to serve it.`,
+	}
+)
+
+// seedRoot is a decrypted seed file.
+type seedRoot struct {
+	file string
+	root common.Address
+	seed []byte
+}
+
+// seedFileName returns the path of the seed file of root in dir.
+func seedFileName(dir string, root common.Address) string {
+	return filepath.Join(dir, seedFilePrefix+strings.ToLower(common.Bytes2Hex(root.Bytes()))+".json")
+}
+
+// seedFileRoot returns the root a seed file is named after.
+func seedFileRoot(path string) (common.Address, error) {
+	name := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), seedFilePrefix), ".json")
+	if !common.IsHexAddress(name) {
+		return common.Address{}, fmt.Errorf("seed file '%s' is not named %s<address>.json", path, seedFilePrefix)
+	}
+	return common.HexToAddress(name), nil
+}
+
+// initializeMnemonic generates a mnemonic, shows it once and stores its seed
+// after the user proved to have written it down.
+func initializeMnemonic(c *cli.Context, configDir string, scryptN, scryptP int) error {
+	mnemonic, err := hdwallet.NewMnemonic(mnemonicBits)
+	if err != nil {
+		return err
+	}
+	fmt.Println("\nWrite down the mnemonic below. It is shown only once and restores every account of the root.")
+	fmt.Printf("\n    %s\n\n", mnemonic)
+	if err := confirmMnemonic(mnemonic); err != nil {
+		return err
+	}
+	return storeSeed(c, configDir, mnemonic, scryptN, scryptP)
+}
+
+// confirmMnemonic asks back a few random words of the mnemonic.
+func confirmMnemonic(mnemonic string) error {
+	words := strings.Fields(mnemonic)
+	asked := make(map[int]bool)
+	for len(asked) < mnemonicChecks {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(words))))
+		if err != nil {
+			return err
+		}
+		i := int(n.Int64())
+		if asked[i] {
+			continue
+		}
+		asked[i] = true
+		word, err := console.Stdin.PromptInput(fmt.Sprintf("Please enter word #%d of the mnemonic: ", i+1))
+		if err != nil {
+			return err
+		}
+		if strings.TrimSpace(word) != words[i] {
+			return errors.New("mnemonic confirmation failed, nothing was stored")
+		}
+	}
+	return nil
+}
+
+func restoreSeed(c *cli.Context) error {
+	if err := initialize(c); err != nil {
+		return err
+	}
+	configDir := c.GlobalString(DataDirFlag.Name)
+	if err := os.Mkdir(configDir, 0700); err != nil && !os.IsExist(err) {
+		return err
+	}
+	n, p := keystore.StandardScryptN, keystore.StandardScryptP
+	if c.GlobalBool(utils.LightKDFFlag.Name) {
+		n, p = keystore.LightScryptN, keystore.LightScryptP
+	}
+	input, err := console.Stdin.PromptPassword("Mnemonic: ")
+	if err != nil {
+		return err
+	}
+	return storeSeed(c, configDir, strings.Join(strings.Fields(input), " "), n, p)
+}
+
+// storeSeed derives the BIP-39 seed of mnemonic and stores it encrypted in the
+// datadir, refusing to overwrite the seed of the same root.
+func storeSeed(c *cli.Context, configDir, mnemonic string, scryptN, scryptP int) error {
+	var passphrase string
+	if c.Bool(bip39PassphraseFlag.Name) {
+		passphrase = getPassPhrase("Please specify the BIP-39 passphrase. It is needed together with the mnemonic to restore the root!", true)
+	}
+	seed, err := hdwallet.NewSeedFromMnemonicPassphrase(mnemonic, passphrase)
+	if err != nil {
+		return err
+	}
+	wallet, err := hdwallet.NewFromSeed(seed)
+	if err != nil {
+		return err
+	}
+	defer wallet.Wipe()
+
+	master, err := wallet.MasterPrivateKey()
+	if err != nil {
+		return err
+	}
+	root := crypto.PubkeyToAddress(master.PublicKey)
+	path := seedFileName(configDir, root)
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("the seed of root %s already exists at '%s'", root.Hex(), path)
+	}
+	password := newPassword()
+	data, err := encryptSeed(seed, []byte(password), scryptN, scryptP)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		return err
+	}
+	log.Info("Initialize seed success", "seed path", path, "address", root.String())
+	return nil
+}
+
+// readSeeds decrypts the seed files given by --seed.
+func readSeeds(files []string, passwords *passwordSources) ([]*seedRoot, error) {
+	var seeds []*seedRoot
+	for _, file := range files {
+		root, err := seedFileRoot(file)
+		if err != nil {
+			return nil, err
+		}
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the seed at '%s': %v", file, err)
+		}
+		err = decryptFile(passwords, file, root, func(password string) error {
+			seed, err := decryptSeed(data, password)
+			if err == nil {
+				seeds = append(seeds, &seedRoot{file, root, seed})
+			}
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return seeds, nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"ethereum/keyservice/accounts/keystore"
+	"ethereum/keyservice/crypto"
+	"ethereum/keyservice/services/truekey/hdwallet"
+	"testing"
+)
+
+const testMnemonic = "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+
+func TestSeedFile(t *testing.T) {
+	seed, err := hdwallet.NewSeedFromMnemonicPassphrase(testMnemonic, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wallet, err := hdwallet.NewFromSeed(seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	master, err := wallet.MasterPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := crypto.PubkeyToAddress(master.PublicKey)
+
+	path := seedFileName("data", root)
+	if have, err := seedFileRoot(path); err != nil || have != root {
+		t.Fatalf("seed file root mismatch: have %x (%v), want %x", have, err, root)
+	}
+	if _, err := seedFileRoot("data/UTC--2020-09-10T08-42-10.662467000Z--e4fad2e5ee2e878e65f1fe02c0f9edaf54789a8e"); err == nil {
+		t.Fatal("keystore file accepted as seed file")
+	}
+
+	data, err := encryptSeed(seed, []byte("password"), keystore.LightScryptN, keystore.LightScryptP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := decryptSeed(data, "wrong"); err == nil {
+		t.Fatal("seed decrypted with wrong password")
+	}
+	have, err := decryptSeed(data, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(have, seed) {
+		t.Fatal("seed changed by encryption")
+	}
+
+	// The BIP-39 passphrase yields a different root for the same mnemonic
+	other, err := hdwallet.NewSeedFromMnemonicPassphrase(testMnemonic, "passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(other, seed) {
+		t.Fatal("passphrase did not change the seed")
+	}
+}
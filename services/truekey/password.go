@@ -0,0 +1,156 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"ethereum/keyservice/common"
+	"ethereum/keyservice/log"
+	"ethereum/keyservice/services/truekey/secret"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"unsafe"
+
+	"gopkg.in/urfave/cli.v1"
+)
+
+// passwordEnv is the environment variable holding the password of every root,
+// passwordEnv_<ADDRESS> the password of a single root.
+const passwordEnv = "TRUEKEY_PASSWORD"
+
+var (
+	passwordDirFlag = cli.StringFlag{
+		Name:  "passworddir",
+		Usage: "Directory holding a password file per root, named by the lowercase hex address without 0x",
+	}
+	passwordFdFlag = cli.IntFlag{
+		Name:  "passwordfd",
+		Usage: "File descriptor to read keystore passwords from, one line per keystore",
+		Value: -1,
+	}
+	passwordStdinFlag = cli.BoolFlag{
+		Name:  "passwordstdin",
+		Usage: "Read keystore passwords from stdin, one line per keystore",
+	}
+	skipBadPasswordFlag = cli.BoolFlag{
+		Name:  "skipbadpassword",
+		Usage: "Start without the roots a non-interactive password fails to decrypt, instead of refusing to start",
+	}
+)
+
+// lineReader hands out one password per line of a stream.
+type lineReader struct {
+	name string
+	r    *bufio.Reader
+}
+
+// next returns the next line without its line ending, or nil once the stream
+// is exhausted.
+func (l *lineReader) next() []byte {
+	line, err := l.r.ReadBytes('\n')
+	if err != nil && (err != io.EOF || len(line) == 0) {
+		secret.Wipe(line)
+		return nil
+	}
+	password := append([]byte(nil), bytes.TrimRight(line, "\r\n")...)
+	secret.Wipe(line)
+	return password
+}
+
+// passwordSources resolves the keystore passwords without a terminal. The
+// sources are consulted in order: the password directory, the environment,
+// the file descriptor and stdin. Stream sources hand their next line to each
+// keystore not resolved by an earlier source, in keystore load order.
+type passwordSources struct {
+	dir     string
+	fd      *lineReader
+	stdin   *lineReader
+	skipBad bool // Skip roots a password fails to decrypt rather than fail
+}
+
+func newPasswordSources(ctx *cli.Context) (*passwordSources, error) {
+	s := &passwordSources{
+		dir:     ctx.GlobalString(passwordDirFlag.Name),
+		skipBad: ctx.GlobalBool(skipBadPasswordFlag.Name),
+	}
+	if fd := ctx.GlobalInt(passwordFdFlag.Name); fd >= 0 {
+		f := os.NewFile(uintptr(fd), "passwordfd")
+		if f == nil {
+			return nil, fmt.Errorf("invalid password file descriptor %d", fd)
+		}
+		s.fd = &lineReader{fmt.Sprintf("fd:%d", fd), bufio.NewReader(f)}
+	}
+	if ctx.GlobalBool(passwordStdinFlag.Name) {
+		s.stdin = &lineReader{"stdin", bufio.NewReader(os.Stdin)}
+	}
+	return s, nil
+}
+
+// lookup returns the password of root and the name of the source it came
+// from. A nil password leaves the keystore to the interactive prompt.
+func (s *passwordSources) lookup(root common.Address) ([]byte, string, error) {
+	name := strings.ToLower(common.Bytes2Hex(root.Bytes()))
+	if s.dir != "" {
+		path := filepath.Join(s.dir, name)
+		if info, err := os.Stat(path); err == nil {
+			if info.Mode().Perm()&0077 != 0 {
+				log.Warn("Password file is accessible by other users", "file", path, "mode", info.Mode().Perm())
+			}
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				return nil, "", err
+			}
+			password := append([]byte(nil), bytes.TrimRight(data, "\r\n")...)
+			secret.Wipe(data)
+			return password, "file:" + path, nil
+		}
+	}
+	for _, env := range []string{passwordEnv + "_" + strings.ToUpper(name), passwordEnv} {
+		if value, ok := os.LookupEnv(env); ok {
+			// Drop root specific variables, so they do not leak into children
+			if env != passwordEnv {
+				os.Unsetenv(env)
+			}
+			return []byte(value), "env:" + env, nil
+		}
+	}
+	for _, stream := range []*lineReader{s.fd, s.stdin} {
+		if stream == nil {
+			continue
+		}
+		if password := stream.next(); password != nil {
+			return password, stream.name, nil
+		}
+	}
+	return nil, "", nil
+}
+
+// close drops the shared environment password once every keystore is loaded.
+func (s *passwordSources) close() {
+	os.Unsetenv(passwordEnv)
+}
+
+// unsafeString views b as a string without copying it, so wiping b also
+// wipes the string. The string must not outlive b.
+func unsafeString(b []byte) string {
+	return *(*string)(unsafe.Pointer(&b))
+}
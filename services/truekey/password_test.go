@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"ethereum/keyservice/common"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPasswordPrecedence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "truekey-passwords")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var (
+		fileRoot  = common.HexToAddress("0x01")
+		envRoot   = common.HexToAddress("0x02")
+		streamOne = common.HexToAddress("0x03")
+		streamTwo = common.HexToAddress("0x04")
+	)
+	if err := ioutil.WriteFile(filepath.Join(dir, strings.ToLower(common.Bytes2Hex(fileRoot.Bytes()))), []byte("from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	envName := passwordEnv + "_" + strings.ToUpper(common.Bytes2Hex(envRoot.Bytes()))
+	os.Setenv(envName, "from-env")
+	defer os.Unsetenv(envName)
+
+	s := &passwordSources{
+		dir:   dir,
+		stdin: &lineReader{"stdin", bufio.NewReader(strings.NewReader("first\r\nsecond"))},
+	}
+	tests := []struct {
+		root     common.Address
+		password string
+		source   string
+	}{
+		{fileRoot, "from-file", "file:" + filepath.Join(dir, strings.ToLower(common.Bytes2Hex(fileRoot.Bytes())))},
+		{envRoot, "from-env", "env:" + envName},
+		{streamOne, "first", "stdin"},
+		{streamTwo, "second", "stdin"},
+		{common.HexToAddress("0x05"), "", ""},
+	}
+	for i, tt := range tests {
+		password, source, err := s.lookup(tt.root)
+		if err != nil {
+			t.Fatalf("test %d: %v", i, err)
+		}
+		if string(password) != tt.password || source != tt.source {
+			t.Errorf("test %d: have %q from %q, want %q from %q", i, password, source, tt.password, tt.source)
+		}
+	}
+	if _, ok := os.LookupEnv(envName); ok {
+		t.Error("root password left in the environment")
+	}
+}
+
+func TestWrongPassword(t *testing.T) {
+	dir, err := ioutil.TempDir("", "truekey-passwords")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	root := common.HexToAddress("0x01")
+	if err := ioutil.WriteFile(filepath.Join(dir, strings.ToLower(common.Bytes2Hex(root.Bytes()))), []byte("wrong"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	decrypt := func(password string) error { return errors.New("could not decrypt key with given password") }
+	if err := decryptFile(&passwordSources{dir: dir}, "keyfile", root, decrypt); err == nil {
+		t.Fatal("wrong password accepted")
+	}
+	if err := decryptFile(&passwordSources{dir: dir, skipBad: true}, "keyfile", root, decrypt); err != nil {
+		t.Fatalf("wrong password with skipping: %v", err)
+	}
+}
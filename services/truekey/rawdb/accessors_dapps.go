@@ -0,0 +1,77 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"bytes"
+	"encoding/json"
+	"ethereum/keyservice/common"
+	"ethereum/keyservice/log"
+	"ethereum/keyservice/rlp"
+	"ethereum/keyservice/services/truekey/types"
+)
+
+// ReadDappAccounts retrieves the accounts of the dapps of a root.
+func ReadDappAccounts(db DatabaseReader, root common.Address) []uint32 {
+	data, _ := db.Get(dappsKey(root))
+	if len(data) == 0 {
+		return []uint32{}
+	}
+	var accounts []uint32
+	if err := rlp.Decode(bytes.NewReader(data), &accounts); err != nil {
+		log.Error("Invalid dapp accounts RLP", "root", root, "err", err)
+		return nil
+	}
+	return accounts
+}
+
+// WriteDappAccounts stores the accounts of the dapps of a root.
+func WriteDappAccounts(db DatabaseWriter, root common.Address, accounts []uint32) {
+	data, err := rlp.EncodeToBytes(accounts)
+	if err != nil {
+		log.Crit("Failed to RLP encode dapp accounts", "err", err)
+	}
+	if err := db.Put(dappsKey(root), data); err != nil {
+		log.Crit("Failed to store dapp accounts", "err", err)
+	}
+}
+
+// ReadDapp retrieves a dapp of a root by its account. Dapps are stored as json
+// since unset limits must stay distinguishable from zero.
+func ReadDapp(db DatabaseReader, root common.Address, account uint32) *types.Dapp {
+	data, _ := db.Get(dappKey(root, account))
+	if len(data) == 0 {
+		return nil
+	}
+	dapp := new(types.Dapp)
+	if err := json.Unmarshal(data, dapp); err != nil {
+		log.Error("Invalid dapp JSON", "root", root, "account", account, "err", err)
+		return nil
+	}
+	return dapp
+}
+
+// WriteDapp stores a dapp.
+func WriteDapp(db DatabaseWriter, dapp *types.Dapp) {
+	data, err := json.Marshal(dapp)
+	if err != nil {
+		log.Crit("Failed to JSON encode dapp", "err", err)
+	}
+	if err := db.Put(dappKey(dapp.Root, dapp.Account), data); err != nil {
+		log.Crit("Failed to store dapp", "err", err)
+	}
+}
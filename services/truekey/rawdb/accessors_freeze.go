@@ -0,0 +1,69 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"bytes"
+	"ethereum/keyservice/common"
+	"ethereum/keyservice/common/hexutil"
+	"ethereum/keyservice/log"
+	"ethereum/keyservice/rlp"
+	"ethereum/keyservice/services/truekey/types"
+)
+
+// ReadFreeze retrieves the signing freeze of a root, the zero address holds the
+// freeze of all roots. Nil means signing is not frozen.
+func ReadFreeze(db DatabaseReader, root common.Address) *types.Freeze {
+	data, _ := db.Get(freezeKey(root))
+	if len(data) == 0 {
+		return nil
+	}
+	freeze := new(types.Freeze)
+	if err := rlp.Decode(bytes.NewReader(data), freeze); err != nil {
+		// Freezes stored before the root was recorded
+		var legacy struct {
+			Reason string
+			By     []common.Address
+			At     hexutil.Uint64
+		}
+		if rlp.DecodeBytes(data, &legacy) == nil {
+			return &types.Freeze{Reason: legacy.Reason, By: legacy.By, At: legacy.At}
+		}
+		// Fail closed, a corrupt record must not unfreeze signing
+		log.Error("Invalid freeze RLP", "root", root, "err", err)
+		return &types.Freeze{Reason: "corrupt freeze record"}
+	}
+	return freeze
+}
+
+// WriteFreeze stores the signing freeze of a root.
+func WriteFreeze(db DatabaseWriter, root common.Address, freeze *types.Freeze) {
+	data, err := rlp.EncodeToBytes(freeze)
+	if err != nil {
+		log.Crit("Failed to RLP encode freeze", "err", err)
+	}
+	if err := db.Put(freezeKey(root), data); err != nil {
+		log.Crit("Failed to store freeze", "err", err)
+	}
+}
+
+// DeleteFreeze lifts the signing freeze of a root.
+func DeleteFreeze(db DatabaseDeleter, root common.Address) {
+	if err := db.Delete(freezeKey(root)); err != nil {
+		log.Crit("Failed to delete freeze", "err", err)
+	}
+}
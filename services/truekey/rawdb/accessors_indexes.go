@@ -35,3 +35,9 @@ func HasAccountLookupEntry(db DatabaseReader, hash common.Hash) bool {
 	}
 	return true
 }
+
+// CheckDatabase reports whether the database can still be read.
+func CheckDatabase(db DatabaseReader) error {
+	_, err := db.Has(indexKey)
+	return err
+}
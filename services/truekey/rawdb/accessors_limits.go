@@ -0,0 +1,92 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"bytes"
+	"encoding/json"
+	"ethereum/keyservice/common"
+	"ethereum/keyservice/log"
+	"ethereum/keyservice/rlp"
+	"ethereum/keyservice/services/truekey/types"
+)
+
+// ReadUsage retrieves the spending counters of a scope, or empty counters if
+// nothing was recorded yet.
+func ReadUsage(db DatabaseReader, hash common.Hash) *types.Usage {
+	data, _ := db.Get(usageKey(hash))
+	if len(data) == 0 {
+		return types.NewUsage()
+	}
+	usage := new(types.Usage)
+	if err := rlp.Decode(bytes.NewReader(data), usage); err != nil {
+		log.Error("Invalid usage RLP", "hash", hash, "err", err)
+		return types.NewUsage()
+	}
+	return usage
+}
+
+// WriteUsage stores the spending counters of a scope.
+func WriteUsage(db DatabaseWriter, hash common.Hash, usage *types.Usage) {
+	data, err := rlp.EncodeToBytes(usage)
+	if err != nil {
+		log.Crit("Failed to RLP encode usage", "err", err)
+	}
+	if err := db.Put(usageKey(hash), data); err != nil {
+		log.Crit("Failed to store usage", "err", err)
+	}
+}
+
+// DeleteUsage removes the spending counters of a scope.
+func DeleteUsage(db DatabaseDeleter, hash common.Hash) {
+	if err := db.Delete(usageKey(hash)); err != nil {
+		log.Crit("Failed to delete usage", "err", err)
+	}
+}
+
+// ReadLimits retrieves the spending limits admins set for a root. The limits
+// are stored as json since unset windows must stay distinguishable from zero.
+func ReadLimits(db DatabaseReader, root common.Address) *types.AdminLimits {
+	data, _ := db.Get(limitsKey(root))
+	if len(data) == 0 {
+		return nil
+	}
+	limits := new(types.AdminLimits)
+	if err := json.Unmarshal(data, limits); err != nil {
+		log.Error("Invalid limits JSON", "root", root, "err", err)
+		return nil
+	}
+	return limits
+}
+
+// WriteLimits stores the spending limits admins set for a root.
+func WriteLimits(db DatabaseWriter, root common.Address, limits *types.AdminLimits) {
+	data, err := json.Marshal(limits)
+	if err != nil {
+		log.Crit("Failed to JSON encode limits", "err", err)
+	}
+	if err := db.Put(limitsKey(root), data); err != nil {
+		log.Crit("Failed to store limits", "err", err)
+	}
+}
+
+// DeleteLimits removes the spending limits admins set for a root.
+func DeleteLimits(db DatabaseDeleter, root common.Address) {
+	if err := db.Delete(limitsKey(root)); err != nil {
+		log.Crit("Failed to delete limits", "err", err)
+	}
+}
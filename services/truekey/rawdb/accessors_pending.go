@@ -0,0 +1,91 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"bytes"
+	"ethereum/keyservice/common"
+	"ethereum/keyservice/log"
+	"ethereum/keyservice/rlp"
+	"ethereum/keyservice/services/truekey/types"
+)
+
+// ReadPendingRequest retrieves an escalated request by its id.
+func ReadPendingRequest(db DatabaseReader, id common.Hash) *types.PendingRequest {
+	data, _ := db.Get(pendingKey(id))
+	if len(data) == 0 {
+		return nil
+	}
+	req := new(types.PendingRequest)
+	if err := rlp.Decode(bytes.NewReader(data), req); err != nil {
+		log.Error("Invalid pending request RLP", "id", id, "err", err)
+		return nil
+	}
+	return req
+}
+
+// WritePendingRequest stores an escalated request.
+func WritePendingRequest(db DatabaseWriter, req *types.PendingRequest) {
+	data, err := rlp.EncodeToBytes(req)
+	if err != nil {
+		log.Crit("Failed to RLP encode pending request", "err", err)
+	}
+	if err := db.Put(pendingKey(req.ID), data); err != nil {
+		log.Crit("Failed to store pending request", "err", err)
+	}
+}
+
+// ReadPendingIndex retrieves the ids of the requests awaiting a decision.
+func ReadPendingIndex(db DatabaseReader) []common.Hash {
+	data, _ := db.Get(pendingIndexKey)
+	if len(data) == 0 {
+		return []common.Hash{}
+	}
+	var ids []common.Hash
+	if err := rlp.Decode(bytes.NewReader(data), &ids); err != nil {
+		log.Error("Invalid pending index RLP", "err", err)
+		return nil
+	}
+	return ids
+}
+
+// WritePendingIndex stores the ids of the requests awaiting a decision.
+func WritePendingIndex(db DatabaseWriter, ids []common.Hash) {
+	data, err := rlp.EncodeToBytes(ids)
+	if err != nil {
+		log.Crit("Failed to RLP encode pending index", "err", err)
+	}
+	if err := db.Put(pendingIndexKey, data); err != nil {
+		log.Crit("Failed to store pending index", "err", err)
+	}
+}
+
+// ReadPendingRequestIDs retrieves the ids of every stored request, decided or
+// not. Of a database that cannot be iterated only the undecided ones are found.
+func ReadPendingRequestIDs(db DatabaseReader) []common.Hash {
+	keys, ok := keysWithPrefix(db, pendingPrefix)
+	if !ok {
+		return ReadPendingIndex(db)
+	}
+	var ids []common.Hash
+	for _, key := range keys {
+		if len(key) == len(pendingPrefix)+common.HashLength {
+			ids = append(ids, common.BytesToHash(key[len(pendingPrefix):]))
+		}
+	}
+	return ids
+}
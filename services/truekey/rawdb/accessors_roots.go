@@ -0,0 +1,71 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"bytes"
+	"ethereum/keyservice/common"
+	"ethereum/keyservice/log"
+	"ethereum/keyservice/rlp"
+	"ethereum/keyservice/services/truekey/types"
+)
+
+// ReadRetirement retrieves the retirement of a root, nil if it is in service.
+func ReadRetirement(db DatabaseReader, root common.Address) *types.Retirement {
+	data, _ := db.Get(retiredKey(root))
+	if len(data) == 0 {
+		return nil
+	}
+	retired := new(types.Retirement)
+	if err := rlp.Decode(bytes.NewReader(data), retired); err != nil {
+		// Fail closed, a corrupt record must not bring the root back
+		log.Error("Invalid retirement RLP", "root", root, "err", err)
+		return &types.Retirement{Reason: "corrupt retirement record"}
+	}
+	return retired
+}
+
+// WriteRetirement stores the retirement of a root.
+func WriteRetirement(db DatabaseWriter, root common.Address, retired *types.Retirement) {
+	data, err := rlp.EncodeToBytes(retired)
+	if err != nil {
+		log.Crit("Failed to RLP encode retirement", "err", err)
+	}
+	if err := db.Put(retiredKey(root), data); err != nil {
+		log.Crit("Failed to store retirement", "err", err)
+	}
+}
+
+// DeleteRetirement puts a retired root back into service.
+func DeleteRetirement(db DatabaseDeleter, root common.Address) {
+	if err := db.Delete(retiredKey(root)); err != nil {
+		log.Crit("Failed to delete retirement", "err", err)
+	}
+}
+
+// ReadUserKey retrieves the encrypted key of the internal user ids of a root.
+func ReadUserKey(db DatabaseReader, root common.Address) []byte {
+	data, _ := db.Get(userKeyKey(root))
+	return data
+}
+
+// WriteUserKey stores the encrypted key of the internal user ids of a root.
+func WriteUserKey(db DatabaseWriter, root common.Address, sealed []byte) {
+	if err := db.Put(userKeyKey(root), sealed); err != nil {
+		log.Crit("Failed to store user id key", "err", err)
+	}
+}
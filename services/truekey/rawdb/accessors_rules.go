@@ -0,0 +1,41 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"ethereum/keyservice/log"
+)
+
+// ReadRuleValue retrieves a value stored by the rule scripts.
+func ReadRuleValue(db DatabaseReader, key string) string {
+	data, _ := db.Get(rulesKey(key))
+	return string(data)
+}
+
+// WriteRuleValue stores a value on behalf of the rule scripts.
+func WriteRuleValue(db DatabaseWriter, key, value string) {
+	if err := db.Put(rulesKey(key), []byte(value)); err != nil {
+		log.Crit("Failed to store rule value", "err", err)
+	}
+}
+
+// DeleteRuleValue removes a value stored by the rule scripts.
+func DeleteRuleValue(db DatabaseDeleter, key string) {
+	if err := db.Delete(rulesKey(key)); err != nil {
+		log.Crit("Failed to delete rule value", "err", err)
+	}
+}
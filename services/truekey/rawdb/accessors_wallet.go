@@ -210,3 +210,47 @@ func HasRootInfo(db DatabaseReader, hash common.Hash) bool {
 	}
 	return true
 }
+
+// DeleteRootInfo removes the list of child accounts of a root, which is kept as
+// one key per child once migrated.
+func DeleteRootInfo(db DatabaseDeleter, hash common.Hash) {
+	if err := db.Delete(adminInfoKey(hash)); err != nil {
+		log.Crit("Failed to delete root info", "err", err)
+	}
+}
+
+// ReadRootChildren retrieves the ids of the child accounts registered under a
+// root. Of a database that cannot be iterated none are found.
+func ReadRootChildren(db DatabaseReader, root common.Hash) []common.Hash {
+	prefix := append(append([]byte{}, rootChildPrefix...), root.Bytes()...)
+	keys, _ := keysWithPrefix(db, prefix)
+	ids := make([]common.Hash, 0, len(keys))
+	for _, key := range keys {
+		if len(key) == len(prefix)+common.HashLength {
+			ids = append(ids, common.BytesToHash(key[len(prefix):]))
+		}
+	}
+	return ids
+}
+
+// WriteRootChild records a child account as registered under a root.
+func WriteRootChild(db DatabaseWriter, root, id common.Hash) {
+	if err := db.Put(rootChildKey(root, id), []byte{}); err != nil {
+		log.Crit("Failed to store root child", "err", err)
+	}
+}
+
+// HasRootChild reports whether a child account is registered under a root.
+func HasRootChild(db DatabaseReader, root, id common.Hash) bool {
+	if has, err := db.Has(rootChildKey(root, id)); !has || err != nil {
+		return false
+	}
+	return true
+}
+
+// DeleteRootChild removes a child account from those registered under a root.
+func DeleteRootChild(db DatabaseDeleter, root, id common.Hash) {
+	if err := db.Delete(rootChildKey(root, id)); err != nil {
+		log.Crit("Failed to delete root child", "err", err)
+	}
+}
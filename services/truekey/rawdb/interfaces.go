@@ -16,6 +16,14 @@
 
 package rawdb
 
+import (
+	"bytes"
+
+	"ethereum/keyservice/common"
+
+	"github.com/syndtr/goleveldb/leveldb/iterator"
+)
+
 // DatabaseReader wraps the Has and Get method of a backing data store.
 type DatabaseReader interface {
 	Has(key []byte) (bool, error)
@@ -31,3 +39,28 @@ type DatabaseWriter interface {
 type DatabaseDeleter interface {
 	Delete(key []byte) error
 }
+
+// keysWithPrefix returns the keys of db starting with prefix, and false if db
+// cannot be iterated.
+func keysWithPrefix(db DatabaseReader, prefix []byte) ([][]byte, bool) {
+	var keys [][]byte
+	switch db := db.(type) {
+	case interface {
+		NewIteratorWithPrefix(prefix []byte) iterator.Iterator
+	}:
+		it := db.NewIteratorWithPrefix(prefix)
+		for it.Next() {
+			keys = append(keys, common.CopyBytes(it.Key()))
+		}
+		it.Release()
+	case interface{ Keys() [][]byte }:
+		for _, key := range db.Keys() {
+			if bytes.HasPrefix(key, prefix) {
+				keys = append(keys, key)
+			}
+		}
+	default:
+		return nil, false
+	}
+	return keys, true
+}
@@ -18,6 +18,7 @@
 package rawdb
 
 import (
+	"encoding/binary"
 	"ethereum/keyservice/common"
 )
 
@@ -26,6 +27,9 @@ var (
 	// fastTrieProgressKey tracks the number of trie entries imported during fast sync.
 	indexKey = []byte("index")
 
+	// pendingIndexKey tracks the requests still waiting for an admin decision.
+	pendingIndexKey = []byte("pendingIndex")
+
 	accountLookupPrefix = []byte("l") // accountLookupPrefix + hash -> account lookup metadata
 
 	// Data item prefixes (use single byte to avoid mixing data types, avoid `i`, used for indexes).
@@ -33,7 +37,16 @@ var (
 	adminWalletPrefix = []byte("b") // adminWalletPrefix  + hash -> adminWallet
 	dappInfoPrefix    = []byte("c") // dappInfoPrefix  + hash -> dappInfo
 	adminInfoPrefix   = []byte("d") // adminInfoPrefix + hash -> header
+	rootChildPrefix   = []byte("h") // rootChildPrefix + root hash + child id -> child account registered under the root
 	accountPrefix     = []byte("e") // dappPrefix + hash (dappid) + root -> dapp account index
+	rulesPrefix       = []byte("r") // rulesPrefix + key -> rule script storage value
+	usagePrefix       = []byte("u") // usagePrefix + hash (scope) -> spending counters
+	limitsPrefix      = []byte("m") // limitsPrefix + root -> spending limits set by admins
+	pendingPrefix     = []byte("q") // pendingPrefix + hash (request id) -> escalated request
+	freezePrefix      = []byte("z") // freezePrefix + root (zero for all roots) -> signing freeze
+	retiredPrefix     = []byte("t") // retiredPrefix + root -> retirement of the root
+	userKeyPrefix     = []byte("k") // userKeyPrefix + root -> user id key, encrypted to the root
+	dappPrefix        = []byte("n") // dappPrefix + root (+ account uint32 big endian) -> dapp accounts (dapp)
 )
 
 // AccountLookup is a positional metadata to help looking up the data content of
@@ -77,3 +90,55 @@ func accountLookupKey(hash common.Hash) []byte {
 func adminInfoKey(hash common.Hash) []byte {
 	return append(adminInfoPrefix, hash.Bytes()...)
 }
+
+// rootChildKey = rootChildPrefix + root + id
+func rootChildKey(root, id common.Hash) []byte {
+	return append(append(rootChildPrefix, root.Bytes()...), id.Bytes()...)
+}
+
+// rulesKey = rulesPrefix + key
+func rulesKey(key string) []byte {
+	return append(rulesPrefix, key...)
+}
+
+// usageKey = usagePrefix + hash
+func usageKey(hash common.Hash) []byte {
+	return append(usagePrefix, hash.Bytes()...)
+}
+
+// limitsKey = limitsPrefix + root
+func limitsKey(root common.Address) []byte {
+	return append(limitsPrefix, root.Bytes()...)
+}
+
+// pendingKey = pendingPrefix + hash
+func pendingKey(id common.Hash) []byte {
+	return append(pendingPrefix, id.Bytes()...)
+}
+
+// freezeKey = freezePrefix + root
+func freezeKey(root common.Address) []byte {
+	return append(freezePrefix, root.Bytes()...)
+}
+
+// retiredKey = retiredPrefix + root
+func retiredKey(root common.Address) []byte {
+	return append(retiredPrefix, root.Bytes()...)
+}
+
+// dappsKey = dappPrefix + root
+func dappsKey(root common.Address) []byte {
+	return append(dappPrefix, root.Bytes()...)
+}
+
+// dappKey = dappPrefix + root + account (uint32 big endian)
+func dappKey(root common.Address, account uint32) []byte {
+	enc := make([]byte, 4)
+	binary.BigEndian.PutUint32(enc, account)
+	return append(dappsKey(root), enc...)
+}
+
+// userKeyKey = userKeyPrefix + root
+func userKeyKey(root common.Address) []byte {
+	return append(userKeyPrefix, root.Bytes()...)
+}
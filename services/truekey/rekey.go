@@ -0,0 +1,257 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"ethereum/keyservice/accounts/keystore"
+	"ethereum/keyservice/common"
+	"ethereum/keyservice/crypto"
+	"ethereum/keyservice/log"
+	"ethereum/keyservice/services/truekey/secret"
+	"ethereum/keyservice/services/truekey/signer"
+	"ethereum/keyservice/services/utils"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pborman/uuid"
+	"gopkg.in/urfave/cli.v1"
+)
+
+// backupSuffix marks the copies rekey keeps of replaced files. Such files are
+// never loaded from --keystoredir.
+const backupSuffix = ".bak"
+
+var (
+	scryptNFlag = cli.IntFlag{
+		Name:  "scryptn",
+		Usage: "Scrypt N parameter of the re-encrypted file",
+		Value: keystore.StandardScryptN,
+	}
+	scryptPFlag = cli.IntFlag{
+		Name:  "scryptp",
+		Usage: "Scrypt P parameter of the re-encrypted file",
+		Value: keystore.StandardScryptP,
+	}
+	newPasswordFileFlag = cli.StringFlag{
+		Name:  "newpasswordfile",
+		Usage: "File holding the new password, prompted for if not given",
+	}
+	rekeyCommand = cli.Command{
+		Action:    utils.MigrateFlags(rekey),
+		Name:      "rekey",
+		Usage:     "Re-encrypt a keystore or seed file with a new password and scrypt parameters",
+		ArgsUsage: "<keyfile>",
+		Flags: []cli.Flag{
+			logLevelFlag,
+			utils.LightKDFFlag,
+			scryptNFlag,
+			scryptPFlag,
+			newPasswordFileFlag,
+			passwordDirFlag,
+			passwordFdFlag,
+			passwordStdinFlag,
+		},
+		Description: `
+The rekey command decrypts a keystore or seed file with its current password and
+encrypts it again with a new password, using --scryptn and --scryptp or the light
+parameters with --lightkdf. The result is verified before it atomically replaces the
+file, the old file is kept next to it as <keyfile>.<unix time>.bak.`,
+	}
+)
+
+// rekey re-encrypts a keystore or seed file in place.
+func rekey(c *cli.Context) error {
+	if err := initialize(c); err != nil {
+		return err
+	}
+	if c.NArg() != 1 {
+		return errors.New("please specify the keystore or seed file to rekey")
+	}
+	file := c.Args().First()
+	n, p := c.Int(scryptNFlag.Name), c.Int(scryptPFlag.Name)
+	if c.GlobalBool(utils.LightKDFFlag.Name) {
+		n, p = keystore.LightScryptN, keystore.LightScryptP
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("failed to read '%s': %v", file, err)
+	}
+	passwords, err := newPasswordSources(c)
+	if err != nil {
+		return err
+	}
+	defer passwords.close()
+
+	// decrypt returns the secret of an encrypted file, so both versions of the
+	// file can be compared without knowing what kind of file it is.
+	var (
+		root    common.Address
+		decrypt func(data []byte, password string) ([]byte, error)
+		encrypt func(secret []byte, password string) ([]byte, error)
+	)
+	if root, err = seedFileRoot(file); err == nil {
+		decrypt = decryptSeed
+		encrypt = func(seed []byte, password string) ([]byte, error) {
+			return encryptSeed(seed, []byte(password), n, p)
+		}
+	} else {
+		var key struct {
+			Address string `json:"address"`
+			Id      string `json:"id"`
+		}
+		if err := json.Unmarshal(data, &key); err != nil || !common.IsHexAddress(key.Address) {
+			return fmt.Errorf("'%s' is neither a keystore nor a seed file", file)
+		}
+		root = common.HexToAddress(key.Address)
+		id := uuid.Parse(key.Id)
+		decrypt = func(data []byte, password string) ([]byte, error) {
+			key, err := keystore.DecryptKey(data, password)
+			if err != nil {
+				return nil, err
+			}
+			defer secret.WipeKey(key.PrivateKey)
+			if key.Address != root {
+				return nil, fmt.Errorf("keystore holds %s instead of %s", key.Address.Hex(), root.Hex())
+			}
+			return crypto.FromECDSA(key.PrivateKey), nil
+		}
+		encrypt = func(material []byte, password string) ([]byte, error) {
+			privateKey, err := crypto.ToECDSA(material)
+			if err != nil {
+				return nil, err
+			}
+			key := &keystore.Key{Id: id, Address: root, PrivateKey: privateKey}
+			defer secret.WipeKey(key.PrivateKey)
+			return keystore.EncryptKey(key, password, n, p)
+		}
+	}
+	var material []byte
+	err = decryptFile(passwords, file, root, func(password string) (err error) {
+		material, err = decrypt(data, password)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if material == nil {
+		return fmt.Errorf("failed to decrypt '%s'", file)
+	}
+	defer secret.Wipe(material)
+
+	password, err := rekeyPassword(c)
+	if err != nil {
+		return err
+	}
+	if old, err := decrypt(data, password); err == nil {
+		secret.Wipe(old)
+		return errors.New("the new password must differ from the current one")
+	}
+	content, err := encrypt(material, password)
+	if err != nil {
+		return err
+	}
+	// Verify the new file before anything is replaced
+	have, err := decrypt(content, password)
+	if err != nil {
+		return fmt.Errorf("verification of the re-encrypted file failed: %v", err)
+	}
+	equal := bytes.Equal(have, material)
+	secret.Wipe(have)
+	if !equal {
+		return errors.New("verification of the re-encrypted file failed: secret differs")
+	}
+	backup, err := replaceFile(file, data, content)
+	if err != nil {
+		return err
+	}
+	log.Info("Rekey success", "file", file, "root", root.Hex(), "backup", backup, "scryptN", n, "scryptP", p)
+	return nil
+}
+
+// rekeyPassword returns the new password from --newpasswordfile or the prompt.
+func rekeyPassword(c *cli.Context) (string, error) {
+	path := c.String(newPasswordFileFlag.Name)
+	if path == "" {
+		return newPassword(), nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read the new password: %v", err)
+	}
+	password := string(bytes.TrimRight(data, "\r\n"))
+	secret.Wipe(data)
+	if err := signer.ValidatePasswordFormat(password); err != nil {
+		return "", fmt.Errorf("invalid password: %v", err)
+	}
+	return password, nil
+}
+
+// replaceFile atomically replaces file, which held old, with content. The old
+// content is first written to a backup next to it, whose path is returned.
+func replaceFile(file string, old, content []byte) (string, error) {
+	info, err := os.Stat(file)
+	if err != nil {
+		return "", err
+	}
+	backup := fmt.Sprintf("%s.%d%s", file, time.Now().Unix(), backupSuffix)
+	if err := writeSynced(backup, old, info.Mode().Perm()); err != nil {
+		return "", fmt.Errorf("failed to write the backup: %v", err)
+	}
+	tmp := filepath.Join(filepath.Dir(file), "."+filepath.Base(file)+".tmp")
+	if err := writeSynced(tmp, content, info.Mode().Perm()); err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	if err := os.Rename(tmp, file); err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	return backup, syncDir(filepath.Dir(file))
+}
+
+// writeSynced writes a new file and flushes it to disk.
+func writeSynced(path string, content []byte, perm os.FileMode) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(content); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// syncDir flushes a directory, so a rename within it survives a crash.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
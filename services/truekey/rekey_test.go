@@ -0,0 +1,46 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReplaceFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "truekey-rekey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "UTC--keystore")
+	if err := ioutil.WriteFile(file, []byte("old"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	backup, err := replaceFile(file, []byte("old"), []byte("new"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(backup, backupSuffix) || filepath.Dir(backup) != dir {
+		t.Fatalf("unexpected backup path %s", backup)
+	}
+	if data, _ := ioutil.ReadFile(file); string(data) != "new" {
+		t.Fatalf("file not replaced: %q", data)
+	}
+	if data, _ := ioutil.ReadFile(backup); string(data) != "old" {
+		t.Fatalf("backup holds %q", data)
+	}
+	if info, _ := os.Stat(file); info.Mode().Perm() != 0600 {
+		t.Fatalf("mode changed to %v", info.Mode().Perm())
+	}
+	// Backups and temporaries are never loaded as keystores
+	files, err := getAllKeystoreFile(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 0 {
+		t.Fatalf("non keystores loaded: %v", files)
+	}
+}
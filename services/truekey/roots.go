@@ -0,0 +1,101 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"ethereum/keyservice/accounts"
+	"ethereum/keyservice/accounts/keystore"
+	"ethereum/keyservice/event"
+	"ethereum/keyservice/log"
+	"ethereum/keyservice/services/truekey/secret"
+	"ethereum/keyservice/services/truekey/signer"
+	"ethereum/keyservice/services/truekey/types"
+	"io/ioutil"
+	"strings"
+)
+
+// watchKeystores follows the keystore directory with the watcher of the
+// keystore package. A keystore that appears is loaded as a sealed root, which
+// admins add with its passphrase or custodians unseal, and it is unlocked right
+// away if passwordDir holds its password. A keystore removed before it was
+// unlocked is dropped, served roots keep signing until they are retired.
+func watchKeystores(api *signer.SignerAPI, dir, passwordDir string) event.Subscription {
+	// The scrypt parameters only matter for new accounts, which are never created
+	ks := keystore.NewKeyStore(dir, keystore.LightScryptN, keystore.LightScryptP)
+	events := make(chan accounts.WalletEvent, 16)
+	sub := ks.Subscribe(events)
+	go func() {
+		for {
+			select {
+			case ev := <-events:
+				keystoreEvent(api, ev, passwordDir)
+			case <-sub.Err():
+				return
+			}
+		}
+	}()
+	log.Info("Watching keystore directory", "dir", dir)
+	return sub
+}
+
+// keystoreEvent applies a change of the keystore directory to the signer.
+func keystoreEvent(api *signer.SignerAPI, ev accounts.WalletEvent, passwordDir string) {
+	path := ev.Wallet.URL().Path
+	if strings.HasSuffix(path, backupSuffix) || len(ev.Wallet.Accounts()) == 0 {
+		return
+	}
+	root := ev.Wallet.Accounts()[0].Address
+
+	switch ev.Kind {
+	case accounts.WalletArrived:
+		keyjson, err := ioutil.ReadFile(path)
+		if err != nil {
+			log.Warn("Failed to read new keystore", "path", path, "err", err)
+			return
+		}
+		if _, err := api.AddKeystore(keyjson); err != nil {
+			log.Warn("Failed to load new keystore", "path", path, "err", err)
+			return
+		}
+		if passwordDir == "" {
+			log.Info("Keystore loaded, root sealed", "path", path, "root", root)
+			return
+		}
+		password, source, err := (&passwordSources{dir: passwordDir}).lookup(root)
+		if err != nil || password == nil {
+			log.Info("Keystore loaded, root sealed", "path", path, "root", root, "err", err)
+			return
+		}
+		err = api.UnlockKeystore(root, unsafeString(password))
+		secret.Wipe(password)
+		switch err {
+		case nil:
+			log.Info("Keystore loaded, root served", "path", path, "root", root, "password", source)
+		case types.ErrRootUnsealed:
+			// Served already, e.g. loaded at startup
+		default:
+			log.Error("Decrypt keystore failed", "keyfile", path, "password", source, "err", err)
+		}
+
+	case accounts.WalletDropped:
+		if api.RemoveKeystore(root) {
+			log.Info("Keystore removed, root dropped", "path", path, "root", root)
+		} else {
+			log.Warn("Keystore removed, root keeps signing until retired", "path", path, "root", root)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+// Package rules implements operator supplied javascript rules which approve,
+// reject or escalate signing and registration requests.
+package rules
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"ethereum/keyservice/internal/jsre"
+	"ethereum/keyservice/log"
+	"ethereum/keyservice/services/truekey/types"
+	"github.com/robertkrimen/otto"
+)
+
+// ruleTimeout bounds the execution time of a single rule invocation.
+const ruleTimeout = time.Second
+
+var (
+	errRuleMissing   = errors.New("rule not defined")
+	errTxRuleMissing = errors.New("rules do not define ApproveTx")
+	errRuleTimeout   = errors.New("rule execution timed out")
+	errRuleHalt      = errors.New("halt")
+)
+
+// consoleOutput is an override for the console.log and console.error methods to
+// stream the output into the configured output stream instead of stdout.
+func consoleOutput(call otto.FunctionCall) otto.Value {
+	output := []string{"JS:> "}
+	for _, argument := range call.ArgumentList {
+		output = append(output, fmt.Sprintf("%v", argument))
+	}
+	log.Info(strings.Join(output, " "))
+	return otto.Value{}
+}
+
+// RuleEvaluator evaluates the operator rules. Each invocation runs in a fresh
+// vm, so the only state a script can keep between calls is its Storage.
+type RuleEvaluator struct {
+	jsRules string
+	storage Storage
+	lock    sync.Mutex // Serialises executions so storage updates are atomic
+}
+
+// NewRuleEvaluator creates a new evaluator backed by the given storage.
+func NewRuleEvaluator(storage Storage) *RuleEvaluator {
+	return &RuleEvaluator{storage: storage}
+}
+
+// Init loads the javascript rules, failing if they cannot be compiled and run
+// or do not define ApproveTx. A misspelt ApproveTx would otherwise leave
+// signing unrestricted.
+func (r *RuleEvaluator) Init(javascriptRules string) error {
+	r.jsRules = javascriptRules
+	vm, err := r.newVM()
+	if err != nil {
+		return err
+	}
+	if fn, err := vm.Get("ApproveTx"); err != nil || !fn.IsFunction() {
+		return errTxRuleMissing
+	}
+	return nil
+}
+
+func (r *RuleEvaluator) newVM() (*otto.Otto, error) {
+	vm := otto.New()
+
+	// Bind the sandboxed storage, it is the only persistent state scripts get
+	vm.Set("storage", struct{}{})
+	storageObj, _ := vm.Get("storage")
+	storageObj.Object().Set("put", func(call otto.FunctionCall) otto.Value {
+		key, val := call.Argument(0).String(), call.Argument(1).String()
+		if key == "" {
+			return otto.FalseValue()
+		}
+		r.storage.Put(key, val)
+		return otto.TrueValue()
+	})
+	storageObj.Object().Set("get", func(call otto.FunctionCall) otto.Value {
+		val, _ := otto.ToValue(r.storage.Get(call.Argument(0).String()))
+		return val
+	})
+	storageObj.Object().Set("del", func(call otto.FunctionCall) otto.Value {
+		r.storage.Del(call.Argument(0).String())
+		return otto.TrueValue()
+	})
+
+	vm.Set("console", struct{}{})
+	consoleObj, _ := vm.Get("console")
+	consoleObj.Object().Set("log", consoleOutput)
+	consoleObj.Object().Set("error", consoleOutput)
+
+	if _, err := vm.Run(string(jsre.BigNumber_JS)); err != nil {
+		return nil, err
+	}
+	if _, err := vm.Run(r.jsRules); err != nil {
+		return nil, fmt.Errorf("failed to load rules: %v", err)
+	}
+	return vm, nil
+}
+
+// execute calls jsfunc with the json encoding of jsarg.
+func (r *RuleEvaluator) execute(jsfunc string, jsarg interface{}) (val otto.Value, err error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	vm, err := r.newVM()
+	if err != nil {
+		return otto.UndefinedValue(), err
+	}
+	fn, err := vm.Get(jsfunc)
+	if err != nil || !fn.IsFunction() {
+		return otto.UndefinedValue(), errRuleMissing
+	}
+	arg, err := json.Marshal(jsarg)
+	if err != nil {
+		return otto.UndefinedValue(), err
+	}
+	defer func() {
+		if caught := recover(); caught != nil {
+			if caught != errRuleHalt {
+				panic(caught)
+			}
+			val, err = otto.UndefinedValue(), errRuleTimeout
+		}
+	}()
+	vm.Interrupt = make(chan func(), 1)
+	timer := time.AfterFunc(ruleTimeout, func() {
+		vm.Interrupt <- func() { panic(errRuleHalt) }
+	})
+	defer timer.Stop()
+
+	return vm.Run(fmt.Sprintf("%s(%s)", jsfunc, arg))
+}
+
+// checkApproval runs a rule and maps its result onto a Decision. Scripts fail
+// closed: any error or unexpected result yields a rejection. Operators that do
+// not define ApproveRegister leave registration unrestricted, ApproveTx is
+// required by Init.
+func (r *RuleEvaluator) checkApproval(jsfunc string, jsarg interface{}) (types.Decision, error) {
+	v, err := r.execute(jsfunc, jsarg)
+	if err == errRuleMissing && jsfunc != "ApproveTx" {
+		log.Debug("Rule not defined, approving", "func", jsfunc)
+		return types.DecisionApprove, nil
+	}
+	if err != nil {
+		log.Warn("Rule execution failed", "func", jsfunc, "err", err)
+		return types.DecisionReject, err
+	}
+	result, err := v.ToString()
+	if err != nil {
+		return types.DecisionReject, err
+	}
+	return types.ParseDecision(result), nil
+}
+
+// ApproveTx implements types.Policy by calling the ApproveTx rule.
+func (r *RuleEvaluator) ApproveTx(req *types.TxRequest) (types.Decision, error) {
+	return r.checkApproval("ApproveTx", req)
+}
+
+// ApproveRegister implements types.Policy by calling the ApproveRegister rule.
+func (r *RuleEvaluator) ApproveRegister(req *types.RegisterRequest) (types.Decision, error) {
+	return r.checkApproval("ApproveRegister", req)
+}
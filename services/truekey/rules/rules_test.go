@@ -0,0 +1,89 @@
+package rules
+
+import (
+	"testing"
+
+	"ethereum/keyservice/etruedb"
+	"ethereum/keyservice/services/truekey/types"
+)
+
+const testRules = `
+function ApproveTx(req) {
+	var value = new BigNumber(req.value);
+	if (value.greaterThan(new BigNumber("1000000000000000000000"))) {
+		return "escalate";
+	}
+	var count = parseInt(storage.get(req.userId) || "0") + 1;
+	storage.put(req.userId, count.toString());
+	if (count > 2) {
+		return "reject";
+	}
+	return "approve";
+}
+function ApproveRegister(req) {
+	if (req.meta.remote == "10.0.0.1") {
+		throw new Error("boom");
+	}
+	return "Approve";
+}
+`
+
+func newTestEvaluator(t *testing.T, js string) *RuleEvaluator {
+	r := NewRuleEvaluator(NewDBStorage(etruedb.NewMemDatabase()))
+	if err := r.Init(js); err != nil {
+		t.Fatalf("failed to init rules: %v", err)
+	}
+	return r
+}
+
+func TestApproveTx(t *testing.T) {
+	r := newTestEvaluator(t, testRules)
+
+	req := &types.TxRequest{UserID: "42", Value: "1"}
+	for i, want := range []types.Decision{types.DecisionApprove, types.DecisionApprove, types.DecisionReject} {
+		if got, err := r.ApproveTx(req); err != nil || got != want {
+			t.Fatalf("call %d: have %v (err %v), want %v", i, got, err, want)
+		}
+	}
+	req = &types.TxRequest{UserID: "43", Value: "2000000000000000000000"}
+	if got, _ := r.ApproveTx(req); got != types.DecisionEscalate {
+		t.Fatalf("have %v, want %v", got, types.DecisionEscalate)
+	}
+}
+
+func TestFailClosed(t *testing.T) {
+	r := newTestEvaluator(t, testRules)
+
+	req := &types.RegisterRequest{Meta: types.RequestMeta{Remote: "10.0.0.1"}}
+	if got, err := r.ApproveRegister(req); err == nil || got != types.DecisionReject {
+		t.Fatalf("have %v (err %v), want reject with error", got, err)
+	}
+	req.Meta.Remote = "10.0.0.2"
+	if got, err := r.ApproveRegister(req); err != nil || got != types.DecisionApprove {
+		t.Fatalf("have %v (err %v), want approve", got, err)
+	}
+
+	loop := newTestEvaluator(t, `function ApproveTx(req) { while (true) {} }`)
+	if got, err := loop.ApproveTx(&types.TxRequest{}); err != errRuleTimeout || got != types.DecisionReject {
+		t.Fatalf("have %v (err %v), want timeout rejection", got, err)
+	}
+	if got, err := loop.ApproveRegister(&types.RegisterRequest{}); err != nil || got != types.DecisionApprove {
+		t.Fatalf("undefined rule: have %v (err %v), want approve", got, err)
+	}
+	noResult := newTestEvaluator(t, `function ApproveTx(req) {}`)
+	if got, _ := noResult.ApproveTx(&types.TxRequest{}); got != types.DecisionReject {
+		t.Fatalf("have %v, want reject", got)
+	}
+}
+
+func TestMissingTxRule(t *testing.T) {
+	for _, js := range []string{
+		`function ApproveRegister(req) { return "approve"; }`,
+		`function approveTx(req) { return "approve"; }`,
+		`var ApproveTx = "approve";`,
+	} {
+		if err := NewRuleEvaluator(NewDBStorage(etruedb.NewMemDatabase())).Init(js); err != errTxRuleMissing {
+			t.Errorf("%s: have %v, want %v", js, err, errTxRuleMissing)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package rules
+
+import (
+	"ethereum/keyservice/etruedb"
+	"ethereum/keyservice/services/truekey/rawdb"
+)
+
+// Storage is the key-value store exposed to the rule scripts.
+type Storage interface {
+	Put(key, value string)
+	Get(key string) string
+	Del(key string)
+}
+
+// dbStorage persists the script values in the signer database, under a prefix
+// that keeps them apart from the account data.
+type dbStorage struct {
+	db etruedb.Database
+}
+
+// NewDBStorage returns a Storage backed by db.
+func NewDBStorage(db etruedb.Database) Storage {
+	return &dbStorage{db: db}
+}
+
+func (s *dbStorage) Put(key, value string) {
+	rawdb.WriteRuleValue(s.db, key, value)
+}
+
+func (s *dbStorage) Get(key string) string {
+	return rawdb.ReadRuleValue(s.db, key)
+}
+
+func (s *dbStorage) Del(key string) {
+	rawdb.DeleteRuleValue(s.db, key)
+}
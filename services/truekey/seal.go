@@ -0,0 +1,81 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"ethereum/keyservice/accounts/keystore"
+	"ethereum/keyservice/common/hexutil"
+	"ethereum/keyservice/log"
+	"ethereum/keyservice/services/truekey/secret"
+	"ethereum/keyservice/services/truekey/shamir"
+	"ethereum/keyservice/services/truekey/types"
+	"fmt"
+	"io/ioutil"
+
+	"gopkg.in/urfave/cli.v1"
+)
+
+// initializeSharedKeyStore creates a keystore encrypted with a random passphrase
+// and prints the passphrase only as unseal shares. Nobody ever sees the whole
+// passphrase, the root is unlocked by custodians submitting their shares.
+func initializeSharedKeyStore(c *cli.Context, configDir string, scryptN, scryptP int) error {
+	parts, threshold := c.Int(sharesFlag.Name), c.Int(thresholdFlag.Name)
+
+	entropy := make([]byte, 32)
+	if _, err := rand.Read(entropy); err != nil {
+		return err
+	}
+	password := []byte(hex.EncodeToString(entropy))
+	secret.Wipe(entropy)
+	defer secret.Wipe(password)
+
+	shares, err := shamir.Split(password, parts, threshold)
+	if err != nil {
+		return err
+	}
+	set, err := types.NewShareSet(threshold)
+	if err != nil {
+		return err
+	}
+	ks := keystore.NewKeyStore(configDir, scryptN, scryptP)
+	account, err := ks.NewAccount(unsafeString(password))
+	if err != nil {
+		return err
+	}
+	// Record the share set in the keystore, unsealing trusts it over the shares
+	keyjson, err := ioutil.ReadFile(account.URL.Path)
+	if err != nil {
+		return err
+	}
+	if keyjson, err = types.WithShareSet(keyjson, set); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(account.URL.Path, keyjson, 0600); err != nil {
+		return err
+	}
+	fmt.Printf("\nHand every share to a different custodian, they are shown only once.\n")
+	fmt.Printf("Any %d of the %d shares unseal root %s.\n\n", threshold, parts, account.Address.Hex())
+	for i, share := range shares {
+		fmt.Printf("Share %d: %s\n", i+1, hexutil.Encode(types.EncodeShare(set, share)))
+		secret.Wipe(share)
+	}
+	fmt.Println()
+	log.Info("Initialize keystore success", "keystore path", configDir, "address", account.Address.String(), "shares", parts, "threshold", threshold)
+	return nil
+}
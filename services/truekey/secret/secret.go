@@ -0,0 +1,23 @@
+// Package secret wipes secrets, such as passwords, shares and private keys,
+// from memory once they are no longer needed.
+package secret
+
+import "crypto/ecdsa"
+
+// Wipe overwrites a secret in memory.
+func Wipe(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+// WipeKey overwrites a private key in memory. A nil key is ignored.
+func WipeKey(k *ecdsa.PrivateKey) {
+	if k == nil {
+		return
+	}
+	b := k.D.Bits()
+	for i := range b {
+		b[i] = 0
+	}
+}
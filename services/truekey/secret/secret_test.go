@@ -0,0 +1,24 @@
+package secret
+
+import (
+	"bytes"
+	"ethereum/keyservice/crypto"
+	"testing"
+)
+
+func TestWipe(t *testing.T) {
+	b := []byte("passphrase")
+	Wipe(b)
+	if !bytes.Equal(b, make([]byte, len(b))) {
+		t.Fatalf("secret left in memory: %x", b)
+	}
+
+	key, _ := crypto.GenerateKey()
+	WipeKey(key)
+	for _, word := range key.D.Bits() {
+		if word != 0 {
+			t.Fatal("private key left in memory")
+		}
+	}
+	WipeKey(nil)
+}
@@ -0,0 +1,133 @@
+// Package shamir implements Shamir's secret sharing over GF(2^8), splitting a
+// secret into shares any threshold of which rebuild it.
+package shamir
+
+import (
+	"crypto/rand"
+	"errors"
+)
+
+var (
+	ErrThreshold   = errors.New("threshold must be between 2 and the number of parts")
+	ErrParts       = errors.New("parts must be between 2 and 255")
+	ErrEmptySecret = errors.New("cannot split an empty secret")
+	ErrShares      = errors.New("need at least two shares of equal length")
+	ErrDuplicate   = errors.New("duplicate share")
+)
+
+// expTable and logTable implement multiplication in GF(2^8) with the AES
+// polynomial x^8 + x^4 + x^3 + x + 1, using 3 as generator.
+var (
+	expTable [510]byte
+	logTable [256]byte
+)
+
+func init() {
+	x := byte(1)
+	for i := 0; i < 255; i++ {
+		expTable[i], expTable[i+255] = x, x
+		logTable[x] = byte(i)
+		// Multiply by the generator: x*3 = x*2 ^ x
+		hi := x & 0x80
+		x2 := x << 1
+		if hi != 0 {
+			x2 ^= 0x1b
+		}
+		x = x2 ^ x
+	}
+}
+
+func mul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return expTable[int(logTable[a])+int(logTable[b])]
+}
+
+func div(a, b byte) byte {
+	if a == 0 {
+		return 0
+	}
+	return expTable[int(logTable[a])+255-int(logTable[b])]
+}
+
+// Split divides secret into parts shares, any threshold of which rebuild it.
+// Every share holds one byte per secret byte followed by its x coordinate.
+func Split(secret []byte, parts, threshold int) ([][]byte, error) {
+	if parts < 2 || parts > 255 {
+		return nil, ErrParts
+	}
+	if threshold < 2 || threshold > parts {
+		return nil, ErrThreshold
+	}
+	if len(secret) == 0 {
+		return nil, ErrEmptySecret
+	}
+	shares := make([][]byte, parts)
+	for i := range shares {
+		shares[i] = make([]byte, len(secret)+1)
+		shares[i][len(secret)] = byte(i + 1)
+	}
+	// One random polynomial of degree threshold-1 per byte, with the secret
+	// byte as constant term
+	coeffs := make([]byte, threshold)
+	defer zero(coeffs)
+	for idx, b := range secret {
+		if _, err := rand.Read(coeffs[1:]); err != nil {
+			return nil, err
+		}
+		coeffs[0] = b
+		for _, share := range shares {
+			x := share[len(secret)]
+			var y byte
+			for i := threshold - 1; i >= 0; i-- {
+				y = mul(y, x) ^ coeffs[i]
+			}
+			share[idx] = y
+		}
+	}
+	return shares, nil
+}
+
+// Combine rebuilds the secret from shares. With fewer shares than the split
+// threshold the result is garbage, callers must verify it.
+func Combine(shares [][]byte) ([]byte, error) {
+	if len(shares) < 2 || len(shares[0]) < 2 {
+		return nil, ErrShares
+	}
+	size := len(shares[0]) - 1
+	xs := make([]byte, len(shares))
+	seen := make(map[byte]bool)
+	for i, share := range shares {
+		if len(share) != size+1 {
+			return nil, ErrShares
+		}
+		xs[i] = share[size]
+		if xs[i] == 0 || seen[xs[i]] {
+			return nil, ErrDuplicate
+		}
+		seen[xs[i]] = true
+	}
+	secret := make([]byte, size)
+	for idx := range secret {
+		// Lagrange interpolation at x = 0
+		var y byte
+		for i, share := range shares {
+			basis := byte(1)
+			for j := range shares {
+				if i != j {
+					basis = mul(basis, div(xs[j], xs[j]^xs[i]))
+				}
+			}
+			y ^= mul(share[idx], basis)
+		}
+		secret[idx] = y
+	}
+	return secret, nil
+}
+
+func zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
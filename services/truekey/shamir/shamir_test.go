@@ -0,0 +1,45 @@
+package shamir
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSplitCombine(t *testing.T) {
+	secret := []byte("correct horse battery staple")
+	shares, err := Split(secret, 5, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, subset := range [][]int{{0, 1, 2}, {4, 2, 0}, {1, 3, 4}, {0, 1, 2, 3, 4}} {
+		var parts [][]byte
+		for _, i := range subset {
+			parts = append(parts, shares[i])
+		}
+		have, err := Combine(parts)
+		if err != nil {
+			t.Fatalf("subset %v: %v", subset, err)
+		}
+		if !bytes.Equal(have, secret) {
+			t.Errorf("subset %v: have %q, want %q", subset, have, secret)
+		}
+	}
+	if have, _ := Combine(shares[:2]); bytes.Equal(have, secret) {
+		t.Error("secret rebuilt below the threshold")
+	}
+	if _, err := Combine([][]byte{shares[0], shares[0]}); err != ErrDuplicate {
+		t.Errorf("duplicate shares: have %v, want %v", err, ErrDuplicate)
+	}
+}
+
+func TestSplitInvalid(t *testing.T) {
+	if _, err := Split([]byte("x"), 3, 4); err != ErrThreshold {
+		t.Errorf("threshold above parts: have %v, want %v", err, ErrThreshold)
+	}
+	if _, err := Split([]byte("x"), 1, 1); err != ErrParts {
+		t.Errorf("single part: have %v, want %v", err, ErrParts)
+	}
+	if _, err := Split(nil, 3, 2); err != ErrEmptySecret {
+		t.Errorf("empty secret: have %v, want %v", err, ErrEmptySecret)
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"ethereum/keyservice/log"
+	"ethereum/keyservice/rpc"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"gopkg.in/urfave/cli.v1"
+)
+
+// defaultShutdownTimeout is how long in-flight requests may take on shutdown.
+const defaultShutdownTimeout = 10 * time.Second
+
+var shutdownTimeoutFlag = cli.DurationFlag{
+	Name:  "shutdowntimeout",
+	Usage: "How long in-flight requests may take to finish on SIGTERM or SIGINT",
+	Value: defaultShutdownTimeout,
+}
+
+// httpServer is an HTTP RPC endpoint that is drained on shutdown.
+type httpServer struct {
+	url    string
+	server *http.Server
+}
+
+// endpoints are the RPC endpoints served by the daemon.
+type endpoints struct {
+	http       []httpServer
+	ipcURL     string
+	ipc        net.Listener
+	ipcHandler *rpc.Server
+}
+
+// drain stops accepting connections and waits for the in-flight HTTP requests
+// until they are done, the timeout passed or another signal arrived. Requests
+// still running then are cut off.
+func (e *endpoints) drain(timeout time.Duration, abort <-chan os.Signal) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	go func() {
+		select {
+		case sig := <-abort:
+			log.Warn("Second signal received, not waiting for requests", "signal", sig)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	if e.ipc != nil {
+		e.ipc.Close()
+		log.Info("IPC endpoint closed", "url", e.ipcURL)
+	}
+	var wg sync.WaitGroup
+	for _, endpoint := range e.http {
+		wg.Add(1)
+		go func(endpoint httpServer) {
+			defer wg.Done()
+			if err := endpoint.server.Shutdown(ctx); err != nil {
+				log.Warn("HTTP requests cut off", "url", endpoint.url, "err", err)
+				endpoint.server.Close()
+			}
+			log.Info("HTTP endpoint closed", "url", endpoint.url)
+		}(endpoint)
+	}
+	wg.Wait()
+}
+
+// close drops the remaining IPC connections. It is called once the signer has
+// stopped, so the calls in flight on them have finished.
+func (e *endpoints) close() {
+	if e.ipcHandler != nil {
+		e.ipcHandler.Stop()
+	}
+}
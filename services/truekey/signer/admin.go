@@ -0,0 +1,262 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package signer
+
+import (
+	"context"
+	"ethereum/keyservice/common"
+	"ethereum/keyservice/common/hexutil"
+	"ethereum/keyservice/services/truekey/audit"
+	"ethereum/keyservice/services/truekey/types"
+	"time"
+)
+
+// adminCallTimeout bounds how far the creation time of an admin authorisation
+// may drift from the local clock.
+const adminCallTimeout = 5 * time.Minute
+
+// checkAuth verifies the admin signatures of a call and returns the admins that
+// signed it. Read-only calls need a single admin of the root, mutating calls
+// (quorum set) need the configured threshold of them.
+func (api *SignerAPI) checkAuth(auth types.AdminAuth, quorum bool, method string, params ...interface{}) ([]common.Address, error) {
+	config, signers, err := api.authSigners(auth, method, params...)
+	if err != nil {
+		return nil, err
+	}
+	for _, signer := range signers {
+		if !config.IsAdmin(signer) {
+			return nil, types.ErrAdminError
+		}
+	}
+	need := 1
+	if quorum {
+		need = config.Threshold()
+	}
+	if len(signers) < need {
+		return nil, types.ErrAdminQuorum
+	}
+	api.useCall(auth, method, params...)
+	return signers, nil
+}
+
+// checkAuditor verifies a call of the auditor role, which needs one auditor of
+// the root and no admin.
+func (api *SignerAPI) checkAuditor(auth types.AdminAuth, method string, params ...interface{}) ([]common.Address, error) {
+	config, signers, err := api.authSigners(auth, method, params...)
+	if err != nil {
+		return nil, err
+	}
+	for _, signer := range signers {
+		if !config.IsAuditor(signer) {
+			return nil, types.ErrNotAuditor
+		}
+	}
+	if len(signers) == 0 {
+		return nil, types.ErrAdminQuorum
+	}
+	api.useCall(auth, method, params...)
+	return signers, nil
+}
+
+// authSigners checks the authorisation is fresh and recovers who signed it.
+func (api *SignerAPI) authSigners(auth types.AdminAuth, method string, params ...interface{}) (types.RootConfig, []common.Address, error) {
+	if api.stopped {
+		return types.RootConfig{}, nil, types.ErrShuttingDown
+	}
+	config, exists := api.configs[auth.Root]
+	if !exists {
+		return types.RootConfig{}, nil, types.ErrRootError
+	}
+	created := time.Unix(int64(auth.CreatedAt), 0)
+	if time.Since(created) > adminCallTimeout || time.Until(created) > adminCallTimeout {
+		return types.RootConfig{}, nil, types.ErrAdminAuthExpired
+	}
+	if _, used := api.usedCalls[auth.Hash(method, params...)]; used {
+		return types.RootConfig{}, nil, types.ErrAdminReplay
+	}
+	signers, err := auth.Signers(method, params...)
+	if err != nil {
+		return types.RootConfig{}, nil, err
+	}
+	return config, signers, nil
+}
+
+// useCall records an accepted admin call, so it cannot be replayed while its
+// creation time is still fresh. Calls turned down can be retried, with more
+// signatures say.
+func (api *SignerAPI) useCall(auth types.AdminAuth, method string, params ...interface{}) {
+	api.markUsed(auth.Hash(method, params...), time.Unix(int64(auth.CreatedAt), 0))
+}
+
+// markUsed records the admin or dapp call signed over hash and created at
+// created until it expires. Expired calls are dropped from the record.
+func (api *SignerAPI) markUsed(hash common.Hash, created time.Time) {
+	now := time.Now()
+	for used, expires := range api.usedCalls {
+		if now.After(expires) {
+			delete(api.usedCalls, used)
+		}
+	}
+	api.usedCalls[hash] = created.Add(adminCallTimeout)
+}
+
+// AdminServerAPI implements types.AdminAPI. It must only be exposed on the admin
+// endpoints, never on the dapp facing HTTP endpoint.
+type AdminServerAPI struct {
+	extApi *SignerAPI
+}
+
+// NewAdminServerAPI creates a new AdminServerAPI
+func NewAdminServerAPI(extapi *SignerAPI) *AdminServerAPI {
+	return &AdminServerAPI{extapi}
+}
+
+// SetLimits replaces the spending limits of the root, it needs a quorum.
+// Example call
+// {"jsonrpc":"2.0","method":"admin_setLimits","params":[{"root":"0x..","createdAt":"0x..","signatures":["0x.."]},{"account":{"day":{"value":1000000000000000000}}}], "id":1}
+func (s *AdminServerAPI) SetLimits(ctx context.Context, auth types.AdminAuth, limits types.LimitConfig) error {
+	return s.extApi.setLimits(auth, limits)
+}
+
+// Usage reports the spending of an account or a dapp of the root.
+func (s *AdminServerAPI) Usage(ctx context.Context, auth types.AdminAuth, scope types.UsageScope) (*types.UsageReport, error) {
+	return s.extApi.usage(auth, scope)
+}
+
+// ResetUsage clears the spending counters of an account or a dapp, it needs a quorum.
+func (s *AdminServerAPI) ResetUsage(ctx context.Context, auth types.AdminAuth, scope types.UsageScope) error {
+	return s.extApi.resetUsage(auth, scope)
+}
+
+// PendingRequests lists the requests of the root waiting for approval.
+func (s *AdminServerAPI) PendingRequests(ctx context.Context, auth types.AdminAuth) ([]*types.PendingRequest, error) {
+	return s.extApi.pendingRequests(auth)
+}
+
+// ApproveRequest signs an escalated request of the root, it needs a quorum.
+// Example call
+// {"jsonrpc":"2.0","method":"admin_approveRequest","params":[{"root":"0x..","createdAt":"0x..","signatures":["0x.."]},"0x..","checked with the customer"], "id":1}
+func (s *AdminServerAPI) ApproveRequest(ctx context.Context, auth types.AdminAuth, id common.Hash, reason string) (*types.PendingResult, error) {
+	return s.extApi.approveRequest(auth, id, reason)
+}
+
+// DenyRequest rejects an escalated request of the root.
+func (s *AdminServerAPI) DenyRequest(ctx context.Context, auth types.AdminAuth, id common.Hash, reason string) (*types.PendingResult, error) {
+	return s.extApi.denyRequest(auth, id, reason)
+}
+
+// Freeze stops signing for the root, or for every root if global is set, until
+// a quorum unfreezes it. Registration and read-only calls keep working.
+// Example call
+// {"jsonrpc":"2.0","method":"admin_freeze","params":[{"root":"0x..","createdAt":"0x..","signatures":["0x.."]},true,"key compromise suspected"], "id":1}
+func (s *AdminServerAPI) Freeze(ctx context.Context, auth types.AdminAuth, global bool, reason string) error {
+	return s.extApi.freeze(auth, global, reason)
+}
+
+// Unfreeze resumes signing, it needs a quorum.
+func (s *AdminServerAPI) Unfreeze(ctx context.Context, auth types.AdminAuth, global bool, reason string) error {
+	return s.extApi.unfreeze(auth, global, reason)
+}
+
+// FreezeStatus reports the global freeze and the freeze of the root.
+func (s *AdminServerAPI) FreezeStatus(ctx context.Context, auth types.AdminAuth) (*types.FreezeStatus, error) {
+	return s.extApi.freezeStatus(auth)
+}
+
+// Seal wipes the keys of the root from memory until custodians unseal it.
+func (s *AdminServerAPI) Seal(ctx context.Context, auth types.AdminAuth) error {
+	return s.extApi.seal(auth)
+}
+
+// Unseal submits a custodian's share of the root passphrase. It needs no admin
+// signature, holding a share is the authorisation.
+// Example call
+// {"jsonrpc":"2.0","method":"admin_unseal","params":["0x..","0x.."], "id":1}
+func (s *AdminServerAPI) Unseal(ctx context.Context, root common.Address, share hexutil.Bytes) (*types.SealStatus, error) {
+	return s.extApi.unseal(root, share)
+}
+
+// SealStatus reports whether the root is sealed and how many shares were submitted.
+func (s *AdminServerAPI) SealStatus(ctx context.Context, root common.Address) (*types.SealStatus, error) {
+	return s.extApi.sealStatus(root)
+}
+
+// AddRoot serves a root whose keystore was loaded at startup or appeared in the
+// keystore directory, decrypting it with the passphrase. A retired root needs
+// a quorum to be added back.
+// Example call
+// {"jsonrpc":"2.0","method":"admin_addRoot","params":[{"root":"0x..","createdAt":"0x..","signatures":["0x.."]},"passphrase"], "id":1}
+func (s *AdminServerAPI) AddRoot(ctx context.Context, auth types.AdminAuth, passphrase string) error {
+	return s.extApi.addRootKeystore(auth, passphrase)
+}
+
+// RetireRoot takes the root out of service, it needs a quorum. Its data stays.
+func (s *AdminServerAPI) RetireRoot(ctx context.Context, auth types.AdminAuth, reason string) error {
+	return s.extApi.retireRoot(auth, reason)
+}
+
+// AddDapp adds a dapp to the root, it needs a quorum. The dapp gets the next
+// free hardened account, its users are derived under it.
+// Example call
+// {"jsonrpc":"2.0","method":"admin_addDapp","params":[{"root":"0x..","createdAt":"0x..","signatures":["0x.."]},{"name":"wallet","key":"0x..","allowlist":["10.0.0.0/8"]}], "id":1}
+func (s *AdminServerAPI) AddDapp(ctx context.Context, auth types.AdminAuth, settings types.DappSettings) (*types.Dapp, error) {
+	return s.extApi.addDapp(auth, settings)
+}
+
+// UpdateDapp replaces the settings of a dapp of the root, it needs a quorum.
+// The account and the users of the dapp stay.
+func (s *AdminServerAPI) UpdateDapp(ctx context.Context, auth types.AdminAuth, account uint32, settings types.DappSettings) (*types.Dapp, error) {
+	return s.extApi.updateDapp(auth, account, settings)
+}
+
+// Dapps lists the dapps of the root.
+func (s *AdminServerAPI) Dapps(ctx context.Context, auth types.AdminAuth) ([]*types.Dapp, error) {
+	return s.extApi.dapps(auth)
+}
+
+// ExtendedPublicKey exports the extended public key of the branch of an account
+// of the root, a dapp or any other. The addresses of the users under the
+// account derive from it with hdwallet.DeriveAddress, without the private keys.
+// Example call
+// {"jsonrpc":"2.0","method":"admin_extendedPublicKey","params":[{"root":"0x..","createdAt":"0x..","signatures":["0x.."]},2000000], "id":1}
+func (s *AdminServerAPI) ExtendedPublicKey(ctx context.Context, auth types.AdminAuth, account uint32) (*types.ExtendedPublicKey, error) {
+	return s.extApi.extendedPublicKey(auth, account)
+}
+
+// ImportUserIDs registers users of the root, of the dapp with account dapp if
+// set, in a single write, at most types.MaxImportUsers a call. Users registered
+// before keep their accounts, so an import is resumed by calling it again.
+// Example call
+// {"jsonrpc":"2.0","method":"admin_importUserIds","params":[{"root":"0x..","createdAt":"0x..","signatures":["0x.."]},["alice",13800000000],2000000], "id":1}
+func (s *AdminServerAPI) ImportUserIDs(ctx context.Context, auth types.AdminAuth, users []types.UserID, dapp *uint32) ([]*types.ImportedAccount, error) {
+	return s.extApi.importUserIDs(auth, users, dapp)
+}
+
+// AuditSearch searches the audit log for records of the root. It is the call of
+// the auditor role: it needs the signature of an auditor of the root, admins
+// cannot search.
+// Example call
+// {"jsonrpc":"2.0","method":"admin_auditSearch","params":[{"root":"0x..","createdAt":"0x..","signatures":["0x.."]},{"from":"2026-10-01T00:00:00Z","method":"SignHashPlain","outcome":"reject"}], "id":1}
+func (s *AdminServerAPI) AuditSearch(ctx context.Context, auth types.AdminAuth, query audit.Query) (*types.AuditSearchResult, error) {
+	return s.extApi.auditSearch(auth, query)
+}
+
+// ReloadConfig re-reads the config file like SIGHUP does. An invalid config is
+// rejected and the active one kept, otherwise the changes are returned.
+func (s *AdminServerAPI) ReloadConfig(ctx context.Context, auth types.AdminAuth) ([]string, error) {
+	return s.extApi.reloadConfig(auth)
+}
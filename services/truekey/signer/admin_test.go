@@ -0,0 +1,102 @@
+package signer
+
+import (
+	"crypto/ecdsa"
+	"ethereum/keyservice/common"
+	"ethereum/keyservice/common/hexutil"
+	"ethereum/keyservice/crypto"
+	"ethereum/keyservice/etruedb"
+	"ethereum/keyservice/services/truekey/types"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func newAdminTestAPI(t *testing.T, admins int) (*SignerAPI, common.Address, []*ecdsa.PrivateKey) {
+	root := common.HexToAddress("0xe4FAd2E5eE2E878e65F1fe02c0F9edAf54789a8e")
+	config := types.RootConfig{Root: root}
+	var keys []*ecdsa.PrivateKey
+	for i := 0; i < admins; i++ {
+		key, _ := crypto.GenerateKey()
+		keys = append(keys, key)
+		config.Admins = append(config.Admins, crypto.PubkeyToAddress(key.PublicKey))
+	}
+	api, err := NewSignerAPI(etruedb.NewMemDatabase(), nil, []types.RootConfig{config})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return api, root, keys
+}
+
+func signAdminCall(root common.Address, keys []*ecdsa.PrivateKey, method string, params ...interface{}) types.AdminAuth {
+	auth := types.AdminAuth{Root: root, CreatedAt: hexutil.Uint64(time.Now().Unix()), Nonce: hexutil.Uint64(rand.Uint64())}
+	hash := auth.Hash(method, params...)
+	for _, key := range keys {
+		sig, _ := crypto.Sign(hash.Bytes(), key)
+		auth.Signatures = append(auth.Signatures, sig)
+	}
+	return auth
+}
+
+func TestAdminQuorum(t *testing.T) {
+	api, root, keys := newAdminTestAPI(t, 3)
+	dapp := uint64(7)
+	scope := types.UsageScope{Dapp: &dapp}
+
+	if _, err := api.usage(signAdminCall(root, keys[:1], "admin_usage", scope), scope); err != nil {
+		t.Fatalf("single admin read: %v", err)
+	}
+	if err := api.resetUsage(signAdminCall(root, keys[:1], "admin_resetUsage", scope), scope); err != types.ErrAdminQuorum {
+		t.Fatalf("single admin reset: have %v, want %v", err, types.ErrAdminQuorum)
+	}
+	dup := []*ecdsa.PrivateKey{keys[0], keys[0]}
+	if err := api.resetUsage(signAdminCall(root, dup, "admin_resetUsage", scope), scope); err != types.ErrAdminQuorum {
+		t.Fatalf("duplicate signatures: have %v, want %v", err, types.ErrAdminQuorum)
+	}
+	if err := api.resetUsage(signAdminCall(root, keys[:2], "admin_resetUsage", scope), scope); err != nil {
+		t.Fatalf("quorum reset: %v", err)
+	}
+	// A signature over another call must not be accepted
+	if err := api.resetUsage(signAdminCall(root, keys[:2], "admin_usage", scope), scope); err != types.ErrAdminError {
+		t.Fatalf("wrong method: have %v, want %v", err, types.ErrAdminError)
+	}
+	outsider, _ := crypto.GenerateKey()
+	if _, err := api.usage(signAdminCall(root, []*ecdsa.PrivateKey{outsider}, "admin_usage", scope), scope); err != types.ErrAdminError {
+		t.Fatalf("outsider: have %v, want %v", err, types.ErrAdminError)
+	}
+	expired := signAdminCall(root, keys, "admin_usage", scope)
+	expired.CreatedAt -= hexutil.Uint64(2 * adminCallTimeout / time.Second)
+	if _, err := api.usage(expired, scope); err != types.ErrAdminAuthExpired {
+		t.Fatalf("expired: have %v, want %v", err, types.ErrAdminAuthExpired)
+	}
+}
+
+func TestAdminReplay(t *testing.T) {
+	api, root, keys := newAdminTestAPI(t, 3)
+	dapp := uint64(7)
+	scope := types.UsageScope{Dapp: &dapp}
+
+	// A call turned down for its quorum is retried with more signatures
+	auth := signAdminCall(root, keys[:1], "admin_resetUsage", scope)
+	if err := api.resetUsage(auth, scope); err != types.ErrAdminQuorum {
+		t.Fatalf("single admin reset: have %v, want %v", err, types.ErrAdminQuorum)
+	}
+	second, _ := crypto.Sign(auth.Hash("admin_resetUsage", scope).Bytes(), keys[1])
+	auth.Signatures = append(auth.Signatures, second)
+	if err := api.resetUsage(auth, scope); err != nil {
+		t.Fatalf("reset with quorum: %v", err)
+	}
+	if err := api.resetUsage(auth, scope); err != types.ErrAdminReplay {
+		t.Fatalf("replayed reset: have %v, want %v", err, types.ErrAdminReplay)
+	}
+	// The same call with another nonce is a new call
+	if err := api.resetUsage(signAdminCall(root, keys[:2], "admin_resetUsage", scope), scope); err != nil {
+		t.Fatalf("second reset: %v", err)
+	}
+	// Expired calls leave the record, they are refused as expired
+	api.usedCalls[common.Hash{}] = time.Now().Add(-time.Second)
+	api.usage(signAdminCall(root, keys[:1], "admin_usage", scope), scope)
+	if _, kept := api.usedCalls[common.Hash{}]; kept {
+		t.Fatal("expired call kept")
+	}
+}
@@ -25,15 +25,19 @@ import (
 	coreType "ethereum/keyservice/core/types"
 	"ethereum/keyservice/crypto"
 	"ethereum/keyservice/etruedb"
+	"ethereum/keyservice/event"
 	"ethereum/keyservice/log"
 	"ethereum/keyservice/rlp"
+	"ethereum/keyservice/services/truekey/audit"
 	"ethereum/keyservice/services/truekey/hdwallet"
 	"ethereum/keyservice/services/truekey/rawdb"
+	"ethereum/keyservice/services/truekey/secret"
 	"ethereum/keyservice/services/truekey/types"
 	"fmt"
 	"math/big"
 	"os"
 	"sync"
+	"time"
 )
 
 func init() {
@@ -44,12 +48,35 @@ const (
 	DefaultBaseDerivationPath = "m/44'/60'/0'/0/"
 )
 
+// dappRoot is the root the dapp facing calls register and sign with.
+var dappRoot = common.HexToAddress("0xe4FAd2E5eE2E878e65F1fe02c0F9edAf54789a8e")
+
 // SignerAPI defines the actual implementation of ExternalAPI
 type SignerAPI struct {
 	db          etruedb.Database
 	rootWallets map[common.Address]*types.RootWallet
 	indexMutex  *sync.Mutex //block mutex
 	PrivateKeys map[common.Address]*ecdsa.PrivateKey
+	configs     map[common.Address]types.RootConfig
+	policy      types.Policy
+
+	config          types.Config
+	loadConfig      ConfigLoader
+	configListeners []func(types.Config)
+
+	keystores map[common.Address][]byte
+	unsealing map[common.Address]*unsealState
+	usedCalls map[common.Hash]time.Time // Accepted admin and dapp calls until they expire
+
+	pendingTimeout time.Duration
+	pendingFeed    event.Feed
+	audit          log.Logger
+	auditSigner    func(*ecdsa.PrivateKey)
+	auditRoot      common.Address
+	auditSearcher  func(audit.Query, func(*audit.Record, []byte) error) error
+	quit           chan struct{}
+	started        time.Time
+	stopped        bool
 }
 
 // NewSignerAPI creates a new API that can be used for Accounts management.
@@ -62,43 +89,227 @@ func NewSignerAPI(db etruedb.Database, keys []*keystore.Key, configs []types.Roo
 		rootWallets: make(map[common.Address]*types.RootWallet),
 		indexMutex:  new(sync.Mutex),
 		PrivateKeys: make(map[common.Address]*ecdsa.PrivateKey),
+		configs:     make(map[common.Address]types.RootConfig),
+		keystores:   make(map[common.Address][]byte),
+		unsealing:   make(map[common.Address]*unsealState),
+		usedCalls:   make(map[common.Hash]time.Time),
+
+		pendingTimeout: DefaultPendingTimeout,
+		audit:          log.Root(),
+		quit:           make(chan struct{}),
+		started:        time.Now(),
+	}
+	for _, root := range configs {
+		signer.configs[root.Root] = root
 	}
+	signer.dropStaleLimits("startup")
 	for _, k := range keys {
-		wallet, err := hdwallet.NewFromSeed(crypto.FromECDSA(k.PrivateKey))
-		if err != nil {
+		if err := signer.unlock(k); err == types.ErrRootRetired {
+			log.Warn("Root retired, not serving it", "root", k.Address)
+		} else if err != nil {
 			return nil, err
 		}
-		address := crypto.PubkeyToAddress(k.PrivateKey.PublicKey)
-		log.Info("NewSignerAPI", "address", address)
-		signer.PrivateKeys[address] = k.PrivateKey
-		signer.rootWallets[k.Address] = &types.RootWallet{
-			Wallet:   wallet,
-			Accounts: make(map[uint64]*types.ChildAccount),
-		}
 	}
-	signer.init(configs)
+	go signer.loop()
 	return signer, nil
 }
 
-func (api *SignerAPI) init(configs []types.RootConfig) {
-	if len(configs) > 0 {
-		for _, root := range configs {
-			v, exists := api.rootWallets[root.Root]
-			if !exists {
-				continue
-			}
-			childHashs := rawdb.ReadRootInfo(api.db, root.Root.Hash())
-			for _, hash := range childHashs {
-				child := rawdb.ReadChildAccount(api.db, hash)
-				privateKey, err := v.Wallet.PrivateKey(child.Account)
-				if err != nil {
-					fmt.Println(fmt.Sprintf("%v: %v", "Wallet calculate PrivateKey error", err))
-					continue
-				}
-				child.PrivateKey = privateKey
-				v.Accounts[convertHashToUint(hash)] = child
-			}
+// unlock serves the root of a decrypted keystore, loading the child accounts
+// registered under it. Retired roots are refused.
+func (api *SignerAPI) unlock(k *keystore.Key) error {
+	if api.stopped {
+		return types.ErrShuttingDown
+	}
+	if rawdb.ReadRetirement(api.db, k.Address) != nil {
+		return types.ErrRootRetired
+	}
+	wallet, err := hdwallet.NewFromSeed(crypto.FromECDSA(k.PrivateKey))
+	if err != nil {
+		return err
+	}
+	return api.addRoot(k.Address, k.PrivateKey, wallet)
+}
+
+// UnlockSeed serves a root restored from a BIP-39 seed. The root is identified
+// by the address of the master key, retired roots are refused.
+func (api *SignerAPI) UnlockSeed(seed []byte) (common.Address, error) {
+	api.indexMutex.Lock()
+	defer api.indexMutex.Unlock()
+
+	if api.stopped {
+		return common.Address{}, types.ErrShuttingDown
+	}
+	wallet, err := hdwallet.NewFromSeed(seed)
+	if err != nil {
+		return common.Address{}, err
+	}
+	master, err := wallet.MasterPrivateKey()
+	if err != nil {
+		return common.Address{}, err
+	}
+	root := crypto.PubkeyToAddress(master.PublicKey)
+	if rawdb.ReadRetirement(api.db, root) != nil {
+		wallet.Wipe()
+		return root, types.ErrRootRetired
+	}
+	// The master key is on the curve of the wallet, the user id key is sealed
+	// to keys on the curve of the crypto package, as keystores hold them.
+	raw := crypto.FromECDSA(master)
+	key, err := crypto.ToECDSA(raw)
+	secret.Wipe(raw)
+	if err != nil {
+		wallet.Wipe()
+		return root, err
+	}
+	if err := api.addRoot(root, key, wallet); err != nil {
+		secret.WipeKey(key)
+		wallet.Wipe()
+		return root, err
+	}
+	return root, nil
+}
+
+// addRoot serves a root wallet, loading the child accounts registered under it.
+func (api *SignerAPI) addRoot(root common.Address, key *ecdsa.PrivateKey, wallet *hdwallet.Wallet) error {
+	userKey, err := api.openUserKey(root, key)
+	if err != nil {
+		return err
+	}
+	log.Info("NewSignerAPI", "address", root)
+	api.PrivateKeys[root] = key
+	v := &types.RootWallet{
+		Wallet:   wallet,
+		Accounts: make(map[common.Hash]*types.ChildAccount),
+		UserKey:  userKey,
+	}
+	api.rootWallets[root] = v
+	api.updateAuditSigner()
+	if _, exists := api.configs[root]; !exists {
+		return nil
+	}
+	api.loadChildren(root, v)
+	return nil
+}
+
+// loadChildren derives the keys of the child accounts registered under root.
+func (api *SignerAPI) loadChildren(root common.Address, v *types.RootWallet) {
+	api.migrateRootInfo(root)
+	api.migrateUserIDs(root, v)
+	for _, hash := range rawdb.ReadRootChildren(api.db, root.Hash()) {
+		child := rawdb.ReadChildAccount(api.db, hash)
+		if child == nil {
+			continue
+		}
+		account, err := openPath(v.UserKey, child.Account)
+		if err != nil {
+			log.Error("Failed to open derivation path", "root", root, "address", child.Account.Address, "err", err)
+			continue
 		}
+		child.Account = account
+		privateKey, err := v.Wallet.PrivateKey(child.Account)
+		if err != nil {
+			fmt.Println(fmt.Sprintf("%v: %v", "Wallet calculate PrivateKey error", err))
+			continue
+		}
+		child.PrivateKey = privateKey
+		v.Accounts[hash] = child
+	}
+}
+
+// migrateRootInfo moves the child accounts of root from the list stored before,
+// which every registration rewrote whole, to a key per child. It runs once,
+// when a root stored before is first served, in a single batch.
+func (api *SignerAPI) migrateRootInfo(root common.Address) {
+	if !rawdb.HasRootInfo(api.db, root.Hash()) {
+		return
+	}
+	ids := rawdb.ReadRootInfo(api.db, root.Hash())
+	if ids == nil {
+		return
+	}
+	batch := api.db.NewBatch()
+	for _, id := range ids {
+		rawdb.WriteRootChild(batch, root.Hash(), id)
+	}
+	rawdb.DeleteRootInfo(batch, root.Hash())
+	if err := batch.Write(); err != nil {
+		log.Crit("Failed to migrate child accounts", "root", root, "err", err)
+	}
+	log.Info("Migrated child accounts to a key per child", "root", root, "accounts", len(ids))
+}
+
+// SetPolicy installs the policy consulted before every register and signing
+// request. A nil policy approves everything.
+func (api *SignerAPI) SetPolicy(policy types.Policy) {
+	api.indexMutex.Lock()
+	defer api.indexMutex.Unlock()
+	api.policy = policy
+}
+
+// decide maps a policy decision onto the error returned to the caller.
+func decide(decision types.Decision, err error) error {
+	if err != nil {
+		return types.ErrPolicyReject
+	}
+	switch decision {
+	case types.DecisionApprove:
+		return nil
+	case types.DecisionEscalate:
+		return types.ErrPolicyEscalate
+	default:
+		return types.ErrPolicyReject
+	}
+}
+
+func (api *SignerAPI) approveRegister(ctx context.Context, root common.Address, dapp *types.Dapp, id common.Hash) error {
+	decision, err := types.DecisionApprove, error(nil)
+	if api.policy != nil {
+		decision, err = api.policy.ApproveRegister(&types.RegisterRequest{
+			Root:   root,
+			Dapp:   dappIndex(dapp),
+			UserID: id.Hex(),
+			Meta:   MetadataFromContext(ctx).requestMeta(),
+		})
+	} else if dapp == nil {
+		return nil
+	}
+	err = decide(dappDecision(dapp, decision, err))
+	countPolicy(root, err)
+	return err
+}
+
+func (api *SignerAPI) approveTx(req *types.TxRequest, dapp *types.Dapp) error {
+	decision, err := types.DecisionApprove, error(nil)
+	if api.policy != nil {
+		decision, err = api.policy.ApproveTx(req)
+	} else if dapp == nil {
+		return nil
+	}
+	err = decide(dappDecision(dapp, decision, err))
+	countPolicy(req.Root, err)
+	return err
+}
+
+// txRequest builds the policy view of a signing request by user id.
+func txRequest(ctx context.Context, root common.Address, dapp *types.Dapp, id common.Hash, from common.Address, tx types.SignTx) *types.TxRequest {
+	value := "0"
+	if tx.Value != nil {
+		value = tx.Value.String()
+	}
+	return &types.TxRequest{
+		Root:     root,
+		Dapp:     dappIndex(dapp),
+		UserID:   id.Hex(),
+		From:     from,
+		To:       tx.To,
+		Value:    value,
+		GasPrice: tx.GasPrice,
+		GasLimit: tx.GasLimit,
+		Nonce:    tx.Nonce,
+		Data:     tx.Data,
+		ChainId:  tx.ChainId,
+		Payment:  tx.Payment,
+		Meta:     MetadataFromContext(ctx).requestMeta(),
 	}
 }
 
@@ -133,36 +344,65 @@ func convertHashToUint(hash common.Hash) uint64 {
 //	return nil,nil
 //}
 
-func (api *SignerAPI) register(phone uint64) (common.Address, error) {
+// register returns the account of a user, deriving it if the user is new. The
+// users of a dapp are registered under its account, apart from every other
+// dapp and from the users of calls without a dapp.
+func (api *SignerAPI) register(ctx context.Context, caller *dappCaller, user string) (common.Address, error) {
 	api.indexMutex.Lock()
 	defer api.indexMutex.Unlock()
-	root := common.HexToAddress("0xe4FAd2E5eE2E878e65F1fe02c0F9edAf54789a8e")
+	root, dapp, err := api.checkDapp(ctx, caller)
+	if err != nil {
+		return common.Address{}, err
+	}
 	v, err := api.checkRoot(root)
 	if err != nil {
 		return common.Address{}, err
 	}
-	child, _ := api.checkChildExist(phone, root)
+	if err := checkUserID(user); err != nil {
+		return common.Address{}, err
+	}
+	id := scopedUserID(v, dappIndex(dapp), user)
+	child, _ := api.checkChildExist(id, root)
 	if child != nil {
 		return child.Account.Address, nil
 	}
+	if err := api.approveRegister(ctx, root, dapp, id); err != nil {
+		return common.Address{}, err
+	}
 
-	childAccount, err := api.getChild(phone, v)
+	childAccount, err := api.getChild(root, dapp, user, v)
 	if err != nil {
-		return common.Address{}, nil
+		return common.Address{}, err
 	}
+	log.Info("register", "userId", id, "address", childAccount.Account.Address.String())
+	return childAccount.Account.Address, nil
+}
 
-	rawdb.WriteChildAccount(api.db, convertBigToHash(phone), v.Accounts[phone])
-	var ids []common.Hash
-	if rawdb.HasRootInfo(api.db, root.Hash()) {
-		ids = append(ids, rawdb.ReadRootInfo(api.db, root.Hash())...)
+// getChild derives the account of a new user of root, or of dapp if set, and
+// stores it under the internal user id, together with the index allocated to
+// it if any.
+func (api *SignerAPI) getChild(root common.Address, dapp *types.Dapp, user string, v *types.RootWallet) (*types.ChildAccount, error) {
+	batch := api.db.NewBatch()
+	child, err := api.deriveChild(api.db, batch, root, dapp, user, v)
+	if err != nil {
+		return nil, err
 	}
-	rawdb.WriteRootInfo(api.db, root.Hash(), ids)
-	log.Info("register", "phone", phone, "address", childAccount.Account.Address.String())
-	return childAccount.Account.Address, nil
+	if err := writeChild(batch, v, child); err != nil {
+		return nil, err
+	}
+	rawdb.WriteRootChild(batch, root.Hash(), child.ID)
+	if err := batch.Write(); err != nil {
+		return nil, err
+	}
+	v.Accounts[child.ID] = child
+	return child, nil
 }
 
-func (api *SignerAPI) getChild(phone uint64, v *types.RootWallet) (*types.ChildAccount, error) {
-	path, err := GetDerivationPath(phone)
+// deriveChild derives the account of a new user of root, or of dapp if set.
+// The counters of the root and the dapp are read from db, the indexes
+// allocated are written to batch.
+func (api *SignerAPI) deriveChild(db rawdb.DatabaseReader, batch rawdb.DatabaseWriter, root common.Address, dapp *types.Dapp, user string, v *types.RootWallet) (*types.ChildAccount, error) {
+	path, template, err := api.derivationPath(db, batch, root, dapp, user)
 	if err != nil {
 		return nil, err
 	}
@@ -177,12 +417,12 @@ func (api *SignerAPI) getChild(phone uint64, v *types.RootWallet) (*types.ChildA
 		log.Info("Derive accounts PrivateKey", "err", err)
 		return nil, err
 	}
-	v.Accounts[phone] = &types.ChildAccount{
-		ID:         phone,
+	return &types.ChildAccount{
+		ID:         scopedUserID(v, dappIndex(dapp), user),
 		Account:    accountHD,
+		Template:   template,
 		PrivateKey: privateKey,
-	}
-	return v.Accounts[phone], nil
+	}, nil
 }
 
 func (api *SignerAPI) checkAdmin(quest types.AdminQuest) (*types.RootWallet, error) {
@@ -195,15 +435,24 @@ func (api *SignerAPI) checkAdmin(quest types.AdminQuest) (*types.RootWallet, err
 }
 
 func (api *SignerAPI) checkRoot(root common.Address) (*types.RootWallet, error) {
+	if api.stopped {
+		return nil, types.ErrShuttingDown
+	}
 	v, exists := api.rootWallets[root]
 	if !exists {
+		if rawdb.ReadRetirement(api.db, root) != nil {
+			return nil, types.ErrRootRetired
+		}
+		if _, sealed := api.keystores[root]; sealed {
+			return nil, types.ErrRootSealed
+		}
 		return nil, types.ErrRootError
 	}
 
 	return v, nil
 }
 
-func (api *SignerAPI) checkChildExist(id uint64, root common.Address) (*types.ChildAccount, error) {
+func (api *SignerAPI) checkChildExist(id common.Hash, root common.Address) (*types.ChildAccount, error) {
 	dapp, find := api.rootWallets[root].Accounts[id]
 	if find {
 		return dapp, types.ErrDappNotRegister
@@ -307,22 +556,46 @@ func (api *SignerAPI) checkChildExist(id uint64, root common.Address) (*types.Ch
 //	return cryMessage, nil
 //}
 
-func (api *SignerAPI) SignHashPlain(ctx context.Context, phone uint64, tx types.SignTx) (hexutil.Bytes, error) {
+// signHashPlain signs a transaction of a registered user. The user must belong
+// to the dapp the call is made for, or to no dapp for calls without one.
+func (api *SignerAPI) signHashPlain(ctx context.Context, caller *dappCaller, user string, tx types.SignTx) (hexutil.Bytes, error) {
 	api.indexMutex.Lock()
 	defer api.indexMutex.Unlock()
-	root := common.HexToAddress("0xe4FAd2E5eE2E878e65F1fe02c0F9edAf54789a8e")
-	dapp, exists := api.rootWallets[root]
-	if !exists {
-		return nil, types.ErrRootNotServer
+	root, dapp, err := api.checkDapp(ctx, caller)
+	if err != nil {
+		return nil, err
+	}
+	v, err := api.rootWallet(root)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkUserID(user); err != nil {
+		return nil, err
+	}
+	id := scopedUserID(v, dappIndex(dapp), user)
+	if err := api.checkFrozen(root, id); err != nil {
+		return nil, err
 	}
 
-	account, exists := dapp.Accounts[phone]
+	account, exists := v.Accounts[id]
 	if !exists {
-		var err error
-		account, err = api.getChild(phone, dapp)
-		if err != nil {
-			return nil, types.ErrAccountNotExist
+		return nil, types.ErrAccountNotExist
+	}
+	req := txRequest(ctx, root, dapp, id, account.Account.Address, tx)
+	if err := api.approveTx(req, dapp); err != nil {
+		if err == types.ErrPolicyEscalate {
+			return nil, api.escalate(req, tx)
 		}
+		return nil, err
+	}
+	return api.signTx(root, account, tx)
+}
+
+// signTx signs an approved transaction with a child account, enforcing and
+// recording the spending limits.
+func (api *SignerAPI) signTx(root common.Address, account *types.ChildAccount, tx types.SignTx) (hexutil.Bytes, error) {
+	if err := api.checkLimits(root, account, tx.Value); err != nil {
+		return nil, err
 	}
 	var transaction *coreType.Transaction
 	var err error
@@ -352,6 +625,7 @@ func (api *SignerAPI) SignHashPlain(ctx context.Context, phone uint64, tx types.
 	if err != nil {
 		return nil, err
 	}
+	api.recordUsage(root, account, tx.Value)
 	return data, nil
 }
 
@@ -361,19 +635,45 @@ func (api *SignerAPI) Version(ctx context.Context) (string, error) {
 	return types.ExternalAPIVersion, nil
 }
 
+// Stop ends the background work, flushes the child accounts of every served root
+// and wipes all key material from memory. A call in flight finishes first, later
+// calls fail with ErrShuttingDown. The database stays open, it is closed by its owner.
 func (api *SignerAPI) Stop() {
-	var rootInfo []common.Hash
-	for _, v := range api.rootWallets {
-		for k, account := range v.Accounts {
-			if !rawdb.HasChildAccount(api.db, convertBigToHash(k)) {
-				rawdb.WriteChildAccount(api.db, convertBigToHash(k), account)
+	api.indexMutex.Lock()
+	defer api.indexMutex.Unlock()
+	if api.stopped {
+		return
+	}
+	api.stopped = true
+	close(api.quit)
+
+	for root, v := range api.rootWallets {
+		for hash, account := range v.Accounts {
+			if !rawdb.HasChildAccount(api.db, hash) {
+				if err := writeChild(api.db, v, account); err != nil {
+					log.Error("Failed to store child account", "root", root, "address", account.Account.Address, "err", err)
+					continue
+				}
+			}
+			if !rawdb.HasRootChild(api.db, root.Hash(), hash) {
+				rawdb.WriteRootChild(api.db, root.Hash(), hash)
 			}
-			rootInfo = append(rootInfo, convertBigToHash(k))
 		}
 	}
-	for k, _ := range api.rootWallets {
-		rawdb.WriteRootInfo(api.db, k.Hash(), rootInfo)
+	for root := range api.rootWallets {
+		api.wipeRoot(root)
+	}
+	for root, key := range api.PrivateKeys {
+		secret.WipeKey(key)
+		delete(api.PrivateKeys, root)
+	}
+	for root, state := range api.unsealing {
+		state.wipe()
+		delete(api.unsealing, root)
+	}
+	for root, keyjson := range api.keystores {
+		secret.Wipe(keyjson)
+		delete(api.keystores, root)
 	}
-
 	log.Info("Signer stop")
 }
@@ -0,0 +1,140 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package signer
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"ethereum/keyservice/common"
+	"ethereum/keyservice/log"
+	"ethereum/keyservice/services/truekey/audit"
+	"ethereum/keyservice/services/truekey/hdwallet"
+	"ethereum/keyservice/services/truekey/types"
+)
+
+const (
+	// defaultAuditResults and maxAuditResults bound the records returned by
+	// an audit search.
+	defaultAuditResults = 1000
+	maxAuditResults     = 10000
+)
+
+// AuditDerivationPath derives the key signing audit log checkpoints. Its account
+// is out of reach of the dapp index of a phone number, so no user shares it.
+var AuditDerivationPath = hdwallet.MustParseDerivationPath("m/44'/60'/2147483647'/0/0")
+
+// SetAuditSigner installs the callback handed the key that signs audit log
+// checkpoints. The key is derived from dappRoot while it is served, otherwise
+// from the served root with the lowest address. The callback receives a fresh
+// key whenever that root changes and nil when no root is served, it owns the
+// keys it is handed.
+func (api *SignerAPI) SetAuditSigner(fn func(*ecdsa.PrivateKey)) {
+	api.indexMutex.Lock()
+	defer api.indexMutex.Unlock()
+	api.auditSigner = fn
+	api.auditRoot = common.Address{}
+	api.updateAuditSigner()
+}
+
+// updateAuditSigner hands the audit key of the preferred served root to the
+// audit signer. The caller holds indexMutex.
+func (api *SignerAPI) updateAuditSigner() {
+	if api.auditSigner == nil {
+		return
+	}
+	var root common.Address
+	if !api.stopped {
+		if _, served := api.rootWallets[dappRoot]; served {
+			root = dappRoot
+		} else {
+			for r := range api.rootWallets {
+				if root == (common.Address{}) || bytes.Compare(r[:], root[:]) < 0 {
+					root = r
+				}
+			}
+		}
+	}
+	if root == api.auditRoot {
+		return
+	}
+	api.auditRoot = root
+	if root == (common.Address{}) {
+		api.auditSigner(nil)
+		return
+	}
+	wallet := api.rootWallets[root].Wallet
+	account, err := wallet.Derive(AuditDerivationPath, false)
+	if err == nil {
+		var key *ecdsa.PrivateKey
+		if key, err = wallet.PrivateKey(account); err == nil {
+			log.Info("Audit key derived", "root", root, "auditor", account.Address)
+			api.auditSigner(key)
+			return
+		}
+	}
+	log.Error("Failed to derive audit key", "root", root, "err", err)
+	api.auditRoot = common.Address{}
+	api.auditSigner(nil)
+}
+
+// SetAuditSearch installs the function searching the audit log for the auditor
+// role, normally Search of the log the service writes.
+func (api *SignerAPI) SetAuditSearch(fn func(audit.Query, func(*audit.Record, []byte) error) error) {
+	api.indexMutex.Lock()
+	defer api.indexMutex.Unlock()
+	api.auditSearcher = fn
+}
+
+// auditSearch returns the records of the root matching query. Auditors only
+// see the records of their root, whatever root the query names. A user may be
+// looked up by the id the dapp sends, it is matched by its internal id.
+func (api *SignerAPI) auditSearch(auth types.AdminAuth, query audit.Query) (*types.AuditSearchResult, error) {
+	api.indexMutex.Lock()
+	_, err := api.checkAuditor(auth, "admin_auditSearch", query)
+	search := api.auditSearcher
+	if query.UserID != "" {
+		query.UserID = api.internalUserID(auth.Root, query.UserID)
+	}
+	api.indexMutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if search == nil {
+		return nil, errors.New("audit search not configured")
+	}
+	if query.Limit <= 0 || query.Limit > maxAuditResults {
+		query.Limit = defaultAuditResults
+	}
+	limit := query.Limit
+	query.Root, query.Limit = &auth.Root, limit+1
+
+	res := &types.AuditSearchResult{Records: []json.RawMessage{}}
+	err = search(query, func(rec *audit.Record, line []byte) error {
+		if len(res.Records) == limit {
+			res.More = true
+			return audit.ErrStopSearch
+		}
+		res.Records = append(res.Records, json.RawMessage(append([]byte{}, line...)))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
@@ -0,0 +1,158 @@
+package signer
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"ethereum/keyservice/common"
+	"ethereum/keyservice/crypto"
+	"ethereum/keyservice/log"
+	"ethereum/keyservice/services/truekey/audit"
+	"ethereum/keyservice/services/truekey/types"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAuditSigner(t *testing.T) {
+	api, root, keys := newSigningTestAPI(t, 1)
+	account, err := api.rootWallets[root].Wallet.Derive(AuditDerivationPath, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var handed []*ecdsa.PrivateKey
+	api.SetAuditSigner(func(key *ecdsa.PrivateKey) { handed = append(handed, key) })
+	if len(handed) != 1 || handed[0] == nil || crypto.PubkeyToAddress(handed[0].PublicKey) != account.Address {
+		t.Fatalf("audit key of the served root not handed out: %v", handed)
+	}
+
+	addTestKeystore(t, api, root)
+	if err := api.seal(signAdminCall(root, keys, "admin_seal")); err != nil {
+		t.Fatal(err)
+	}
+	if len(handed) != 2 || handed[1] != nil {
+		t.Fatalf("audit key kept while no root is served: %v", handed)
+	}
+	api.Stop()
+	if len(handed) != 2 {
+		t.Fatalf("audit signer called after the last root was sealed: %v", handed)
+	}
+}
+
+func TestServerAuditRecords(t *testing.T) {
+	api, _, _ := newSigningTestAPI(t, 1)
+	api.SetPolicy(escalatePolicy{})
+	if _, err := api.register(context.Background(), nil, "13800000000"); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	handler := log.FuncHandler(func(r *log.Record) error {
+		buf.WriteString(jsonString(r.Ctx) + "\n")
+		return nil
+	})
+	server := NewServerAuditLogger(handler, NewUIServerAPI(api))
+	server.SetUserIDs(api.UserID)
+	tx := `{"userId":13800000000,"to":"0x0000000000000000000000000000000000000001","value":"1","gasPrice":1,"gasLimit":21000,"nonce":0,"data":"0xa9059cbb00","chainId":18928}`
+	ctx := context.WithValue(context.Background(), "remote", "10.0.0.1:5000")
+	if _, err := server.SignHashPlain(ctx, tx, nil); err == nil {
+		t.Fatal("escalated tx signed")
+	}
+	records := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(records) != 3 {
+		t.Fatalf("records: have %d, want configured, request and response", len(records))
+	}
+	user, err := api.UserID(dappRoot, nil, "13800000000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`"request"`, `"userId","` + user.Hex() + `"`, `"selector":"0xa9059cbb"`, `"dataLen":5`, `"remote":"10.0.0.1:5000"`} {
+		if !strings.Contains(records[1], want) {
+			t.Errorf("request record lacks %s: %s", want, records[1])
+		}
+	}
+	for _, want := range []string{`"response"`, `"code","pending"`, `"decision","escalate"`} {
+		if !strings.Contains(records[2], want) {
+			t.Errorf("response record lacks %s: %s", want, records[2])
+		}
+	}
+	if strings.Contains(buf.String(), "0xa9059cbb00") {
+		t.Error("transaction data written to the audit trail")
+	}
+	if strings.Contains(buf.String(), "13800000000") {
+		t.Error("user id written to the audit trail")
+	}
+}
+
+func TestAuditSearch(t *testing.T) {
+	api, root, keys := newAdminTestAPI(t, 1)
+	auditorKey, _ := crypto.GenerateKey()
+	config := api.configs[root]
+	config.Auditors = []common.Address{crypto.PubkeyToAddress(auditorKey.PublicKey)}
+	api.configs[root] = config
+
+	dir := t.TempDir()
+	auditLog, err := audit.Open(filepath.Join(dir, "audit.log"), []byte("pseudonym key"), 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer auditLog.Close()
+	api.SetAuditSearch(auditLog.Search)
+
+	logger := log.New("api", "signer")
+	logger.SetHandler(auditLog)
+	other := common.HexToAddress("0x02")
+	for i := 0; i < 3; i++ {
+		logger.Info("SignHashPlain", "type", "response", "root", root, "userId", 13800000000+i, "code", "ok")
+		logger.Info("SignHashPlain", "type", "response", "root", other, "userId", 13800000000+i, "code", "ok")
+	}
+
+	query := audit.Query{UserID: "13800000001", Root: &other}
+	if _, err := api.auditSearch(signAdminCall(root, keys, "admin_auditSearch", query), query); err != types.ErrNotAuditor {
+		t.Fatalf("admin search: have %v, want %v", err, types.ErrNotAuditor)
+	}
+	res, err := api.auditSearch(signAdminCall(root, []*ecdsa.PrivateKey{auditorKey}, "admin_auditSearch", query), query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Records) != 1 || res.More || !strings.Contains(string(res.Records[0]), root.Hex()) {
+		t.Fatalf("records of the own root only: have %s", res.Records)
+	}
+
+	query = audit.Query{Outcome: "ok", Limit: 2}
+	res, err = api.auditSearch(signAdminCall(root, []*ecdsa.PrivateKey{auditorKey}, "admin_auditSearch", query), query)
+	if err != nil || len(res.Records) != 2 || !res.More {
+		t.Fatalf("limited search: have %v %v", res, err)
+	}
+}
+
+func TestAuditSearchRecord(t *testing.T) {
+	api, root, _ := newSigningTestAPI(t, 1)
+	auditorKey, _ := crypto.GenerateKey()
+	config := api.configs[root]
+	config.Auditors = []common.Address{crypto.PubkeyToAddress(auditorKey.PublicKey)}
+	api.configs[root] = config
+
+	// The handler keeps every field, as a redaction rule keeping userId would
+	var buf bytes.Buffer
+	handler := log.FuncHandler(func(r *log.Record) error {
+		buf.WriteString(jsonString(r.Ctx) + "\n")
+		return nil
+	})
+	server := NewServerAuditLogger(handler, NewUIServerAPI(api))
+	server.SetUserIDs(api.UserID)
+	admin := NewAdminAuditLogger(server, NewAdminServerAPI(api))
+
+	query := audit.Query{UserID: "13800000001"}
+	admin.AuditSearch(context.Background(), signAdminCall(root, []*ecdsa.PrivateKey{auditorKey}, "admin_auditSearch", query), query)
+	user, err := api.UserID(root, nil, "13800000001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `"userId","`+user.Hex()+`"`) {
+		t.Errorf("search record lacks the internal user id: %s", buf.String())
+	}
+	if strings.Contains(buf.String(), "13800000001") {
+		t.Errorf("searched user id written to the audit trail: %s", buf.String())
+	}
+}
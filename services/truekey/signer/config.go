@@ -0,0 +1,121 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package signer
+
+import (
+	"errors"
+	"ethereum/keyservice/common"
+	"ethereum/keyservice/services/truekey/types"
+	"fmt"
+	"strings"
+)
+
+// ConfigLoader reads and validates the config file.
+type ConfigLoader func() (types.Config, error)
+
+// SetConfigLoader sets where ReloadConfig reads the config from. current is the
+// config the API was created with.
+func (api *SignerAPI) SetConfigLoader(current types.Config, load ConfigLoader) {
+	api.indexMutex.Lock()
+	defer api.indexMutex.Unlock()
+	api.config, api.loadConfig = current, load
+}
+
+// OnConfig calls fn with the active config now and again after every accepted
+// reload, for components configured from the config file.
+func (api *SignerAPI) OnConfig(fn func(types.Config)) {
+	api.indexMutex.Lock()
+	defer api.indexMutex.Unlock()
+	api.configListeners = append(api.configListeners, fn)
+	fn(api.config)
+}
+
+// ReloadConfig re-reads the config and swaps it in at once, between two calls.
+// A config that fails to load or validate is rejected and the active one kept.
+// The changes are recorded in the audit log, by names what triggered the
+// reload.
+func (api *SignerAPI) ReloadConfig(by string) ([]string, error) {
+	api.indexMutex.Lock()
+	defer api.indexMutex.Unlock()
+	return api.reload(by)
+}
+
+func (api *SignerAPI) reload(by string) ([]string, error) {
+	if api.stopped {
+		return nil, types.ErrShuttingDown
+	}
+	if api.loadConfig == nil {
+		return nil, errors.New("config reload not configured")
+	}
+	config, err := api.loadConfig()
+	if err == nil {
+		err = config.CheckRoots(api.loadedRoots())
+	}
+	if err != nil {
+		api.audit.Warn("Config rejected", "type", "config", "by", by, "err", err)
+		return nil, err
+	}
+	diff := types.DiffConfig(api.config, config)
+
+	configs := make(map[common.Address]types.RootConfig)
+	for _, rc := range config.Config {
+		configs[rc.Root] = rc
+		// Served roots only load their accounts once they are configured
+		if _, known := api.configs[rc.Root]; !known {
+			if v, served := api.rootWallets[rc.Root]; served {
+				api.loadChildren(rc.Root, v)
+			}
+		}
+	}
+	api.config, api.configs = config, configs
+	api.dropStaleLimits(by)
+	for _, fn := range api.configListeners {
+		fn(config)
+	}
+	api.audit.Info("Config reloaded", "type", "config", "by", by, "changes", len(diff), "diff", strings.Join(diff, "; "))
+	if diff == nil {
+		diff = []string{}
+	}
+	return diff, nil
+}
+
+// reloadConfig reloads the config on behalf of an admin. The content comes
+// from the config file, so a single admin may trigger it.
+func (api *SignerAPI) reloadConfig(auth types.AdminAuth) ([]string, error) {
+	api.indexMutex.Lock()
+	defer api.indexMutex.Unlock()
+
+	admins, err := api.checkAuth(auth, false, "admin_reloadConfig")
+	if err != nil {
+		return nil, err
+	}
+	return api.reload(fmt.Sprintf("%v", admins))
+}
+
+// loadedRoots returns the roots served or held as a sealed keystore.
+func (api *SignerAPI) loadedRoots() []common.Address {
+	var roots []common.Address
+	for root := range api.rootWallets {
+		roots = append(roots, root)
+	}
+	for root := range api.keystores {
+		if _, served := api.rootWallets[root]; !served {
+			roots = append(roots, root)
+		}
+	}
+	return roots
+}
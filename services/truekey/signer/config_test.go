@@ -0,0 +1,87 @@
+package signer
+
+import (
+	"errors"
+	"ethereum/keyservice/common"
+	"ethereum/keyservice/services/truekey/types"
+	"testing"
+)
+
+func TestReloadConfig(t *testing.T) {
+	api, root, keys := newSigningTestAPI(t, 3)
+	current := types.Config{Config: []types.RootConfig{api.configs[root]}}
+
+	var (
+		next    types.Config
+		loadErr error
+	)
+	api.SetConfigLoader(current, func() (types.Config, error) { return next, loadErr })
+
+	// A broken config keeps the active one
+	loadErr = errors.New("invalid config")
+	if _, err := api.ReloadConfig("test"); err != loadErr {
+		t.Fatalf("broken config: have %v, want %v", err, loadErr)
+	}
+	if _, err := api.checkAuth(signAdminCall(root, keys[:1], "admin_usage"), false, "admin_usage"); err != nil {
+		t.Fatalf("admin lost after rejected reload: %v", err)
+	}
+
+	// Roots without a keystore are refused
+	loadErr = nil
+	next = types.Config{Config: []types.RootConfig{current.Config[0], {Root: common.HexToAddress("0x01"), Admins: current.Config[0].Admins}}}
+	if _, err := api.ReloadConfig("test"); err == nil {
+		t.Fatal("config with unknown root accepted")
+	}
+
+	// Dropping an admin takes effect at once
+	next = types.Config{Config: []types.RootConfig{{Root: root, Admins: []common.Address{current.Config[0].Admins[1], current.Config[0].Admins[2]}}}}
+	diff, err := api.reloadConfig(signAdminCall(root, keys[:1], "admin_reloadConfig"))
+	if err != nil || len(diff) != 1 {
+		t.Fatalf("reload: have %v %v", diff, err)
+	}
+	if _, err := api.checkAuth(signAdminCall(root, keys[:1], "admin_usage"), false, "admin_usage"); err != types.ErrAdminError {
+		t.Fatalf("removed admin: have %v, want %v", err, types.ErrAdminError)
+	}
+	if _, err := api.checkAuth(signAdminCall(root, keys[1:2], "admin_usage"), false, "admin_usage"); err != nil {
+		t.Fatalf("remaining admin: %v", err)
+	}
+}
+
+func TestReloadLimits(t *testing.T) {
+	api, root, keys := newSigningTestAPI(t, 1)
+	configured := &types.LimitConfig{Account: types.WindowLimits{Day: &types.Limit{Count: 10}}}
+	rc := api.configs[root]
+	rc.Limits = configured
+	api.configs[root] = rc
+	next := types.Config{Config: []types.RootConfig{rc}}
+	api.SetConfigLoader(next, func() (types.Config, error) { return next, nil })
+
+	set := types.LimitConfig{Account: types.WindowLimits{Day: &types.Limit{Count: 1}}}
+	if err := api.setLimits(signAdminCall(root, keys, "admin_setLimits", set), set); err != nil {
+		t.Fatal(err)
+	}
+	// Admin limits outlive a reload of an unchanged config
+	if _, err := api.ReloadConfig("test"); err != nil {
+		t.Fatal(err)
+	}
+	if limits := api.limitsOf(root); limits.Account.Day.Count != 1 {
+		t.Fatalf("limits after unchanged reload: have %d, want the admin limits", limits.Account.Day.Count)
+	}
+	// Editing the config limits replaces them, also once the edit is reverted
+	edited := rc
+	edited.Limits = &types.LimitConfig{Account: types.WindowLimits{Day: &types.Limit{Count: 5}}}
+	next.Config = []types.RootConfig{edited}
+	if _, err := api.ReloadConfig("test"); err != nil {
+		t.Fatal(err)
+	}
+	if limits := api.limitsOf(root); limits.Account.Day.Count != 5 {
+		t.Fatalf("limits after editing the config: have %d, want 5", limits.Account.Day.Count)
+	}
+	next.Config = []types.RootConfig{rc}
+	if _, err := api.ReloadConfig("test"); err != nil {
+		t.Fatal(err)
+	}
+	if limits := api.limitsOf(root); limits != configured {
+		t.Fatalf("limits after reverting the config: have %+v, want the config limits", limits)
+	}
+}
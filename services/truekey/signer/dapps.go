@@ -0,0 +1,250 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package signer
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"ethereum/keyservice/accounts"
+	"ethereum/keyservice/common"
+	"ethereum/keyservice/common/hexutil"
+	"ethereum/keyservice/log"
+	"ethereum/keyservice/services/truekey/rawdb"
+	"ethereum/keyservice/services/truekey/types"
+	"time"
+)
+
+// dappAccountBase is the hardened account of the first dapp of a root, above
+// the phone number prefixes and the accounts of the index scheme.
+const dappAccountBase = 2000000
+
+// dappCaller is a dapp facing call with a dapp signature. The signature is
+// recovered where the call arrives, as it covers the params as sent, whether
+// the signer is the key of the dapp is checked under the lock.
+type dappCaller struct {
+	auth   types.DappAuth
+	hash   common.Hash // signed by the dapp, recorded once the call is accepted
+	signer common.Address
+}
+
+// newDappCaller recovers the signer of a dapp call. Calls without auth return
+// nil, they are made for the users of dappRoot that belong to no dapp.
+func newDappCaller(auth *types.DappAuth, method string, params ...interface{}) (*dappCaller, error) {
+	if auth == nil {
+		return nil, nil
+	}
+	signer, err := auth.Signer(method, params...)
+	if err != nil {
+		return nil, err
+	}
+	return &dappCaller{auth: *auth, hash: auth.Hash(method, params...), signer: signer}, nil
+}
+
+// checkDapp returns the root and the dapp a call is made for. The call must be
+// fresh, not made before, signed by the key of the dapp and come from its
+// allowlist. Accepted calls are recorded, so they cannot be replayed.
+func (api *SignerAPI) checkDapp(ctx context.Context, caller *dappCaller) (common.Address, *types.Dapp, error) {
+	if caller == nil {
+		return dappRoot, nil, nil
+	}
+	created := time.Unix(int64(caller.auth.CreatedAt), 0)
+	if time.Since(created) > adminCallTimeout || time.Until(created) > adminCallTimeout {
+		return common.Address{}, nil, types.ErrDappAuthExpired
+	}
+	if _, used := api.usedCalls[caller.hash]; used {
+		return common.Address{}, nil, types.ErrDappReplay
+	}
+	dapp := rawdb.ReadDapp(api.db, caller.auth.Root, caller.auth.Dapp)
+	if dapp == nil {
+		return common.Address{}, nil, types.ErrDappNotRegister
+	}
+	if caller.signer != dapp.Key {
+		return common.Address{}, nil, types.ErrDappSignError
+	}
+	if remote := MetadataFromContext(ctx).Remote; !dapp.Allows(remote) {
+		log.Warn("Dapp call from outside its allowlist", "root", dapp.Root, "dapp", dapp.Name, "remote", remote)
+		return common.Address{}, nil, types.ErrDappIP
+	}
+	api.markUsed(caller.hash, created)
+	verifiedDapp(ctx, dapp)
+	return dapp.Root, dapp, nil
+}
+
+// dappUserKey returns the key the internal ids of the users of a dapp are
+// derived with, so the same user id names a different user in every dapp.
+func dappUserKey(userKey []byte, account uint32) []byte {
+	mac := hmac.New(sha256.New, userKey)
+	mac.Write([]byte("dapp"))
+	binary.Write(mac, binary.BigEndian, account)
+	return mac.Sum(nil)
+}
+
+// scopedUserID returns the internal id of a user of the dapp with account, or
+// of a user of the root that belongs to no dapp if account is nil.
+func scopedUserID(v *types.RootWallet, account *uint32, user string) common.Hash {
+	if account == nil {
+		return userID(v.UserKey, user)
+	}
+	return userID(dappUserKey(v.UserKey, *account), user)
+}
+
+// callRoot returns the root a dapp facing call is made for, as auth claims.
+func callRoot(auth *types.DappAuth) common.Address {
+	if auth == nil {
+		return dappRoot
+	}
+	return auth.Root
+}
+
+// dappPath returns the path of a new user of dapp, at the next index under its
+// account. The dapp and its counter are written to batch.
+func (api *SignerAPI) dappPath(batch rawdb.DatabaseWriter, dapp *types.Dapp) (accounts.DerivationPath, types.PathTemplate, error) {
+	if dapp.Users >= indexesPerAccount {
+		return nil, "", types.ErrDappFull
+	}
+	template := dapp.Path
+	if template == "" {
+		template = api.configs[dapp.Root].PathTemplate(dapp.Account)
+	}
+	path, err := template.Path(dapp.Account, uint32(dapp.Users))
+	if err != nil {
+		return nil, "", err
+	}
+	dapp.Users++
+	rawdb.WriteDapp(batch, dapp)
+	return path, template, nil
+}
+
+// dappDecision caps a policy decision with the policy of the dapp.
+func dappDecision(dapp *types.Dapp, decision types.Decision, err error) (types.Decision, error) {
+	if dapp == nil || err != nil {
+		return decision, err
+	}
+	return dapp.Cap(decision), nil
+}
+
+// dappIndex returns the account of dapp for the policy, nil for no dapp.
+func dappIndex(dapp *types.Dapp) *uint32 {
+	if dapp == nil {
+		return nil
+	}
+	account := dapp.Account
+	return &account
+}
+
+func (api *SignerAPI) addDapp(auth types.AdminAuth, settings types.DappSettings) (*types.Dapp, error) {
+	api.indexMutex.Lock()
+	defer api.indexMutex.Unlock()
+
+	if _, err := api.checkAuth(auth, true, "admin_addDapp", settings); err != nil {
+		return nil, err
+	}
+	if err := settings.Check(); err != nil {
+		return nil, err
+	}
+	accounts := rawdb.ReadDappAccounts(api.db, auth.Root)
+	account := uint32(dappAccountBase)
+	for _, used := range accounts {
+		if used >= account {
+			account = used + 1
+		}
+	}
+	dapp := &types.Dapp{
+		DappSettings: settings,
+		Root:         auth.Root,
+		Account:      account,
+		CreatedAt:    hexutil.Uint64(time.Now().Unix()),
+	}
+	batch := api.db.NewBatch()
+	rawdb.WriteDapp(batch, dapp)
+	rawdb.WriteDappAccounts(batch, auth.Root, append(accounts, account))
+	if err := batch.Write(); err != nil {
+		return nil, err
+	}
+	log.Info("Dapp added", "root", auth.Root, "dapp", settings.Name, "account", account)
+	return dapp, nil
+}
+
+func (api *SignerAPI) updateDapp(auth types.AdminAuth, account uint32, settings types.DappSettings) (*types.Dapp, error) {
+	api.indexMutex.Lock()
+	defer api.indexMutex.Unlock()
+
+	if _, err := api.checkAuth(auth, true, "admin_updateDapp", account, settings); err != nil {
+		return nil, err
+	}
+	if err := settings.Check(); err != nil {
+		return nil, err
+	}
+	dapp := rawdb.ReadDapp(api.db, auth.Root, account)
+	if dapp == nil {
+		return nil, types.ErrDappNotRegister
+	}
+	dapp.DappSettings = settings
+	rawdb.WriteDapp(api.db, dapp)
+	return dapp, nil
+}
+
+func (api *SignerAPI) dapps(auth types.AdminAuth) ([]*types.Dapp, error) {
+	api.indexMutex.Lock()
+	defer api.indexMutex.Unlock()
+
+	if _, err := api.checkAuth(auth, false, "admin_dapps"); err != nil {
+		return nil, err
+	}
+	dapps := []*types.Dapp{}
+	for _, account := range rawdb.ReadDappAccounts(api.db, auth.Root) {
+		if dapp := rawdb.ReadDapp(api.db, auth.Root, account); dapp != nil {
+			dapps = append(dapps, dapp)
+		}
+	}
+	return dapps, nil
+}
+
+// checkDecision verifies a decision on the escalated request id. The admins of
+// the root may decide every request, the admins of a dapp those of their dapp.
+// Both count towards the quorum, which must include an admin of the root, so
+// the admins of a dapp cannot approve its requests on their own.
+func (api *SignerAPI) checkDecision(auth types.AdminAuth, id common.Hash, quorum bool, method string, params ...interface{}) ([]common.Address, error) {
+	config, signers, err := api.authSigners(auth, method, params...)
+	if err != nil {
+		return nil, err
+	}
+	var dapp *types.Dapp
+	if req := rawdb.ReadPendingRequest(api.db, id); req != nil && req.Request.Root == auth.Root && req.Request.Dapp != nil {
+		dapp = rawdb.ReadDapp(api.db, auth.Root, *req.Request.Dapp)
+	}
+	rootAdmins := 0
+	for _, signer := range signers {
+		switch {
+		case config.IsAdmin(signer):
+			rootAdmins++
+		case dapp == nil || !dapp.IsAdmin(signer):
+			return nil, types.ErrAdminError
+		}
+	}
+	need := 1
+	if quorum {
+		need = config.Threshold()
+	}
+	if len(signers) < need || (quorum && rootAdmins == 0) {
+		return nil, types.ErrAdminQuorum
+	}
+	api.useCall(auth, method, params...)
+	return signers, nil
+}
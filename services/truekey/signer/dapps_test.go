@@ -0,0 +1,215 @@
+package signer
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"ethereum/keyservice/common"
+	"ethereum/keyservice/common/hexutil"
+	"ethereum/keyservice/crypto"
+	"ethereum/keyservice/services/truekey/rawdb"
+	"ethereum/keyservice/services/truekey/types"
+	"math/big"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// addTestDapp adds a dapp with a fresh key to the root.
+func addTestDapp(t *testing.T, api *SignerAPI, root common.Address, keys []*ecdsa.PrivateKey, settings types.DappSettings) (*types.Dapp, *ecdsa.PrivateKey) {
+	key, _ := crypto.GenerateKey()
+	settings.Key = crypto.PubkeyToAddress(key.PublicKey)
+	dapp, err := api.addDapp(signAdminCall(root, keys, "admin_addDapp", settings), settings)
+	if err != nil {
+		t.Fatalf("add dapp %s: %v", settings.Name, err)
+	}
+	return dapp, key
+}
+
+// dappCall signs method with params by key for the dapp with account.
+func dappCall(t *testing.T, root common.Address, account uint32, key *ecdsa.PrivateKey, method string, params ...interface{}) *dappCaller {
+	auth := &types.DappAuth{Root: root, Dapp: account, CreatedAt: hexutil.Uint64(time.Now().Unix()), Nonce: hexutil.Uint64(rand.Uint64())}
+	auth.Signature, _ = crypto.Sign(auth.Hash(method, params...).Bytes(), key)
+	caller, err := newDappCaller(auth, method, params...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return caller
+}
+
+func TestDappTenants(t *testing.T) {
+	api, root, keys := newSigningTestAPI(t, 1)
+	ctx := context.Background()
+
+	wallet, walletKey := addTestDapp(t, api, root, keys, types.DappSettings{Name: "wallet"})
+	game, gameKey := addTestDapp(t, api, root, keys, types.DappSettings{Name: "game"})
+	if wallet.Account != dappAccountBase || game.Account != dappAccountBase+1 {
+		t.Fatalf("dapp accounts: have %d %d, want %d %d", wallet.Account, game.Account, dappAccountBase, dappAccountBase+1)
+	}
+	if _, err := api.updateDapp(signAdminCall(root, keys, "admin_updateDapp", uint32(1), game.DappSettings), 1, game.DappSettings); err != types.ErrDappNotRegister {
+		t.Fatalf("update unknown dapp: have %v, want %v", err, types.ErrDappNotRegister)
+	}
+
+	// The same user id is a different user in every dapp and without one
+	user := "13800000001"
+	inWallet, err := api.register(ctx, dappCall(t, root, wallet.Account, walletKey, "truekey_registerAccount", user), user)
+	if err != nil {
+		t.Fatalf("register in wallet: %v", err)
+	}
+	inGame, err := api.register(ctx, dappCall(t, root, game.Account, gameKey, "truekey_registerAccount", user), user)
+	if err != nil {
+		t.Fatalf("register in game: %v", err)
+	}
+	unscoped, err := api.register(ctx, nil, user)
+	if err != nil {
+		t.Fatalf("register without dapp: %v", err)
+	}
+	if inWallet == inGame || inWallet == unscoped || inGame == unscoped {
+		t.Fatalf("dapps share an account: %x %x %x", inWallet, inGame, unscoped)
+	}
+	v := api.rootWallets[root]
+	account := wallet.Account
+	child := v.Accounts[scopedUserID(v, &account, user)]
+	if want := "m/44'/60'/2000000'/0/0"; child == nil || child.Account.URL.Path != want {
+		t.Fatalf("wallet user path: have %v, want %s", child, want)
+	}
+	again, err := api.register(ctx, dappCall(t, root, wallet.Account, walletKey, "truekey_registerAccount", user), user)
+	if err != nil || again != inWallet {
+		t.Fatalf("register again: have %x %v, want %x", again, err, inWallet)
+	}
+	dapps, err := api.dapps(signAdminCall(root, keys, "admin_dapps"))
+	if err != nil || len(dapps) != 2 || dapps[0].Users != 1 || dapps[1].Users != 1 {
+		t.Fatalf("dapps: have %+v %v", dapps, err)
+	}
+
+	// A dapp cannot sign with the key of another or for another
+	caller := dappCall(t, root, wallet.Account, gameKey, "truekey_registerAccount", user)
+	if _, err := api.register(ctx, caller, user); err != types.ErrDappSignError {
+		t.Fatalf("register with the key of another dapp: have %v, want %v", err, types.ErrDappSignError)
+	}
+	tx := testTx()
+	caller = dappCall(t, root, wallet.Account, walletKey, "truekey_signHashPlain", "tx")
+	caller.auth.CreatedAt -= hexutil.Uint64(2 * adminCallTimeout / time.Second)
+	if _, err := api.signHashPlain(ctx, caller, user, tx); err != types.ErrDappAuthExpired {
+		t.Fatalf("stale call: have %v, want %v", err, types.ErrDappAuthExpired)
+	}
+	caller = dappCall(t, root, game.Account, gameKey, "truekey_signHashPlain", "tx")
+	if _, err := api.signHashPlain(ctx, caller, user, tx); err != nil {
+		t.Fatalf("sign in game: %v", err)
+	}
+	// A call is signed once, a replay of it is refused
+	if _, err := api.signHashPlain(ctx, caller, user, tx); err != types.ErrDappReplay {
+		t.Fatalf("replayed call: have %v, want %v", err, types.ErrDappReplay)
+	}
+	if _, err := api.signHashPlain(ctx, nil, user, tx); err != nil {
+		t.Fatalf("sign without dapp: %v", err)
+	}
+}
+
+func TestDappAllowlistAndPolicy(t *testing.T) {
+	api, root, keys := newSigningTestAPI(t, 3)
+	ctx := context.WithValue(context.Background(), "remote", "10.0.0.1:5000")
+
+	dapp, key := addTestDapp(t, api, root, keys[:2], types.DappSettings{Name: "wallet", Allowlist: []string{"192.168.0.0/16"}})
+	if _, err := api.register(ctx, dappCall(t, root, dapp.Account, key, "truekey_registerAccount", "bob"), "bob"); err != types.ErrDappIP {
+		t.Fatalf("call from outside the allowlist: have %v, want %v", err, types.ErrDappIP)
+	}
+	if _, err := api.addDapp(signAdminCall(root, keys[:1], "admin_addDapp", dapp.DappSettings), dapp.DappSettings); err != types.ErrAdminQuorum {
+		t.Fatalf("add dapp without quorum: have %v, want %v", err, types.ErrAdminQuorum)
+	}
+
+	dappAdmin, _ := crypto.GenerateKey()
+	otherDappAdmin, _ := crypto.GenerateKey()
+	settings := dapp.DappSettings
+	settings.Allowlist = append(settings.Allowlist, "10.0.0.1")
+	settings.Admins = []common.Address{crypto.PubkeyToAddress(dappAdmin.PublicKey), crypto.PubkeyToAddress(otherDappAdmin.PublicKey)}
+	settings.Policy = types.DecisionEscalate
+	if _, err := api.updateDapp(signAdminCall(root, keys[:2], "admin_updateDapp", dapp.Account, settings), dapp.Account, settings); err != nil {
+		t.Fatalf("update dapp: %v", err)
+	}
+	if _, err := api.register(ctx, dappCall(t, root, dapp.Account, key, "truekey_registerAccount", "bob"), "bob"); err != types.ErrPolicyEscalate {
+		t.Fatalf("register under an escalating dapp: have %v, want %v", err, types.ErrPolicyEscalate)
+	}
+
+	// Escalated transactions of the dapp are decided by its admins together
+	// with the admins of the root
+	settings.Policy = ""
+	api.updateDapp(signAdminCall(root, keys[:2], "admin_updateDapp", dapp.Account, settings), dapp.Account, settings)
+	if _, err := api.register(ctx, dappCall(t, root, dapp.Account, key, "truekey_registerAccount", "bob"), "bob"); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	settings.Policy = types.DecisionEscalate
+	api.updateDapp(signAdminCall(root, keys[:2], "admin_updateDapp", dapp.Account, settings), dapp.Account, settings)
+	tx := testTx()
+	_, err := api.signHashPlain(ctx, dappCall(t, root, dapp.Account, key, "truekey_signHashPlain", "tx"), "bob", tx)
+	var pending *types.PendingError
+	if !errors.As(err, &pending) {
+		t.Fatalf("escalated tx: have %v, want %v", err, types.ErrRequestPending)
+	}
+	id := pending.ID
+	req := rawdb.ReadPendingRequest(api.db, id)
+	if req == nil || req.Request.Dapp == nil || *req.Request.Dapp != dapp.Account {
+		t.Fatalf("pending request dapp: have %+v", req)
+	}
+	// Only the dapp looks up its requests
+	if result, err := api.pendingResult(ctx, dappCall(t, root, dapp.Account, key, "truekey_pendingResult", id), id); err != nil || result.Status != types.PendingStatusPending {
+		t.Fatalf("result for the dapp: have %+v %v", result, err)
+	}
+	if _, err := api.pendingResult(ctx, nil, id); err != types.ErrRequestNotFound {
+		t.Fatalf("result without the dapp: have %v, want %v", err, types.ErrRequestNotFound)
+	}
+	outsider, _ := crypto.GenerateKey()
+	signers := []*ecdsa.PrivateKey{keys[0], outsider}
+	if _, err := api.approveRequest(signAdminCall(root, signers, "admin_approveRequest", id, "ok"), id, "ok"); err != types.ErrAdminError {
+		t.Fatalf("approve by an outsider: have %v, want %v", err, types.ErrAdminError)
+	}
+	// The admins of the dapp reach the quorum, but not without the root
+	signers = []*ecdsa.PrivateKey{dappAdmin, otherDappAdmin}
+	if _, err := api.approveRequest(signAdminCall(root, signers, "admin_approveRequest", id, "ok"), id, "ok"); err != types.ErrAdminQuorum {
+		t.Fatalf("approve by dapp admins only: have %v, want %v", err, types.ErrAdminQuorum)
+	}
+	signers = []*ecdsa.PrivateKey{keys[0], dappAdmin}
+	result, err := api.approveRequest(signAdminCall(root, signers, "admin_approveRequest", id, "ok"), id, "ok")
+	if err != nil || result.Status != types.PendingStatusApproved {
+		t.Fatalf("approve by a dapp admin: have %+v %v", result, err)
+	}
+
+	settings.Policy = types.DecisionReject
+	api.updateDapp(signAdminCall(root, keys[:2], "admin_updateDapp", dapp.Account, settings), dapp.Account, settings)
+	if _, err := api.signHashPlain(ctx, dappCall(t, root, dapp.Account, key, "truekey_signHashPlain", "tx"), "bob", tx); err != types.ErrPolicyReject {
+		t.Fatalf("tx of a suspended dapp: have %v, want %v", err, types.ErrPolicyReject)
+	}
+}
+
+func TestDappLimits(t *testing.T) {
+	api, root, keys := newSigningTestAPI(t, 1)
+	ctx := context.Background()
+	config := api.configs[root]
+	config.Limits = &types.LimitConfig{Dapp: types.WindowLimits{Day: &types.Limit{Count: 5}}}
+	api.configs[root] = config
+
+	limited, limitedKey := addTestDapp(t, api, root, keys, types.DappSettings{Name: "limited", Limits: &types.WindowLimits{Day: &types.Limit{Value: big.NewInt(1)}}})
+	other, otherKey := addTestDapp(t, api, root, keys, types.DappSettings{Name: "other"})
+
+	for _, user := range []string{"bob", "carol"} {
+		if _, err := api.register(ctx, dappCall(t, root, limited.Account, limitedKey, "truekey_registerAccount", user), user); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := api.register(ctx, dappCall(t, root, other.Account, otherKey, "truekey_registerAccount", "bob"), "bob"); err != nil {
+		t.Fatal(err)
+	}
+	tx := testTx()
+	if _, err := api.signHashPlain(ctx, dappCall(t, root, limited.Account, limitedKey, "truekey_signHashPlain", "tx"), "bob", tx); err != nil {
+		t.Fatalf("first tx: %v", err)
+	}
+	if _, err := api.signHashPlain(ctx, dappCall(t, root, limited.Account, limitedKey, "truekey_signHashPlain", "tx"), "carol", tx); !errors.Is(err, types.ErrLimitExceeded) {
+		t.Fatalf("tx over the dapp limit: have %v, want %v", err, types.ErrLimitExceeded)
+	}
+	// The other dapp has the limits of the root and its own usage
+	for i := 0; i < 2; i++ {
+		if _, err := api.signHashPlain(ctx, dappCall(t, root, other.Account, otherKey, "truekey_signHashPlain", "tx"), "bob", tx); err != nil {
+			t.Fatalf("tx %d of the other dapp: %v", i, err)
+		}
+	}
+}
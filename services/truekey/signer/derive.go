@@ -0,0 +1,122 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package signer
+
+import (
+	"ethereum/keyservice/accounts"
+	"ethereum/keyservice/common"
+	"ethereum/keyservice/crypto"
+	"ethereum/keyservice/services/truekey/rawdb"
+	"ethereum/keyservice/services/truekey/types"
+	"strconv"
+)
+
+const (
+	// indexAccountBase is the first hardened account of the index scheme. It is
+	// out of reach of the dapp index of a phone number, so a root switching
+	// schemes never hands out a path twice.
+	indexAccountBase = 1000000
+
+	// indexesPerAccount is the number of non-hardened indexes allocated under
+	// one account before the next account is opened.
+	indexesPerAccount = 0x80000000
+)
+
+// allocationKey is the IndexKey of the counter of users allocated an index
+// under root.
+func allocationKey(root common.Address) common.Hash {
+	return crypto.Keccak256Hash([]byte("userIds"), root.Bytes())
+}
+
+// allocate assigns the next free (account, index) pair of root. The counter is
+// read from db and written to batch, to be committed together with the account it is for, so
+// a pair is never handed out twice. The caller holds indexMutex.
+func (api *SignerAPI) allocate(db rawdb.DatabaseReader, batch rawdb.DatabaseWriter, root common.Address) (uint32, uint32) {
+	n := rawdb.ReadIndexKey(db, allocationKey(root))
+	rawdb.WriteIndexKey(batch, allocationKey(root), n+1)
+	return uint32(indexAccountBase + n/indexesPerAccount), uint32(n % indexesPerAccount)
+}
+
+// derivationPath returns the path of a new user of root following the user id
+// scheme and path template of the root, or of a new user of dapp, and the
+// template it was filled in from. Counters are read from db, allocated indexes
+// are written to batch.
+func (api *SignerAPI) derivationPath(db rawdb.DatabaseReader, batch rawdb.DatabaseWriter, root common.Address, dapp *types.Dapp, user string) (accounts.DerivationPath, types.PathTemplate, error) {
+	if dapp != nil {
+		return api.dappPath(batch, dapp)
+	}
+	var account, index uint32
+	switch api.configs[root].UserIDScheme() {
+	case types.UserIDsIndex:
+		account, index = api.allocate(db, batch, root)
+	default:
+		phone, err := strconv.ParseUint(user, 10, 64)
+		if err != nil {
+			return nil, "", types.ErrPhoneError
+		}
+		if account, index, err = phoneIndexes(phone); err != nil {
+			return nil, "", err
+		}
+	}
+	template := api.configs[root].PathTemplate(account)
+	path, err := template.Path(account, index)
+	if err != nil {
+		return nil, "", err
+	}
+	return path, template, nil
+}
+
+// overlayDB reads through to a database and keeps what is written to it in
+// memory. Derivations on it allocate indexes as registrations would, the
+// writes reach the datadir only if written to a batch with writeTo.
+type overlayDB struct {
+	db     rawdb.DatabaseReader
+	writes map[string][]byte
+}
+
+func newOverlayDB(db rawdb.DatabaseReader) *overlayDB {
+	return &overlayDB{db: db, writes: make(map[string][]byte)}
+}
+
+func (o *overlayDB) Has(key []byte) (bool, error) {
+	if _, ok := o.writes[string(key)]; ok {
+		return true, nil
+	}
+	return o.db.Has(key)
+}
+
+func (o *overlayDB) Get(key []byte) ([]byte, error) {
+	if value, ok := o.writes[string(key)]; ok {
+		return common.CopyBytes(value), nil
+	}
+	return o.db.Get(key)
+}
+
+func (o *overlayDB) Put(key []byte, value []byte) error {
+	o.writes[string(key)] = common.CopyBytes(value)
+	return nil
+}
+
+// writeTo copies the writes kept in memory to batch.
+func (o *overlayDB) writeTo(batch rawdb.DatabaseWriter) error {
+	for key, value := range o.writes {
+		if err := batch.Put([]byte(key), value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
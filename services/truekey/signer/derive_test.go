@@ -0,0 +1,124 @@
+package signer
+
+import (
+	"context"
+	"ethereum/keyservice/accounts/keystore"
+	"ethereum/keyservice/crypto"
+	"ethereum/keyservice/services/truekey/types"
+	"testing"
+)
+
+func TestIndexAllocation(t *testing.T) {
+	api, root, _ := newSigningTestAPI(t, 1)
+	config := api.configs[root]
+	ui := NewUIServerAPI(api)
+	ctx := context.Background()
+
+	// The phone scheme keeps deriving from the number
+	phone, err := ui.RegisterAccount(ctx, `{"userId":13800000000}`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ui.RegisterAccount(ctx, `{"userId":"alice@example.com"}`, nil); err != types.ErrPhoneError {
+		t.Fatalf("email under the phone scheme: have %v, want %v", err, types.ErrPhoneError)
+	}
+
+	config.UserIDs = types.UserIDsIndex
+	api.configs[root] = config
+	users := []struct{ json, id string }{
+		{`"alice@example.com"`, "alice@example.com"},
+		{`"6ba7b810-9dad-11d1-80b4-00c04fd430c8"`, "6ba7b810-9dad-11d1-80b4-00c04fd430c8"},
+		{`13800000001`, "13800000001"},
+	}
+	for i, user := range users {
+		if _, err := ui.RegisterAccount(ctx, `{"userId":`+user.json+`}`, nil); err != nil {
+			t.Fatalf("register %s: %v", user.id, err)
+		}
+		child := api.rootWallets[root].Accounts[userID(api.rootWallets[root].UserKey, user.id)]
+		if want, _ := types.DefaultPathTemplate.Path(indexAccountBase, uint32(i)); child == nil || child.Account.URL.Path != want.String() {
+			t.Fatalf("register %s: have %v, want path %s", user.id, child, want)
+		}
+	}
+	// Registered users keep their account, whatever the scheme
+	if again, err := ui.RegisterAccount(ctx, `{"userId":"13800000000"}`, nil); err != nil || again != phone {
+		t.Fatalf("phone user under the index scheme: have %x %v, want %x", again, err, phone)
+	}
+	if _, err := ui.RegisterAccount(ctx, `{"userId":""}`, nil); err != types.ErrUserIDError {
+		t.Fatalf("empty user id: have %v, want %v", err, types.ErrUserIDError)
+	}
+
+	// The counter survives a restart
+	key := api.PrivateKeys[root]
+	restarted, err := NewSignerAPI(api.db, []*keystore.Key{{Address: root, PrivateKey: key}}, []types.RootConfig{config})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := restarted.register(ctx, nil, "bob"); err != nil {
+		t.Fatal(err)
+	}
+	child := restarted.rootWallets[root].Accounts[userID(restarted.rootWallets[root].UserKey, "bob")]
+	if want, _ := types.DefaultPathTemplate.Path(indexAccountBase, uint32(len(users))); child.Account.URL.Path != want.String() {
+		t.Fatalf("after restart: have %s, want %s", child.Account.URL.Path, want)
+	}
+	if len(restarted.rootWallets[root].Accounts) != len(users)+2 {
+		t.Fatalf("accounts after restart: have %d, want %d", len(restarted.rootWallets[root].Accounts), len(users)+2)
+	}
+}
+
+func TestPathTemplates(t *testing.T) {
+	api, root, _ := newSigningTestAPI(t, 1)
+	config := api.configs[root]
+	config.Path = "m/44'/246'/{account}'/0/{index}"
+	config.DappPaths = map[string]types.PathTemplate{"138000": "m/44'/246'/{account}'/1/{index}'"}
+	api.configs[root] = config
+	ctx := context.Background()
+
+	tests := []struct {
+		user     string
+		template types.PathTemplate
+		path     string
+	}{
+		{"9999", config.Path, "m/44'/246'/0'/0/9999"},
+		{"13800000001", config.DappPaths["138000"], "m/44'/246'/138000'/1/1'"},
+		{"13900000001", config.Path, "m/44'/246'/139000'/0/1"},
+	}
+	addrs := make(map[string]string)
+	for _, tt := range tests {
+		addr, err := api.register(ctx, nil, tt.user)
+		if err != nil {
+			t.Fatalf("register %s: %v", tt.user, err)
+		}
+		child := api.rootWallets[root].Accounts[userID(api.rootWallets[root].UserKey, tt.user)]
+		if child.Account.URL.Path != tt.path || child.Template != tt.template {
+			t.Fatalf("register %s: have %s from %s, want %s from %s", tt.user, child.Account.URL.Path, child.Template, tt.path, tt.template)
+		}
+		addrs[tt.user] = addr.Hex()
+	}
+
+	// A changed template applies to new users only, registered users keep
+	// the account and template they were derived with
+	config.Path, config.DappPaths = "", nil
+	key, _ := crypto.ToECDSA(crypto.FromECDSA(api.PrivateKeys[root]))
+	api.Stop()
+	restarted, err := NewSignerAPI(api.db, []*keystore.Key{{Address: root, PrivateKey: key}}, []types.RootConfig{config})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		addr, err := restarted.register(ctx, nil, tt.user)
+		if err != nil || addr.Hex() != addrs[tt.user] {
+			t.Fatalf("registered %s after the change: have %s %v, want %s", tt.user, addr.Hex(), err, addrs[tt.user])
+		}
+		child := restarted.rootWallets[root].Accounts[userID(restarted.rootWallets[root].UserKey, tt.user)]
+		if child.Account.URL.Path != tt.path || child.Template != tt.template {
+			t.Fatalf("registered %s after the change: have %s from %s", tt.user, child.Account.URL.Path, child.Template)
+		}
+	}
+	if _, err := restarted.register(ctx, nil, "13800000002"); err != nil {
+		t.Fatal(err)
+	}
+	child := restarted.rootWallets[root].Accounts[userID(restarted.rootWallets[root].UserKey, "13800000002")]
+	if child.Account.URL.Path != "m/44'/60'/138000'/0/2" || child.Template != types.DefaultPathTemplate {
+		t.Fatalf("new user after the change: have %s from %s", child.Account.URL.Path, child.Template)
+	}
+}
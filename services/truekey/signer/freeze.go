@@ -0,0 +1,110 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package signer
+
+import (
+	"ethereum/keyservice/common"
+	"ethereum/keyservice/common/hexutil"
+	"ethereum/keyservice/services/truekey/rawdb"
+	"ethereum/keyservice/services/truekey/types"
+	"fmt"
+	"time"
+)
+
+// freezeScope returns the database key of a freeze, the zero address freezes
+// every root.
+func freezeScope(root common.Address, global bool) common.Address {
+	if global {
+		return common.Address{}
+	}
+	return root
+}
+
+// checkFrozen refuses signing with root while it or all roots are frozen.
+func (api *SignerAPI) checkFrozen(root common.Address, userID common.Hash) error {
+	for _, scope := range []common.Address{{}, root} {
+		if freeze := rawdb.ReadFreeze(api.db, scope); freeze != nil {
+			api.audit.Warn("Refused", "type", "freeze", "root", root, "userId", userID, "decision", "reject", "global", scope == common.Address{}, "reason", freeze.Reason)
+			return fmt.Errorf("%w: %s", types.ErrSigningFrozen, freeze.Reason)
+		}
+	}
+	return nil
+}
+
+// freeze stops signing for the root, or for every root if global is set. Any
+// single admin may pull the emergency brake. A global freeze set by another
+// root stays in place, it is theirs to lift.
+func (api *SignerAPI) freeze(auth types.AdminAuth, global bool, reason string) error {
+	api.indexMutex.Lock()
+	defer api.indexMutex.Unlock()
+
+	admins, err := api.checkAuth(auth, false, "admin_freeze", global, reason)
+	if err != nil {
+		return err
+	}
+	scope := freezeScope(auth.Root, global)
+	if checkFreezeOwner(rawdb.ReadFreeze(api.db, scope), auth.Root) != nil {
+		// Signing is stopped already, the freeze stays with its root
+		return nil
+	}
+	rawdb.WriteFreeze(api.db, scope, &types.Freeze{
+		Reason: reason,
+		By:     admins,
+		At:     hexutil.Uint64(time.Now().Unix()),
+		Root:   auth.Root,
+	})
+	return nil
+}
+
+// unfreeze resumes signing, it needs a quorum. A global freeze is lifted by the
+// root that set it.
+func (api *SignerAPI) unfreeze(auth types.AdminAuth, global bool, reason string) error {
+	api.indexMutex.Lock()
+	defer api.indexMutex.Unlock()
+
+	if _, err := api.checkAuth(auth, true, "admin_unfreeze", global, reason); err != nil {
+		return err
+	}
+	scope := freezeScope(auth.Root, global)
+	if err := checkFreezeOwner(rawdb.ReadFreeze(api.db, scope), auth.Root); err != nil {
+		return err
+	}
+	rawdb.DeleteFreeze(api.db, scope)
+	return nil
+}
+
+// checkFreezeOwner fails if freeze was set by the admins of another root than
+// root. Freezes stored without their root belong to every root.
+func checkFreezeOwner(freeze *types.Freeze, root common.Address) error {
+	if freeze != nil && freeze.Root != (common.Address{}) && freeze.Root != root {
+		return types.ErrFreezeOwner
+	}
+	return nil
+}
+
+func (api *SignerAPI) freezeStatus(auth types.AdminAuth) (*types.FreezeStatus, error) {
+	api.indexMutex.Lock()
+	defer api.indexMutex.Unlock()
+
+	if _, err := api.checkAuth(auth, false, "admin_freezeStatus"); err != nil {
+		return nil, err
+	}
+	return &types.FreezeStatus{
+		Global: rawdb.ReadFreeze(api.db, common.Address{}),
+		Root:   rawdb.ReadFreeze(api.db, auth.Root),
+	}, nil
+}
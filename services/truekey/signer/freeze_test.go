@@ -0,0 +1,88 @@
+package signer
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"ethereum/keyservice/common"
+	"ethereum/keyservice/crypto"
+	"ethereum/keyservice/services/truekey/types"
+	"testing"
+)
+
+func TestFreeze(t *testing.T) {
+	api, root, keys := newSigningTestAPI(t, 3)
+	tx := testTx()
+
+	if _, err := api.signHashPlain(context.Background(), nil, string(tx.UserID), tx); err != types.ErrAccountNotExist {
+		t.Fatalf("sign for an unregistered user: have %v, want %v", err, types.ErrAccountNotExist)
+	}
+	if _, err := api.register(context.Background(), nil, string(tx.UserID)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := api.signHashPlain(context.Background(), nil, string(tx.UserID), tx); err != nil {
+		t.Fatalf("sign before freeze: %v", err)
+	}
+	if err := api.freeze(signAdminCall(root, keys[:1], "admin_freeze", false, "incident"), false, "incident"); err != nil {
+		t.Fatalf("single admin freeze: %v", err)
+	}
+	if _, err := api.signHashPlain(context.Background(), nil, string(tx.UserID), tx); !errors.Is(err, types.ErrSigningFrozen) {
+		t.Fatalf("sign while frozen: have %v, want %v", err, types.ErrSigningFrozen)
+	}
+	if _, err := api.register(context.Background(), nil, "13800000001"); err != nil {
+		t.Fatalf("register while frozen: %v", err)
+	}
+	// The freeze survives a restart
+	restarted, err := NewSignerAPI(api.db, nil, []types.RootConfig{api.configs[root]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := restarted.checkFrozen(root, userID(api.rootWallets[root].UserKey, string(tx.UserID))); !errors.Is(err, types.ErrSigningFrozen) {
+		t.Fatalf("sign after restart: have %v, want %v", err, types.ErrSigningFrozen)
+	}
+	if err := api.unfreeze(signAdminCall(root, keys[:1], "admin_unfreeze", false, "resolved"), false, "resolved"); err != types.ErrAdminQuorum {
+		t.Fatalf("single admin unfreeze: have %v, want %v", err, types.ErrAdminQuorum)
+	}
+	if err := api.unfreeze(signAdminCall(root, keys[:2], "admin_unfreeze", false, "resolved"), false, "resolved"); err != nil {
+		t.Fatalf("quorum unfreeze: %v", err)
+	}
+	if _, err := api.signHashPlain(context.Background(), nil, string(tx.UserID), tx); err != nil {
+		t.Fatalf("sign after unfreeze: %v", err)
+	}
+
+	// A global freeze is not lifted by unfreezing the root alone
+	if err := api.freeze(signAdminCall(root, keys[:1], "admin_freeze", true, "incident"), true, "incident"); err != nil {
+		t.Fatalf("global freeze: %v", err)
+	}
+	if err := api.unfreeze(signAdminCall(root, keys[:2], "admin_unfreeze", false, "resolved"), false, "resolved"); err != nil {
+		t.Fatalf("root unfreeze: %v", err)
+	}
+	if _, err := api.signHashPlain(context.Background(), nil, string(tx.UserID), tx); !errors.Is(err, types.ErrSigningFrozen) {
+		t.Fatalf("sign while globally frozen: have %v, want %v", err, types.ErrSigningFrozen)
+	}
+	status, err := api.freezeStatus(signAdminCall(root, keys[:1], "admin_freezeStatus"))
+	if err != nil || status.Global == nil || status.Root != nil {
+		t.Fatalf("freeze status: have %+v %v", status, err)
+	}
+
+	// The admins of another root neither take over nor lift the global freeze
+	other := common.HexToAddress("0x02")
+	otherKey, _ := crypto.GenerateKey()
+	otherKeys := []*ecdsa.PrivateKey{otherKey}
+	api.configs[other] = types.RootConfig{Root: other, Admins: []common.Address{crypto.PubkeyToAddress(otherKey.PublicKey)}}
+	if err := api.freeze(signAdminCall(other, otherKeys, "admin_freeze", true, "other"), true, "other"); err != nil {
+		t.Fatalf("global freeze by another root: %v", err)
+	}
+	if err := api.unfreeze(signAdminCall(other, otherKeys, "admin_unfreeze", true, "resolved"), true, "resolved"); err != types.ErrFreezeOwner {
+		t.Fatalf("global unfreeze by another root: have %v, want %v", err, types.ErrFreezeOwner)
+	}
+	if status, _ := api.freezeStatus(signAdminCall(root, keys[:1], "admin_freezeStatus")); status.Global == nil || status.Global.Root != root || status.Global.Reason != "incident" {
+		t.Fatalf("global freeze after another root: have %+v", status.Global)
+	}
+	if err := api.unfreeze(signAdminCall(root, keys[:2], "admin_unfreeze", true, "resolved"), true, "resolved"); err != nil {
+		t.Fatalf("global unfreeze: %v", err)
+	}
+	if _, err := api.signHashPlain(context.Background(), nil, string(tx.UserID), tx); err != nil {
+		t.Fatalf("sign after global unfreeze: %v", err)
+	}
+}
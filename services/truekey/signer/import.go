@@ -0,0 +1,114 @@
+package signer
+
+import (
+	"ethereum/keyservice/common"
+	"ethereum/keyservice/log"
+	"ethereum/keyservice/services/truekey/rawdb"
+	"ethereum/keyservice/services/truekey/types"
+	"fmt"
+)
+
+// ImportUsers registers users of root, of the dapp with account if set, and
+// commits them in a single write. Users registered before keep their accounts,
+// so an interrupted import is resumed by running it again. The accounts are
+// derived as register does, the register policy is not consulted as imports
+// are made by admins. The caller splits large imports into batches.
+func (api *SignerAPI) ImportUsers(root common.Address, account *uint32, users []string) ([]*types.ImportedAccount, error) {
+	api.indexMutex.Lock()
+	defer api.indexMutex.Unlock()
+
+	return api.importUsers(root, account, users)
+}
+
+func (api *SignerAPI) importUsers(root common.Address, account *uint32, users []string) ([]*types.ImportedAccount, error) {
+	v, err := api.checkRoot(root)
+	if err != nil {
+		return nil, err
+	}
+	var dapp *types.Dapp
+	if account != nil {
+		if dapp = rawdb.ReadDapp(api.db, root, *account); dapp == nil {
+			return nil, types.ErrDappNotRegister
+		}
+	}
+	var (
+		overlay  = newOverlayDB(api.db)
+		derived  = make(map[common.Hash]*types.ChildAccount)
+		imported = make([]*types.ImportedAccount, 0, len(users))
+	)
+	for i, user := range users {
+		if err := checkUserID(user); err != nil {
+			return nil, fmt.Errorf("user %d of the batch: %v", i, err)
+		}
+		id := scopedUserID(v, dappIndex(dapp), user)
+		child, registered := v.Accounts[id]
+		if !registered {
+			child, registered = storedChild(api.db, v, id)
+		}
+		if !registered {
+			if child = derived[id]; child == nil {
+				if child, err = api.deriveChild(overlay, overlay, root, dapp, user, v); err != nil {
+					return nil, fmt.Errorf("user %d of the batch: %v", i, err)
+				}
+				if err := writeChild(overlay, v, child); err != nil {
+					return nil, err
+				}
+				rawdb.WriteRootChild(overlay, root.Hash(), child.ID)
+				derived[id] = child
+			}
+		}
+		imported = append(imported, &types.ImportedAccount{
+			UserID:  types.UserID(user),
+			Address: child.Account.Address,
+			Path:    child.Account.URL.Path,
+			New:     !registered,
+		})
+	}
+	if len(derived) == 0 {
+		return imported, nil
+	}
+	batch := api.db.NewBatch()
+	if err := overlay.writeTo(batch); err != nil {
+		return nil, err
+	}
+	if err := batch.Write(); err != nil {
+		return nil, err
+	}
+	for id, child := range derived {
+		v.Accounts[id] = child
+	}
+	log.Info("Users imported", "root", root, "dapp", account, "users", len(users), "new", len(derived))
+	return imported, nil
+}
+
+func (api *SignerAPI) importUserIDs(auth types.AdminAuth, users []types.UserID, account *uint32) ([]*types.ImportedAccount, error) {
+	api.indexMutex.Lock()
+	defer api.indexMutex.Unlock()
+
+	if _, err := api.checkAuth(auth, false, "admin_importUserIds", users, account); err != nil {
+		return nil, err
+	}
+	if len(users) > types.MaxImportUsers {
+		return nil, fmt.Errorf("import at most %d users a call", types.MaxImportUsers)
+	}
+	ids := make([]string, len(users))
+	for i, user := range users {
+		ids[i] = string(user)
+	}
+	return api.importUsers(auth.Root, account, ids)
+}
+
+// storedChild reads the account of a user from the database, for roots whose
+// accounts are not loaded, such as roots served without a config.
+func storedChild(db rawdb.DatabaseReader, v *types.RootWallet, id common.Hash) (*types.ChildAccount, bool) {
+	child := rawdb.ReadChildAccount(db, id)
+	if child == nil {
+		return nil, false
+	}
+	account, err := openPath(v.UserKey, child.Account)
+	if err != nil {
+		return nil, false
+	}
+	child.Account = account
+	return child, true
+}
@@ -0,0 +1,91 @@
+package signer
+
+import (
+	"context"
+	"ethereum/keyservice/accounts/keystore"
+	"ethereum/keyservice/crypto"
+	"ethereum/keyservice/etruedb"
+	"ethereum/keyservice/services/truekey/rawdb"
+	"ethereum/keyservice/services/truekey/types"
+	"testing"
+)
+
+func TestImportUsers(t *testing.T) {
+	api, root, keys := newSigningTestAPI(t, 1)
+	ctx := context.Background()
+	memdb := api.db.(*etruedb.MemDatabase)
+
+	// A batch fails as a whole, nothing of it is written
+	keysBefore := memdb.Len()
+	if _, err := api.ImportUsers(root, nil, []string{"13800000001", "alice"}); err == nil {
+		t.Fatal("imported an email under the phone scheme")
+	}
+	if memdb.Len() != keysBefore || len(api.rootWallets[root].Accounts) != 0 {
+		t.Fatal("failed batch written")
+	}
+
+	config := api.configs[root]
+	config.UserIDs = types.UserIDsIndex
+	api.configs[root] = config
+	first, err := api.ImportUsers(root, nil, []string{"alice", "bob", "alice", "carol"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first) != 4 || first[0].Address != first[2].Address || first[3].Path != "m/44'/60'/1000000'/0/2" {
+		t.Fatalf("import: have %+v", first)
+	}
+	for _, account := range first {
+		addr, err := api.register(ctx, nil, string(account.UserID))
+		if err != nil || addr != account.Address {
+			t.Fatalf("register %s after import: have %x %v, want %x", account.UserID, addr, err, account.Address)
+		}
+	}
+
+	// Importing again resumes after the users imported before
+	again, err := api.ImportUsers(root, nil, []string{"alice", "bob", "carol", "dave"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, account := range again[:3] {
+		if account.New || account.Address != first[[]int{0, 1, 3}[i]].Address {
+			t.Fatalf("import again %s: have %+v", account.UserID, account)
+		}
+	}
+	if !again[3].New || again[3].Path != "m/44'/60'/1000000'/0/3" {
+		t.Fatalf("resumed import: have %+v", again[3])
+	}
+	// Every user is indexed under a key of its own, not in a list rewritten
+	// by every batch
+	if ids := rawdb.ReadRootChildren(api.db, root.Hash()); len(ids) != 4 || rawdb.HasRootInfo(api.db, root.Hash()) {
+		t.Fatalf("root children: have %x", ids)
+	}
+
+	// The accounts are committed, not only cached
+	key, _ := crypto.ToECDSA(crypto.FromECDSA(api.PrivateKeys[root]))
+	api.Stop()
+	restarted, err := NewSignerAPI(api.db, []*keystore.Key{{Address: root, PrivateKey: key}}, []types.RootConfig{config})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr, err := restarted.register(ctx, nil, "dave"); err != nil || addr != again[3].Address {
+		t.Fatalf("imported user after restart: have %x %v, want %x", addr, err, again[3].Address)
+	}
+
+	// Dapps import their users under their account
+	dapp, _ := addTestDapp(t, restarted, root, keys, types.DappSettings{Name: "wallet"})
+	users := []types.UserID{"alice", "bob"}
+	imported, err := restarted.importUserIDs(signAdminCall(root, keys, "admin_importUserIds", users, &dapp.Account), users, &dapp.Account)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !imported[0].New || imported[0].Address == first[0].Address || imported[1].Path != "m/44'/60'/2000000'/0/1" {
+		t.Fatalf("dapp import: have %+v", imported)
+	}
+	missing := uint32(1)
+	if _, err := restarted.importUserIDs(signAdminCall(root, keys, "admin_importUserIds", users, &missing), users, &missing); err != types.ErrDappNotRegister {
+		t.Fatalf("import into an unknown dapp: have %v, want %v", err, types.ErrDappNotRegister)
+	}
+	if _, err := restarted.importUserIDs(signAdminCall(root, keys, "admin_importUserIds", users, nil), users, &dapp.Account); err == nil {
+		t.Fatal("import with a signature over other params")
+	}
+}
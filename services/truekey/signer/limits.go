@@ -0,0 +1,165 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package signer
+
+import (
+	"ethereum/keyservice/accounts"
+	"ethereum/keyservice/common"
+	"ethereum/keyservice/log"
+	"ethereum/keyservice/services/truekey/rawdb"
+	"ethereum/keyservice/services/truekey/types"
+	"math"
+	"math/big"
+	"time"
+)
+
+// limitsOf returns the spending limits of a root. Limits set over the admin API
+// take precedence over the config file until the limits in the config change,
+// then the config applies again.
+func (api *SignerAPI) limitsOf(root common.Address) *types.LimitConfig {
+	config := api.configs[root].Limits
+	if limits := rawdb.ReadLimits(api.db, root); limits != nil && limits.Config == types.LimitsHash(config) {
+		return &limits.Limits
+	}
+	return config
+}
+
+// dropStaleLimits deletes the limits admins set for roots whose config limits
+// changed since, so they do not return when the config is reverted.
+func (api *SignerAPI) dropStaleLimits(by string) {
+	for root, rc := range api.configs {
+		limits := rawdb.ReadLimits(api.db, root)
+		if limits == nil || limits.Config == types.LimitsHash(rc.Limits) {
+			continue
+		}
+		rawdb.DeleteLimits(api.db, root)
+		api.audit.Info("Admin limits replaced by the config", "type", "config", "by", by, "root", root)
+	}
+}
+
+// dappOf returns the dapp an account belongs to, which is the hardened account
+// level of its derivation path.
+func dappOf(child *types.ChildAccount) uint64 {
+	path, err := accounts.ParseDerivationPath(child.Account.URL.Path)
+	if err != nil {
+		return 0
+	}
+	level := 2
+	if child.Template != "" {
+		level = child.Template.AccountLevel()
+	}
+	if level < 0 || level >= len(path) || path[level] < 0x80000000 {
+		return 0
+	}
+	return uint64(path[level] - 0x80000000)
+}
+
+// dappLimits returns the limits of a dapp of root, its own ones if it is a
+// dapp with limits.
+func (api *SignerAPI) dappLimits(root common.Address, limits *types.LimitConfig, dapp uint64) types.WindowLimits {
+	if dapp <= math.MaxUint32 {
+		if d := rawdb.ReadDapp(api.db, root, uint32(dapp)); d != nil && d.Limits != nil {
+			return *d.Limits
+		}
+	}
+	if limits == nil {
+		return types.WindowLimits{}
+	}
+	return limits.Dapp
+}
+
+// checkLimits fails if signing value from account would exceed the account or
+// the dapp limits of the root.
+func (api *SignerAPI) checkLimits(root common.Address, child *types.ChildAccount, value *big.Int) error {
+	limits, dapp := api.limitsOf(root), dappOf(child)
+	now := uint64(time.Now().Unix())
+	if limits != nil {
+		if err := rawdb.ReadUsage(api.db, types.AccountUsageKey(child.Account.Address)).Check(limits.Account, now, value); err != nil {
+			log.Warn("Account spending limit reached", "root", root, "account", child.Account.Address, "err", err)
+			return err
+		}
+	}
+	if err := rawdb.ReadUsage(api.db, types.DappUsageKey(root, dapp)).Check(api.dappLimits(root, limits, dapp), now, value); err != nil {
+		log.Warn("Dapp spending limit reached", "root", root, "dapp", dapp, "err", err)
+		return err
+	}
+	return nil
+}
+
+// recordUsage adds a signed transaction to the account and dapp counters.
+func (api *SignerAPI) recordUsage(root common.Address, child *types.ChildAccount, value *big.Int) {
+	now := uint64(time.Now().Unix())
+	for _, key := range []common.Hash{types.AccountUsageKey(child.Account.Address), types.DappUsageKey(root, dappOf(child))} {
+		usage := rawdb.ReadUsage(api.db, key)
+		usage.Add(now, value)
+		rawdb.WriteUsage(api.db, key, usage)
+	}
+}
+
+func (api *SignerAPI) setLimits(auth types.AdminAuth, limits types.LimitConfig) error {
+	api.indexMutex.Lock()
+	defer api.indexMutex.Unlock()
+
+	if _, err := api.checkAuth(auth, true, "admin_setLimits", limits); err != nil {
+		return err
+	}
+	rawdb.WriteLimits(api.db, auth.Root, &types.AdminLimits{Limits: limits, Config: types.LimitsHash(api.configs[auth.Root].Limits)})
+	return nil
+}
+
+func (api *SignerAPI) usage(auth types.AdminAuth, scope types.UsageScope) (*types.UsageReport, error) {
+	api.indexMutex.Lock()
+	defer api.indexMutex.Unlock()
+
+	if _, err := api.checkAuth(auth, false, "admin_usage", scope); err != nil {
+		return nil, err
+	}
+	if err := scope.Validate(); err != nil {
+		return nil, err
+	}
+	now := uint64(time.Now().Unix())
+	usage := rawdb.ReadUsage(api.db, scope.Key(auth.Root))
+	report := &types.UsageReport{
+		Scope: scope,
+		Hour:  usage.Hour(now),
+		Day:   usage.Day(now),
+		Month: usage.Month(now),
+	}
+	if limits := api.limitsOf(auth.Root); limits != nil {
+		if scope.Account != nil {
+			report.Limits = limits.Account
+		}
+	}
+	if scope.Dapp != nil {
+		report.Limits = api.dappLimits(auth.Root, api.limitsOf(auth.Root), *scope.Dapp)
+	}
+	return report, nil
+}
+
+func (api *SignerAPI) resetUsage(auth types.AdminAuth, scope types.UsageScope) error {
+	api.indexMutex.Lock()
+	defer api.indexMutex.Unlock()
+
+	if _, err := api.checkAuth(auth, true, "admin_resetUsage", scope); err != nil {
+		return err
+	}
+	if err := scope.Validate(); err != nil {
+		return err
+	}
+	rawdb.DeleteUsage(api.db, scope.Key(auth.Root))
+	return nil
+}
@@ -0,0 +1,449 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package signer
+
+import (
+	"context"
+	"errors"
+	"ethereum/keyservice/common"
+	"ethereum/keyservice/common/hexutil"
+	"ethereum/keyservice/metrics"
+	"ethereum/keyservice/rpc"
+	"ethereum/keyservice/services/truekey/audit"
+	"ethereum/keyservice/services/truekey/rawdb"
+	"ethereum/keyservice/services/truekey/types"
+	"strings"
+	"time"
+)
+
+const (
+	// metricsRefreshInterval is how often the gauges are recomputed.
+	metricsRefreshInterval = 10 * time.Second
+
+	// otherDapp labels the calls of no dapp, and those whose dapp signature
+	// was not accepted. Dapps are labelled by the name the admins gave them.
+	otherDapp = "other"
+)
+
+var (
+	keysCachedGauge  = metrics.NewRegisteredGauge("truekey/keys/cached", nil)
+	rootsServedGauge = metrics.NewRegisteredGauge("truekey/roots/served", nil)
+	rootsSealedGauge = metrics.NewRegisteredGauge("truekey/roots/sealed", nil)
+)
+
+// resultCodes name the outcome of a call in the metrics, anything else is
+// counted as "error".
+var resultCodes = []struct {
+	err  error
+	code string
+}{
+	{types.ErrShuttingDown, "shutting_down"},
+	{types.ErrRootSealed, "sealed"},
+	{types.ErrRootRetired, "retired"},
+	{types.ErrSigningFrozen, "frozen"},
+	{types.ErrFreezeOwner, "unauthorized"},
+	{types.ErrPolicyReject, "policy_rejected"},
+	{types.ErrPolicyEscalate, "escalated"},
+	{types.ErrRequestPending, "pending"},
+	{types.ErrLimitExceeded, "limit_exceeded"},
+	{types.ErrAdminAuthExpired, "auth_expired"},
+	{types.ErrAdminReplay, "replayed"},
+	{types.ErrDappReplay, "replayed"},
+	{types.ErrAdminQuorum, "quorum"},
+	{types.ErrAdminError, "unauthorized"},
+	{types.ErrNotAuditor, "unauthorized"},
+	{types.ErrRootError, "unknown_root"},
+	{types.ErrRootNotServer, "not_served"},
+	{types.ErrAccountNotExist, "unknown_account"},
+	{types.ErrRequestNotFound, "unknown_request"},
+}
+
+// resultCode returns the metrics label of the outcome of a call.
+func resultCode(err error) string {
+	if err == nil {
+		return "ok"
+	}
+	for _, known := range resultCodes {
+		// Some errors are extended with details rather than wrapped
+		if errors.Is(err, known.err) || strings.HasPrefix(err.Error(), known.err.Error()) {
+			return known.code
+		}
+	}
+	return "error"
+}
+
+// rootLabel returns the metrics label of a root, empty for calls without one.
+func rootLabel(root common.Address) string {
+	if root == (common.Address{}) {
+		return ""
+	}
+	return strings.ToLower(root.Hex())
+}
+
+// callDappKey is the context key of the callDapp of a call.
+type callDappKey struct{}
+
+// callDapp receives the dapp a call was verified for, so the metrics label it
+// by the dapp that signed rather than by anything the caller claims.
+type callDapp struct {
+	name string
+}
+
+// withCallDapp returns a context checkDapp reports the verified dapp into.
+func withCallDapp(ctx context.Context) (context.Context, *callDapp) {
+	dapp := &callDapp{name: otherDapp}
+	return context.WithValue(ctx, callDappKey{}, dapp), dapp
+}
+
+// verifiedDapp reports the dapp a call was verified for to the metrics.
+func verifiedDapp(ctx context.Context, dapp *types.Dapp) {
+	if holder, ok := ctx.Value(callDappKey{}).(*callDapp); ok {
+		holder.name = dapp.Name
+	}
+}
+
+// recordCall counts and times a call under prefix.
+func recordCall(prefix string, start time.Time, err error, labels ...metrics.Label) {
+	labels = append([]metrics.Label{{Name: "code", Value: resultCode(err)}}, labels...)
+	metrics.GetOrRegisterCounter(metrics.LabeledName(prefix+"/requests", labels...), nil).Inc(1)
+	metrics.GetOrRegisterTimer(metrics.LabeledName(prefix+"/duration", labels...), nil).UpdateSince(start)
+}
+
+// countPolicy counts the requests the policy rejected or escalated.
+func countPolicy(root common.Address, err error) {
+	var name string
+	switch err {
+	case types.ErrPolicyReject:
+		name = "truekey/policy/rejected"
+	case types.ErrPolicyEscalate:
+		name = "truekey/policy/escalated"
+	default:
+		return
+	}
+	metrics.GetOrRegisterCounter(metrics.LabeledName(name, metrics.Label{Name: "root", Value: rootLabel(root)}), nil).Inc(1)
+}
+
+// updateMetrics recomputes the gauges of the cached keys, roots, registered
+// accounts and pending approvals.
+func (api *SignerAPI) updateMetrics() {
+	api.indexMutex.Lock()
+	defer api.indexMutex.Unlock()
+
+	if api.stopped {
+		return
+	}
+	var keys int64
+	for _, key := range api.PrivateKeys {
+		if key != nil {
+			keys++
+		}
+	}
+	for _, v := range api.rootWallets {
+		for _, child := range v.Accounts {
+			if child.PrivateKey != nil {
+				keys++
+			}
+		}
+	}
+	keysCachedGauge.Update(keys)
+	rootsServedGauge.Update(int64(len(api.rootWallets)))
+
+	var sealed int64
+	for root := range api.keystores {
+		if _, served := api.rootWallets[root]; !served {
+			sealed++
+		}
+	}
+	rootsSealedGauge.Update(sealed)
+
+	pending := make(map[common.Address]int64)
+	for _, root := range api.loadedRoots() {
+		registered := int64(len(rawdb.ReadRootChildren(api.db, root.Hash())))
+		metrics.GetOrRegisterGauge(metrics.LabeledName("truekey/accounts/registered", metrics.Label{Name: "root", Value: rootLabel(root)}), nil).Update(registered)
+		pending[root] = 0
+	}
+	for _, id := range rawdb.ReadPendingIndex(api.db) {
+		if req := rawdb.ReadPendingRequest(api.db, id); req != nil {
+			pending[req.Request.Root]++
+		}
+	}
+	for root, count := range pending {
+		metrics.GetOrRegisterGauge(metrics.LabeledName("truekey/pending/requests", metrics.Label{Name: "root", Value: rootLabel(root)}), nil).Update(count)
+	}
+}
+
+// MetricsServerAPI counts and times the dapp facing calls by method, result
+// code, root and dapp.
+type MetricsServerAPI struct {
+	api types.ServerAPI
+}
+
+// NewMetricsServerAPI wraps api with metrics.
+func NewMetricsServerAPI(api types.ServerAPI) *MetricsServerAPI {
+	return &MetricsServerAPI{api}
+}
+
+func (m *MetricsServerAPI) record(dapp *callDapp, method string, root common.Address, start time.Time, err error) {
+	recordCall("truekey/rpc", start, err,
+		metrics.Label{Name: "method", Value: method},
+		metrics.Label{Name: "root", Value: rootLabel(root)},
+		metrics.Label{Name: "dapp", Value: dapp.name})
+}
+
+func (m *MetricsServerAPI) RegisterDapp(ctx context.Context, quest types.AdminQuest, encryMessage types.EncryptMessage) (*types.EncryptMessage, error) {
+	start := time.Now()
+	ctx, dapp := withCallDapp(ctx)
+	res, err := m.api.RegisterDapp(ctx, quest, encryMessage)
+	m.record(dapp, "truekey_registerDapp", quest.Root, start, err)
+	return res, err
+}
+
+func (m *MetricsServerAPI) RegisterAccount(ctx context.Context, userId string, auth *types.DappAuth) (common.Address, error) {
+	start := time.Now()
+	ctx, dapp := withCallDapp(ctx)
+	res, err := m.api.RegisterAccount(ctx, userId, auth)
+	m.record(dapp, "truekey_registerAccount", callRoot(auth), start, err)
+	return res, err
+}
+
+func (m *MetricsServerAPI) PreviewAccounts(ctx context.Context, request string, auth *types.DappAuth) ([]*types.PreviewAccount, error) {
+	start := time.Now()
+	ctx, dapp := withCallDapp(ctx)
+	res, err := m.api.PreviewAccounts(ctx, request, auth)
+	m.record(dapp, "truekey_previewAccounts", callRoot(auth), start, err)
+	return res, err
+}
+
+func (m *MetricsServerAPI) AuthPub(ctx context.Context, quest types.AdminQuest, auth types.AuthQuest) (*types.EncryptMessage, error) {
+	start := time.Now()
+	ctx, dapp := withCallDapp(ctx)
+	res, err := m.api.AuthPub(ctx, quest, auth)
+	m.record(dapp, "truekey_authPub", quest.Root, start, err)
+	return res, err
+}
+
+func (m *MetricsServerAPI) SignHash(ctx context.Context, key common.Hash, addr common.Address, id common.Hash, encryMessage types.EncryptMessage) (*types.EncryptMessage, error) {
+	start := time.Now()
+	ctx, dapp := withCallDapp(ctx)
+	res, err := m.api.SignHash(ctx, key, addr, id, encryMessage)
+	m.record(dapp, "truekey_signHash", common.Address{}, start, err)
+	return res, err
+}
+
+func (m *MetricsServerAPI) SignHashPlain(ctx context.Context, query string, auth *types.DappAuth) (hexutil.Bytes, error) {
+	start := time.Now()
+	ctx, dapp := withCallDapp(ctx)
+	res, err := m.api.SignHashPlain(ctx, query, auth)
+	m.record(dapp, "truekey_signHashPlain", callRoot(auth), start, err)
+	return res, err
+}
+
+func (m *MetricsServerAPI) PendingResult(ctx context.Context, id common.Hash, auth *types.DappAuth) (*types.PendingResult, error) {
+	start := time.Now()
+	ctx, dapp := withCallDapp(ctx)
+	res, err := m.api.PendingResult(ctx, id, auth)
+	m.record(dapp, "truekey_pendingResult", callRoot(auth), start, err)
+	return res, err
+}
+
+func (m *MetricsServerAPI) PendingDecision(ctx context.Context, id common.Hash, auth *types.DappAuth) (*rpc.Subscription, error) {
+	start := time.Now()
+	ctx, dapp := withCallDapp(ctx)
+	res, err := m.api.PendingDecision(ctx, id, auth)
+	m.record(dapp, "truekey_subscribe_pendingDecision", callRoot(auth), start, err)
+	return res, err
+}
+
+func (m *MetricsServerAPI) Status(ctx context.Context) (*types.Status, error) {
+	start := time.Now()
+	ctx, dapp := withCallDapp(ctx)
+	res, err := m.api.Status(ctx)
+	m.record(dapp, "truekey_status", common.Address{}, start, err)
+	return res, err
+}
+
+func (m *MetricsServerAPI) Version(ctx context.Context) (string, error) {
+	start := time.Now()
+	ctx, dapp := withCallDapp(ctx)
+	res, err := m.api.Version(ctx)
+	m.record(dapp, "truekey_version", common.Address{}, start, err)
+	return res, err
+}
+
+// MetricsAdminAPI counts and times the admin calls by method, result code and
+// root.
+type MetricsAdminAPI struct {
+	api types.AdminAPI
+}
+
+// NewMetricsAdminAPI wraps api with metrics.
+func NewMetricsAdminAPI(api types.AdminAPI) *MetricsAdminAPI {
+	return &MetricsAdminAPI{api}
+}
+
+func (m *MetricsAdminAPI) record(method string, root common.Address, start time.Time, err error) {
+	recordCall("truekey/admin", start, err,
+		metrics.Label{Name: "method", Value: method},
+		metrics.Label{Name: "root", Value: rootLabel(root)})
+}
+
+func (m *MetricsAdminAPI) SetLimits(ctx context.Context, auth types.AdminAuth, limits types.LimitConfig) error {
+	start := time.Now()
+	err := m.api.SetLimits(ctx, auth, limits)
+	m.record("admin_setLimits", auth.Root, start, err)
+	return err
+}
+
+func (m *MetricsAdminAPI) Usage(ctx context.Context, auth types.AdminAuth, scope types.UsageScope) (*types.UsageReport, error) {
+	start := time.Now()
+	res, err := m.api.Usage(ctx, auth, scope)
+	m.record("admin_usage", auth.Root, start, err)
+	return res, err
+}
+
+func (m *MetricsAdminAPI) ResetUsage(ctx context.Context, auth types.AdminAuth, scope types.UsageScope) error {
+	start := time.Now()
+	err := m.api.ResetUsage(ctx, auth, scope)
+	m.record("admin_resetUsage", auth.Root, start, err)
+	return err
+}
+
+func (m *MetricsAdminAPI) PendingRequests(ctx context.Context, auth types.AdminAuth) ([]*types.PendingRequest, error) {
+	start := time.Now()
+	res, err := m.api.PendingRequests(ctx, auth)
+	m.record("admin_pendingRequests", auth.Root, start, err)
+	return res, err
+}
+
+func (m *MetricsAdminAPI) ApproveRequest(ctx context.Context, auth types.AdminAuth, id common.Hash, reason string) (*types.PendingResult, error) {
+	start := time.Now()
+	res, err := m.api.ApproveRequest(ctx, auth, id, reason)
+	m.record("admin_approveRequest", auth.Root, start, err)
+	return res, err
+}
+
+func (m *MetricsAdminAPI) DenyRequest(ctx context.Context, auth types.AdminAuth, id common.Hash, reason string) (*types.PendingResult, error) {
+	start := time.Now()
+	res, err := m.api.DenyRequest(ctx, auth, id, reason)
+	m.record("admin_denyRequest", auth.Root, start, err)
+	return res, err
+}
+
+func (m *MetricsAdminAPI) Freeze(ctx context.Context, auth types.AdminAuth, global bool, reason string) error {
+	start := time.Now()
+	err := m.api.Freeze(ctx, auth, global, reason)
+	m.record("admin_freeze", auth.Root, start, err)
+	return err
+}
+
+func (m *MetricsAdminAPI) Unfreeze(ctx context.Context, auth types.AdminAuth, global bool, reason string) error {
+	start := time.Now()
+	err := m.api.Unfreeze(ctx, auth, global, reason)
+	m.record("admin_unfreeze", auth.Root, start, err)
+	return err
+}
+
+func (m *MetricsAdminAPI) FreezeStatus(ctx context.Context, auth types.AdminAuth) (*types.FreezeStatus, error) {
+	start := time.Now()
+	res, err := m.api.FreezeStatus(ctx, auth)
+	m.record("admin_freezeStatus", auth.Root, start, err)
+	return res, err
+}
+
+func (m *MetricsAdminAPI) Seal(ctx context.Context, auth types.AdminAuth) error {
+	start := time.Now()
+	err := m.api.Seal(ctx, auth)
+	m.record("admin_seal", auth.Root, start, err)
+	return err
+}
+
+func (m *MetricsAdminAPI) Unseal(ctx context.Context, root common.Address, share hexutil.Bytes) (*types.SealStatus, error) {
+	start := time.Now()
+	res, err := m.api.Unseal(ctx, root, share)
+	m.record("admin_unseal", root, start, err)
+	return res, err
+}
+
+func (m *MetricsAdminAPI) SealStatus(ctx context.Context, root common.Address) (*types.SealStatus, error) {
+	start := time.Now()
+	res, err := m.api.SealStatus(ctx, root)
+	m.record("admin_sealStatus", root, start, err)
+	return res, err
+}
+
+func (m *MetricsAdminAPI) AddRoot(ctx context.Context, auth types.AdminAuth, passphrase string) error {
+	start := time.Now()
+	err := m.api.AddRoot(ctx, auth, passphrase)
+	m.record("admin_addRoot", auth.Root, start, err)
+	return err
+}
+
+func (m *MetricsAdminAPI) RetireRoot(ctx context.Context, auth types.AdminAuth, reason string) error {
+	start := time.Now()
+	err := m.api.RetireRoot(ctx, auth, reason)
+	m.record("admin_retireRoot", auth.Root, start, err)
+	return err
+}
+
+func (m *MetricsAdminAPI) ReloadConfig(ctx context.Context, auth types.AdminAuth) ([]string, error) {
+	start := time.Now()
+	res, err := m.api.ReloadConfig(ctx, auth)
+	m.record("admin_reloadConfig", auth.Root, start, err)
+	return res, err
+}
+
+func (m *MetricsAdminAPI) AddDapp(ctx context.Context, auth types.AdminAuth, settings types.DappSettings) (*types.Dapp, error) {
+	start := time.Now()
+	res, err := m.api.AddDapp(ctx, auth, settings)
+	m.record("admin_addDapp", auth.Root, start, err)
+	return res, err
+}
+
+func (m *MetricsAdminAPI) UpdateDapp(ctx context.Context, auth types.AdminAuth, account uint32, settings types.DappSettings) (*types.Dapp, error) {
+	start := time.Now()
+	res, err := m.api.UpdateDapp(ctx, auth, account, settings)
+	m.record("admin_updateDapp", auth.Root, start, err)
+	return res, err
+}
+
+func (m *MetricsAdminAPI) Dapps(ctx context.Context, auth types.AdminAuth) ([]*types.Dapp, error) {
+	start := time.Now()
+	res, err := m.api.Dapps(ctx, auth)
+	m.record("admin_dapps", auth.Root, start, err)
+	return res, err
+}
+
+func (m *MetricsAdminAPI) ExtendedPublicKey(ctx context.Context, auth types.AdminAuth, account uint32) (*types.ExtendedPublicKey, error) {
+	start := time.Now()
+	res, err := m.api.ExtendedPublicKey(ctx, auth, account)
+	m.record("admin_extendedPublicKey", auth.Root, start, err)
+	return res, err
+}
+
+func (m *MetricsAdminAPI) ImportUserIDs(ctx context.Context, auth types.AdminAuth, users []types.UserID, dapp *uint32) ([]*types.ImportedAccount, error) {
+	start := time.Now()
+	res, err := m.api.ImportUserIDs(ctx, auth, users, dapp)
+	m.record("admin_importUserIds", auth.Root, start, err)
+	return res, err
+}
+
+func (m *MetricsAdminAPI) AuditSearch(ctx context.Context, auth types.AdminAuth, query audit.Query) (*types.AuditSearchResult, error) {
+	start := time.Now()
+	res, err := m.api.AuditSearch(ctx, auth, query)
+	m.record("admin_auditSearch", auth.Root, start, err)
+	return res, err
+}
@@ -0,0 +1,83 @@
+package signer
+
+import (
+	"context"
+	"ethereum/keyservice/metrics"
+	"ethereum/keyservice/services/truekey/types"
+	"fmt"
+	"testing"
+)
+
+func TestResultCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		code string
+	}{
+		{nil, "ok"},
+		{types.ErrRootSealed, "sealed"},
+		{fmt.Errorf("%w: incident", types.ErrSigningFrozen), "frozen"},
+		{fmt.Errorf("%v: 0x01", types.ErrRequestPending), "pending"},
+		{fmt.Errorf("missing required field"), "error"},
+	}
+	for _, tt := range tests {
+		if code := resultCode(tt.err); code != tt.code {
+			t.Errorf("%v: have %q, want %q", tt.err, code, tt.code)
+		}
+	}
+}
+
+func TestCallMetrics(t *testing.T) {
+	api, root, keys := newSigningTestAPI(t, 1)
+	api.SetPolicy(escalatePolicy{})
+	server := NewMetricsServerAPI(NewUIServerAPI(api))
+	if _, err := api.register(context.Background(), nil, "13800000000"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The Origin header a caller sends does not name a dapp
+	tx := `{"userId":13800000000,"to":"0x0000000000000000000000000000000000000001","value":"1","gasPrice":1,"gasLimit":21000,"nonce":0,"data":"0x","chainId":18928}`
+	ctx := context.WithValue(context.Background(), "Origin", "https://dapp.example")
+	if _, err := server.SignHashPlain(ctx, tx, nil); err == nil {
+		t.Fatal("escalated tx signed")
+	}
+	labels := []metrics.Label{
+		{Name: "code", Value: "pending"},
+		{Name: "method", Value: "truekey_signHashPlain"},
+		{Name: "root", Value: rootLabel(root)},
+		{Name: "dapp", Value: otherDapp},
+	}
+	counter, ok := metrics.DefaultRegistry.Get(metrics.LabeledName("truekey/rpc/requests", labels...)).(metrics.Counter)
+	if !ok || counter.Count() != 1 {
+		t.Fatalf("request counter: have %v", counter)
+	}
+	if timer, ok := metrics.DefaultRegistry.Get(metrics.LabeledName("truekey/rpc/duration", labels...)).(metrics.Timer); !ok || timer.Count() != 1 {
+		t.Fatal("request duration not recorded")
+	}
+	escalated := metrics.DefaultRegistry.Get(metrics.LabeledName("truekey/policy/escalated", metrics.Label{Name: "root", Value: rootLabel(root)}))
+	if counter, ok := escalated.(metrics.Counter); !ok || counter.Count() == 0 {
+		t.Fatal("escalation not counted")
+	}
+
+	// Calls signed by a dapp are labelled by its name
+	dapp, key := addTestDapp(t, api, root, keys, types.DappSettings{Name: "wallet"})
+	user := `{"userId":"bob"}`
+	auth := dappCall(t, root, dapp.Account, key, "truekey_registerAccount", user).auth
+	if _, err := server.RegisterAccount(ctx, user, &auth); err != nil {
+		t.Fatal(err)
+	}
+	labels = []metrics.Label{
+		{Name: "code", Value: "ok"},
+		{Name: "method", Value: "truekey_registerAccount"},
+		{Name: "root", Value: rootLabel(root)},
+		{Name: "dapp", Value: "wallet"},
+	}
+	if counter, ok := metrics.DefaultRegistry.Get(metrics.LabeledName("truekey/rpc/requests", labels...)).(metrics.Counter); !ok || counter.Count() != 1 {
+		t.Fatalf("dapp request counter: have %v", counter)
+	}
+
+	api.updateMetrics()
+	pending := metrics.DefaultRegistry.Get(metrics.LabeledName("truekey/pending/requests", metrics.Label{Name: "root", Value: rootLabel(root)}))
+	if gauge, ok := pending.(metrics.Gauge); !ok || gauge.Value() != 1 {
+		t.Fatalf("pending gauge: have %v", pending)
+	}
+}
@@ -0,0 +1,255 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package signer
+
+import (
+	"context"
+	"crypto/rand"
+	"ethereum/keyservice/common"
+	"ethereum/keyservice/common/hexutil"
+	"ethereum/keyservice/event"
+	"ethereum/keyservice/log"
+	"ethereum/keyservice/services/truekey/audit"
+	"ethereum/keyservice/services/truekey/rawdb"
+	"ethereum/keyservice/services/truekey/types"
+	"fmt"
+	"time"
+)
+
+const (
+	// DefaultPendingTimeout is how long an escalated request waits for the admins
+	// before it expires.
+	DefaultPendingTimeout = time.Hour
+
+	// pendingSweepInterval is how often expired requests are swept.
+	pendingSweepInterval = time.Minute
+)
+
+// SetPendingTimeout sets how long escalated requests wait for a decision.
+func (api *SignerAPI) SetPendingTimeout(timeout time.Duration) {
+	api.indexMutex.Lock()
+	defer api.indexMutex.Unlock()
+	api.pendingTimeout = timeout
+}
+
+// SetAuditLog sets the logger recording what the signer decides on its own,
+// such as expiries of escalated requests, refusals and config reloads.
+func (api *SignerAPI) SetAuditLog(logger log.Logger) {
+	api.indexMutex.Lock()
+	defer api.indexMutex.Unlock()
+	api.audit = logger
+}
+
+// SubscribePending delivers the outcome of every decided escalated request.
+func (api *SignerAPI) SubscribePending(ch chan<- *types.PendingResult) event.Subscription {
+	return api.pendingFeed.Subscribe(ch)
+}
+
+// escalate queues a signing request for the admins and returns the error
+// handing its id to the caller as error data.
+func (api *SignerAPI) escalate(req *types.TxRequest, tx types.SignTx) error {
+	var id common.Hash
+	if _, err := rand.Read(id[:]); err != nil {
+		return err
+	}
+	// The user id is not stored, the user is known by the internal id of
+	// the request.
+	tx.UserID = ""
+	now := time.Now()
+	pending := &types.PendingRequest{
+		ID:        id,
+		Tx:        tx,
+		Request:   *req,
+		CreatedAt: hexutil.Uint64(now.Unix()),
+		Expires:   hexutil.Uint64(now.Add(api.pendingTimeout).Unix()),
+		Status:    types.PendingStatusPending,
+	}
+	rawdb.WritePendingRequest(api.db, pending)
+	rawdb.WritePendingIndex(api.db, append(rawdb.ReadPendingIndex(api.db), id))
+	api.audit.Info("Escalated", "type", "pending", "pendingId", id.Hex(), "root", req.Root, "userId", req.UserID, "decision", "escalate", "tx", &audit.Tx{From: &req.From, To: &req.To, Value: req.Value, Nonce: &req.Nonce, ChainID: req.ChainId, DataLen: len(req.Data)})
+	return &types.PendingError{ID: id}
+}
+
+// settle records the decision on a pending request and notifies subscribers.
+func (api *SignerAPI) settle(req *types.PendingRequest, status types.PendingStatus, reason string, admins []common.Address) {
+	req.Status, req.Reason, req.DecidedBy = status, reason, admins
+	rawdb.WritePendingRequest(api.db, req)
+
+	ids := rawdb.ReadPendingIndex(api.db)
+	for i, id := range ids {
+		if id == req.ID {
+			ids = append(ids[:i], ids[i+1:]...)
+			break
+		}
+	}
+	rawdb.WritePendingIndex(api.db, ids)
+
+	api.audit.Info("Decided", "type", "pending", "pendingId", req.ID.Hex(), "root", req.Request.Root, "userId", req.Request.UserID, "status", status, "admins", admins, "reason", reason)
+	// Subscribers read without the index lock, but sending from here could
+	// still stall a decision on a slow subscriber.
+	go api.pendingFeed.Send(req.Outcome())
+}
+
+// lookupPending returns a request of root that is still waiting for a decision,
+// expiring it first if its time is up.
+func (api *SignerAPI) lookupPending(root common.Address, id common.Hash) (*types.PendingRequest, error) {
+	req := rawdb.ReadPendingRequest(api.db, id)
+	if req == nil || req.Request.Root != root {
+		return nil, types.ErrRequestNotFound
+	}
+	if req.Status == types.PendingStatusPending && uint64(time.Now().Unix()) >= uint64(req.Expires) {
+		api.settle(req, types.PendingStatusExpired, "timeout", nil)
+	}
+	if req.Status != types.PendingStatusPending {
+		return nil, fmt.Errorf("%v: %s", types.ErrRequestDecided, req.Status)
+	}
+	return req, nil
+}
+
+// pendingResult returns the outcome of a request to the caller that made it,
+// the dapp of the request or, for requests without one, an unsigned call.
+func (api *SignerAPI) pendingResult(ctx context.Context, caller *dappCaller, id common.Hash) (*types.PendingResult, error) {
+	api.indexMutex.Lock()
+	defer api.indexMutex.Unlock()
+
+	if api.stopped {
+		return nil, types.ErrShuttingDown
+	}
+	root, dapp, err := api.checkDapp(ctx, caller)
+	if err != nil {
+		return nil, err
+	}
+	req := rawdb.ReadPendingRequest(api.db, id)
+	if req == nil || req.Request.Root != root || !sameDapp(req.Request.Dapp, dappIndex(dapp)) {
+		return nil, types.ErrRequestNotFound
+	}
+	return req.Outcome(), nil
+}
+
+// sameDapp reports whether two optional dapp accounts are the same.
+func sameDapp(a, b *uint32) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func (api *SignerAPI) pendingRequests(auth types.AdminAuth) ([]*types.PendingRequest, error) {
+	api.indexMutex.Lock()
+	defer api.indexMutex.Unlock()
+
+	if _, err := api.checkAuth(auth, false, "admin_pendingRequests"); err != nil {
+		return nil, err
+	}
+	reqs := []*types.PendingRequest{}
+	for _, id := range rawdb.ReadPendingIndex(api.db) {
+		if req := rawdb.ReadPendingRequest(api.db, id); req != nil && req.Request.Root == auth.Root {
+			reqs = append(reqs, req)
+		}
+	}
+	return reqs, nil
+}
+
+// approveRequest signs an escalated request, it needs a quorum. A request that
+// fails to sign, e.g. on a spending limit, stays pending, and signing it later
+// takes a new approval.
+func (api *SignerAPI) approveRequest(auth types.AdminAuth, id common.Hash, reason string) (*types.PendingResult, error) {
+	api.indexMutex.Lock()
+	defer api.indexMutex.Unlock()
+
+	admins, err := api.checkDecision(auth, id, true, "admin_approveRequest", id, reason)
+	if err != nil {
+		return nil, err
+	}
+	req, err := api.lookupPending(auth.Root, id)
+	if err != nil {
+		return nil, err
+	}
+	user := common.HexToHash(req.Request.UserID)
+	if err := api.checkFrozen(auth.Root, user); err != nil {
+		return nil, err
+	}
+	v, err := api.rootWallet(auth.Root)
+	if err != nil {
+		return nil, err
+	}
+	account, exists := v.Accounts[user]
+	if !exists {
+		return nil, types.ErrAccountNotExist
+	}
+	signed, err := api.signTx(auth.Root, account, req.Tx)
+	if err != nil {
+		return nil, err
+	}
+	req.Signed = signed
+	api.settle(req, types.PendingStatusApproved, reason, admins)
+	return req.Outcome(), nil
+}
+
+// denyRequest rejects an escalated request. A single admin may deny, as that
+// can never move funds.
+func (api *SignerAPI) denyRequest(auth types.AdminAuth, id common.Hash, reason string) (*types.PendingResult, error) {
+	api.indexMutex.Lock()
+	defer api.indexMutex.Unlock()
+
+	admins, err := api.checkDecision(auth, id, false, "admin_denyRequest", id, reason)
+	if err != nil {
+		return nil, err
+	}
+	req, err := api.lookupPending(auth.Root, id)
+	if err != nil {
+		return nil, err
+	}
+	api.settle(req, types.PendingStatusDenied, reason, admins)
+	return req.Outcome(), nil
+}
+
+// expirePending settles every pending request whose time is up.
+func (api *SignerAPI) expirePending(now time.Time) {
+	api.indexMutex.Lock()
+	defer api.indexMutex.Unlock()
+
+	if api.stopped {
+		return
+	}
+	for _, id := range rawdb.ReadPendingIndex(api.db) {
+		req := rawdb.ReadPendingRequest(api.db, id)
+		if req != nil && uint64(now.Unix()) >= uint64(req.Expires) {
+			api.settle(req, types.PendingStatusExpired, "timeout", nil)
+		}
+	}
+}
+
+// loop runs the background maintenance of the signer until it is stopped.
+func (api *SignerAPI) loop() {
+	sweep := time.NewTicker(pendingSweepInterval)
+	defer sweep.Stop()
+	refresh := time.NewTicker(metricsRefreshInterval)
+	defer refresh.Stop()
+
+	api.updateMetrics()
+	for {
+		select {
+		case now := <-sweep.C:
+			api.expirePending(now)
+		case <-refresh.C:
+			api.updateMetrics()
+		case <-api.quit:
+			return
+		}
+	}
+}
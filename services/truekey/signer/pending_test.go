@@ -0,0 +1,120 @@
+package signer
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"ethereum/keyservice/accounts/keystore"
+	"ethereum/keyservice/common"
+	"ethereum/keyservice/crypto"
+	"ethereum/keyservice/services/truekey/types"
+	"math/big"
+	"testing"
+	"time"
+)
+
+type escalatePolicy struct{}
+
+func (escalatePolicy) ApproveTx(req *types.TxRequest) (types.Decision, error) {
+	return types.DecisionEscalate, nil
+}
+
+func (escalatePolicy) ApproveRegister(req *types.RegisterRequest) (types.Decision, error) {
+	return types.DecisionApprove, nil
+}
+
+// newSigningTestAPI creates a signer serving the test root with its key.
+func newSigningTestAPI(t *testing.T, admins int) (*SignerAPI, common.Address, []*ecdsa.PrivateKey) {
+	admin, root, keys := newAdminTestAPI(t, admins)
+	key, _ := crypto.GenerateKey()
+	api, err := NewSignerAPI(admin.db, []*keystore.Key{{Address: root, PrivateKey: key}}, []types.RootConfig{admin.configs[root]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return api, root, keys
+}
+
+func testTx() types.SignTx {
+	return types.SignTx{UserID: "13800000000", To: common.HexToAddress("0x01"), Value: big.NewInt(1), GasPrice: 1, GasLimit: 21000, ChainId: 18928}
+}
+
+// escalateTx submits a transaction and returns the id of its pending request.
+func escalateTx(t *testing.T, api *SignerAPI) common.Hash {
+	tx := testTx()
+	if _, err := api.register(context.Background(), nil, string(tx.UserID)); err != nil {
+		t.Fatal(err)
+	}
+	_, err := api.signHashPlain(context.Background(), nil, string(tx.UserID), tx)
+	var pending *types.PendingError
+	if !errors.As(err, &pending) {
+		t.Fatalf("escalated tx: have %v, want %v", err, types.ErrRequestPending)
+	}
+	return pending.ID
+}
+
+func TestPendingApproval(t *testing.T) {
+	api, root, keys := newSigningTestAPI(t, 3)
+	api.SetPolicy(escalatePolicy{})
+
+	id := escalateTx(t, api)
+	reqs, err := api.pendingRequests(signAdminCall(root, keys[:1], "admin_pendingRequests"))
+	if err != nil || len(reqs) != 1 || reqs[0].ID != id {
+		t.Fatalf("pending list: have %v %v, want %x", reqs, err, id)
+	}
+	results := make(chan *types.PendingResult, 1)
+	sub := api.SubscribePending(results)
+	defer sub.Unsubscribe()
+
+	if _, err := api.approveRequest(signAdminCall(root, keys[:1], "admin_approveRequest", id, "ok"), id, "ok"); err != types.ErrAdminQuorum {
+		t.Fatalf("single admin approve: have %v, want %v", err, types.ErrAdminQuorum)
+	}
+	result, err := api.approveRequest(signAdminCall(root, keys[:2], "admin_approveRequest", id, "ok"), id, "ok")
+	if err != nil {
+		t.Fatalf("quorum approve: %v", err)
+	}
+	if result.Status != types.PendingStatusApproved || len(result.Signed) == 0 {
+		t.Fatalf("approved result: %+v", result)
+	}
+	select {
+	case notified := <-results:
+		if notified.ID != id || notified.Status != types.PendingStatusApproved {
+			t.Fatalf("notification: %+v", notified)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no notification of the decision")
+	}
+	if _, err := api.denyRequest(signAdminCall(root, keys[:1], "admin_denyRequest", id, "late"), id, "late"); err == nil {
+		t.Fatal("decided request denied again")
+	}
+	if reqs, _ := api.pendingRequests(signAdminCall(root, keys[:1], "admin_pendingRequests")); len(reqs) != 0 {
+		t.Fatalf("decided request still listed: %v", reqs)
+	}
+
+	// An approval that fails to sign leaves the request pending, sending it
+	// again once signing resumes is a replay
+	id = escalateTx(t, api)
+	if err := api.freeze(signAdminCall(root, keys[:1], "admin_freeze", false, "incident"), false, "incident"); err != nil {
+		t.Fatal(err)
+	}
+	approve := signAdminCall(root, keys[:2], "admin_approveRequest", id, "ok")
+	if _, err := api.approveRequest(approve, id, "ok"); !errors.Is(err, types.ErrSigningFrozen) {
+		t.Fatalf("approve while frozen: have %v, want %v", err, types.ErrSigningFrozen)
+	}
+	if err := api.unfreeze(signAdminCall(root, keys[:2], "admin_unfreeze", false, "resolved"), false, "resolved"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := api.approveRequest(approve, id, "ok"); err != types.ErrAdminReplay {
+		t.Fatalf("replayed approve: have %v, want %v", err, types.ErrAdminReplay)
+	}
+	if result, err := api.approveRequest(signAdminCall(root, keys[:2], "admin_approveRequest", id, "ok"), id, "ok"); err != nil || result.Status != types.PendingStatusApproved {
+		t.Fatalf("approve again: have %+v %v", result, err)
+	}
+	<-results
+
+	// Requests nobody decides expire
+	id = escalateTx(t, api)
+	api.expirePending(time.Now().Add(DefaultPendingTimeout))
+	if result, err := api.pendingResult(context.Background(), nil, id); err != nil || result.Status != types.PendingStatusExpired {
+		t.Fatalf("expired result: have %v %v", result, err)
+	}
+}
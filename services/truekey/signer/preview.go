@@ -0,0 +1,90 @@
+package signer
+
+import (
+	"context"
+	"ethereum/keyservice/common"
+	"ethereum/keyservice/services/truekey/rawdb"
+	"ethereum/keyservice/services/truekey/types"
+)
+
+// previewAccounts returns the accounts users would receive from register,
+// derived by the same code on an overlayDB that is dropped, so nothing is
+// registered.
+func (api *SignerAPI) previewAccounts(ctx context.Context, caller *dappCaller, req types.PreviewRequest) ([]*types.PreviewAccount, error) {
+	api.indexMutex.Lock()
+	defer api.indexMutex.Unlock()
+	root, dapp, err := api.checkDapp(ctx, caller)
+	if err != nil {
+		return nil, err
+	}
+	v, err := api.checkRoot(root)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Check(); err != nil {
+		return nil, err
+	}
+	store := newOverlayDB(api.db)
+	if req.Count > 0 {
+		return api.previewRange(store, root, dapp, req.From, req.Count, v)
+	}
+
+	previews := make([]*types.PreviewAccount, 0, len(req.UserIDs))
+	previewed := make(map[common.Hash]*types.PreviewAccount)
+	for _, user := range req.UserIDs {
+		if err := checkUserID(string(user)); err != nil {
+			return nil, err
+		}
+		id := scopedUserID(v, dappIndex(dapp), string(user))
+		preview, done := previewed[id]
+		if !done {
+			if child, registered := v.Accounts[id]; registered {
+				preview = &types.PreviewAccount{Path: child.Account.URL.Path, Address: child.Account.Address, Registered: true}
+			} else {
+				child, err := api.deriveChild(store, store, root, dapp, string(user), v)
+				if err != nil {
+					return nil, err
+				}
+				preview = &types.PreviewAccount{Path: child.Account.URL.Path, Address: child.Account.Address}
+			}
+			previewed[id] = preview
+		}
+		previews = append(previews, &types.PreviewAccount{
+			UserID:     user,
+			Path:       preview.Path,
+			Address:    preview.Address,
+			Registered: preview.Registered,
+		})
+	}
+	return previews, nil
+}
+
+// previewRange returns the accounts of count new users of dapp, or of root
+// under the index scheme, allocated from the index from on.
+func (api *SignerAPI) previewRange(store *overlayDB, root common.Address, dapp *types.Dapp, from *uint64, count uint64, v *types.RootWallet) ([]*types.PreviewAccount, error) {
+	var next uint64
+	switch {
+	case dapp != nil:
+		if from != nil {
+			dapp.Users = *from
+		}
+		next = dapp.Users
+	case api.configs[root].UserIDScheme() == types.UserIDsIndex:
+		if from != nil {
+			rawdb.WriteIndexKey(store, allocationKey(root), *from)
+		}
+		next = rawdb.ReadIndexKey(store, allocationKey(root))
+	default:
+		return nil, types.ErrPreviewRange
+	}
+	previews := make([]*types.PreviewAccount, 0, count)
+	for i := uint64(0); i < count; i++ {
+		child, err := api.deriveChild(store, store, root, dapp, "", v)
+		if err != nil {
+			return nil, err
+		}
+		index := next + i
+		previews = append(previews, &types.PreviewAccount{Index: &index, Path: child.Account.URL.Path, Address: child.Account.Address})
+	}
+	return previews, nil
+}
@@ -0,0 +1,80 @@
+package signer
+
+import (
+	"context"
+	"ethereum/keyservice/etruedb"
+	"ethereum/keyservice/services/truekey/types"
+	"testing"
+)
+
+func TestPreviewAccounts(t *testing.T) {
+	api, root, keys := newSigningTestAPI(t, 1)
+	ctx := context.Background()
+	memdb := api.db.(*etruedb.MemDatabase)
+	keysBefore := memdb.Len()
+
+	// The phone scheme previews single ids, not ranges
+	previews, err := api.previewAccounts(ctx, nil, types.PreviewRequest{UserIDs: []types.UserID{"13800000005"}})
+	if err != nil || len(previews) != 1 || previews[0].Path != "m/44'/60'/138000'/0/5" || previews[0].Registered {
+		t.Fatalf("phone preview: have %+v %v", previews, err)
+	}
+	if _, err := api.previewAccounts(ctx, nil, types.PreviewRequest{Count: 2}); err != types.ErrPreviewRange {
+		t.Fatalf("phone range: have %v, want %v", err, types.ErrPreviewRange)
+	}
+	if _, err := api.previewAccounts(ctx, nil, types.PreviewRequest{UserIDs: []types.UserID{"1"}, Count: 2}); err == nil {
+		t.Fatal("ids and range previewed together")
+	}
+
+	config := api.configs[root]
+	config.UserIDs = types.UserIDsIndex
+	api.configs[root] = config
+	users := []types.UserID{"alice", "bob", "alice"}
+	previews, err = api.previewAccounts(ctx, nil, types.PreviewRequest{UserIDs: users})
+	if err != nil || len(previews) != 3 || previews[0].Address != previews[2].Address || previews[0].Address == previews[1].Address {
+		t.Fatalf("index preview: have %+v %v", previews, err)
+	}
+	if memdb.Len() != keysBefore || len(api.rootWallets[root].Accounts) != 0 {
+		t.Fatalf("preview wrote %d keys", memdb.Len()-keysBefore)
+	}
+	for i, user := range users[:2] {
+		addr, err := api.register(ctx, nil, string(user))
+		if err != nil || addr != previews[i].Address {
+			t.Fatalf("register %s: have %x %v, want %x", user, addr, err, previews[i].Address)
+		}
+	}
+	previews, err = api.previewAccounts(ctx, nil, types.PreviewRequest{UserIDs: []types.UserID{"bob"}})
+	if err != nil || !previews[0].Registered {
+		t.Fatalf("registered preview: have %+v %v", previews, err)
+	}
+
+	// Ranges preview the next users of a dapp, or any indexes of it
+	dapp, dappKey := addTestDapp(t, api, root, keys, types.DappSettings{Name: "wallet"})
+	request := `{"count":3}`
+	caller := dappCall(t, root, dapp.Account, dappKey, "truekey_previewAccounts", request)
+	previews, err = api.previewAccounts(ctx, caller, types.PreviewRequest{Count: 3})
+	if err != nil || len(previews) != 3 || *previews[2].Index != 2 {
+		t.Fatalf("dapp range: have %+v %v", previews, err)
+	}
+	for i, user := range []string{"carol", "dave", "erin"} {
+		addr, err := api.register(ctx, dappCall(t, root, dapp.Account, dappKey, "truekey_registerAccount", user), user)
+		if err != nil || addr != previews[i].Address {
+			t.Fatalf("register %s in the dapp: have %x %v, want %x", user, addr, err, previews[i].Address)
+		}
+	}
+	from := uint64(1)
+	caller = dappCall(t, root, dapp.Account, dappKey, "truekey_previewAccounts", `{"from":1,"count":1}`)
+	previews, err = api.previewAccounts(ctx, caller, types.PreviewRequest{From: &from, Count: 1})
+	if err != nil || previews[0].Path != "m/44'/60'/2000000'/0/1" {
+		t.Fatalf("dapp range from 1: have %+v %v", previews, err)
+	}
+	caller = dappCall(t, root, dapp.Account, dappKey, "truekey_previewAccounts", `{"count":1001}`)
+	if _, err := api.previewAccounts(ctx, caller, types.PreviewRequest{Count: types.MaxPreviewAccounts + 1}); err == nil {
+		t.Fatal("oversized preview accepted")
+	}
+
+	// Only a registered user may sign
+	tx := testTx()
+	if _, err := api.signHashPlain(ctx, nil, "frank", tx); err != types.ErrAccountNotExist {
+		t.Fatalf("sign for an unregistered user: have %v, want %v", err, types.ErrAccountNotExist)
+	}
+}
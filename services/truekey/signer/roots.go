@@ -0,0 +1,135 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package signer
+
+import (
+	"ethereum/keyservice/accounts/keystore"
+	"ethereum/keyservice/common"
+	"ethereum/keyservice/common/hexutil"
+	"ethereum/keyservice/services/truekey/rawdb"
+	"ethereum/keyservice/services/truekey/secret"
+	"ethereum/keyservice/services/truekey/types"
+	"fmt"
+	"time"
+)
+
+// RemoveKeystore forgets the keystore of a root whose file was removed. A root
+// that is served keeps signing, only sealed roots are dropped. It reports
+// whether the keystore was dropped.
+func (api *SignerAPI) RemoveKeystore(root common.Address) bool {
+	api.indexMutex.Lock()
+	defer api.indexMutex.Unlock()
+
+	if _, served := api.rootWallets[root]; served {
+		return false
+	}
+	if state := api.unsealing[root]; state != nil {
+		state.wipe()
+		delete(api.unsealing, root)
+	}
+	delete(api.keystores, root)
+	return true
+}
+
+// UnlockKeystore serves a root from its loaded keystore, e.g. one that appeared
+// in the keystore directory while running. Retired roots are refused.
+func (api *SignerAPI) UnlockKeystore(root common.Address, passphrase string) error {
+	api.indexMutex.Lock()
+	defer api.indexMutex.Unlock()
+
+	if api.stopped {
+		return types.ErrShuttingDown
+	}
+	if rawdb.ReadRetirement(api.db, root) != nil {
+		return types.ErrRootRetired
+	}
+	return api.openKeystore(root, passphrase)
+}
+
+// openKeystore decrypts the loaded keystore of a root and serves it.
+func (api *SignerAPI) openKeystore(root common.Address, passphrase string) error {
+	if _, served := api.rootWallets[root]; served {
+		return types.ErrRootUnsealed
+	}
+	keyjson, exists := api.keystores[root]
+	if !exists {
+		return types.ErrKeystoreUnknown
+	}
+	key, err := keystore.DecryptKey(keyjson, passphrase)
+	if err != nil {
+		return err
+	}
+	if key.Address != root {
+		secret.WipeKey(key.PrivateKey)
+		return fmt.Errorf("keystore holds %s instead of %s", key.Address.Hex(), root.Hex())
+	}
+	if state := api.unsealing[root]; state != nil {
+		state.wipe()
+		delete(api.unsealing, root)
+	}
+	rawdb.DeleteRetirement(api.db, root)
+	return api.unlock(key)
+}
+
+// addRootKeystore serves a root whose keystore was loaded at startup or picked
+// up from the keystore directory. Knowing the passphrase is the main
+// authorisation, so a single admin may add a root, while bringing back a
+// retired root needs the same quorum that retired it.
+func (api *SignerAPI) addRootKeystore(auth types.AdminAuth, passphrase string) error {
+	api.indexMutex.Lock()
+	defer api.indexMutex.Unlock()
+
+	retired := rawdb.ReadRetirement(api.db, auth.Root) != nil
+	admins, err := api.checkAuth(auth, retired, "admin_addRoot", passphrase)
+	if err != nil {
+		return err
+	}
+	if err := api.openKeystore(auth.Root, passphrase); err != nil {
+		api.audit.Warn("Adding root failed", "type", "roots", "root", auth.Root.String(), "admins", admins, "err", err)
+		return err
+	}
+	api.audit.Info("Root added", "type", "roots", "root", auth.Root.String(), "admins", admins, "retired", retired)
+	return nil
+}
+
+// retireRoot takes a root out of service, it needs a quorum. The keys are
+// wiped from memory and the root is not served again, not even after a
+// restart, until admins add it back. Its accounts and history are kept.
+func (api *SignerAPI) retireRoot(auth types.AdminAuth, reason string) error {
+	api.indexMutex.Lock()
+	defer api.indexMutex.Unlock()
+
+	admins, err := api.checkAuth(auth, true, "admin_retireRoot", reason)
+	if err != nil {
+		return err
+	}
+	if rawdb.ReadRetirement(api.db, auth.Root) != nil {
+		return types.ErrRootRetired
+	}
+	rawdb.WriteRetirement(api.db, auth.Root, &types.Retirement{
+		Reason: reason,
+		By:     admins,
+		At:     hexutil.Uint64(time.Now().Unix()),
+	})
+	if state := api.unsealing[auth.Root]; state != nil {
+		state.wipe()
+		delete(api.unsealing, auth.Root)
+	}
+	api.wipeRoot(auth.Root)
+	api.audit.Info("Root retired", "type", "roots", "root", auth.Root.String(), "admins", admins, "reason", reason)
+	return nil
+}
@@ -0,0 +1,90 @@
+package signer
+
+import (
+	"crypto/ecdsa"
+	"ethereum/keyservice/accounts/keystore"
+	"ethereum/keyservice/crypto"
+	"ethereum/keyservice/etruedb"
+	"ethereum/keyservice/services/truekey/types"
+	"testing"
+
+	"github.com/pborman/uuid"
+)
+
+func TestAddRetireRoot(t *testing.T) {
+	rootKey, _ := crypto.GenerateKey()
+	key := &keystore.Key{Id: uuid.NewRandom(), Address: crypto.PubkeyToAddress(rootKey.PublicKey), PrivateKey: rootKey}
+	root := key.Address
+
+	passphrase := "hot added root"
+	keyjson, err := keystore.EncryptKey(key, passphrase, keystore.LightScryptN, keystore.LightScryptP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := types.RootConfig{Root: root}
+	var keys []*ecdsa.PrivateKey
+	for i := 0; i < 3; i++ {
+		adminKey, _ := crypto.GenerateKey()
+		keys = append(keys, adminKey)
+		config.Admins = append(config.Admins, crypto.PubkeyToAddress(adminKey.PublicKey))
+	}
+
+	db := etruedb.NewMemDatabase()
+	api, err := NewSignerAPI(db, nil, []types.RootConfig{config})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := api.addRootKeystore(signAdminCall(root, keys[:1], "admin_addRoot", passphrase), passphrase); err != types.ErrKeystoreUnknown {
+		t.Fatalf("add without keystore: have %v, want %v", err, types.ErrKeystoreUnknown)
+	}
+	if _, err := api.AddKeystore(keyjson); err != nil {
+		t.Fatal(err)
+	}
+	if err := api.addRootKeystore(signAdminCall(root, keys[:1], "admin_addRoot", "wrong"), "wrong"); err == nil {
+		t.Fatal("root added with wrong passphrase")
+	}
+	if err := api.addRootKeystore(signAdminCall(root, keys[:1], "admin_addRoot", passphrase), passphrase); err != nil {
+		t.Fatalf("add root: %v", err)
+	}
+	if _, err := api.rootWallet(root); err != nil {
+		t.Fatalf("added root not served: %v", err)
+	}
+
+	// Retiring needs a quorum and survives a restart
+	if err := api.retireRoot(signAdminCall(root, keys[:1], "admin_retireRoot", "migrated"), "migrated"); err != types.ErrAdminQuorum {
+		t.Fatalf("single admin retire: have %v, want %v", err, types.ErrAdminQuorum)
+	}
+	if err := api.retireRoot(signAdminCall(root, keys[:2], "admin_retireRoot", "migrated"), "migrated"); err != nil {
+		t.Fatalf("retire: %v", err)
+	}
+	if _, err := api.rootWallet(root); err != types.ErrRootRetired {
+		t.Fatalf("retired root: have %v, want %v", err, types.ErrRootRetired)
+	}
+	if err := api.UnlockKeystore(root, passphrase); err != types.ErrRootRetired {
+		t.Fatalf("unlock retired root: have %v, want %v", err, types.ErrRootRetired)
+	}
+	restarted, err := NewSignerAPI(db, []*keystore.Key{key}, []types.RootConfig{config})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := restarted.rootWallet(root); err != types.ErrRootRetired {
+		t.Fatalf("retired root after restart: have %v, want %v", err, types.ErrRootRetired)
+	}
+
+	// Bringing it back needs the quorum as well
+	if _, err := api.AddKeystore(keyjson); err != nil {
+		t.Fatal(err)
+	}
+	if err := api.addRootKeystore(signAdminCall(root, keys[:1], "admin_addRoot", passphrase), passphrase); err != types.ErrAdminQuorum {
+		t.Fatalf("single admin re-add: have %v, want %v", err, types.ErrAdminQuorum)
+	}
+	if err := api.addRootKeystore(signAdminCall(root, keys[:2], "admin_addRoot", passphrase), passphrase); err != nil {
+		t.Fatalf("re-add root: %v", err)
+	}
+	if _, err := api.rootWallet(root); err != nil {
+		t.Fatalf("re-added root not served: %v", err)
+	}
+	if api.RemoveKeystore(root) {
+		t.Fatal("served root dropped with its keystore file")
+	}
+}
@@ -0,0 +1,219 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package signer
+
+import (
+	"bytes"
+	"encoding/json"
+	"ethereum/keyservice/accounts/keystore"
+	"ethereum/keyservice/common"
+	"ethereum/keyservice/services/truekey/rawdb"
+	"ethereum/keyservice/services/truekey/secret"
+	"ethereum/keyservice/services/truekey/shamir"
+	"ethereum/keyservice/services/truekey/types"
+	"fmt"
+	"unsafe"
+)
+
+// unsealState collects the shares submitted for a sealed root.
+type unsealState struct {
+	threshold int
+	shares    [][]byte
+}
+
+// wipe clears the collected shares from memory.
+func (s *unsealState) wipe() {
+	for _, share := range s.shares {
+		secret.Wipe(share)
+	}
+	s.shares = nil
+}
+
+// AddKeystore records the encrypted keystore of a root, so the root can be
+// unsealed with shares of its passphrase. Roots without an unlocked key start
+// sealed.
+func (api *SignerAPI) AddKeystore(keyjson []byte) (common.Address, error) {
+	api.indexMutex.Lock()
+	defer api.indexMutex.Unlock()
+
+	if api.stopped {
+		return common.Address{}, types.ErrShuttingDown
+	}
+	var key struct {
+		Address string `json:"address"`
+	}
+	if err := json.Unmarshal(keyjson, &key); err != nil {
+		return common.Address{}, err
+	}
+	if !common.IsHexAddress(key.Address) {
+		return common.Address{}, fmt.Errorf("invalid keystore address %q", key.Address)
+	}
+	root := common.HexToAddress(key.Address)
+	api.keystores[root] = keyjson
+	return root, nil
+}
+
+// rootWallet returns the wallet of a root that is served and unsealed.
+func (api *SignerAPI) rootWallet(root common.Address) (*types.RootWallet, error) {
+	if api.stopped {
+		return nil, types.ErrShuttingDown
+	}
+	v, exists := api.rootWallets[root]
+	if !exists {
+		if rawdb.ReadRetirement(api.db, root) != nil {
+			return nil, types.ErrRootRetired
+		}
+		if _, sealed := api.keystores[root]; sealed {
+			return nil, types.ErrRootSealed
+		}
+		return nil, types.ErrRootNotServer
+	}
+	return v, nil
+}
+
+// sealStatus reports whether the root is sealed and how many shares were
+// submitted.
+func (api *SignerAPI) sealStatus(root common.Address) (*types.SealStatus, error) {
+	api.indexMutex.Lock()
+	defer api.indexMutex.Unlock()
+	return api.rootSealStatus(root)
+}
+
+// rootSealStatus reports the seal status of root. The caller holds indexMutex.
+func (api *SignerAPI) rootSealStatus(root common.Address) (*types.SealStatus, error) {
+	_, sealed := api.keystores[root]
+	_, unsealed := api.rootWallets[root]
+	if !sealed && !unsealed {
+		return nil, types.ErrRootError
+	}
+	status := &types.SealStatus{Root: root, Sealed: !unsealed}
+	if state := api.unsealing[root]; state != nil {
+		status.Progress, status.Threshold = len(state.shares), state.threshold
+	}
+	return status, nil
+}
+
+// seal wipes the keys of the root from memory. Any single admin may seal. Roots
+// without a keystore, those restored from a seed, cannot be unsealed and are
+// not sealed.
+func (api *SignerAPI) seal(auth types.AdminAuth) error {
+	api.indexMutex.Lock()
+	defer api.indexMutex.Unlock()
+
+	admins, err := api.checkAuth(auth, false, "admin_seal")
+	if err != nil {
+		return err
+	}
+	if _, exists := api.keystores[auth.Root]; !exists {
+		return types.ErrNoKeystore
+	}
+	if !api.wipeRoot(auth.Root) {
+		return types.ErrRootSealed
+	}
+	api.audit.Info("Sealed", "type", "seal", "root", auth.Root.String(), "admins", admins)
+	return nil
+}
+
+// wipeRoot stops serving a root and clears its keys from memory. It reports
+// whether the root was served.
+func (api *SignerAPI) wipeRoot(root common.Address) bool {
+	v, exists := api.rootWallets[root]
+	if !exists {
+		return false
+	}
+	for _, child := range v.Accounts {
+		secret.WipeKey(child.PrivateKey)
+	}
+	v.Wallet.Wipe()
+	secret.Wipe(v.UserKey)
+	secret.WipeKey(api.PrivateKeys[root])
+	delete(api.PrivateKeys, root)
+	delete(api.rootWallets, root)
+	api.updateAuditSigner()
+	return true
+}
+
+// unseal adds a custodian's share of the root passphrase. Once the threshold
+// recorded in the keystore is met the keystore is decrypted and the root served
+// again. Possession of a share is the authorisation, shares of another set are
+// refused and a failed attempt discards every share.
+func (api *SignerAPI) unseal(root common.Address, share []byte) (*types.SealStatus, error) {
+	api.indexMutex.Lock()
+	defer api.indexMutex.Unlock()
+
+	if api.stopped {
+		return nil, types.ErrShuttingDown
+	}
+	keyjson, exists := api.keystores[root]
+	if !exists {
+		return nil, types.ErrRootError
+	}
+	if _, unsealed := api.rootWallets[root]; unsealed {
+		return nil, types.ErrRootUnsealed
+	}
+	if rawdb.ReadRetirement(api.db, root) != nil {
+		return nil, types.ErrRootRetired
+	}
+	// The threshold comes from the keystore, never from a share
+	want, err := types.KeystoreShareSet(keyjson)
+	if err != nil {
+		return nil, err
+	}
+	set, part, err := types.DecodeShare(share)
+	if err != nil {
+		return nil, err
+	}
+	if set.Threshold != want.Threshold || !bytes.Equal(set.ID, want.ID) {
+		return nil, types.ErrShareInvalid
+	}
+	state := api.unsealing[root]
+	if state == nil {
+		state = &unsealState{threshold: want.Threshold}
+		api.unsealing[root] = state
+	}
+	if len(state.shares) > 0 && len(part) != len(state.shares[0]) {
+		return nil, types.ErrShareInvalid
+	}
+	for _, have := range state.shares {
+		if bytes.Equal(have, part) {
+			return api.rootSealStatus(root)
+		}
+	}
+	state.shares = append(state.shares, append([]byte(nil), part...))
+	if len(state.shares) < state.threshold {
+		return api.rootSealStatus(root)
+	}
+
+	passphrase, err := shamir.Combine(state.shares)
+	state.wipe()
+	delete(api.unsealing, root)
+	if err != nil {
+		api.audit.Warn("Unseal failed", "type", "seal", "root", root.String(), "err", err)
+		return nil, types.ErrUnsealFailed
+	}
+	key, err := keystore.DecryptKey(keyjson, *(*string)(unsafe.Pointer(&passphrase)))
+	secret.Wipe(passphrase)
+	if err != nil {
+		api.audit.Warn("Unseal failed", "type", "seal", "root", root.String(), "err", err)
+		return nil, types.ErrUnsealFailed
+	}
+	if err := api.unlock(key); err != nil {
+		return nil, err
+	}
+	api.audit.Info("Unsealed", "type", "seal", "root", root.String(), "shares", want.Threshold)
+	return api.rootSealStatus(root)
+}
@@ -0,0 +1,167 @@
+package signer
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"ethereum/keyservice/accounts/keystore"
+	"ethereum/keyservice/common"
+	"ethereum/keyservice/crypto"
+	"ethereum/keyservice/etruedb"
+	"ethereum/keyservice/services/truekey/hdwallet"
+	"ethereum/keyservice/services/truekey/rawdb"
+	"ethereum/keyservice/services/truekey/shamir"
+	"ethereum/keyservice/services/truekey/types"
+	"testing"
+
+	"github.com/pborman/uuid"
+)
+
+// addTestKeystore records a keystore of the served root, so it can be sealed.
+func addTestKeystore(t *testing.T, api *SignerAPI, root common.Address) {
+	keyjson, err := keystore.EncryptKey(&keystore.Key{Id: uuid.NewRandom(), Address: root, PrivateKey: api.PrivateKeys[root]}, "", keystore.LightScryptN, keystore.LightScryptP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := api.AddKeystore(keyjson); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSealUnseal(t *testing.T) {
+	rootKey, _ := crypto.GenerateKey()
+	adminKey, _ := crypto.GenerateKey()
+	key := &keystore.Key{Id: uuid.NewRandom(), Address: crypto.PubkeyToAddress(rootKey.PublicKey), PrivateKey: rootKey}
+	root := key.Address
+
+	passphrase := "custodian passphrase"
+	keyjson, err := keystore.EncryptKey(key, passphrase, keystore.LightScryptN, keystore.LightScryptP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts, err := shamir.Split([]byte(passphrase), 3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	set, _ := types.NewShareSet(2)
+	shared, err := types.WithShareSet(keyjson, set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := types.RootConfig{Root: root, Admins: []common.Address{crypto.PubkeyToAddress(adminKey.PublicKey)}}
+	api, err := NewSignerAPI(etruedb.NewMemDatabase(), []*keystore.Key{key}, []types.RootConfig{config})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := api.AddKeystore(shared); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := api.unseal(root, types.EncodeShare(set, parts[0])); err != types.ErrRootUnsealed {
+		t.Fatalf("unseal served root: have %v, want %v", err, types.ErrRootUnsealed)
+	}
+	if err := api.seal(signAdminCall(root, []*ecdsa.PrivateKey{adminKey}, "admin_seal")); err != nil {
+		t.Fatalf("seal: %v", err)
+	}
+	if _, err := api.checkRoot(root); err != types.ErrRootSealed {
+		t.Fatalf("sealed root: have %v, want %v", err, types.ErrRootSealed)
+	}
+	for _, word := range rootKey.D.Bits() {
+		if word != 0 {
+			t.Fatal("root key left in memory after sealing")
+		}
+	}
+
+	// Shares must match the set recorded in the keystore, a first share
+	// cannot lower the threshold
+	forged := types.ShareSet{ID: set.ID, Threshold: 3}
+	if _, err := api.unseal(root, types.EncodeShare(forged, parts[0])); err != types.ErrShareInvalid {
+		t.Fatalf("share with another threshold: have %v, want %v", err, types.ErrShareInvalid)
+	}
+	other, _ := types.NewShareSet(2)
+	if _, err := api.unseal(root, types.EncodeShare(other, parts[0])); err != types.ErrShareInvalid {
+		t.Fatalf("share of another set: have %v, want %v", err, types.ErrShareInvalid)
+	}
+
+	// Mismatching shares are discarded together
+	bogus := append([]byte(nil), parts[1]...)
+	bogus[0] ^= 0xff
+	if _, err := api.unseal(root, types.EncodeShare(set, parts[0])); err != nil {
+		t.Fatalf("first share: %v", err)
+	}
+	if _, err := api.unseal(root, types.EncodeShare(set, bogus)); err != types.ErrUnsealFailed {
+		t.Fatalf("bogus share: have %v, want %v", err, types.ErrUnsealFailed)
+	}
+
+	status, err := api.unseal(root, types.EncodeShare(set, parts[2]))
+	if err != nil || !status.Sealed || status.Progress != 1 || status.Threshold != 2 {
+		t.Fatalf("progress: have %+v %v", status, err)
+	}
+	if status, err = api.unseal(root, types.EncodeShare(set, parts[0])); err != nil || status.Sealed {
+		t.Fatalf("unseal: have %+v %v", status, err)
+	}
+	if _, err := api.checkRoot(root); err != nil {
+		t.Fatalf("unsealed root: %v", err)
+	}
+
+	// A keystore without shares cannot be unsealed
+	api.seal(signAdminCall(root, []*ecdsa.PrivateKey{adminKey}, "admin_seal"))
+	api.AddKeystore(keyjson)
+	if _, err := api.unseal(root, types.EncodeShare(set, parts[0])); err != types.ErrNotShared {
+		t.Fatalf("keystore without shares: have %v, want %v", err, types.ErrNotShared)
+	}
+}
+
+func TestSealSeedRoot(t *testing.T) {
+	seed, err := hdwallet.NewSeed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	api, err := NewSignerAPI(etruedb.NewMemDatabase(), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := api.UnlockSeed(seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	adminKey, _ := crypto.GenerateKey()
+	api.configs[root] = types.RootConfig{Root: root, Admins: []common.Address{crypto.PubkeyToAddress(adminKey.PublicKey)}}
+
+	// Nothing could unseal a root restored from a seed again
+	if err := api.seal(signAdminCall(root, []*ecdsa.PrivateKey{adminKey}, "admin_seal")); err != types.ErrNoKeystore {
+		t.Fatalf("seal seed root: have %v, want %v", err, types.ErrNoKeystore)
+	}
+	if _, err := api.checkRoot(root); err != nil {
+		t.Fatalf("seed root after refused seal: %v", err)
+	}
+}
+
+func TestStop(t *testing.T) {
+	api, root, keys := newSigningTestAPI(t, 1)
+	if _, err := api.register(context.Background(), nil, "13800000000"); err != nil {
+		t.Fatal(err)
+	}
+	rootKey := api.PrivateKeys[root]
+	child := api.rootWallets[root].Accounts[userID(api.rootWallets[root].UserKey, "13800000000")]
+
+	api.Stop()
+	api.Stop()
+	for _, key := range []*ecdsa.PrivateKey{rootKey, child.PrivateKey} {
+		for _, word := range key.D.Bits() {
+			if word != 0 {
+				t.Fatal("keys not zeroed on stop")
+			}
+		}
+	}
+	if len(api.PrivateKeys) != 0 || len(api.rootWallets) != 0 {
+		t.Fatal("roots still served after stop")
+	}
+	if _, err := api.register(context.Background(), nil, "13800000001"); err != types.ErrShuttingDown {
+		t.Fatalf("register after stop: have %v, want %v", err, types.ErrShuttingDown)
+	}
+	if err := api.seal(signAdminCall(root, keys, "admin_seal")); err != types.ErrShuttingDown {
+		t.Fatalf("admin call after stop: have %v, want %v", err, types.ErrShuttingDown)
+	}
+	if ids := rawdb.ReadRootChildren(api.db, root.Hash()); len(ids) != 1 || ids[0] != child.ID {
+		t.Fatalf("root children after stop: have %x, want [%x]", ids, child.ID)
+	}
+}
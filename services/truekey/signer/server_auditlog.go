@@ -18,77 +18,532 @@ package signer
 
 import (
 	"context"
+	"encoding/json"
 	"ethereum/keyservice/common"
 	"ethereum/keyservice/common/hexutil"
+	coreType "ethereum/keyservice/core/types"
+	"ethereum/keyservice/crypto"
 	"ethereum/keyservice/log"
+	"ethereum/keyservice/rlp"
+	"ethereum/keyservice/rpc"
+	"ethereum/keyservice/services/truekey/audit"
 	"ethereum/keyservice/services/truekey/types"
+	"math/big"
 )
 
+// ServerAuditLogger records every dapp call in the audit trail: a request and
+// a response record paired by a request id. Payloads are summarized, never
+// written as they are.
 type ServerAuditLogger struct {
-	log log.Logger
-	api types.ServerAPI
+	log     log.Logger
+	api     types.ServerAPI
+	userIDs func(common.Address, *uint32, string) (common.Hash, error)
 }
 
+// callerOf returns where a call came from for the audit trail.
+func callerOf(ctx context.Context) audit.Caller {
+	m := MetadataFromContext(ctx)
+	na := func(s string) string {
+		if s == "NA" {
+			return ""
+		}
+		return s
+	}
+	return audit.Caller{Remote: na(m.Remote), Local: na(m.Local), Scheme: na(m.Scheme), UserAgent: m.UserAgent, Origin: m.Origin}
+}
+
+// auditRequest records the request of a call and returns its request id.
+func auditRequest(l log.Logger, ctx context.Context, method string, fields ...interface{}) string {
+	id := audit.NewRequestID()
+	l.Info(method, append([]interface{}{"type", "request", "requestId", id, "metadata", callerOf(ctx)}, fields...)...)
+	return id
+}
+
+// auditResponse records the outcome of the call with request id.
+func auditResponse(l log.Logger, method, id string, err error, fields ...interface{}) {
+	fields = append([]interface{}{"type", "response", "requestId", id, "code", resultCode(err)}, fields...)
+	l.Info(method, append(fields, "error", err)...)
+}
+
+// decisionOf names the decision taken on a register or signing request.
+func decisionOf(err error) string {
+	switch resultCode(err) {
+	case "ok":
+		return "approve"
+	case "policy_rejected", "limit_exceeded", "frozen":
+		return "reject"
+	case "escalated", "pending":
+		return "escalate"
+	}
+	return ""
+}
+
+// txSummary describes a transaction to sign without its payload.
+func txSummary(tx types.SignTx) *audit.Tx {
+	sum := &audit.Tx{
+		To:       &tx.To,
+		Nonce:    &tx.Nonce,
+		GasPrice: tx.GasPrice,
+		GasLimit: tx.GasLimit,
+		ChainID:  tx.ChainId,
+		DataLen:  len(tx.Data),
+	}
+	if tx.Value != nil {
+		sum.Value = tx.Value.String()
+	}
+	if len(tx.Data) >= 4 {
+		sum.Selector = hexutil.Encode(tx.Data[:4])
+	}
+	return sum
+}
+
+// signedSummary identifies a signed transaction by its hash and sender.
+func signedSummary(signed []byte, chainID uint64) *audit.Tx {
+	hash := crypto.Keccak256Hash(signed)
+	sum := &audit.Tx{Hash: &hash}
+	var tx coreType.Transaction
+	if rlp.DecodeBytes(signed, &tx) == nil {
+		if from, err := coreType.Sender(coreType.NewTIP1Signer(new(big.Int).SetUint64(chainID)), &tx); err == nil {
+			sum.From = &from
+		}
+	}
+	return sum
+}
+
+// SetUserIDs installs the mapping of user ids onto internal user ids,
+// normally UserID of the signer. Without it user ids are not recorded.
+func (l *ServerAuditLogger) SetUserIDs(fn func(common.Address, *uint32, string) (common.Hash, error)) {
+	l.userIDs = fn
+}
+
+// userID returns the fields recording the internal id of a user of the call
+// authorised with auth, none if the root is not served.
+func (l *ServerAuditLogger) userID(auth *types.DappAuth, user types.UserID) []interface{} {
+	if l.userIDs == nil {
+		return nil
+	}
+	var account *uint32
+	if auth != nil {
+		account = &auth.Dapp
+	}
+	id, err := l.userIDs(callRoot(auth), account, string(user))
+	if err != nil {
+		return nil
+	}
+	return []interface{}{"userId", id.Hex()}
+}
+
+// queryUserID returns the fields recording the internal id of the user id of
+// an audit search of root, mapped as the search maps it. Internal ids are
+// recorded as they are, user ids that cannot be mapped not at all.
+func (l *ServerAuditLogger) queryUserID(root common.Address, user string) []interface{} {
+	if b, err := hexutil.Decode(user); err == nil && len(b) == common.HashLength {
+		return []interface{}{"userId", user}
+	}
+	if l.userIDs == nil {
+		return nil
+	}
+	id, err := l.userIDs(root, nil, user)
+	if err != nil {
+		return nil
+	}
+	return []interface{}{"userId", id.Hex()}
+}
+
+// callFields records the root and dapp a dapp facing call is made for.
+func callFields(auth *types.DappAuth) []interface{} {
+	if auth == nil {
+		return []interface{}{"root", dappRoot}
+	}
+	return []interface{}{"root", auth.Root, "dapp", auth.Dapp}
+}
+
+// RegisterDapp, AuthPub and SignHash carry encrypted payloads, only that a call
+// was made is recorded.
 func (l *ServerAuditLogger) RegisterDapp(ctx context.Context, quest types.AdminQuest, encryMessage types.EncryptMessage) (*types.EncryptMessage, error) {
-	l.log.Info("RegisterDapp", "type", "request", "metadata", MetadataFromContext(ctx).String(), "quest", quest, "encryMessage", encryMessage)
+	id := auditRequest(l.log, ctx, "RegisterDapp")
 	res, e := l.api.RegisterDapp(ctx, quest, encryMessage)
-	l.log.Info("RegisterDapp", "type", "response", "data", res, "error", e)
+	auditResponse(l.log, "RegisterDapp", id, e)
 	return res, e
 }
 
-func (l *ServerAuditLogger) RegisterAccount(ctx context.Context, phone string) (common.Address, error) {
-	l.log.Info("RegisterAccount", "type", "request", "metadata", MetadataFromContext(ctx).String(), "quest", phone)
-	res, e := l.api.RegisterAccount(ctx, phone)
-	l.log.Info("RegisterAccount", "type", "response", "data", res, "error", e)
+func (l *ServerAuditLogger) RegisterAccount(ctx context.Context, userId string, auth *types.DappAuth) (common.Address, error) {
+	fields := callFields(auth)
+	var user types.User
+	if err := json.Unmarshal([]byte(userId), &user); err == nil {
+		fields = append(fields, l.userID(auth, user.UserID)...)
+	}
+	id := auditRequest(l.log, ctx, "RegisterAccount", fields...)
+	res, e := l.api.RegisterAccount(ctx, userId, auth)
+	auditResponse(l.log, "RegisterAccount", id, e, append(fields, "decision", decisionOf(e), "address", res)...)
+	return res, e
+}
+
+// PreviewAccounts records how many accounts were previewed, the user ids are
+// not registered and so not recorded.
+func (l *ServerAuditLogger) PreviewAccounts(ctx context.Context, request string, auth *types.DappAuth) ([]*types.PreviewAccount, error) {
+	fields := callFields(auth)
+	var req types.PreviewRequest
+	if err := json.Unmarshal([]byte(request), &req); err == nil {
+		fields = append(fields, "users", len(req.UserIDs), "count", req.Count)
+	}
+	id := auditRequest(l.log, ctx, "PreviewAccounts", fields...)
+	res, e := l.api.PreviewAccounts(ctx, request, auth)
+	auditResponse(l.log, "PreviewAccounts", id, e, append(fields, "accounts", len(res))...)
 	return res, e
 }
 
 func (l *ServerAuditLogger) AuthPub(ctx context.Context, quest types.AdminQuest, auth types.AuthQuest) (*types.EncryptMessage, error) {
-	l.log.Info("AuthPub", "type", "request", "metadata", MetadataFromContext(ctx).String(),
-		"quest", quest,
-		"auth", auth,
-	)
+	id := auditRequest(l.log, ctx, "AuthPub")
 	res, err := l.api.AuthPub(ctx, quest, auth)
-	l.log.Info("AuthPub", "type", "response", "res", res, "error", err)
+	auditResponse(l.log, "AuthPub", id, err)
 	return res, err
 }
 
 func (l *ServerAuditLogger) SignHash(ctx context.Context, key common.Hash, addr common.Address, id common.Hash, encryMessage types.EncryptMessage) (*types.EncryptMessage, error) {
-	l.log.Info("SignHash", "type", "request", "metadata", MetadataFromContext(ctx).String(),
-		"key", key.String(),
-		"addr", addr.String(),
-		"id", id.String(),
-		"encryMessage", encryMessage)
-
+	reqID := auditRequest(l.log, ctx, "SignHash", "address", addr)
 	res, e := l.api.SignHash(ctx, key, addr, id, encryMessage)
-	l.log.Info("SignHash", "type", "response", "data", res, "error", e)
+	auditResponse(l.log, "SignHash", reqID, e)
 	return res, e
 }
 
-func (l *ServerAuditLogger) SignHashPlain(ctx context.Context, query string) (hexutil.Bytes, error) {
-	l.log.Info("SignHashPlain", "type", "request", "metadata", MetadataFromContext(ctx).String(),
-		"encryMessage", query)
+func (l *ServerAuditLogger) SignHashPlain(ctx context.Context, query string, auth *types.DappAuth) (hexutil.Bytes, error) {
+	fields := callFields(auth)
+	request := fields
+	var tx types.SignTx
+	if err := json.Unmarshal([]byte(query), &tx); err == nil {
+		fields = append(fields, l.userID(auth, tx.UserID)...)
+		request = append(fields[:len(fields):len(fields)], "tx", txSummary(tx))
+	}
+	id := auditRequest(l.log, ctx, "SignHashPlain", request...)
+	res, e := l.api.SignHashPlain(ctx, query, auth)
+	fields = append(fields, "decision", decisionOf(e))
+	if e == nil {
+		fields = append(fields, "tx", signedSummary(res, tx.ChainId))
+	}
+	auditResponse(l.log, "SignHashPlain", id, e, fields...)
+	return res, e
+}
+
+func (l *ServerAuditLogger) PendingResult(ctx context.Context, id common.Hash, auth *types.DappAuth) (*types.PendingResult, error) {
+	fields := append(callFields(auth), "pendingId", id.Hex())
+	reqID := auditRequest(l.log, ctx, "PendingResult", fields...)
+	res, e := l.api.PendingResult(ctx, id, auth)
+	if res != nil {
+		fields = append(fields, "status", res.Status)
+	}
+	auditResponse(l.log, "PendingResult", reqID, e, fields...)
+	return res, e
+}
 
-	res, e := l.api.SignHashPlain(ctx, query)
-	l.log.Info("SignHashPlain", "type", "response", "data", res, "error", e)
+func (l *ServerAuditLogger) PendingDecision(ctx context.Context, id common.Hash, auth *types.DappAuth) (*rpc.Subscription, error) {
+	fields := append(callFields(auth), "pendingId", id.Hex())
+	reqID := auditRequest(l.log, ctx, "PendingDecision", fields...)
+	res, e := l.api.PendingDecision(ctx, id, auth)
+	auditResponse(l.log, "PendingDecision", reqID, e, fields...)
 	return res, e
 }
 
+// Handler returns the handler of the audit trail, so other components can
+// record into it.
+func (l *ServerAuditLogger) Handler() log.Handler {
+	return l.log.GetHandler()
+}
+
+// Status is not recorded, health checks poll it every few seconds.
+func (l *ServerAuditLogger) Status(ctx context.Context) (*types.Status, error) {
+	return l.api.Status(ctx)
+}
+
 func (l *ServerAuditLogger) Version(ctx context.Context) (string, error) {
-	l.log.Info("Version", "type", "request", "metadata", MetadataFromContext(ctx).String())
+	id := auditRequest(l.log, ctx, "Version")
 	data, err := l.api.Version(ctx)
-	l.log.Info("Version", "type", "response", "data", data, "error", err)
+	auditResponse(l.log, "Version", id, err, "version", data)
 	return data, err
-
 }
 
-func NewServerAuditLogger(path string, api types.ServerAPI) (*ServerAuditLogger, error) {
+// NewServerAuditLogger records every call to api with handler, normally the
+// hash chained audit log.
+func NewServerAuditLogger(handler log.Handler, api types.ServerAPI) *ServerAuditLogger {
 	l := log.New("api", "signer")
-	handler, err := log.FileHandler(path, log.LogfmtFormat())
+	l.SetHandler(handler)
+	l.Info("Configured", "type", "startup", "schema", audit.SchemaVersion)
+	return &ServerAuditLogger{log: l, api: api}
+}
+
+// AdminAuditLogger records every admin call together with the admins that
+// signed it.
+type AdminAuditLogger struct {
+	log    log.Logger
+	api    types.AdminAPI
+	server *ServerAuditLogger // maps user ids onto internal ids
+}
+
+// adminSigners recovers the signers of an admin call for the audit trail.
+func adminSigners(auth types.AdminAuth, method string, params ...interface{}) interface{} {
+	signers, err := auth.Signers(method, params...)
 	if err != nil {
-		return nil, err
+		return err.Error()
 	}
-	l.SetHandler(handler)
-	l.Info("Configured", "server audit log", path)
-	return &ServerAuditLogger{l, api}, nil
+	return signers
+}
+
+// jsonString renders v as json for the audit trail.
+func jsonString(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err.Error()
+	}
+	return string(data)
+}
+
+func (l *AdminAuditLogger) SetLimits(ctx context.Context, auth types.AdminAuth, limits types.LimitConfig) error {
+	id := auditRequest(l.log, ctx, "SetLimits",
+		"root", auth.Root,
+		"admins", adminSigners(auth, "admin_setLimits", limits),
+		"limits", jsonString(limits))
+	e := l.api.SetLimits(ctx, auth, limits)
+	auditResponse(l.log, "SetLimits", id, e, "root", auth.Root)
+	return e
+}
+
+func (l *AdminAuditLogger) Usage(ctx context.Context, auth types.AdminAuth, scope types.UsageScope) (*types.UsageReport, error) {
+	id := auditRequest(l.log, ctx, "Usage",
+		"root", auth.Root,
+		"admins", adminSigners(auth, "admin_usage", scope),
+		"scope", jsonString(scope))
+	res, e := l.api.Usage(ctx, auth, scope)
+	auditResponse(l.log, "Usage", id, e, "root", auth.Root, "result", jsonString(res))
+	return res, e
+}
+
+func (l *AdminAuditLogger) ResetUsage(ctx context.Context, auth types.AdminAuth, scope types.UsageScope) error {
+	id := auditRequest(l.log, ctx, "ResetUsage",
+		"root", auth.Root,
+		"admins", adminSigners(auth, "admin_resetUsage", scope),
+		"scope", jsonString(scope))
+	e := l.api.ResetUsage(ctx, auth, scope)
+	auditResponse(l.log, "ResetUsage", id, e, "root", auth.Root)
+	return e
+}
+
+func (l *AdminAuditLogger) PendingRequests(ctx context.Context, auth types.AdminAuth) ([]*types.PendingRequest, error) {
+	id := auditRequest(l.log, ctx, "PendingRequests",
+		"root", auth.Root,
+		"admins", adminSigners(auth, "admin_pendingRequests"))
+	res, e := l.api.PendingRequests(ctx, auth)
+	auditResponse(l.log, "PendingRequests", id, e, "root", auth.Root, "count", len(res))
+	return res, e
+}
+
+// pendingOutcome summarizes a decided request, leaving out the signed bytes.
+func pendingOutcome(res *types.PendingResult) []interface{} {
+	if res == nil {
+		return nil
+	}
+	return []interface{}{"pendingId", res.ID.Hex(), "status", res.Status}
+}
+
+func (l *AdminAuditLogger) ApproveRequest(ctx context.Context, auth types.AdminAuth, id common.Hash, reason string) (*types.PendingResult, error) {
+	reqID := auditRequest(l.log, ctx, "ApproveRequest",
+		"root", auth.Root,
+		"admins", adminSigners(auth, "admin_approveRequest", id, reason),
+		"pendingId", id.Hex(),
+		"reason", reason)
+	res, e := l.api.ApproveRequest(ctx, auth, id, reason)
+	auditResponse(l.log, "ApproveRequest", reqID, e, append([]interface{}{"root", auth.Root}, pendingOutcome(res)...)...)
+	return res, e
+}
+
+func (l *AdminAuditLogger) DenyRequest(ctx context.Context, auth types.AdminAuth, id common.Hash, reason string) (*types.PendingResult, error) {
+	reqID := auditRequest(l.log, ctx, "DenyRequest",
+		"root", auth.Root,
+		"admins", adminSigners(auth, "admin_denyRequest", id, reason),
+		"pendingId", id.Hex(),
+		"reason", reason)
+	res, e := l.api.DenyRequest(ctx, auth, id, reason)
+	auditResponse(l.log, "DenyRequest", reqID, e, append([]interface{}{"root", auth.Root}, pendingOutcome(res)...)...)
+	return res, e
+}
+
+func (l *AdminAuditLogger) Freeze(ctx context.Context, auth types.AdminAuth, global bool, reason string) error {
+	id := auditRequest(l.log, ctx, "Freeze",
+		"root", auth.Root,
+		"admins", adminSigners(auth, "admin_freeze", global, reason),
+		"global", global,
+		"reason", reason)
+	e := l.api.Freeze(ctx, auth, global, reason)
+	auditResponse(l.log, "Freeze", id, e, "root", auth.Root)
+	return e
+}
+
+func (l *AdminAuditLogger) Unfreeze(ctx context.Context, auth types.AdminAuth, global bool, reason string) error {
+	id := auditRequest(l.log, ctx, "Unfreeze",
+		"root", auth.Root,
+		"admins", adminSigners(auth, "admin_unfreeze", global, reason),
+		"global", global,
+		"reason", reason)
+	e := l.api.Unfreeze(ctx, auth, global, reason)
+	auditResponse(l.log, "Unfreeze", id, e, "root", auth.Root)
+	return e
+}
+
+func (l *AdminAuditLogger) FreezeStatus(ctx context.Context, auth types.AdminAuth) (*types.FreezeStatus, error) {
+	id := auditRequest(l.log, ctx, "FreezeStatus",
+		"root", auth.Root,
+		"admins", adminSigners(auth, "admin_freezeStatus"))
+	res, e := l.api.FreezeStatus(ctx, auth)
+	auditResponse(l.log, "FreezeStatus", id, e, "root", auth.Root, "result", jsonString(res))
+	return res, e
+}
+
+func (l *AdminAuditLogger) Seal(ctx context.Context, auth types.AdminAuth) error {
+	id := auditRequest(l.log, ctx, "Seal",
+		"root", auth.Root,
+		"admins", adminSigners(auth, "admin_seal"))
+	e := l.api.Seal(ctx, auth)
+	auditResponse(l.log, "Seal", id, e, "root", auth.Root)
+	return e
+}
+
+// Unseal never records the share itself, only who submitted one.
+func (l *AdminAuditLogger) Unseal(ctx context.Context, root common.Address, share hexutil.Bytes) (*types.SealStatus, error) {
+	id := auditRequest(l.log, ctx, "Unseal", "root", root)
+	res, e := l.api.Unseal(ctx, root, share)
+	auditResponse(l.log, "Unseal", id, e, "root", root, "result", jsonString(res))
+	return res, e
+}
+
+func (l *AdminAuditLogger) SealStatus(ctx context.Context, root common.Address) (*types.SealStatus, error) {
+	id := auditRequest(l.log, ctx, "SealStatus", "root", root)
+	res, e := l.api.SealStatus(ctx, root)
+	auditResponse(l.log, "SealStatus", id, e, "root", root, "result", jsonString(res))
+	return res, e
+}
+
+// AddRoot never records the passphrase, which the admin signatures cover.
+func (l *AdminAuditLogger) AddRoot(ctx context.Context, auth types.AdminAuth, passphrase string) error {
+	id := auditRequest(l.log, ctx, "AddRoot",
+		"root", auth.Root,
+		"admins", adminSigners(auth, "admin_addRoot", passphrase))
+	e := l.api.AddRoot(ctx, auth, passphrase)
+	auditResponse(l.log, "AddRoot", id, e, "root", auth.Root)
+	return e
+}
+
+func (l *AdminAuditLogger) RetireRoot(ctx context.Context, auth types.AdminAuth, reason string) error {
+	id := auditRequest(l.log, ctx, "RetireRoot",
+		"root", auth.Root,
+		"admins", adminSigners(auth, "admin_retireRoot", reason),
+		"reason", reason)
+	e := l.api.RetireRoot(ctx, auth, reason)
+	auditResponse(l.log, "RetireRoot", id, e, "root", auth.Root)
+	return e
+}
+
+func (l *AdminAuditLogger) ReloadConfig(ctx context.Context, auth types.AdminAuth) ([]string, error) {
+	id := auditRequest(l.log, ctx, "ReloadConfig",
+		"root", auth.Root,
+		"admins", adminSigners(auth, "admin_reloadConfig"))
+	res, e := l.api.ReloadConfig(ctx, auth)
+	auditResponse(l.log, "ReloadConfig", id, e, "root", auth.Root, "changes", jsonString(res))
+	return res, e
+}
+
+func (l *AdminAuditLogger) AddDapp(ctx context.Context, auth types.AdminAuth, settings types.DappSettings) (*types.Dapp, error) {
+	id := auditRequest(l.log, ctx, "AddDapp",
+		"root", auth.Root,
+		"admins", adminSigners(auth, "admin_addDapp", settings),
+		"settings", jsonString(settings))
+	res, e := l.api.AddDapp(ctx, auth, settings)
+	fields := []interface{}{"root", auth.Root}
+	if res != nil {
+		fields = append(fields, "dapp", res.Account)
+	}
+	auditResponse(l.log, "AddDapp", id, e, fields...)
+	return res, e
+}
+
+func (l *AdminAuditLogger) UpdateDapp(ctx context.Context, auth types.AdminAuth, account uint32, settings types.DappSettings) (*types.Dapp, error) {
+	id := auditRequest(l.log, ctx, "UpdateDapp",
+		"root", auth.Root,
+		"admins", adminSigners(auth, "admin_updateDapp", account, settings),
+		"dapp", account,
+		"settings", jsonString(settings))
+	res, e := l.api.UpdateDapp(ctx, auth, account, settings)
+	auditResponse(l.log, "UpdateDapp", id, e, "root", auth.Root, "dapp", account)
+	return res, e
+}
+
+func (l *AdminAuditLogger) Dapps(ctx context.Context, auth types.AdminAuth) ([]*types.Dapp, error) {
+	id := auditRequest(l.log, ctx, "Dapps",
+		"root", auth.Root,
+		"admins", adminSigners(auth, "admin_dapps"))
+	res, e := l.api.Dapps(ctx, auth)
+	auditResponse(l.log, "Dapps", id, e, "root", auth.Root, "dapps", len(res))
+	return res, e
+}
+
+func (l *AdminAuditLogger) ExtendedPublicKey(ctx context.Context, auth types.AdminAuth, account uint32) (*types.ExtendedPublicKey, error) {
+	id := auditRequest(l.log, ctx, "ExtendedPublicKey",
+		"root", auth.Root,
+		"admins", adminSigners(auth, "admin_extendedPublicKey", account),
+		"account", account)
+	res, e := l.api.ExtendedPublicKey(ctx, auth, account)
+	fields := []interface{}{"root", auth.Root, "account", account}
+	if res != nil {
+		fields = append(fields, "path", res.Path)
+	}
+	auditResponse(l.log, "ExtendedPublicKey", id, e, fields...)
+	return res, e
+}
+
+// ImportUserIDs records how many users were imported, the user ids are left
+// out like those of single registrations.
+func (l *AdminAuditLogger) ImportUserIDs(ctx context.Context, auth types.AdminAuth, users []types.UserID, dapp *uint32) ([]*types.ImportedAccount, error) {
+	fields := []interface{}{"root", auth.Root, "users", len(users)}
+	if dapp != nil {
+		fields = append(fields, "dapp", *dapp)
+	}
+	id := auditRequest(l.log, ctx, "ImportUserIDs", append(fields, "admins", adminSigners(auth, "admin_importUserIds", users, dapp))...)
+	res, e := l.api.ImportUserIDs(ctx, auth, users, dapp)
+	imported := 0
+	for _, account := range res {
+		if account.New {
+			imported++
+		}
+	}
+	auditResponse(l.log, "ImportUserIDs", id, e, append(fields, "new", imported)...)
+	return res, e
+}
+
+// AuditSearch records who searched for what. The user id searched for is
+// recorded as its internal id, like the user ids of every other call.
+func (l *AdminAuditLogger) AuditSearch(ctx context.Context, auth types.AdminAuth, query audit.Query) (*types.AuditSearchResult, error) {
+	scope := query
+	scope.UserID = ""
+	fields := []interface{}{
+		"root", auth.Root,
+		"admins", adminSigners(auth, "admin_auditSearch", query),
+		"query", jsonString(scope),
+	}
+	if query.UserID != "" {
+		fields = append(fields, l.server.queryUserID(auth.Root, query.UserID)...)
+	}
+	id := auditRequest(l.log, ctx, "AuditSearch", fields...)
+	res, e := l.api.AuditSearch(ctx, auth, query)
+	fields = []interface{}{"root", auth.Root}
+	if res != nil {
+		fields = append(fields, "count", len(res.Records), "more", res.More)
+	}
+	auditResponse(l.log, "AuditSearch", id, e, fields...)
+	return res, e
+}
+
+// NewAdminAuditLogger creates an admin audit logger writing to the same trail
+// as the server audit logger.
+func NewAdminAuditLogger(server *ServerAuditLogger, api types.AdminAPI) *AdminAuditLogger {
+	l := log.New("api", "admin")
+	l.SetHandler(server.log.GetHandler())
+	return &AdminAuditLogger{l, api, server}
 }
@@ -0,0 +1,87 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package signer
+
+import (
+	"bytes"
+	"ethereum/keyservice/common"
+	"ethereum/keyservice/common/hexutil"
+	"ethereum/keyservice/services/truekey/rawdb"
+	"ethereum/keyservice/services/truekey/types"
+	"runtime/debug"
+	"sort"
+	"time"
+)
+
+// Status reports the loaded roots, their sealed and frozen state and whether
+// the database is reachable. It needs no authorisation, load balancers poll it.
+func (api *SignerAPI) Status() *types.Status {
+	api.indexMutex.Lock()
+	defer api.indexMutex.Unlock()
+
+	status := &types.Status{
+		ConfigVersion: api.config.Version,
+		StartedAt:     hexutil.Uint64(api.started.Unix()),
+		Uptime:        time.Since(api.started).Round(time.Second).String(),
+		Roots:         []types.RootStatus{},
+		Build:         buildInfo(),
+	}
+	if api.stopped {
+		status.ShuttingDown, status.Database = true, "closed"
+		return status
+	}
+	if err := rawdb.CheckDatabase(api.db); err != nil {
+		status.Database = err.Error()
+		return status
+	}
+	status.Database = "ok"
+	status.Frozen = rawdb.ReadFreeze(api.db, common.Address{}) != nil
+
+	roots := api.loadedRoots()
+	sort.Slice(roots, func(i, j int) bool { return bytes.Compare(roots[i][:], roots[j][:]) < 0 })
+	for _, root := range roots {
+		_, served := api.rootWallets[root]
+		rs := types.RootStatus{
+			Root:    root,
+			Sealed:  !served,
+			Frozen:  status.Frozen || rawdb.ReadFreeze(api.db, root) != nil,
+			Retired: rawdb.ReadRetirement(api.db, root) != nil,
+		}
+		status.Ready = status.Ready || rs.Signing()
+		status.Roots = append(status.Roots, rs)
+	}
+	return status
+}
+
+// buildInfo identifies the running binary from the data the go tool embedded.
+func buildInfo() types.BuildInfo {
+	build := types.BuildInfo{APIVersion: types.ExternalAPIVersion}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return build
+	}
+	build.GoVersion = info.GoVersion
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			build.Commit = setting.Value
+		case "vcs.modified":
+			build.Modified = setting.Value == "true"
+		}
+	}
+	return build
+}
@@ -0,0 +1,43 @@
+package signer
+
+import (
+	"ethereum/keyservice/accounts/keystore"
+	"testing"
+
+	"github.com/pborman/uuid"
+)
+
+func TestStatus(t *testing.T) {
+	api, root, keys := newSigningTestAPI(t, 1)
+	keyjson, err := keystore.EncryptKey(&keystore.Key{Id: uuid.NewRandom(), Address: root, PrivateKey: api.PrivateKeys[root]}, "status", keystore.LightScryptN, keystore.LightScryptP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := api.AddKeystore(keyjson); err != nil {
+		t.Fatal(err)
+	}
+
+	status := api.Status()
+	if !status.Ready || status.Database != "ok" || len(status.Roots) != 1 || status.Roots[0].Root != root {
+		t.Fatalf("serving status: have %+v", status)
+	}
+	if err := api.freeze(signAdminCall(root, keys, "admin_freeze", false, "incident"), false, "incident"); err != nil {
+		t.Fatal(err)
+	}
+	if status = api.Status(); status.Ready || !status.Roots[0].Frozen || status.Frozen {
+		t.Fatalf("frozen root status: have %+v", status)
+	}
+	if err := api.unfreeze(signAdminCall(root, keys, "admin_unfreeze", false, "resolved"), false, "resolved"); err != nil {
+		t.Fatal(err)
+	}
+	if err := api.seal(signAdminCall(root, keys, "admin_seal")); err != nil {
+		t.Fatal(err)
+	}
+	if status = api.Status(); status.Ready || !status.Roots[0].Sealed {
+		t.Fatalf("sealed root status: have %+v", status)
+	}
+	api.Stop()
+	if status = api.Status(); status.Ready || !status.ShuttingDown {
+		t.Fatalf("stopped status: have %+v", status)
+	}
+}
@@ -25,14 +25,12 @@ import (
 	"ethereum/keyservice/common"
 	"ethereum/keyservice/common/hexutil"
 	"ethereum/keyservice/rlp"
-	"ethereum/keyservice/services/truekey/hdwallet"
+	"ethereum/keyservice/rpc"
 	"ethereum/keyservice/services/truekey/types"
-	"fmt"
 	"golang.org/x/crypto/sha3"
 	"path/filepath"
 	"regexp"
 	"strconv"
-	"strings"
 )
 
 // SignerUIAPI implements methods truekey provides for a UI to query, in the bidirectional communication
@@ -60,14 +58,39 @@ func (s *UIServerAPI) RegisterDapp(ctx context.Context, quest types.AdminQuest,
 	return nil, nil
 }
 
-func (s *UIServerAPI) RegisterAccount(ctx context.Context, phone string) (common.Address, error) {
-	var phoneNumber types.Phone
-	err := json.Unmarshal([]byte(phone), &phoneNumber)
+// RegisterAccount registers a user. Dapps sign the call with auth, which
+// registers the user under the dapp, calls without auth register users of no dapp.
+// Example call
+// {"jsonrpc":"2.0","method":"truekey_registerAccount","params":["{\"userId\":\"alice\"}",{"root":"0x..","dapp":2000000,"createdAt":"0x..","signature":"0x.."}], "id":1}
+func (s *UIServerAPI) RegisterAccount(ctx context.Context, userId string, auth *types.DappAuth) (common.Address, error) {
+	var user types.User
+	err := json.Unmarshal([]byte(userId), &user)
+	if err != nil {
+		return common.Address{}, err
+	}
+	caller, err := newDappCaller(auth, "truekey_registerAccount", userId)
 	if err != nil {
 		return common.Address{}, err
 	}
+	return s.extApi.register(ctx, caller, string(user.UserID))
+}
 
-	return s.extApi.register(uint64(phoneNumber.Phone))
+// PreviewAccounts returns the accounts users would receive from RegisterAccount,
+// without registering them: of a list of user ids, or of a range of the indexes
+// of a dapp or of the index scheme. Calls are authorised as RegisterAccount.
+// Example call
+// {"jsonrpc":"2.0","method":"truekey_previewAccounts","params":["{\"userIds\":[\"alice\",\"bob\"]}",{"root":"0x..","dapp":2000000,"createdAt":"0x..","signature":"0x.."}], "id":1}
+// {"jsonrpc":"2.0","method":"truekey_previewAccounts","params":["{\"from\":0,\"count\":100}",{"root":"0x..","dapp":2000000,"createdAt":"0x..","signature":"0x.."}], "id":2}
+func (s *UIServerAPI) PreviewAccounts(ctx context.Context, request string, auth *types.DappAuth) ([]*types.PreviewAccount, error) {
+	var req types.PreviewRequest
+	if err := json.Unmarshal([]byte(request), &req); err != nil {
+		return nil, err
+	}
+	caller, err := newDappCaller(auth, "truekey_previewAccounts", request)
+	if err != nil {
+		return nil, err
+	}
+	return s.extApi.previewAccounts(ctx, caller, req)
 }
 
 // List available accounts. As opposed to the external API definition, this method delivers
@@ -84,13 +107,83 @@ func (s *UIServerAPI) SignHash(ctx context.Context, key common.Hash, addr common
 	return nil, nil
 }
 
-func (s *UIServerAPI) SignHashPlain(ctx context.Context, txStr string) (hexutil.Bytes, error) {
+// SignHashPlain signs a transaction of a user, of the dapp that signed the call
+// with auth if set.
+func (s *UIServerAPI) SignHashPlain(ctx context.Context, txStr string, auth *types.DappAuth) (hexutil.Bytes, error) {
 	var tx types.SignTx
 	err := json.Unmarshal([]byte(txStr), &tx)
 	if err != nil {
 		return nil, err
 	}
-	return s.extApi.SignHashPlain(ctx, tx.Phone, tx)
+	caller, err := newDappCaller(auth, "truekey_signHashPlain", txStr)
+	if err != nil {
+		return nil, err
+	}
+	return s.extApi.signHashPlain(ctx, caller, string(tx.UserID), tx)
+}
+
+// PendingResult reports the state of a request escalated for admin approval,
+// to the dapp that signed the call with auth if set. Requests are only found
+// by the dapp they were made for.
+// Example call
+// {"jsonrpc":"2.0","method":"truekey_pendingResult","params":["0x.."], "id":7}
+func (s *UIServerAPI) PendingResult(ctx context.Context, id common.Hash, auth *types.DappAuth) (*types.PendingResult, error) {
+	caller, err := newDappCaller(auth, "truekey_pendingResult", id)
+	if err != nil {
+		return nil, err
+	}
+	return s.extApi.pendingResult(ctx, caller, id)
+}
+
+// PendingDecision sends a single notification with the outcome of an escalated
+// request once the admins decided it or it expired, to the dapp that signed the
+// call with auth if set. Only available over IPC.
+// Example call
+// {"jsonrpc":"2.0","method":"truekey_subscribe","params":["pendingDecision","0x.."], "id":8}
+func (s *UIServerAPI) PendingDecision(ctx context.Context, id common.Hash, auth *types.DappAuth) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+	caller, err := newDappCaller(auth, "truekey_pendingDecision", id)
+	if err != nil {
+		return nil, err
+	}
+	// Subscribe before reading the state so no decision slips in between
+	results := make(chan *types.PendingResult, 1)
+	sub := s.extApi.SubscribePending(results)
+	result, err := s.extApi.pendingResult(ctx, caller, id)
+	if err != nil {
+		sub.Unsubscribe()
+		return nil, err
+	}
+	rpcSub := notifier.CreateSubscription()
+
+	go func() {
+		defer sub.Unsubscribe()
+		for {
+			if result.ID == id && result.Status != types.PendingStatusPending {
+				notifier.Notify(rpcSub.ID, result)
+				return
+			}
+			select {
+			case result = <-results:
+			case <-rpcSub.Err():
+				return
+			case <-notifier.Closed():
+				return
+			}
+		}
+	}()
+	return rpcSub, nil
+}
+
+// Status reports the loaded roots, whether they are sealed or frozen, the
+// database reachability, config version, uptime and build.
+// Example call
+// {"jsonrpc":"2.0","method":"truekey_status","params":[], "id":9}
+func (s *UIServerAPI) Status(ctx context.Context) (*types.Status, error) {
+	return s.extApi.Status(), nil
 }
 
 func (s *UIServerAPI) Version(ctx context.Context) (string, error) {
@@ -101,31 +194,32 @@ func getKeyStoreDir(root string, hash common.Hash) string {
 	return filepath.Join(root, common.Bytes2Hex(hash.Bytes()))
 }
 
-//"m/44'/60'/0'/0/"
+// GetDerivationPath returns the path a phone number derives at under
+// types.DefaultPathTemplate.
 func GetDerivationPath(phone uint64) (accounts.DerivationPath, error) {
-	var pathIndex string
-	if phone > 4294967290 {
-		phoneStr := strconv.FormatUint(phone, 10)
-		dappIndex, err := strconv.ParseUint(phoneStr[:6], 10, 64)
-		if err != nil {
-			return nil, types.ErrPhoneNumberError
-		}
-		index, err := strconv.ParseUint(phoneStr[6:], 10, 64)
-		if err != nil {
-			return nil, types.ErrPhoneNumberError
-		}
-		arrs := strings.Split(DefaultBaseDerivationPath, "/")
-		arrs[3] = strconv.FormatInt(int64(dappIndex), 10) + "'"
-		subDerivationPath := strings.Join(arrs, "/")
-		pathIndex = subDerivationPath + fmt.Sprintf("%d", index)
-	} else {
-		arrs := strings.Split(DefaultBaseDerivationPath, "/")
-		arrs[3] = strconv.FormatInt(int64(0), 10) + "'"
-		subDerivationPath := strings.Join(arrs, "/")
-		pathIndex = subDerivationPath + fmt.Sprintf("%d", phone)
+	account, index, err := phoneIndexes(phone)
+	if err != nil {
+		return nil, err
+	}
+	return types.DefaultPathTemplate.Path(account, index)
+}
+
+// phoneIndexes splits a phone number into the account and index it derives at.
+// Numbers longer than an index hold the dapp in their first six digits.
+func phoneIndexes(phone uint64) (uint32, uint32, error) {
+	if phone <= 4294967290 {
+		return 0, uint32(phone), nil
+	}
+	phoneStr := strconv.FormatUint(phone, 10)
+	dappIndex, err := strconv.ParseUint(phoneStr[:6], 10, 32)
+	if err != nil {
+		return 0, 0, types.ErrPhoneNumberError
+	}
+	index, err := strconv.ParseUint(phoneStr[6:], 10, 32)
+	if err != nil {
+		return 0, 0, types.ErrPhoneNumberError
 	}
-	fmt.Println(pathIndex)
-	return hdwallet.MustParseDerivationPath(pathIndex), nil
+	return uint32(dappIndex), uint32(index), nil
 }
 
 func verifyPhone(phone uint64) bool {
@@ -178,6 +272,17 @@ func MetadataFromContext(ctx context.Context) Metadata {
 	return m
 }
 
+// requestMeta converts the metadata into the form handed to a policy.
+func (m Metadata) requestMeta() types.RequestMeta {
+	return types.RequestMeta{
+		Remote:    m.Remote,
+		Local:     m.Local,
+		Scheme:    m.Scheme,
+		UserAgent: m.UserAgent,
+		Origin:    m.Origin,
+	}
+}
+
 // String implements Stringer interface
 func (m Metadata) String() string {
 	s, err := json.Marshal(m)
@@ -0,0 +1,246 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package signer
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"ethereum/keyservice/accounts"
+	"ethereum/keyservice/common"
+	"ethereum/keyservice/common/hexutil"
+	"ethereum/keyservice/crypto/ecies"
+	"ethereum/keyservice/log"
+	"ethereum/keyservice/services/truekey/rawdb"
+	"ethereum/keyservice/services/truekey/types"
+	"fmt"
+	"math/big"
+	"strconv"
+)
+
+const (
+	// userKeyLength is the size of the key internal user ids are derived with.
+	userKeyLength = 32
+
+	// sealedPathScheme marks a stored account whose derivation path is
+	// encrypted with the user id key.
+	sealedPathScheme = "sealed"
+
+	// maxUserIDLength bounds the user ids dapps may send.
+	maxUserIDLength = 256
+)
+
+// userID maps the id a dapp knows a user by, such as a phone number, onto the
+// internal id the user is stored, logged and policed under. The mapping is
+// keyed, internal ids cannot be traced back to user ids without the key.
+func userID(key []byte, id string) common.Hash {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(id))
+	return common.BytesToHash(mac.Sum(nil))
+}
+
+// checkUserID fails on a user id that is empty or too long.
+func checkUserID(id string) error {
+	if id == "" || len(id) > maxUserIDLength {
+		return types.ErrUserIDError
+	}
+	return nil
+}
+
+// isLegacyID reports whether a child account is stored under the phone number
+// itself, as it was before internal user ids.
+func isLegacyID(id common.Hash) bool {
+	for _, b := range id[:common.HashLength-8] {
+		if b != 0 {
+			return false
+		}
+	}
+	return id != common.Hash{}
+}
+
+// openUserKey returns the user id key of root, creating it on first use. It is
+// kept in the key database rather than next to the root keystore, as roots
+// restored from a seed have no keystore. It is encrypted to the root key, so it
+// can only be read while the root is served.
+func (api *SignerAPI) openUserKey(root common.Address, key *ecdsa.PrivateKey) ([]byte, error) {
+	if sealed := rawdb.ReadUserKey(api.db, root); len(sealed) > 0 {
+		userKey, err := ecies.ImportECDSA(key).Decrypt(sealed, nil, nil)
+		if err != nil {
+			return nil, fmt.Errorf("user id key of %s: %v", root.Hex(), err)
+		}
+		if len(userKey) != userKeyLength {
+			return nil, fmt.Errorf("user id key of %s is %d bytes, want %d", root.Hex(), len(userKey), userKeyLength)
+		}
+		return userKey, nil
+	}
+	userKey := make([]byte, userKeyLength)
+	if _, err := rand.Read(userKey); err != nil {
+		return nil, err
+	}
+	sealed, err := ecies.Encrypt(rand.Reader, ecies.ImportECDSAPublic(&key.PublicKey), userKey, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	rawdb.WriteUserKey(api.db, root, sealed)
+	log.Info("User id key created", "root", root)
+	return userKey, nil
+}
+
+// pathCipher returns the cipher sealing derivation paths, keyed apart from the
+// user ids.
+func pathCipher(userKey []byte) (cipher.AEAD, error) {
+	mac := hmac.New(sha256.New, userKey)
+	mac.Write([]byte("derivation path"))
+	block, err := aes.NewCipher(mac.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealPath encrypts the derivation path of an account for storage, as a path
+// derived from a phone number spells it out.
+func sealPath(userKey []byte, account accounts.Account) (accounts.Account, error) {
+	aead, err := pathCipher(userKey)
+	if err != nil {
+		return account, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return account, err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(account.URL.Path), account.Address.Bytes())
+	account.URL = accounts.URL{Scheme: sealedPathScheme, Path: hexutil.Encode(sealed)}
+	return account, nil
+}
+
+// openPath decrypts the derivation path of a stored account. Accounts stored
+// before paths were sealed are returned as they are.
+func openPath(userKey []byte, account accounts.Account) (accounts.Account, error) {
+	if account.URL.Scheme != sealedPathScheme {
+		return account, nil
+	}
+	sealed, err := hexutil.Decode(account.URL.Path)
+	if err != nil {
+		return account, err
+	}
+	aead, err := pathCipher(userKey)
+	if err != nil {
+		return account, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return account, errors.New("sealed path too short")
+	}
+	path, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], account.Address.Bytes())
+	if err != nil {
+		return account, err
+	}
+	account.URL = accounts.URL{Path: string(path)}
+	return account, nil
+}
+
+// writeChild stores a child account of v under its internal id, with the
+// derivation path sealed.
+func writeChild(db rawdb.DatabaseWriter, v *types.RootWallet, child *types.ChildAccount) error {
+	account, err := sealPath(v.UserKey, child.Account)
+	if err != nil {
+		return err
+	}
+	rawdb.WriteChildAccount(db, child.ID, &types.ChildAccount{ID: child.ID, Account: account, Template: child.Template})
+	return nil
+}
+
+// migrateUserIDs moves the child accounts of root stored under phone numbers to
+// their internal ids, and takes the phone numbers out of the signing requests
+// of root kept for the admins. It runs once, when a root stored before
+// internal ids is first served, in a single batch.
+func (api *SignerAPI) migrateUserIDs(root common.Address, v *types.RootWallet) {
+	var legacy []common.Hash
+	batch := api.db.NewBatch()
+	for _, id := range rawdb.ReadRootChildren(api.db, root.Hash()) {
+		if !isLegacyID(id) {
+			continue
+		}
+		child := rawdb.ReadChildAccount(api.db, id)
+		if child == nil {
+			continue
+		}
+		child.ID = userID(v.UserKey, strconv.FormatUint(convertHashToUint(id), 10))
+		if err := writeChild(batch, v, child); err != nil {
+			log.Error("Failed to migrate user id", "root", root, "err", err)
+			return
+		}
+		rawdb.WriteRootChild(batch, root.Hash(), child.ID)
+		legacy = append(legacy, id)
+	}
+	if len(legacy) == 0 {
+		return
+	}
+	for _, id := range legacy {
+		rawdb.DeleteRootChild(batch, root.Hash(), id)
+		rawdb.DeleteChildAccount(batch, id)
+	}
+	pending := 0
+	for _, id := range rawdb.ReadPendingRequestIDs(api.db) {
+		req := rawdb.ReadPendingRequest(api.db, id)
+		if req == nil || req.Request.Root != root || req.Tx.UserID == "" {
+			continue
+		}
+		// Requests stored before internal ids hold the phone number as an
+		// RLP integer, which decodes to its big endian bytes.
+		phone := new(big.Int).SetBytes([]byte(req.Tx.UserID)).Uint64()
+		req.Request.UserID = userID(v.UserKey, strconv.FormatUint(phone, 10)).Hex()
+		req.Tx.UserID = ""
+		rawdb.WritePendingRequest(batch, req)
+		pending++
+	}
+	if err := batch.Write(); err != nil {
+		log.Crit("Failed to migrate user ids", "root", root, "err", err)
+	}
+	log.Info("Migrated accounts to internal user ids", "root", root, "accounts", len(legacy), "requests", pending)
+}
+
+// UserID returns the internal id of a user of a served root, of the dapp with
+// account if set, for the audit trail to record instead of the user id.
+func (api *SignerAPI) UserID(root common.Address, account *uint32, id string) (common.Hash, error) {
+	api.indexMutex.Lock()
+	defer api.indexMutex.Unlock()
+
+	v, err := api.rootWallet(root)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return scopedUserID(v, account, id), nil
+}
+
+// internalUserID maps a user id in a query onto the internal id of root. Ids
+// shaped like internal ids, or that cannot be mapped while the root is sealed,
+// are returned as they are.
+func (api *SignerAPI) internalUserID(root common.Address, id string) string {
+	if b, err := hexutil.Decode(id); err == nil && len(b) == common.HashLength {
+		return id
+	}
+	v, err := api.rootWallet(root)
+	if err != nil {
+		return id
+	}
+	return userID(v.UserKey, id).Hex()
+}
@@ -0,0 +1,175 @@
+package signer
+
+import (
+	"bytes"
+	"context"
+	"ethereum/keyservice/accounts"
+	"ethereum/keyservice/accounts/keystore"
+	"ethereum/keyservice/common"
+	"ethereum/keyservice/crypto"
+	"ethereum/keyservice/etruedb"
+	"ethereum/keyservice/rlp"
+	"ethereum/keyservice/services/truekey/hdwallet"
+	"ethereum/keyservice/services/truekey/rawdb"
+	"ethereum/keyservice/services/truekey/types"
+	"math/big"
+	"strconv"
+	"testing"
+
+	"github.com/pborman/uuid"
+)
+
+// hasPhone reports whether a phone number is stored anywhere in db, as a
+// number, as text or spelled out by a derivation path.
+func hasPhone(db *etruedb.MemDatabase, phone uint64) bool {
+	path, _ := GetDerivationPath(phone)
+	for _, key := range db.Keys() {
+		value, _ := db.Get(key)
+		for _, b := range [][]byte{key, value} {
+			if bytes.Contains(b, convertBigToHash(phone).Bytes()[24:]) ||
+				bytes.Contains(b, []byte(strconv.FormatUint(phone, 10))) ||
+				bytes.Contains(b, []byte(path.String())) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func TestMigrateUserIDs(t *testing.T) {
+	admin, root, _ := newAdminTestAPI(t, 1)
+	db := admin.db.(*etruedb.MemDatabase)
+	// Stop wipes the root key, every start gets a fresh copy
+	generated, _ := crypto.GenerateKey()
+	keys := func() []*keystore.Key {
+		key, _ := crypto.ToECDSA(crypto.FromECDSA(generated))
+		return []*keystore.Key{{Address: root, PrivateKey: key}}
+	}
+	phone := uint64(13800000000)
+
+	// Lay down an account and a pending request as stored under phone numbers
+	api, err := NewSignerAPI(db, keys(), []types.RootConfig{admin.configs[root]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path, _ := GetDerivationPath(phone)
+	account, err := api.rootWallets[root].Wallet.Derive(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy, _ := rlp.EncodeToBytes(struct {
+		ID      uint64
+		Account accounts.Account
+	}{phone, account})
+	child := new(types.ChildAccount)
+	if err := rlp.DecodeBytes(legacy, child); err != nil || child.ID != convertBigToHash(phone) {
+		t.Fatalf("legacy account: have %x %v", child.ID, err)
+	}
+	rawdb.WriteChildAccount(db, convertBigToHash(phone), child)
+	rawdb.WriteRootInfo(db, root.Hash(), []common.Hash{convertBigToHash(phone)})
+	tx := testTx()
+	tx.UserID = types.UserID(new(big.Int).SetUint64(phone).Bytes())
+	rawdb.WritePendingRequest(db, &types.PendingRequest{ID: common.HexToHash("0x01"), Tx: tx, Request: types.TxRequest{Root: root, UserID: strconv.FormatUint(phone, 10)}})
+	api.Stop()
+	if !hasPhone(db, phone) {
+		t.Fatal("legacy layout without phone number")
+	}
+
+	for i := 0; i < 2; i++ {
+		api, err = NewSignerAPI(db, keys(), []types.RootConfig{admin.configs[root]})
+		if err != nil {
+			t.Fatal(err)
+		}
+		id := userID(api.rootWallets[root].UserKey, strconv.FormatUint(phone, 10))
+		child := api.rootWallets[root].Accounts[id]
+		if child == nil || child.Account.Address != account.Address || child.Account.URL.Path != path.String() || child.PrivateKey == nil {
+			t.Fatalf("restart %d: migrated account %v", i, child)
+		}
+		// The list of children moved to a key per child as well
+		if ids := rawdb.ReadRootChildren(db, root.Hash()); len(ids) != i+1 || !rawdb.HasRootChild(db, root.Hash(), id) || rawdb.HasRootInfo(db, root.Hash()) {
+			t.Fatalf("restart %d: root children %x", i, ids)
+		}
+		if req := rawdb.ReadPendingRequest(db, common.HexToHash("0x01")); req.Tx.UserID != "" || req.Request.UserID != id.Hex() {
+			t.Fatalf("restart %d: pending request %+v", i, req)
+		}
+		if addr, err := api.register(context.Background(), nil, strconv.FormatUint(phone, 10)); err != nil || addr != account.Address {
+			t.Fatalf("restart %d: register migrated user: have %x %v", i, addr, err)
+		}
+		if _, err := api.register(context.Background(), nil, strconv.FormatUint(phone+1, 10)); err != nil {
+			t.Fatal(err)
+		}
+		api.Stop()
+		if hasPhone(db, phone) || hasPhone(db, phone+1) {
+			t.Fatalf("restart %d: phone number stored", i)
+		}
+	}
+}
+
+// A root restored from a seed keeps its user id key across restarts like a
+// root of a keystore.
+func TestSeedRootUserKey(t *testing.T) {
+	seed, err := hdwallet.NewSeed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := etruedb.NewMemDatabase()
+	var ids []common.Hash
+	for run := 0; run < 2; run++ {
+		api, err := NewSignerAPI(db, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		root, err := api.UnlockSeed(append([]byte(nil), seed...))
+		if err != nil {
+			t.Fatalf("run %d: unlock seed: %v", run, err)
+		}
+		if crypto.PubkeyToAddress(api.PrivateKeys[root].PublicKey) != root {
+			t.Fatalf("run %d: key of another root served", run)
+		}
+		ids = append(ids, userID(api.rootWallets[root].UserKey, "alice"))
+		api.Stop()
+	}
+	if ids[0] != ids[1] {
+		t.Fatalf("user id changed across restarts: %x", ids)
+	}
+}
+
+// The user id key lives in the database, sealed to the root key. A root
+// unlocked from its keystore file again reads it back and maps its users as
+// before.
+func TestRestoreUserKey(t *testing.T) {
+	rootKey, _ := crypto.GenerateKey()
+	root := crypto.PubkeyToAddress(rootKey.PublicKey)
+	keyjson, err := keystore.EncryptKey(&keystore.Key{Id: uuid.NewRandom(), Address: root, PrivateKey: rootKey}, "", keystore.LightScryptN, keystore.LightScryptP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := etruedb.NewMemDatabase()
+	configs := []types.RootConfig{{Root: root}}
+	var (
+		userKeys [][]byte
+		ids      []common.Hash
+	)
+	for run := 0; run < 2; run++ {
+		api, err := NewSignerAPI(db, nil, configs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Stop wipes the keystores held, every start gets a fresh copy
+		if _, err := api.AddKeystore(append([]byte(nil), keyjson...)); err != nil {
+			t.Fatal(err)
+		}
+		if err := api.UnlockKeystore(root, ""); err != nil {
+			t.Fatalf("run %d: unlock keystore: %v", run, err)
+		}
+		userKeys = append(userKeys, append([]byte(nil), api.rootWallets[root].UserKey...))
+		ids = append(ids, userID(api.rootWallets[root].UserKey, "13800000000"))
+		api.Stop()
+	}
+	if !bytes.Equal(userKeys[0], userKeys[1]) || ids[0] != ids[1] {
+		t.Fatalf("user id key not restored: have %x %x", userKeys, ids)
+	}
+	if sealed := rawdb.ReadUserKey(db, root); len(sealed) == 0 || bytes.Contains(sealed, userKeys[0]) {
+		t.Fatalf("user id key stored in the clear: %x", sealed)
+	}
+}
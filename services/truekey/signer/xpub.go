@@ -0,0 +1,47 @@
+package signer
+
+import (
+	"ethereum/keyservice/common"
+	"ethereum/keyservice/log"
+	"ethereum/keyservice/services/truekey/rawdb"
+	"ethereum/keyservice/services/truekey/types"
+)
+
+// accountTemplate returns the path template new users of account are derived
+// with, the one of the dapp with the account if it sets one.
+func (api *SignerAPI) accountTemplate(root common.Address, account uint32) types.PathTemplate {
+	if dapp := rawdb.ReadDapp(api.db, root, account); dapp != nil && dapp.Path != "" {
+		return dapp.Path
+	}
+	return api.configs[root].PathTemplate(account)
+}
+
+func (api *SignerAPI) extendedPublicKey(auth types.AdminAuth, account uint32) (*types.ExtendedPublicKey, error) {
+	api.indexMutex.Lock()
+	defer api.indexMutex.Unlock()
+
+	if _, err := api.checkAuth(auth, false, "admin_extendedPublicKey", account); err != nil {
+		return nil, err
+	}
+	v, err := api.rootWallet(auth.Root)
+	if err != nil {
+		return nil, err
+	}
+	template := api.accountTemplate(auth.Root, account)
+	path, children, err := template.PublicBranch(account)
+	if err != nil {
+		return nil, err
+	}
+	xpub, err := v.Wallet.ExtendedPublicKey(path)
+	if err != nil {
+		return nil, err
+	}
+	log.Info("Extended public key exported", "root", auth.Root, "account", account, "path", path)
+	return &types.ExtendedPublicKey{
+		Account:  account,
+		Template: template,
+		Path:     path.String(),
+		XPub:     xpub,
+		Children: children,
+	}, nil
+}
@@ -0,0 +1,54 @@
+package signer
+
+import (
+	"context"
+	"ethereum/keyservice/services/truekey/hdwallet"
+	"ethereum/keyservice/services/truekey/types"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestExtendedPublicKey(t *testing.T) {
+	api, root, keys := newSigningTestAPI(t, 1)
+	ctx := context.Background()
+	dapp, dappKey := addTestDapp(t, api, root, keys, types.DappSettings{Name: "wallet", Path: "m/44'/246'/{account}'/1'/0/{index}"})
+
+	xpub, err := api.extendedPublicKey(signAdminCall(root, keys, "admin_extendedPublicKey", dapp.Account), dapp.Account)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if xpub.Path != "m/44'/246'/2000000'/1'" || xpub.Children != "0/{index}" {
+		t.Fatalf("dapp branch: have %s %s", xpub.Path, xpub.Children)
+	}
+	for i, user := range []string{"alice", "bob", "carol"} {
+		addr, err := api.register(ctx, dappCall(t, root, dapp.Account, dappKey, "truekey_registerAccount", user), user)
+		if err != nil {
+			t.Fatal(err)
+		}
+		derived, err := hdwallet.DeriveAddress(xpub.XPub, strings.Replace(xpub.Children, "{index}", strconv.Itoa(i), 1))
+		if err != nil || derived != addr {
+			t.Fatalf("dapp user %d: have %x %v, want %x", i, derived, err, addr)
+		}
+	}
+
+	// Accounts of the phone scheme export the same way
+	xpub, err = api.extendedPublicKey(signAdminCall(root, keys, "admin_extendedPublicKey", uint32(138000)), 138000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr, err := api.register(ctx, nil, "13800000042")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if derived, err := hdwallet.DeriveAddress(xpub.XPub, "0/42"); err != nil || derived != addr {
+		t.Fatalf("phone user: have %x %v, want %x", derived, err, addr)
+	}
+
+	config := api.configs[root]
+	config.Path = "m/44'/60'/{account}'/0/{index}'"
+	api.configs[root] = config
+	if _, err := api.extendedPublicKey(signAdminCall(root, keys, "admin_extendedPublicKey", uint32(0)), 0); err == nil {
+		t.Fatal("exported a branch with hardened indexes")
+	}
+}
@@ -0,0 +1,133 @@
+package types
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"ethereum/keyservice/common"
+	"ethereum/keyservice/common/hexutil"
+	"ethereum/keyservice/crypto"
+	"ethereum/keyservice/services/truekey/audit"
+)
+
+var (
+	ErrAdminAuthExpired = errors.New("admin request expired")
+	ErrAdminQuorum      = errors.New("not enough admin signatures")
+)
+
+// AdminAuth authorises a call on the admin API. Every signature is made by one
+// admin of Root over AdminCallHash of the call. The nonce tells apart calls
+// made at the same time, a call is accepted once.
+type AdminAuth struct {
+	Root       common.Address  `json:"root"`
+	CreatedAt  hexutil.Uint64  `json:"createdAt"`
+	Nonce      hexutil.Uint64  `json:"nonce"`
+	Signatures []hexutil.Bytes `json:"signatures"`
+}
+
+// AdminCallHash returns the hash admins sign to authorise method with params.
+// The params are hashed in their json encoding, which is what travels over RPC.
+func AdminCallHash(method string, root common.Address, createdAt, nonce uint64, params ...interface{}) common.Hash {
+	if params == nil {
+		params = []interface{}{}
+	}
+	data, _ := json.Marshal(params)
+	return rlpHash([]interface{}{
+		method,
+		root,
+		createdAt,
+		nonce,
+		data,
+	})
+}
+
+// Hash returns the hash the admins signed to authorise method with params.
+func (a AdminAuth) Hash(method string, params ...interface{}) common.Hash {
+	return AdminCallHash(method, a.Root, uint64(a.CreatedAt), uint64(a.Nonce), params...)
+}
+
+// Signers recovers the distinct addresses that signed the call. Signatures
+// which cannot be recovered are an error, duplicates are ignored.
+func (a AdminAuth) Signers(method string, params ...interface{}) ([]common.Address, error) {
+	hash := a.Hash(method, params...)
+	seen := make(map[common.Address]bool)
+	var signers []common.Address
+	for _, sig := range a.Signatures {
+		pub, err := crypto.SigToPub(hash.Bytes(), sig)
+		if err != nil {
+			return nil, ErrAdminSignError
+		}
+		addr := crypto.PubkeyToAddress(*pub)
+		if !seen[addr] {
+			seen[addr] = true
+			signers = append(signers, addr)
+		}
+	}
+	return signers, nil
+}
+
+// AdminAPI defines the admin channel. Every method is authorised by the admins
+// configured for the root, mutating calls need a quorum of them, except
+// AuditSearch, which is authorised by an auditor.
+type AdminAPI interface {
+	// SetLimits replaces the spending limits of a root
+	SetLimits(ctx context.Context, auth AdminAuth, limits LimitConfig) error
+	// Usage reports the current spending of an account or a dapp
+	Usage(ctx context.Context, auth AdminAuth, scope UsageScope) (*UsageReport, error)
+	// ResetUsage clears the spending counters of an account or a dapp
+	ResetUsage(ctx context.Context, auth AdminAuth, scope UsageScope) error
+	// PendingRequests lists the requests of the root waiting for approval
+	PendingRequests(ctx context.Context, auth AdminAuth) ([]*PendingRequest, error)
+	// ApproveRequest signs an escalated request
+	ApproveRequest(ctx context.Context, auth AdminAuth, id common.Hash, reason string) (*PendingResult, error)
+	// DenyRequest rejects an escalated request
+	DenyRequest(ctx context.Context, auth AdminAuth, id common.Hash, reason string) (*PendingResult, error)
+	// Freeze stops all signing of the root, or of every root if global is set
+	Freeze(ctx context.Context, auth AdminAuth, global bool, reason string) error
+	// Unfreeze resumes signing stopped by Freeze
+	Unfreeze(ctx context.Context, auth AdminAuth, global bool, reason string) error
+	// FreezeStatus reports the global freeze and the freeze of the root
+	FreezeStatus(ctx context.Context, auth AdminAuth) (*FreezeStatus, error)
+	// Seal wipes the keys of the root from memory
+	Seal(ctx context.Context, auth AdminAuth) error
+	// Unseal submits a custodian's share of the root passphrase
+	Unseal(ctx context.Context, root common.Address, share hexutil.Bytes) (*SealStatus, error)
+	// SealStatus reports the unseal progress of a root
+	SealStatus(ctx context.Context, root common.Address) (*SealStatus, error)
+	// AddRoot serves a root from its loaded keystore
+	AddRoot(ctx context.Context, auth AdminAuth, passphrase string) error
+	// RetireRoot takes a root out of service
+	RetireRoot(ctx context.Context, auth AdminAuth, reason string) error
+	// ReloadConfig re-reads the config file and returns what changed
+	ReloadConfig(ctx context.Context, auth AdminAuth) ([]string, error)
+	// AddDapp adds a dapp to the root under an account of its own
+	AddDapp(ctx context.Context, auth AdminAuth, settings DappSettings) (*Dapp, error)
+	// UpdateDapp replaces the settings of a dapp of the root
+	UpdateDapp(ctx context.Context, auth AdminAuth, account uint32, settings DappSettings) (*Dapp, error)
+	// Dapps lists the dapps of the root
+	Dapps(ctx context.Context, auth AdminAuth) ([]*Dapp, error)
+	// ExtendedPublicKey exports the public key of the branch of an account
+	ExtendedPublicKey(ctx context.Context, auth AdminAuth, account uint32) (*ExtendedPublicKey, error)
+	// ImportUserIDs registers users of the root in a single write
+	ImportUserIDs(ctx context.Context, auth AdminAuth, users []UserID, dapp *uint32) ([]*ImportedAccount, error)
+	// AuditSearch searches the audit log for records of the root, for auditors
+	AuditSearch(ctx context.Context, auth AdminAuth, query audit.Query) (*AuditSearchResult, error)
+}
+
+// AuditSearchResult holds audit records as written, so they stay verifiable.
+// More is set if records beyond the limit of the query matched as well.
+type AuditSearchResult struct {
+	Records []json.RawMessage `json:"records"`
+	More    bool              `json:"more"`
+}
+
+// ExtendedPublicKey is the BIP-32 extended public key of the branch of an
+// account of a root. The address of a user with index i under the account is
+// the one of Children with {index} set to i, derived from XPub.
+type ExtendedPublicKey struct {
+	Account  uint32       `json:"account"`
+	Template PathTemplate `json:"template"`
+	Path     string       `json:"path"`
+	XPub     string       `json:"xpub"`
+	Children string       `json:"children"`
+}
@@ -1,26 +1,487 @@
 package types
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"ethereum/keyservice/common"
 	"ethereum/keyservice/log"
+	"ethereum/keyservice/services/truekey/audit"
+	"fmt"
 	"io/ioutil"
+	"net"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 )
 
 const jsonIndent = "    "
 
+// ConfigVersion is the version of the config schema. Configs without a version
+// predate versioning and are read as the current one.
+const ConfigVersion = 1
+
 // Config is the config.json file format. It holds a set of node records
 // as a JSON object.
 type Config struct {
+	Version int          `json:"version,omitempty"`
 	RpcPort int          `json:"rpcport"`
 	RpcAddr string       `json:"rpcaddr"`
 	Config  []RootConfig `json:"admins"`
+	Audit   *AuditConfig `json:"audit,omitempty"`
+}
+
+// AuditConfig configures the audit log.
+type AuditConfig struct {
+	// Redact maps record fields to keep, drop, hash or mask. Fields not listed
+	// follow audit.DefaultRedaction.
+	Redact map[string]string `json:"redact,omitempty"`
+
+	Rotate  *AuditRotateConfig `json:"rotate,omitempty"`
+	Retain  *AuditRetainConfig `json:"retain,omitempty"`
+	Forward []audit.Forward    `json:"forward,omitempty"`
+}
+
+// AuditRotateConfig says when the audit log file is rotated. Without either
+// limit the file is never rotated.
+type AuditRotateConfig struct {
+	MaxSizeMB     int  `json:"maxSizeMB,omitempty"`
+	IntervalHours int  `json:"intervalHours,omitempty"`
+	Compress      bool `json:"compress,omitempty"`
+}
+
+// AuditRetainConfig says which rotated audit log files are kept. Without either
+// limit all of them are.
+type AuditRetainConfig struct {
+	Files int `json:"files,omitempty"`
+	Days  int `json:"days,omitempty"`
+}
+
+// Redaction returns the configured redaction rules, nil if there are none.
+func (c Config) Redaction() map[string]string {
+	if c.Audit == nil {
+		return nil
+	}
+	return c.Audit.Redact
+}
+
+// AuditRotation returns the rotation and retention policy of the audit log.
+func (c Config) AuditRotation() audit.RotatePolicy {
+	var policy audit.RotatePolicy
+	if c.Audit == nil {
+		return policy
+	}
+	if rotate := c.Audit.Rotate; rotate != nil {
+		policy.MaxSize = int64(rotate.MaxSizeMB) << 20
+		policy.Interval = time.Duration(rotate.IntervalHours) * time.Hour
+		policy.Compress = rotate.Compress
+	}
+	if retain := c.Audit.Retain; retain != nil {
+		policy.KeepFiles = retain.Files
+		policy.KeepAge = time.Duration(retain.Days) * 24 * time.Hour
+	}
+	return policy
+}
+
+// AuditForward returns where copies of the audit log are forwarded to.
+func (c Config) AuditForward() []audit.Forward {
+	if c.Audit == nil {
+		return nil
+	}
+	return c.Audit.Forward
 }
 
 type RootConfig struct {
 	Root   common.Address   `json:"root"`
 	Admins []common.Address `json:"admins"`
+	Quorum int              `json:"quorum,omitempty"`
+	Limits *LimitConfig     `json:"limits,omitempty"`
+
+	// Auditors may search the audit log for records of the root
+	Auditors []common.Address `json:"auditors,omitempty"`
+
+	// UserIDs is how new users get their derivation path, UserIDsPhone by
+	// default. Registered users keep theirs when it changes.
+	UserIDs string `json:"userIds,omitempty"`
+
+	// Path is the derivation path template of new users, DefaultPathTemplate
+	// by default. DappPaths overrides it for the dapps keyed by their account
+	// number. Registered users keep their path when either changes.
+	Path      PathTemplate            `json:"path,omitempty"`
+	DappPaths map[string]PathTemplate `json:"dappPaths,omitempty"`
+}
+
+const (
+	// UserIDsPhone derives the path from the user id, which must be a phone
+	// number, as the service always did.
+	UserIDsPhone = "phone"
+	// UserIDsIndex allocates the next free index of the root to a user id of
+	// any kind.
+	UserIDsIndex = "index"
+)
+
+// UserIDScheme returns how new users of the root get their derivation path.
+func (rc RootConfig) UserIDScheme() string {
+	if rc.UserIDs == "" {
+		return UserIDsPhone
+	}
+	return rc.UserIDs
+}
+
+// PathTemplate returns the derivation path template of new users under the
+// hardened account of a dapp.
+func (rc RootConfig) PathTemplate(account uint32) PathTemplate {
+	if t, ok := rc.DappPaths[strconv.FormatUint(uint64(account), 10)]; ok {
+		return t
+	}
+	if rc.Path != "" {
+		return rc.Path
+	}
+	return DefaultPathTemplate
+}
+
+// Threshold returns the number of admins needed to approve a mutating admin
+// call, a simple majority unless the quorum is configured explicitly.
+func (rc RootConfig) Threshold() int {
+	if rc.Quorum > 0 {
+		return rc.Quorum
+	}
+	return len(rc.Admins)/2 + 1
+}
+
+// IsAdmin reports whether addr is an admin of the root.
+func (rc RootConfig) IsAdmin(addr common.Address) bool {
+	for _, admin := range rc.Admins {
+		if admin == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// IsAuditor reports whether addr is an auditor of the root.
+func (rc RootConfig) IsAuditor(addr common.Address) bool {
+	for _, auditor := range rc.Auditors {
+		if auditor == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// ConfigError lists every problem found in a config, so all of them can be
+// fixed at once.
+type ConfigError struct {
+	Problems []string
+}
+
+func (e *ConfigError) Error() string {
+	return "invalid config:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// configProblems collects the problems of a config.
+type configProblems []string
+
+func (p *configProblems) add(format string, args ...interface{}) {
+	*p = append(*p, fmt.Sprintf(format, args...))
+}
+
+func (p configProblems) err() error {
+	if len(p) == 0 {
+		return nil
+	}
+	return &ConfigError{p}
+}
+
+// Validate checks the config is well formed, so a broken edit is never used.
+func (c Config) Validate() error {
+	var problems configProblems
+	if c.Version > ConfigVersion {
+		problems.add("version: %d is not supported, the newest is %d", c.Version, ConfigVersion)
+	}
+	if c.RpcPort < 0 || c.RpcPort > 65535 {
+		problems.add("rpcport: %d is out of range 0..65535", c.RpcPort)
+	}
+	if c.RpcAddr != "" && net.ParseIP(c.RpcAddr) == nil && !validHostname(c.RpcAddr) {
+		problems.add("rpcaddr: %q is neither an IP address nor a host name", c.RpcAddr)
+	}
+	seen := make(map[common.Address]int)
+	for i, rc := range c.Config {
+		at := fmt.Sprintf("admins[%d]", i)
+		if rc.Root == (common.Address{}) {
+			problems.add("%s.root: missing", at)
+		} else if j, dup := seen[rc.Root]; dup {
+			problems.add("%s.root: %s is configured again, first at admins[%d]", at, rc.Root.Hex(), j)
+		} else {
+			seen[rc.Root] = i
+		}
+		if len(rc.Admins) == 0 {
+			problems.add("%s.admins: root %s has no admins", at, rc.Root.Hex())
+		}
+		admins := make(map[common.Address]bool)
+		for j, admin := range rc.Admins {
+			switch {
+			case admin == (common.Address{}):
+				problems.add("%s.admins[%d]: missing address", at, j)
+			case admins[admin]:
+				problems.add("%s.admins[%d]: %s is listed twice", at, j, admin.Hex())
+			}
+			admins[admin] = true
+		}
+		auditors := make(map[common.Address]bool)
+		for j, auditor := range rc.Auditors {
+			switch {
+			case auditor == (common.Address{}):
+				problems.add("%s.auditors[%d]: missing address", at, j)
+			case auditors[auditor]:
+				problems.add("%s.auditors[%d]: %s is listed twice", at, j, auditor.Hex())
+			}
+			auditors[auditor] = true
+		}
+		if scheme := rc.UserIDScheme(); scheme != UserIDsPhone && scheme != UserIDsIndex {
+			problems.add("%s.userIds: %q is neither %q nor %q", at, rc.UserIDs, UserIDsPhone, UserIDsIndex)
+		}
+		if rc.Path != "" {
+			if err := rc.Path.Check(); err != nil {
+				problems.add("%s.path: %v", at, err)
+			}
+		}
+		dapps := make([]string, 0, len(rc.DappPaths))
+		for dapp := range rc.DappPaths {
+			dapps = append(dapps, dapp)
+		}
+		sort.Strings(dapps)
+		for _, dapp := range dapps {
+			t := rc.DappPaths[dapp]
+			if n, err := strconv.ParseUint(dapp, 10, 32); err != nil || n >= 0x80000000 {
+				problems.add("%s.dappPaths.%s: not an account number", at, dapp)
+			}
+			if err := t.Check(); err != nil {
+				problems.add("%s.dappPaths.%s: %v", at, dapp, err)
+			}
+		}
+		if rc.Quorum < 0 || rc.Quorum > len(rc.Admins) {
+			problems.add("%s.quorum: %d is out of range 1..%d", at, rc.Quorum, len(rc.Admins))
+		}
+		if rc.Limits != nil {
+			rc.Limits.Account.validate(&problems, at+".limits.account")
+			rc.Limits.Dapp.validate(&problems, at+".limits.dapp")
+		}
+	}
+	if err := audit.CheckRedaction(c.Redaction()); err != nil {
+		problems.add("audit.redact.%v", err)
+	}
+	if c.Audit != nil {
+		if rotate := c.Audit.Rotate; rotate != nil {
+			if rotate.MaxSizeMB < 0 {
+				problems.add("audit.rotate.maxSizeMB: %d is negative", rotate.MaxSizeMB)
+			}
+			if rotate.IntervalHours < 0 {
+				problems.add("audit.rotate.intervalHours: %d is negative", rotate.IntervalHours)
+			}
+		}
+		if retain := c.Audit.Retain; retain != nil {
+			if retain.Files < 0 {
+				problems.add("audit.retain.files: %d is negative", retain.Files)
+			}
+			if retain.Days < 0 {
+				problems.add("audit.retain.days: %d is negative", retain.Days)
+			}
+		}
+		for i, forward := range c.Audit.Forward {
+			if err := audit.CheckForward(forward); err != nil {
+				problems.add("audit.forward[%d].%v", i, err)
+			}
+		}
+	}
+	return problems.err()
+}
+
+// validate checks every configured window limits something.
+func (w WindowLimits) validate(problems *configProblems, at string) {
+	for _, window := range []struct {
+		name  string
+		limit *Limit
+	}{{"hour", w.Hour}, {"day", w.Day}, {"month", w.Month}} {
+		if window.limit == nil {
+			continue
+		}
+		if window.limit.Value == nil && window.limit.Count == 0 {
+			problems.add("%s.%s: sets neither value nor count", at, window.name)
+		}
+		if window.limit.Value != nil && window.limit.Value.Sign() < 0 {
+			problems.add("%s.%s.value: %v is negative", at, window.name, window.limit.Value)
+		}
+	}
+}
+
+// CheckRoots reports configured roots that are not among the loaded ones.
+func (c Config) CheckRoots(loaded []common.Address) error {
+	known := make(map[common.Address]bool)
+	for _, root := range loaded {
+		known[root] = true
+	}
+	var problems configProblems
+	for i, rc := range c.Config {
+		if rc.Root != (common.Address{}) && !known[rc.Root] {
+			problems.add("admins[%d].root: no keystore or seed of %s is loaded", i, rc.Root.Hex())
+		}
+	}
+	return problems.err()
+}
+
+// validHostname reports whether name is a syntactically valid host name.
+func validHostname(name string) bool {
+	if len(name) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(name, ".") {
+		if len(label) == 0 || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, r := range label {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// ParseConfig decodes a config strictly: unknown fields, e.g. misspelt ones,
+// are errors instead of being ignored.
+func ParseConfig(data []byte) (Config, error) {
+	var config Config
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&config); err != nil {
+		switch err := err.(type) {
+		case *json.SyntaxError:
+			return Config{}, fmt.Errorf("line %d: %v", lineOf(data, err.Offset), err)
+		case *json.UnmarshalTypeError:
+			return Config{}, fmt.Errorf("line %d: %v", lineOf(data, err.Offset), err)
+		}
+		return Config{}, err
+	}
+	if dec.More() {
+		return Config{}, errors.New("data after the config object")
+	}
+	return config, nil
+}
+
+// lineOf returns the line of data at offset.
+func lineOf(data []byte, offset int64) int {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	return bytes.Count(data[:offset], []byte("\n")) + 1
+}
+
+// LoadConfig reads, parses and validates a config file. Unlike LoadNodesJSON
+// a file that cannot be used is an error.
+func LoadConfig(file string) (Config, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return Config{}, err
+	}
+	config, err := ParseConfig(data)
+	if err != nil {
+		return Config{}, fmt.Errorf("%s: %v", file, err)
+	}
+	if err := config.Validate(); err != nil {
+		return Config{}, fmt.Errorf("%s: %v", file, err)
+	}
+	if config.Version == 0 {
+		log.Warn("Config has no version, assuming the current one", "file", file, "version", ConfigVersion)
+	}
+	return config, nil
+}
+
+// DiffConfig describes what changed from old to new, one line per change.
+func DiffConfig(old, new Config) []string {
+	var diff []string
+	if old.RpcAddr != new.RpcAddr || old.RpcPort != new.RpcPort {
+		diff = append(diff, fmt.Sprintf("admin endpoint %s:%d -> %s:%d, effective after a restart", old.RpcAddr, old.RpcPort, new.RpcAddr, new.RpcPort))
+	}
+	roots := make(map[common.Address]RootConfig)
+	for _, rc := range old.Config {
+		roots[rc.Root] = rc
+	}
+	for _, rc := range new.Config {
+		prev, exists := roots[rc.Root]
+		if !exists {
+			diff = append(diff, fmt.Sprintf("root %s added with admins %v", rc.Root.Hex(), rc.Admins))
+			continue
+		}
+		delete(roots, rc.Root)
+
+		admins := make(map[common.Address]bool)
+		for _, admin := range prev.Admins {
+			admins[admin] = true
+		}
+		for _, admin := range rc.Admins {
+			if !admins[admin] {
+				diff = append(diff, fmt.Sprintf("root %s admin %s added", rc.Root.Hex(), admin.Hex()))
+			}
+			delete(admins, admin)
+		}
+		for _, admin := range prev.Admins {
+			if admins[admin] {
+				diff = append(diff, fmt.Sprintf("root %s admin %s removed", rc.Root.Hex(), admin.Hex()))
+			}
+		}
+		before, _ := json.Marshal(prev.Auditors)
+		after, _ := json.Marshal(rc.Auditors)
+		if !bytes.Equal(before, after) {
+			diff = append(diff, fmt.Sprintf("root %s auditors %v -> %v", rc.Root.Hex(), prev.Auditors, rc.Auditors))
+		}
+		if prev.UserIDScheme() != rc.UserIDScheme() {
+			diff = append(diff, fmt.Sprintf("root %s user ids %s -> %s", rc.Root.Hex(), prev.UserIDScheme(), rc.UserIDScheme()))
+		}
+		before, _ = json.Marshal(prev.DappPaths)
+		after, _ = json.Marshal(rc.DappPaths)
+		if prev.Path != rc.Path || !bytes.Equal(before, after) {
+			diff = append(diff, fmt.Sprintf("root %s paths %q %s -> %q %s, for new users", rc.Root.Hex(), prev.Path, before, rc.Path, after))
+		}
+		if prev.Threshold() != rc.Threshold() {
+			diff = append(diff, fmt.Sprintf("root %s quorum %d -> %d", rc.Root.Hex(), prev.Threshold(), rc.Threshold()))
+		}
+		before, _ = json.Marshal(prev.Limits)
+		after, _ = json.Marshal(rc.Limits)
+		if !bytes.Equal(before, after) {
+			diff = append(diff, fmt.Sprintf("root %s limits %s -> %s", rc.Root.Hex(), before, after))
+		}
+	}
+	for _, rc := range old.Config {
+		if _, removed := roots[rc.Root]; removed {
+			diff = append(diff, fmt.Sprintf("root %s removed", rc.Root.Hex()))
+		}
+	}
+	before, _ := json.Marshal(old.Redaction())
+	after, _ := json.Marshal(new.Redaction())
+	if !bytes.Equal(before, after) {
+		diff = append(diff, fmt.Sprintf("audit redaction %s -> %s", before, after))
+	}
+	if old.AuditRotation() != new.AuditRotation() {
+		var before, after AuditConfig
+		if old.Audit != nil {
+			before = AuditConfig{Rotate: old.Audit.Rotate, Retain: old.Audit.Retain}
+		}
+		if new.Audit != nil {
+			after = AuditConfig{Rotate: new.Audit.Rotate, Retain: new.Audit.Retain}
+		}
+		b, _ := json.Marshal(before)
+		a, _ := json.Marshal(after)
+		diff = append(diff, fmt.Sprintf("audit rotation %s -> %s", b, a))
+	}
+	before, _ = json.Marshal(old.AuditForward())
+	after, _ = json.Marshal(new.AuditForward())
+	if !bytes.Equal(before, after) {
+		diff = append(diff, fmt.Sprintf("audit forwarding %s -> %s", before, after))
+	}
+	return diff
 }
 
 func LoadNodesJSON(file string) Config {
@@ -42,6 +503,9 @@ func WriteNodesJSON(file string, config Config) {
 		}
 	}
 
+	if config.Version == 0 {
+		config.Version = ConfigVersion
+	}
 	nodesJSON, err := json.MarshalIndent(config, "", jsonIndent)
 	if err != nil {
 		log.Info("writeNodesJSON MarshalIndent", "error", err)
@@ -3,7 +3,9 @@ package types
 import (
 	"ethereum/keyservice/common"
 	"ethereum/keyservice/crypto"
+	"ethereum/keyservice/services/truekey/audit"
 	"fmt"
+	"strings"
 	"testing"
 )
 
@@ -24,9 +26,9 @@ func TestWriteNodes(t *testing.T) {
 	fmt.Println("configAdmins", configAdmins, " configAdmins ", configAdmins.RpcPort, configAdmins.RpcAddr, configAdmins.Config)
 
 	WriteNodesJSON("config.json", Config{
-		8985,
-		"127.0.0.1",
-		[]RootConfig{
+		RpcPort: 8985,
+		RpcAddr: "127.0.0.1",
+		Config: []RootConfig{
 			{
 				Root: root1,
 				Admins: []common.Address{
@@ -42,3 +44,88 @@ func TestWriteNodes(t *testing.T) {
 		},
 	})
 }
+
+func TestConfigValidate(t *testing.T) {
+	root, admin := common.HexToAddress("0x01"), common.HexToAddress("0x02")
+	tests := []struct {
+		config Config
+		valid  bool
+	}{
+		{Config{Config: []RootConfig{{Root: root, Admins: []common.Address{admin}}}}, true},
+		{Config{Config: []RootConfig{{Root: root}}}, false},
+		{Config{Config: []RootConfig{{Admins: []common.Address{admin}}}}, false},
+		{Config{Config: []RootConfig{{Root: root, Admins: []common.Address{{}}}}}, false},
+		{Config{Config: []RootConfig{{Root: root, Admins: []common.Address{admin}, Quorum: 2}}}, false},
+		{Config{Config: []RootConfig{{Root: root, Admins: []common.Address{admin}}, {Root: root, Admins: []common.Address{admin}}}}, false},
+		{Config{Config: []RootConfig{{Root: root, Admins: []common.Address{admin, admin}}}}, false},
+		{Config{Config: []RootConfig{{Root: root, Admins: []common.Address{admin}, Limits: &LimitConfig{Dapp: WindowLimits{Day: &Limit{}}}}}}, false},
+		{Config{Config: []RootConfig{{Root: root, Admins: []common.Address{admin}, Limits: &LimitConfig{Dapp: WindowLimits{Day: &Limit{Count: 5}}}}}}, true},
+		{Config{Config: []RootConfig{{Root: root, Admins: []common.Address{admin}, Auditors: []common.Address{common.HexToAddress("0x03")}}}}, true},
+		{Config{Config: []RootConfig{{Root: root, Admins: []common.Address{admin}, Auditors: []common.Address{admin, admin}}}}, false},
+		{Config{Config: []RootConfig{{Root: root, Admins: []common.Address{admin}, UserIDs: UserIDsIndex}}}, true},
+		{Config{Config: []RootConfig{{Root: root, Admins: []common.Address{admin}, UserIDs: "uuid"}}}, false},
+		{Config{Config: []RootConfig{{Root: root, Admins: []common.Address{admin}, Path: "m/44'/246'/{account}'/0/{index}'", DappPaths: map[string]PathTemplate{"138000": "m/44'/246'/{account}'/1/{index}"}}}}, true},
+		{Config{Config: []RootConfig{{Root: root, Admins: []common.Address{admin}, Path: "m/44'/246'/0'/0/{index}"}}}, false},
+		{Config{Config: []RootConfig{{Root: root, Admins: []common.Address{admin}, Path: "m/44'/246'/{account}/0/{index}"}}}, false},
+		{Config{Config: []RootConfig{{Root: root, Admins: []common.Address{admin}, Path: "m/44'/246'/{account}'/{index}/0"}}}, false},
+		{Config{Config: []RootConfig{{Root: root, Admins: []common.Address{admin}, Path: "44'/246'/{account}'/0/{index}"}}}, false},
+		{Config{Config: []RootConfig{{Root: root, Admins: []common.Address{admin}, Path: "m/44'/x/{account}'/0/{index}"}}}, false},
+		{Config{Config: []RootConfig{{Root: root, Admins: []common.Address{admin}, DappPaths: map[string]PathTemplate{"dapp": DefaultPathTemplate}}}}, false},
+		{Config{Version: ConfigVersion + 1}, false},
+		{Config{RpcPort: 65536}, false},
+		{Config{RpcAddr: "admin.example.com", RpcPort: 8985}, true},
+		{Config{RpcAddr: "not a host"}, false},
+		{Config{Audit: &AuditConfig{Redact: map[string]string{"userId": "keep", "caller.remote": "mask"}}}, true},
+		{Config{Audit: &AuditConfig{Redact: map[string]string{"userId": "encrypt"}}}, false},
+		{Config{Audit: &AuditConfig{Rotate: &AuditRotateConfig{MaxSizeMB: 100, Compress: true}, Retain: &AuditRetainConfig{Days: 365}}}, true},
+		{Config{Audit: &AuditConfig{Retain: &AuditRetainConfig{Files: -1}}}, false},
+		{Config{Audit: &AuditConfig{Forward: []audit.Forward{{Type: "syslog"}, {Type: "syslog", Network: "udp", Addr: "10.0.0.1:514"}, {Type: "file", Path: "/var/log/audit.log"}}}}, true},
+		{Config{Audit: &AuditConfig{Forward: []audit.Forward{{Type: "syslog", Network: "tcp"}}}}, false},
+		{Config{Audit: &AuditConfig{Forward: []audit.Forward{{Type: "kafka"}}}}, false},
+	}
+	for i, tt := range tests {
+		if err := tt.config.Validate(); (err == nil) != tt.valid {
+			t.Errorf("test %d: have %v, want valid %v", i, err, tt.valid)
+		}
+	}
+}
+
+func TestDiffConfig(t *testing.T) {
+	root1, root2 := common.HexToAddress("0x01"), common.HexToAddress("0x02")
+	admin1, admin2 := common.HexToAddress("0x11"), common.HexToAddress("0x12")
+
+	old := Config{RpcPort: 8985, Config: []RootConfig{{Root: root1, Admins: []common.Address{admin1}}}}
+	if diff := DiffConfig(old, old); len(diff) != 0 {
+		t.Fatalf("unchanged config: %v", diff)
+	}
+	// admin2 added, which raises the quorum, and root2 added
+	added := Config{RpcPort: 8985, Config: []RootConfig{
+		{Root: root1, Admins: []common.Address{admin1, admin2}},
+		{Root: root2, Admins: []common.Address{admin1}},
+	}}
+	if diff := DiffConfig(old, added); len(diff) != 3 {
+		t.Fatalf("added: have %v", diff)
+	}
+	// endpoint changed, both roots removed
+	if diff := DiffConfig(added, Config{RpcPort: 8986}); len(diff) != 3 {
+		t.Fatalf("removed: have %v", diff)
+	}
+}
+
+func TestParseConfig(t *testing.T) {
+	if _, err := ParseConfig([]byte(`{"version": 1, "admins": [{"root": "0x01", "admin": []}]}`)); err == nil {
+		t.Fatal("short root address accepted")
+	}
+	_, err := ParseConfig([]byte(`{"version": 1, "admins": [{"root": "0x0000000000000000000000000000000000000001", "admin": []}]}`))
+	if err == nil || !strings.Contains(err.Error(), `unknown field "admin"`) {
+		t.Fatalf("misspelt field: have %v", err)
+	}
+	_, err = ParseConfig([]byte("{\n  \"rpcport\": \"8985\"\n}"))
+	if err == nil || !strings.HasPrefix(err.Error(), "line 2:") {
+		t.Fatalf("wrong type: have %v, want the line", err)
+	}
+	config, err := ParseConfig([]byte(`{"version": 1, "rpcport": 8985, "admins": []}`))
+	if err != nil || config.Version != 1 || config.RpcPort != 8985 {
+		t.Fatalf("valid config: have %+v %v", config, err)
+	}
+}
@@ -0,0 +1,186 @@
+package types
+
+import (
+	"encoding/json"
+	"errors"
+	"ethereum/keyservice/common"
+	"ethereum/keyservice/common/hexutil"
+	"ethereum/keyservice/crypto"
+	"fmt"
+	"net"
+	"strings"
+)
+
+var (
+	ErrDappAuthExpired = errors.New("dapp request expired")
+	ErrDappSignError   = errors.New("dapp sign error")
+	ErrDappReplay      = errors.New("dapp call already made")
+	ErrDappFull        = errors.New("dapp has no free index left")
+)
+
+// maxDappNameLength bounds the name of a dapp, it is used as a metrics label.
+const maxDappNameLength = 64
+
+// DappSettings is what the admins of a root configure for a dapp.
+type DappSettings struct {
+	// Name identifies the dapp to humans, in metrics and the audit log
+	Name string `json:"name"`
+	// Key is the address whose signature authorises the calls of the dapp
+	Key common.Address `json:"key"`
+	// Admins may approve and deny the escalated requests of the dapp, next to
+	// the admins of the root
+	Admins []common.Address `json:"admins,omitempty"`
+	// Allowlist holds the IP addresses and CIDR ranges the dapp may call
+	// from, any if empty
+	Allowlist []string `json:"allowlist,omitempty"`
+	// Policy caps the decision of the root policy: escalate sends every
+	// request of the dapp to the admins, reject suspends the dapp
+	Policy Decision `json:"policy,omitempty"`
+	// Limits replace the dapp limits of the root for this dapp
+	Limits *WindowLimits `json:"limits,omitempty"`
+	// Path is the derivation path template of new users, the one of the
+	// root by default
+	Path PathTemplate `json:"path,omitempty"`
+}
+
+// Dapp is a tenant of a root. Its users live under a hardened account of
+// their own and are only reachable through calls signed by the dapp.
+type Dapp struct {
+	DappSettings
+	Root    common.Address `json:"root"`
+	Account uint32         `json:"account"`
+	// Users is the number of indexes allocated under the account so far
+	Users     uint64         `json:"users"`
+	CreatedAt hexutil.Uint64 `json:"createdAt"`
+}
+
+// Check fails on settings a dapp cannot be served with.
+func (s DappSettings) Check() error {
+	if s.Name == "" || len(s.Name) > maxDappNameLength {
+		return fmt.Errorf("dapp name must be 1..%d bytes", maxDappNameLength)
+	}
+	if s.Key == (common.Address{}) {
+		return errors.New("dapp key missing")
+	}
+	for _, admin := range s.Admins {
+		if admin == (common.Address{}) {
+			return errors.New("dapp admin missing address")
+		}
+	}
+	for _, entry := range s.Allowlist {
+		if strings.Contains(entry, "/") {
+			if _, _, err := net.ParseCIDR(entry); err != nil {
+				return fmt.Errorf("allowlist: %v", err)
+			}
+		} else if net.ParseIP(entry) == nil {
+			return fmt.Errorf("allowlist: %q is neither an IP address nor a CIDR range", entry)
+		}
+	}
+	switch s.Policy {
+	case "", DecisionApprove, DecisionEscalate, DecisionReject:
+	default:
+		return fmt.Errorf("dapp policy %q is neither %q, %q nor %q", s.Policy, DecisionApprove, DecisionEscalate, DecisionReject)
+	}
+	if s.Limits != nil {
+		var problems configProblems
+		s.Limits.validate(&problems, "limits")
+		if err := problems.err(); err != nil {
+			return err
+		}
+	}
+	if s.Path != "" {
+		if err := s.Path.Check(); err != nil {
+			return fmt.Errorf("path: %v", err)
+		}
+	}
+	return nil
+}
+
+// IsAdmin reports whether addr is an admin of the dapp.
+func (d *Dapp) IsAdmin(addr common.Address) bool {
+	for _, admin := range d.Admins {
+		if admin == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// Allows reports whether the dapp may call from remote, an address with or
+// without a port.
+func (d *Dapp) Allows(remote string) bool {
+	if len(d.Allowlist) == 0 {
+		return true
+	}
+	if host, _, err := net.SplitHostPort(remote); err == nil {
+		remote = host
+	}
+	ip := net.ParseIP(remote)
+	if ip == nil {
+		return false
+	}
+	for _, entry := range d.Allowlist {
+		if _, ipNet, err := net.ParseCIDR(entry); err == nil {
+			if ipNet.Contains(ip) {
+				return true
+			}
+		} else if allowed := net.ParseIP(entry); allowed != nil && allowed.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Cap returns the stricter of decision and the policy of the dapp.
+func (d *Dapp) Cap(decision Decision) Decision {
+	switch {
+	case decision == DecisionReject || d.Policy == DecisionReject:
+		return DecisionReject
+	case decision == DecisionEscalate || d.Policy == DecisionEscalate:
+		return DecisionEscalate
+	}
+	return decision
+}
+
+// DappAuth authorises a dapp facing call for the users of a dapp. The signature
+// is made by the key of the dapp over DappCallHash of the call. The nonce tells
+// apart calls made with the same params in the same second, each is accepted once.
+type DappAuth struct {
+	Root      common.Address `json:"root"`
+	Dapp      uint32         `json:"dapp"`
+	CreatedAt hexutil.Uint64 `json:"createdAt"`
+	Nonce     hexutil.Uint64 `json:"nonce"`
+	Signature hexutil.Bytes  `json:"signature"`
+}
+
+// DappCallHash returns the hash a dapp signs to authorise method with params.
+// The params are hashed in their json encoding, which is what travels over RPC.
+func DappCallHash(method string, root common.Address, dapp uint32, createdAt, nonce uint64, params ...interface{}) common.Hash {
+	if params == nil {
+		params = []interface{}{}
+	}
+	data, _ := json.Marshal(params)
+	return rlpHash([]interface{}{
+		method,
+		root,
+		dapp,
+		createdAt,
+		nonce,
+		data,
+	})
+}
+
+// Hash returns the hash the dapp signed to authorise method with params.
+func (a DappAuth) Hash(method string, params ...interface{}) common.Hash {
+	return DappCallHash(method, a.Root, a.Dapp, uint64(a.CreatedAt), uint64(a.Nonce), params...)
+}
+
+// Signer recovers the address that signed the call.
+func (a DappAuth) Signer(method string, params ...interface{}) (common.Address, error) {
+	hash := a.Hash(method, params...)
+	pub, err := crypto.SigToPub(hash.Bytes(), a.Signature)
+	if err != nil {
+		return common.Address{}, ErrDappSignError
+	}
+	return crypto.PubkeyToAddress(*pub), nil
+}
@@ -13,7 +13,6 @@ import (
 	"ethereum/keyservice/log"
 	"ethereum/keyservice/rlp"
 	"io"
-	"strconv"
 	"time"
 )
 
@@ -158,23 +157,30 @@ func (i *DappIdentify) EncodeRLP(w io.Writer) error {
 	})
 }
 
+// ChildAccount is an account registered for a user. ID is the internal user id,
+// never the id the dapp sent. Template is the path template the account was
+// derived from, empty for accounts derived before templates.
 type ChildAccount struct {
-	ID         uint64           `json:"id"`
+	ID         common.Hash      `json:"id"`
 	Account    accounts.Account `json:"account"`
+	Template   PathTemplate     `json:"template,omitempty"`
 	PrivateKey *ecdsa.PrivateKey
 }
 
 func (c *ChildAccount) String() string {
 	var ss string
-	ss += "[ID:" + strconv.FormatUint(c.ID, 10)
+	ss += "[ID:" + c.ID.Hex()
 	ss += " address:" + c.Account.Address.String() + " URL:" + c.Account.URL.String() + " ]"
 	return ss
 }
 
-// "external" ChildAccount encoding. used for pos hd.
+// "external" ChildAccount encoding. used for pos hd. ID is kept as bytes, as
+// accounts stored before internal ids hold the user id as a number. The
+// template is optional, accounts stored before templates have none.
 type extChildAccount struct {
-	ID      uint64           `json:"id"`
-	Account accounts.Account `json:"account"`
+	ID       []byte           `json:"id"`
+	Account  accounts.Account `json:"account"`
+	Template []PathTemplate   `json:"template" rlp:"tail"`
 }
 
 func (i *ChildAccount) DecodeRLP(s *rlp.Stream) error {
@@ -182,15 +188,22 @@ func (i *ChildAccount) DecodeRLP(s *rlp.Stream) error {
 	if err := s.Decode(&ei); err != nil {
 		return err
 	}
-	i.ID, i.Account = ei.ID, ei.Account
+	i.ID, i.Account = common.BytesToHash(ei.ID), ei.Account
+	if len(ei.Template) > 0 {
+		i.Template = ei.Template[0]
+	}
 	return nil
 }
 
 // EncodeRLP serializes b into the truechain RLP AdminWallet format.
 func (i *ChildAccount) EncodeRLP(w io.Writer) error {
 
-	return rlp.Encode(w, extChildAccount{
-		ID:      i.ID,
+	ext := extChildAccount{
+		ID:      i.ID.Bytes(),
 		Account: i.Account,
-	})
+	}
+	if i.Template != "" {
+		ext.Template = []PathTemplate{i.Template}
+	}
+	return rlp.Encode(w, ext)
 }
@@ -0,0 +1,28 @@
+package types
+
+import (
+	"errors"
+	"ethereum/keyservice/common"
+	"ethereum/keyservice/common/hexutil"
+)
+
+var (
+	ErrSigningFrozen = errors.New("signing frozen")
+	ErrFreezeOwner   = errors.New("signing frozen by the admins of another root")
+)
+
+// Freeze records who stopped signing and why. Root is the root whose admins
+// froze, it is zero for freezes stored before it was recorded.
+type Freeze struct {
+	Reason string           `json:"reason"`
+	By     []common.Address `json:"by"`
+	At     hexutil.Uint64   `json:"at"`
+	Root   common.Address   `json:"root"`
+}
+
+// FreezeStatus reports the global freeze and the freeze of a single root, a nil
+// entry is not frozen.
+type FreezeStatus struct {
+	Global *Freeze `json:"global,omitempty"`
+	Root   *Freeze `json:"root,omitempty"`
+}
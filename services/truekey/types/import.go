@@ -0,0 +1,15 @@
+package types
+
+import "ethereum/keyservice/common"
+
+// MaxImportUsers bounds the user ids of a single import call.
+const MaxImportUsers = 10000
+
+// ImportedAccount is the account of a user of a bulk import. New is unset for
+// users registered before, by an earlier run of the import or otherwise.
+type ImportedAccount struct {
+	UserID  UserID         `json:"userId"`
+	Address common.Address `json:"address"`
+	Path    string         `json:"path"`
+	New     bool           `json:"new"`
+}
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"ethereum/keyservice/common"
 	"ethereum/keyservice/common/hexutil"
+	"ethereum/keyservice/rpc"
 	"fmt"
 	"math/big"
 	"strconv"
@@ -41,24 +42,55 @@ type ClentQuest struct {
 type ServerAPI interface {
 	// Register a admin
 	RegisterDapp(ctx context.Context, quest AdminQuest, encryMessage EncryptMessage) (*EncryptMessage, error)
-	// Register a account
-	RegisterAccount(ctx context.Context, phone string) (common.Address, error)
+	// Register a account, for the users of a dapp if auth is set
+	RegisterAccount(ctx context.Context, userId string, auth *DappAuth) (common.Address, error)
 	// auth admin
 	AuthPub(ctx context.Context, quest AdminQuest, auth AuthQuest) (*EncryptMessage, error)
+	// PreviewAccounts returns the accounts users would receive, without registering them
+	PreviewAccounts(ctx context.Context, request string, auth *DappAuth) ([]*PreviewAccount, error)
 	// SignHash request to sign the specified transaction
 	SignHash(ctx context.Context, dappid common.Hash, addr common.Address, id common.Hash, encryMessage EncryptMessage) (*EncryptMessage, error)
 	// SignHash request to sign the specified hash no crypto data , data hexutil.Bytes ClentQuest
-	SignHashPlain(ctx context.Context, tx string) (hexutil.Bytes, error)
+	SignHashPlain(ctx context.Context, tx string, auth *DappAuth) (hexutil.Bytes, error)
+	// PendingResult reports the state of a request escalated for admin approval
+	PendingResult(ctx context.Context, id common.Hash, auth *DappAuth) (*PendingResult, error)
+	// PendingDecision notifies once the admins decided an escalated request
+	PendingDecision(ctx context.Context, id common.Hash, auth *DappAuth) (*rpc.Subscription, error)
+	// Status reports whether the service is able to sign
+	Status(ctx context.Context) (*Status, error)
 	// Version info about the APIs
 	Version(ctx context.Context) (string, error)
 }
 
-type Phone struct {
-	Phone int64 `json:"userId"`
+// UserID is the id a dapp knows a user by, such as a phone number, an email
+// address or a uuid. It is sent as a JSON string, or as a number.
+type UserID string
+
+// UnmarshalJSON accepts a string or a non-negative integer.
+func (id *UserID) UnmarshalJSON(input []byte) error {
+	if len(input) > 0 && input[0] == '"' {
+		var s string
+		if err := json.Unmarshal(input, &s); err != nil {
+			return err
+		}
+		*id = UserID(s)
+		return nil
+	}
+	n, err := strconv.ParseUint(string(input), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid user id %s", input)
+	}
+	*id = UserID(strconv.FormatUint(n, 10))
+	return nil
+}
+
+// User is the account registration request of a dapp.
+type User struct {
+	UserID UserID `json:"userId"`
 }
 
 type SignTx struct {
-	Phone    uint64         `json:"userId"`
+	UserID   UserID         `json:"userId"`
 	To       common.Address `json:"to"`
 	Value    *big.Int       `json:"value"`
 	GasPrice uint64         `json:"gasPrice"`
@@ -100,7 +132,7 @@ type SignTx struct {
 // UnmarshalJSON unmarshals from JSON.
 func (h *SignTx) UnmarshalJSON(input []byte) error {
 	type SignTx struct {
-		Phone    *int64          `json:"userId"`
+		UserID   *UserID         `json:"userId"`
 		To       *common.Address `json:"to"`
 		Value    *string         `json:"value"`
 		GasPrice *int64          `json:"gasPrice"`
@@ -115,17 +147,17 @@ func (h *SignTx) UnmarshalJSON(input []byte) error {
 		fmt.Println("UnmarshalJSON ", err)
 		return err
 	}
-	if dec.Phone == nil {
-		return errors.New("missing required field 'Phone' for SignTx")
+	if dec.UserID == nil {
+		return errors.New("missing required field 'UserID' for SignTx")
 	}
-	h.Phone = uint64(*dec.Phone)
+	h.UserID = *dec.UserID
 	if dec.To != nil {
 		h.To = *dec.To
 	}
 	if dec.Value != nil {
-		r, result := new(big.Int).SetString("15151545445646", 10)
-		if result {
-			return errors.New("missing required field 'Value' can't SetString")
+		r, ok := new(big.Int).SetString(*dec.Value, 0)
+		if !ok {
+			return errors.New("invalid field 'Value' for SignTx")
 		}
 		h.Value = r
 	}
@@ -0,0 +1,196 @@
+package types
+
+import (
+	"encoding/json"
+	"errors"
+	"ethereum/keyservice/common"
+	"ethereum/keyservice/crypto"
+	"fmt"
+	"math/big"
+)
+
+var (
+	ErrLimitExceeded = errors.New("spending limit reached")
+	ErrUsageScope    = errors.New("usage scope needs exactly one of account or dapp")
+)
+
+const (
+	minuteSeconds = 60
+	hourSeconds   = 60 * minuteSeconds
+	daySeconds    = 24 * hourSeconds
+	monthSeconds  = 30 * daySeconds
+)
+
+// Limit caps the transferred value and the number of transactions within a
+// window. A nil Value or a zero Count leaves that dimension unlimited.
+type Limit struct {
+	Value *big.Int `json:"value,omitempty"`
+	Count uint64   `json:"count,omitempty"`
+}
+
+// WindowLimits holds the limits of the rolling hour, day and month windows.
+type WindowLimits struct {
+	Hour  *Limit `json:"hour,omitempty"`
+	Day   *Limit `json:"day,omitempty"`
+	Month *Limit `json:"month,omitempty"`
+}
+
+// LimitConfig is the spending limit section of a root. Account limits apply to
+// every child account, dapp limits to the aggregate of a dapp's accounts.
+type LimitConfig struct {
+	Account WindowLimits `json:"account"`
+	Dapp    WindowLimits `json:"dapp"`
+}
+
+// AdminLimits are the spending limits admins set for a root, with the hash of
+// the config limits they replaced. They apply until the config limits change.
+type AdminLimits struct {
+	Limits LimitConfig `json:"limits"`
+	Config common.Hash `json:"config"`
+}
+
+// LimitsHash identifies the limits of a root config, nil included.
+func LimitsHash(limits *LimitConfig) common.Hash {
+	data, _ := json.Marshal(limits)
+	return crypto.Keccak256Hash(data)
+}
+
+// UsageScope selects the counters of a single account or a single dapp.
+type UsageScope struct {
+	Account *common.Address `json:"account,omitempty"`
+	Dapp    *uint64         `json:"dapp,omitempty"`
+}
+
+// Validate checks exactly one scope is selected.
+func (s UsageScope) Validate() error {
+	if (s.Account == nil) == (s.Dapp == nil) {
+		return ErrUsageScope
+	}
+	return nil
+}
+
+// Key returns the database key of the scope's counters under root.
+func (s UsageScope) Key(root common.Address) common.Hash {
+	if s.Account != nil {
+		return AccountUsageKey(*s.Account)
+	}
+	return DappUsageKey(root, *s.Dapp)
+}
+
+// AccountUsageKey is the usage key of a child account.
+func AccountUsageKey(account common.Address) common.Hash {
+	return crypto.Keccak256Hash([]byte("account"), account.Bytes())
+}
+
+// DappUsageKey is the usage key of a dapp under root.
+func DappUsageKey(root common.Address, dapp uint64) common.Hash {
+	return crypto.Keccak256Hash([]byte("dapp"), root.Bytes(), new(big.Int).SetUint64(dapp).Bytes())
+}
+
+// UsageReport is the current spending of a scope next to its limits.
+type UsageReport struct {
+	Scope  UsageScope   `json:"scope"`
+	Hour   Limit        `json:"hour"`
+	Day    Limit        `json:"day"`
+	Month  Limit        `json:"month"`
+	Limits WindowLimits `json:"limits"`
+}
+
+// UsageBucket accumulates the transactions of one time slot.
+type UsageBucket struct {
+	Start uint64
+	Count uint64
+	Value *big.Int
+}
+
+// Usage tracks spending in rolling windows. The hour window is made of minute
+// buckets, the day of hour buckets and the month of day buckets, so a window
+// is exact up to the granularity of its buckets.
+type Usage struct {
+	Minutes []UsageBucket
+	Hours   []UsageBucket
+	Days    []UsageBucket
+}
+
+// NewUsage returns empty counters.
+func NewUsage() *Usage {
+	return &Usage{
+		Minutes: newBuckets(hourSeconds / minuteSeconds),
+		Hours:   newBuckets(daySeconds / hourSeconds),
+		Days:    newBuckets(monthSeconds / daySeconds),
+	}
+}
+
+func newBuckets(n int) []UsageBucket {
+	buckets := make([]UsageBucket, n)
+	for i := range buckets {
+		buckets[i].Value = new(big.Int)
+	}
+	return buckets
+}
+
+// Add records a transaction of value at unix time now.
+func (u *Usage) Add(now uint64, value *big.Int) {
+	addBucket(u.Minutes, minuteSeconds, now, value)
+	addBucket(u.Hours, hourSeconds, now, value)
+	addBucket(u.Days, daySeconds, now, value)
+}
+
+func addBucket(buckets []UsageBucket, granularity, now uint64, value *big.Int) {
+	start := now - now%granularity
+	b := &buckets[(now/granularity)%uint64(len(buckets))]
+	if b.Start != start || b.Value == nil {
+		b.Start, b.Count, b.Value = start, 0, new(big.Int)
+	}
+	b.Count++
+	if value != nil {
+		b.Value.Add(b.Value, value)
+	}
+}
+
+func sumBuckets(buckets []UsageBucket, window, now uint64) Limit {
+	total := Limit{Value: new(big.Int)}
+	for _, b := range buckets {
+		if b.Value == nil || b.Start > now || b.Start+window <= now {
+			continue
+		}
+		total.Count += b.Count
+		total.Value.Add(total.Value, b.Value)
+	}
+	return total
+}
+
+// Hour returns the spending of the last hour.
+func (u *Usage) Hour(now uint64) Limit { return sumBuckets(u.Minutes, hourSeconds, now) }
+
+// Day returns the spending of the last day.
+func (u *Usage) Day(now uint64) Limit { return sumBuckets(u.Hours, daySeconds, now) }
+
+// Month returns the spending of the last thirty days.
+func (u *Usage) Month(now uint64) Limit { return sumBuckets(u.Days, monthSeconds, now) }
+
+// Check returns an error naming the first window whose limit would be
+// exceeded by one more transaction of value.
+func (u *Usage) Check(limits WindowLimits, now uint64, value *big.Int) error {
+	windows := []struct {
+		name  string
+		limit *Limit
+		used  Limit
+	}{
+		{"hour", limits.Hour, u.Hour(now)},
+		{"day", limits.Day, u.Day(now)},
+		{"month", limits.Month, u.Month(now)},
+	}
+	for _, w := range windows {
+		if w.limit == nil {
+			continue
+		}
+		if w.limit.Count != 0 && w.used.Count+1 > w.limit.Count {
+			return fmt.Errorf("%w: %s transaction count %d", ErrLimitExceeded, w.name, w.limit.Count)
+		}
+		if w.limit.Value != nil && value != nil && new(big.Int).Add(w.used.Value, value).Cmp(w.limit.Value) > 0 {
+			return fmt.Errorf("%w: %s value %v", ErrLimitExceeded, w.name, w.limit.Value)
+		}
+	}
+	return nil
+}
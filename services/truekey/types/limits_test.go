@@ -0,0 +1,54 @@
+package types
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+)
+
+func TestUsageWindows(t *testing.T) {
+	usage := NewUsage()
+	start := uint64(1600000000)
+
+	usage.Add(start, big.NewInt(10))
+	usage.Add(start+30*minuteSeconds, big.NewInt(20))
+	usage.Add(start+2*hourSeconds, big.NewInt(40))
+
+	now := start + 2*hourSeconds
+	if hour := usage.Hour(now); hour.Count != 1 || hour.Value.Int64() != 40 {
+		t.Errorf("hour window: have %d/%v, want 1/40", hour.Count, hour.Value)
+	}
+	if day := usage.Day(now); day.Count != 3 || day.Value.Int64() != 70 {
+		t.Errorf("day window: have %d/%v, want 3/70", day.Count, day.Value)
+	}
+	now = start + 2*daySeconds
+	if day := usage.Day(now); day.Count != 0 {
+		t.Errorf("expired day window: have %d, want 0", day.Count)
+	}
+	if month := usage.Month(now); month.Count != 3 || month.Value.Int64() != 70 {
+		t.Errorf("month window: have %d/%v, want 3/70", month.Count, month.Value)
+	}
+}
+
+func TestUsageCheck(t *testing.T) {
+	usage := NewUsage()
+	now := uint64(1600000000)
+	limits := WindowLimits{
+		Hour: &Limit{Count: 2},
+		Day:  &Limit{Value: big.NewInt(100)},
+	}
+	if err := usage.Check(limits, now, big.NewInt(60)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	usage.Add(now, big.NewInt(60))
+	if err := usage.Check(limits, now, big.NewInt(60)); !errors.Is(err, ErrLimitExceeded) {
+		t.Fatalf("day value: have %v, want %v", err, ErrLimitExceeded)
+	}
+	usage.Add(now, big.NewInt(1))
+	if err := usage.Check(limits, now, big.NewInt(1)); !errors.Is(err, ErrLimitExceeded) {
+		t.Fatalf("hour count: have %v, want %v", err, ErrLimitExceeded)
+	}
+	if err := usage.Check(WindowLimits{}, now, big.NewInt(1000)); err != nil {
+		t.Fatalf("unlimited: unexpected error %v", err)
+	}
+}
@@ -0,0 +1,96 @@
+package types
+
+import (
+	"errors"
+	"ethereum/keyservice/accounts"
+	"fmt"
+	"strings"
+)
+
+const (
+	accountPlaceholder = "{account}"
+	indexPlaceholder   = "{index}"
+
+	// DefaultPathTemplate derives the paths the service always derived.
+	DefaultPathTemplate PathTemplate = "m/44'/60'/{account}'/0/{index}"
+)
+
+// PathTemplate is a derivation path with the account and index of a user left
+// as placeholders, e.g. "m/44'/246'/{account}'/0/{index}". The account is a
+// hardened level of its own, so dapps never share a branch. The index is the
+// last level, hardened if the template marks it so.
+type PathTemplate string
+
+// Check fails on a template that does not place the account and index as
+// above, or that is no derivation path once they are filled in.
+func (t PathTemplate) Check() error {
+	s := string(t)
+	if strings.Count(s, accountPlaceholder) != 1 || strings.Count(s, indexPlaceholder) != 1 {
+		return fmt.Errorf("%q needs %s and %s once each", s, accountPlaceholder, indexPlaceholder)
+	}
+	components := strings.Split(s, "/")
+	account := -1
+	for i, component := range components {
+		if strings.Contains(component, accountPlaceholder) {
+			account = i
+			if strings.TrimSpace(component) != accountPlaceholder+"'" {
+				return fmt.Errorf("%q: %s must be a hardened level of its own", s, accountPlaceholder)
+			}
+		}
+	}
+	last := strings.TrimSpace(components[len(components)-1])
+	if last != indexPlaceholder && last != indexPlaceholder+"'" {
+		return fmt.Errorf("%q: %s must be the last level", s, indexPlaceholder)
+	}
+	if account == len(components)-1 {
+		return fmt.Errorf("%q: %s must come before %s", s, accountPlaceholder, indexPlaceholder)
+	}
+	if strings.TrimSpace(components[0]) != "m" {
+		return errors.New("path template must be absolute, starting with m/")
+	}
+	if _, err := t.Path(0, 0); err != nil {
+		return fmt.Errorf("%q: %v", s, err)
+	}
+	return nil
+}
+
+// Path fills in the account and index of a user.
+func (t PathTemplate) Path(account, index uint32) (accounts.DerivationPath, error) {
+	s := strings.Replace(string(t), accountPlaceholder, fmt.Sprint(account), 1)
+	s = strings.Replace(s, indexPlaceholder, fmt.Sprint(index), 1)
+	return accounts.ParseDerivationPath(s)
+}
+
+// PublicBranch splits the path of account into the branch ending in the last
+// hardened level, which takes the private key to derive, and the template of
+// the levels below it, e.g. "m/44'/60'/5'" and "0/{index}". The users derive
+// from the public key of the branch, unless the index is hardened.
+func (t PathTemplate) PublicBranch(account uint32) (accounts.DerivationPath, string, error) {
+	components := strings.Split(string(t), "/")
+	if strings.HasSuffix(strings.TrimSpace(components[len(components)-1]), "'") {
+		return nil, "", fmt.Errorf("%q: a hardened %s does not derive from a public key", string(t), indexPlaceholder)
+	}
+	last := 0
+	for i, component := range components[:len(components)-1] {
+		if strings.HasSuffix(strings.TrimSpace(component), "'") {
+			last = i
+		}
+	}
+	branch := strings.Replace(strings.Join(components[:last+1], "/"), accountPlaceholder, fmt.Sprint(account), 1)
+	path, err := accounts.ParseDerivationPath(branch)
+	if err != nil {
+		return nil, "", err
+	}
+	return path, strings.Join(components[last+1:], "/"), nil
+}
+
+// AccountLevel returns the position of the account in the paths of the
+// template, not counting the master key.
+func (t PathTemplate) AccountLevel() int {
+	for i, component := range strings.Split(string(t), "/") {
+		if strings.Contains(component, accountPlaceholder) {
+			return i - 1
+		}
+	}
+	return -1
+}
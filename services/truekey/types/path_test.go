@@ -0,0 +1,45 @@
+package types
+
+import "testing"
+
+func TestPathTemplate(t *testing.T) {
+	rc := RootConfig{DappPaths: map[string]PathTemplate{"138000": "m/44'/246'/{account}'/0/{index}'"}}
+	tests := []struct {
+		account, index uint32
+		want           string
+	}{
+		{0, 7, "m/44'/60'/0'/0/7"},
+		{138000, 7, "m/44'/246'/138000'/0/7'"},
+		{139000, 7, "m/44'/60'/139000'/0/7"},
+	}
+	for _, tt := range tests {
+		path, err := rc.PathTemplate(tt.account).Path(tt.account, tt.index)
+		if err != nil || path.String() != tt.want {
+			t.Errorf("account %d index %d: have %v %v, want %s", tt.account, tt.index, path, err, tt.want)
+		}
+	}
+	if _, err := rc.PathTemplate(138000).Path(138000, 0x80000000); err == nil {
+		t.Error("hardened index out of range accepted")
+	}
+}
+
+func TestPublicBranch(t *testing.T) {
+	tests := []struct {
+		template PathTemplate
+		branch   string
+		children string
+	}{
+		{DefaultPathTemplate, "m/44'/60'/2000000'", "0/{index}"},
+		{"m/44'/60'/{account}'/1'/0/{index}", "m/44'/60'/2000000'/1'", "0/{index}"},
+		{"m/{account}'/{index}", "m/2000000'", "{index}"},
+	}
+	for _, tt := range tests {
+		branch, children, err := tt.template.PublicBranch(2000000)
+		if err != nil || branch.String() != tt.branch || children != tt.children {
+			t.Errorf("%s: have %v %s %v, want %s %s", tt.template, branch, children, err, tt.branch, tt.children)
+		}
+	}
+	if _, _, err := PathTemplate("m/44'/60'/{account}'/0/{index}'").PublicBranch(0); err == nil {
+		t.Error("hardened index accepted")
+	}
+}
@@ -0,0 +1,124 @@
+package types
+
+import (
+	"errors"
+	"ethereum/keyservice/common"
+	"ethereum/keyservice/common/hexutil"
+	"ethereum/keyservice/rlp"
+	"fmt"
+	"io"
+)
+
+var (
+	ErrRequestPending  = errors.New("request pending admin approval")
+	ErrRequestNotFound = errors.New("pending request not found")
+	ErrRequestDecided  = errors.New("request already decided")
+)
+
+// PendingError is returned for a request escalated to the admins. Its data is
+// the pending result, so callers get the id without parsing the message.
+type PendingError struct {
+	ID common.Hash
+}
+
+func (e *PendingError) Error() string {
+	return fmt.Sprintf("%v: %s", ErrRequestPending, e.ID.Hex())
+}
+
+// ErrorData implements rpc.DataError.
+func (e *PendingError) ErrorData() interface{} {
+	return &PendingResult{ID: e.ID, Status: PendingStatusPending}
+}
+
+// Is makes the error match ErrRequestPending.
+func (e *PendingError) Is(target error) bool {
+	return target == ErrRequestPending
+}
+
+// PendingStatus is the state of an escalated request.
+type PendingStatus string
+
+const (
+	PendingStatusPending  PendingStatus = "pending"
+	PendingStatusApproved PendingStatus = "approved"
+	PendingStatusDenied   PendingStatus = "denied"
+	PendingStatusExpired  PendingStatus = "expired"
+)
+
+// PendingRequest is a signing request the policy escalated to the admins. Tx is
+// kept to sign the request on approval, Request is what the admins review.
+type PendingRequest struct {
+	ID        common.Hash      `json:"id"`
+	Tx        SignTx           `json:"-"`
+	Request   TxRequest        `json:"request"`
+	CreatedAt hexutil.Uint64   `json:"createdAt"`
+	Expires   hexutil.Uint64   `json:"expires"`
+	Status    PendingStatus    `json:"status"`
+	Signed    hexutil.Bytes    `json:"signed,omitempty"`
+	Reason    string           `json:"reason,omitempty"`
+	DecidedBy []common.Address `json:"decidedBy,omitempty"`
+}
+
+// PendingResult is what the caller of an escalated request gets to see.
+type PendingResult struct {
+	ID     common.Hash   `json:"id"`
+	Status PendingStatus `json:"status"`
+	Signed hexutil.Bytes `json:"signed,omitempty"`
+	Reason string        `json:"reason,omitempty"`
+}
+
+// Outcome returns the caller view of the request.
+func (r *PendingRequest) Outcome() *PendingResult {
+	return &PendingResult{
+		ID:     r.ID,
+		Status: r.Status,
+		Signed: r.Signed,
+		Reason: r.Reason,
+	}
+}
+
+// "external" PendingRequest encoding. The dapp of the request is optional,
+// requests stored before dapps have none.
+type extPendingRequest struct {
+	ID        common.Hash
+	Tx        SignTx
+	Request   TxRequest
+	CreatedAt hexutil.Uint64
+	Expires   hexutil.Uint64
+	Status    PendingStatus
+	Signed    hexutil.Bytes
+	Reason    string
+	DecidedBy []common.Address
+	Dapp      []uint32 `rlp:"tail"`
+}
+
+func (r *PendingRequest) DecodeRLP(s *rlp.Stream) error {
+	var er extPendingRequest
+	if err := s.Decode(&er); err != nil {
+		return err
+	}
+	r.ID, r.Tx, r.Request, r.CreatedAt, r.Expires = er.ID, er.Tx, er.Request, er.CreatedAt, er.Expires
+	r.Status, r.Signed, r.Reason, r.DecidedBy = er.Status, er.Signed, er.Reason, er.DecidedBy
+	if len(er.Dapp) > 0 {
+		r.Request.Dapp = &er.Dapp[0]
+	}
+	return nil
+}
+
+func (r *PendingRequest) EncodeRLP(w io.Writer) error {
+	er := extPendingRequest{
+		ID:        r.ID,
+		Tx:        r.Tx,
+		Request:   r.Request,
+		CreatedAt: r.CreatedAt,
+		Expires:   r.Expires,
+		Status:    r.Status,
+		Signed:    r.Signed,
+		Reason:    r.Reason,
+		DecidedBy: r.DecidedBy,
+	}
+	if r.Request.Dapp != nil {
+		er.Dapp = []uint32{*r.Request.Dapp}
+	}
+	return rlp.Encode(w, er)
+}
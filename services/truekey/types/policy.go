@@ -0,0 +1,77 @@
+package types
+
+import (
+	"errors"
+	"ethereum/keyservice/common"
+	"ethereum/keyservice/common/hexutil"
+	"strings"
+)
+
+// Decision is the outcome of a policy check.
+type Decision string
+
+const (
+	DecisionApprove  Decision = "approve"
+	DecisionReject   Decision = "reject"
+	DecisionEscalate Decision = "escalate"
+)
+
+var (
+	ErrPolicyReject   = errors.New("request rejected by policy")
+	ErrPolicyEscalate = errors.New("request escalated by policy")
+)
+
+// ParseDecision maps a rule result onto a Decision. Anything that is not a known
+// decision is treated as a rejection.
+func ParseDecision(s string) Decision {
+	switch Decision(strings.ToLower(strings.TrimSpace(s))) {
+	case DecisionApprove:
+		return DecisionApprove
+	case DecisionEscalate:
+		return DecisionEscalate
+	default:
+		return DecisionReject
+	}
+}
+
+// Policy decides whether a register or signing request may proceed.
+type Policy interface {
+	ApproveTx(req *TxRequest) (Decision, error)
+	ApproveRegister(req *RegisterRequest) (Decision, error)
+}
+
+// RequestMeta is the caller information handed to a policy.
+type RequestMeta struct {
+	Remote    string `json:"remote"`
+	Local     string `json:"local"`
+	Scheme    string `json:"scheme"`
+	UserAgent string `json:"userAgent"`
+	Origin    string `json:"origin"`
+}
+
+// RegisterRequest is the policy view of a RegisterAccount call.
+type RegisterRequest struct {
+	Root   common.Address `json:"root"`
+	Dapp   *uint32        `json:"dapp,omitempty"`
+	UserID string         `json:"userId"`
+	Meta   RequestMeta    `json:"meta"`
+}
+
+// TxRequest is the policy view of a SignHashPlain call. Big values are carried
+// as decimal strings so scripts do not lose precision. Dapp is the account of the
+// dapp that signed the call, unset for calls without a dapp.
+type TxRequest struct {
+	Root     common.Address `json:"root"`
+	Dapp     *uint32        `json:"dapp,omitempty" rlp:"-"`
+	UserID   string         `json:"userId"`
+	From     common.Address `json:"from"`
+	To       common.Address `json:"to"`
+	Value    string         `json:"value"`
+	GasPrice uint64         `json:"gasPrice"`
+	GasLimit uint64         `json:"gasLimit"`
+	Nonce    uint64         `json:"nonce"`
+	Data     hexutil.Bytes  `json:"data"`
+	ChainId  uint64         `json:"chainId"`
+	Payment  common.Address `json:"payment"`
+	Meta     RequestMeta    `json:"meta"`
+}
@@ -0,0 +1,47 @@
+package types
+
+import (
+	"errors"
+	"ethereum/keyservice/common"
+	"fmt"
+)
+
+// MaxPreviewAccounts bounds the accounts previewed by a single call.
+const MaxPreviewAccounts = 1000
+
+var ErrPreviewRange = errors.New("index ranges preview the users of a dapp or of the index scheme only")
+
+// PreviewRequest asks for the accounts users would receive if registered now,
+// of the ids in UserIDs, or of Count new users from the allocation index From
+// on, from the next free index if From is unset.
+type PreviewRequest struct {
+	UserIDs []UserID `json:"userIds,omitempty"`
+	From    *uint64  `json:"from,omitempty"`
+	Count   uint64   `json:"count,omitempty"`
+}
+
+// Check fails on requests that ask for both ids and a range, or for too many
+// accounts.
+func (r PreviewRequest) Check() error {
+	if (len(r.UserIDs) == 0) == (r.Count == 0) {
+		return errors.New("preview needs either userIds or count")
+	}
+	if r.From != nil && r.Count == 0 {
+		return errors.New("preview from needs a count")
+	}
+	if len(r.UserIDs) > MaxPreviewAccounts || r.Count > MaxPreviewAccounts {
+		return fmt.Errorf("preview at most %d accounts", MaxPreviewAccounts)
+	}
+	return nil
+}
+
+// PreviewAccount is the account a user would receive, or has received if
+// Registered is set. The accounts of new users under a counter are only held
+// for them if nobody else registers before.
+type PreviewAccount struct {
+	UserID     UserID         `json:"userId,omitempty"`
+	Index      *uint64        `json:"index,omitempty"`
+	Path       string         `json:"path"`
+	Address    common.Address `json:"address"`
+	Registered bool           `json:"registered"`
+}
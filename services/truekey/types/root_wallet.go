@@ -15,9 +15,12 @@ import (
 	"time"
 )
 
+// RootWallet is a served root with the child accounts registered under it,
+// keyed by internal user id. UserKey keys the internal ids.
 type RootWallet struct {
 	Wallet   *hdwallet.Wallet
-	Accounts map[uint64]*ChildAccount
+	Accounts map[common.Hash]*ChildAccount
+	UserKey  []byte
 }
 
 func addressEqual(address1, address2 common.Address) bool {
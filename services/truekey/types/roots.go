@@ -0,0 +1,20 @@
+package types
+
+import (
+	"errors"
+	"ethereum/keyservice/common"
+	"ethereum/keyservice/common/hexutil"
+)
+
+var (
+	ErrRootRetired     = errors.New("root retired")
+	ErrKeystoreUnknown = errors.New("no keystore of the root loaded")
+)
+
+// Retirement records who took a root out of service and why. A retired root
+// stops signing, its accounts, limits and history stay in the database.
+type Retirement struct {
+	Reason string           `json:"reason"`
+	By     []common.Address `json:"by"`
+	At     hexutil.Uint64   `json:"at"`
+}
@@ -0,0 +1,90 @@
+package types
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"ethereum/keyservice/common"
+	"ethereum/keyservice/common/hexutil"
+)
+
+var (
+	ErrRootSealed   = errors.New("root sealed")
+	ErrRootUnsealed = errors.New("root already unsealed")
+	ErrShareInvalid = errors.New("invalid unseal share")
+	ErrUnsealFailed = errors.New("unseal failed, submitted shares discarded")
+	ErrNotShared    = errors.New("keystore passphrase not split into shares")
+	ErrNoKeystore   = errors.New("root has no keystore to unseal it from")
+)
+
+// shareSetIDLength is the size of the random id of a share set.
+const shareSetIDLength = 8
+
+// ShareSet describes the shares a keystore passphrase was split into. It is
+// stored in the keystore when the shares are created, so unsealing takes the
+// threshold from there and refuses shares of another set.
+type ShareSet struct {
+	ID        hexutil.Bytes `json:"id"`
+	Threshold int           `json:"threshold"`
+}
+
+// NewShareSet creates the description of a new share set.
+func NewShareSet(threshold int) (ShareSet, error) {
+	id := make([]byte, shareSetIDLength)
+	if _, err := rand.Read(id); err != nil {
+		return ShareSet{}, err
+	}
+	return ShareSet{ID: id, Threshold: threshold}, nil
+}
+
+// WithShareSet returns keyjson with the share set recorded under "unseal".
+func WithShareSet(keyjson []byte, set ShareSet) ([]byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(keyjson, &fields); err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(set)
+	if err != nil {
+		return nil, err
+	}
+	fields["unseal"] = data
+	return json.Marshal(fields)
+}
+
+// KeystoreShareSet returns the share set recorded in keyjson.
+func KeystoreShareSet(keyjson []byte) (*ShareSet, error) {
+	var key struct {
+		Unseal *ShareSet `json:"unseal"`
+	}
+	if err := json.Unmarshal(keyjson, &key); err != nil {
+		return nil, err
+	}
+	if key.Unseal == nil || len(key.Unseal.ID) != shareSetIDLength || key.Unseal.Threshold < 2 {
+		return nil, ErrNotShared
+	}
+	return key.Unseal, nil
+}
+
+// SealStatus reports the unseal progress of a root.
+type SealStatus struct {
+	Root      common.Address `json:"root"`
+	Sealed    bool           `json:"sealed"`
+	Progress  int            `json:"progress"`
+	Threshold int            `json:"threshold"`
+}
+
+// EncodeShare prefixes a shamir share of a keystore passphrase with the number
+// of shares needed to rebuild it and the id of its set.
+func EncodeShare(set ShareSet, share []byte) []byte {
+	data := append([]byte{byte(set.Threshold)}, set.ID...)
+	return append(data, share...)
+}
+
+// DecodeShare splits an encoded share into its set and shamir share.
+func DecodeShare(data []byte) (ShareSet, []byte, error) {
+	if len(data) < 1+shareSetIDLength+2 || data[0] < 2 {
+		return ShareSet{}, nil, ErrShareInvalid
+	}
+	set := ShareSet{ID: data[1 : 1+shareSetIDLength], Threshold: int(data[0])}
+	return set, data[1+shareSetIDLength:], nil
+}
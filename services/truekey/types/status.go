@@ -0,0 +1,42 @@
+package types
+
+import (
+	"ethereum/keyservice/common"
+	"ethereum/keyservice/common/hexutil"
+)
+
+// Status reports whether the service is able to sign. Ready is set while the
+// database is reachable and at least one root is unsealed and not frozen.
+type Status struct {
+	Ready         bool           `json:"ready"`
+	ShuttingDown  bool           `json:"shuttingDown"`
+	Database      string         `json:"database"`
+	Frozen        bool           `json:"frozen"`
+	ConfigVersion int            `json:"configVersion"`
+	StartedAt     hexutil.Uint64 `json:"startedAt"`
+	Uptime        string         `json:"uptime"`
+	Roots         []RootStatus   `json:"roots"`
+	Build         BuildInfo      `json:"build"`
+}
+
+// RootStatus reports the state of a loaded root. Only a root that is neither
+// sealed, frozen nor retired signs.
+type RootStatus struct {
+	Root    common.Address `json:"root"`
+	Sealed  bool           `json:"sealed"`
+	Frozen  bool           `json:"frozen"`
+	Retired bool           `json:"retired"`
+}
+
+// Signing reports whether the root signs requests.
+func (s RootStatus) Signing() bool {
+	return !s.Sealed && !s.Frozen && !s.Retired
+}
+
+// BuildInfo identifies the running binary.
+type BuildInfo struct {
+	APIVersion string `json:"apiVersion"`
+	GoVersion  string `json:"goVersion"`
+	Commit     string `json:"commit,omitempty"`
+	Modified   bool   `json:"modified,omitempty"`
+}
@@ -16,7 +16,9 @@ var (
 	ErrRootError        = errors.New("root id error")
 	ErrRootNotServer    = errors.New("root keystore not server")
 	ErrAdminError       = errors.New("admin not exist in server")
+	ErrNotAuditor       = errors.New("not an auditor of the root")
 	ErrAdminSignError   = errors.New("admin sign error")
+	ErrAdminReplay      = errors.New("admin call already made")
 	ErrDappAlready      = errors.New("dapp already exist")
 	ErrAccountNotExist  = errors.New("account not exist")
 	ErrChildNotExist    = errors.New("child id not exist")
@@ -29,6 +31,8 @@ var (
 	ErrCreateTxError    = errors.New("create tx error")
 	ErrPhoneError       = errors.New("phone number error")
 	ErrPhoneNumberError = errors.New("phone number spilt error")
+	ErrShuttingDown     = errors.New("signer shutting down")
+	ErrUserIDError      = errors.New("invalid user id")
 )
 
 func CheckIp(ips []string) []string {
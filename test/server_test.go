@@ -119,7 +119,7 @@ func register(client *rpc.Client, quest types.AdminQuest) common.Address {
 	//Payment  common.Address `json:"payment"`
 	//Fee      *big.Int       `json:"fee"`
 	tx := types.SignTx{
-		Phone:    18682003824,
+		UserID:   "18682003824",
 		To:       common.BigToAddress(new(big.Int).SetUint64(100)),
 		Value:    big.NewInt(1000),
 		GasPrice: 100,